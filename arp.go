@@ -0,0 +1,298 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// DetectIPConflict reports whether a host other than this one answers ARP for the IPv4 address and
+// returns its MAC address. ARP resolution is triggered by sending an empty UDP datagram to the address,
+// then the ARP table is polled until the timeout. Addresses assigned to this host are never resolved by
+// ARP, so their conflicts can't be detected this way and an error is returned.
+func DetectIPConflict(ip net.IP, timeout time.Duration) (bool, net.HardwareAddr, error) {
+	if ip = ip.To4(); ip == nil {
+		return false, nil, fmt.Errorf("ARP conflict detection requires an IPv4 address")
+	}
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+
+	if _, err := interfaceByIP(ip); err == nil {
+		return false, nil, fmt.Errorf("%s is assigned to this host", ip)
+	}
+
+	localMACs := make(map[string]bool)
+	if interfaces, err := net.Interfaces(); err == nil {
+		for _, interf := range interfaces {
+			if len(interf.HardwareAddr) > 0 {
+				localMACs[interf.HardwareAddr.String()] = true
+			}
+		}
+	}
+
+	// Sending a datagram makes the kernel resolve the address, the port doesn't matter
+	conn, err := net.Dial("udp4", net.JoinHostPort(ip.String(), "9"))
+	if err != nil {
+		return false, nil, fmt.Errorf("failed to reach %s: %w", ip, err)
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(timeout)
+	for {
+		conn.Write(nil)
+
+		table, err := arpTable()
+		if err != nil {
+			return false, nil, err
+		}
+		if mac, ok := table[ip.String()]; ok && !localMACs[mac.String()] {
+			return true, mac, nil
+		}
+
+		if time.Now().After(deadline) {
+			return false, nil, nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// readARPTable reads the ARP table for ScanLAN and GatewayHealth, replaced in tests
+var readARPTable = arpTable
+
+// arpTable returns the resolved entries of the ARP table keyed by IP address
+func arpTable() (map[string]net.HardwareAddr, error) {
+	if runtime.GOOS == "linux" {
+		data, err := os.ReadFile("/proc/net/arp")
+		if err == nil {
+			return parseProcNetARP(string(data)), nil
+		}
+		logger().Warn("reading /proc/net/arp failed, using arp -a", "error", err)
+	}
+
+	out, err := command(context.Background(), "arp", "-a").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ARP table: %w", err)
+	}
+	return parseARPOutput(string(out)), nil
+}
+
+// parseProcNetARP parses /proc/net/arp, incomplete entries are skipped
+// "192.168.1.1      0x1         0x2         00:11:22:33:44:55     *        eth0"
+func parseProcNetARP(data string) map[string]net.HardwareAddr {
+	table := make(map[string]net.HardwareAddr)
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || net.ParseIP(fields[0]) == nil {
+			continue
+		}
+		// ATF_COM flag is set for completed entries
+		if fields[2] == "0x0" {
+			continue
+		}
+		if mac, err := net.ParseMAC(fields[3]); err == nil && !isZeroMAC(mac) {
+			table[fields[0]] = mac
+		}
+	}
+	return table
+}
+
+var arpOutputRegexp = regexp.MustCompile(`\(?(\d+\.\d+\.\d+\.\d+)\)?\s+(?:at\s+)?([0-9a-fA-F]{1,2}(?:[:-][0-9a-fA-F]{1,2}){5})\b`)
+
+// parseARPOutput parses "arp -a" output of Windows and BSD/macOS
+// "  192.168.1.1           00-11-22-33-44-55     dynamic"
+// "? (192.168.1.1) at 0:11:22:33:44:55 on en0 ifscope [ethernet]"
+func parseARPOutput(output string) map[string]net.HardwareAddr {
+	table := make(map[string]net.HardwareAddr)
+	for _, line := range strings.Split(output, "\n") {
+		matches := arpOutputRegexp.FindStringSubmatch(line)
+		if matches == nil {
+			continue
+		}
+		mac, err := parseLooseMAC(matches[2])
+		if err != nil || isZeroMAC(mac) {
+			continue
+		}
+		table[matches[1]] = mac
+	}
+	return table
+}
+
+// parseLooseMAC parses MAC addresses which may omit leading zeros (macOS) or use dashes (Windows)
+func parseLooseMAC(s string) (net.HardwareAddr, error) {
+	parts := strings.FieldsFunc(s, func(r rune) bool { return r == ':' || r == '-' })
+	for i, part := range parts {
+		if len(part) == 1 {
+			parts[i] = "0" + part
+		}
+	}
+	return net.ParseMAC(strings.Join(parts, ":"))
+}
+
+// isZeroMAC reports whether all bytes of the MAC address are zero
+func isZeroMAC(mac net.HardwareAddr) bool {
+	return bytes.Equal(mac, make(net.HardwareAddr, len(mac)))
+}
+
+// ARP operations of arpRequest and parseARPReply
+const (
+	arpOpRequest = 1
+	arpOpReply   = 2
+)
+
+// arpRequest returns an ARP request for the IPv4 target over Ethernet without the link-layer header
+func arpRequest(senderMAC net.HardwareAddr, senderIP, targetIP net.IP) []byte {
+	packet := make([]byte, 28)
+	binary.BigEndian.PutUint16(packet[0:], 1)      // Ethernet
+	binary.BigEndian.PutUint16(packet[2:], 0x0800) // IPv4
+	packet[4], packet[5] = 6, 4
+	binary.BigEndian.PutUint16(packet[6:], arpOpRequest)
+	copy(packet[8:14], senderMAC)
+	copy(packet[14:18], senderIP.To4())
+	copy(packet[24:28], targetIP.To4())
+	return packet
+}
+
+// parseARPReply returns the sender MAC address of an ARP reply from the IPv4 target, nil for other packets
+func parseARPReply(packet []byte, target net.IP) net.HardwareAddr {
+	if len(packet) < 28 || binary.BigEndian.Uint16(packet[0:]) != 1 || binary.BigEndian.Uint16(packet[2:]) != 0x0800 ||
+		packet[4] != 6 || packet[5] != 4 || binary.BigEndian.Uint16(packet[6:]) != arpOpReply {
+		return nil
+	}
+	if !net.IP(packet[14:18]).Equal(target) {
+		return nil
+	}
+	return net.HardwareAddr(append([]byte(nil), packet[8:14]...))
+}
+
+// NeighborEntry is an entry of the IPv6 neighbor cache
+type NeighborEntry struct {
+	IP        net.IP
+	MAC       net.HardwareAddr // nil for unresolved entries
+	Interface string
+	State     string // REACHABLE, STALE, DELAY, PROBE, INCOMPLETE, FAILED, PERMANENT or NOARP
+	Router    bool   // The neighbor announced itself as a router
+}
+
+// Addr returns the neighbor's IP with the interface as zone if it is a link-local address
+func (e NeighborEntry) Addr() *net.IPAddr {
+	addr := &net.IPAddr{IP: e.IP}
+	if isLinkLocalIPv6(e.IP) {
+		addr.Zone = e.Interface
+	}
+	return addr
+}
+
+// NeighborTable returns the IPv6 neighbor cache, read with "ip -6 neigh" on Linux and
+// "netsh interface ipv6 show neighbors" on Windows
+func NeighborTable() ([]NeighborEntry, error) {
+	switch runtime.GOOS {
+	case "linux":
+		ipCmd := findCommand("ip", []string{"/bin/ip", "/sbin/ip", "/usr/bin/ip", "/usr/sbin/ip"})
+		if ipCmd == "" {
+			return nil, fmt.Errorf("ip command not found")
+		}
+		out, err := command(context.Background(), ipCmd, "-6", "neigh", "show").Output()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read neighbor table: %w", err)
+		}
+		return parseIPNeigh(string(out)), nil
+	case "windows":
+		out, err := command(context.Background(), "netsh", "interface", "ipv6", "show", "neighbors").Output()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read neighbor table: %w", err)
+		}
+		return parseNetshNeighbors(string(out)), nil
+	}
+	return nil, fmt.Errorf("neighbor table is not supported on %s", runtime.GOOS)
+}
+
+// parseIPNeigh parses the output of "ip neigh show"
+// "fe80::1 dev eth0 lladdr 00:11:22:33:44:55 router REACHABLE"
+// "fe80::2 dev eth0 FAILED"
+func parseIPNeigh(output string) []NeighborEntry {
+	var entries []NeighborEntry
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		ip := net.ParseIP(fields[0])
+		if ip == nil {
+			continue
+		}
+		entry := NeighborEntry{IP: ip}
+		for i := 1; i < len(fields); i++ {
+			switch fields[i] {
+			case "dev":
+				if i+1 < len(fields) {
+					i++
+					entry.Interface = fields[i]
+				}
+			case "lladdr":
+				if i+1 < len(fields) {
+					i++
+					entry.MAC, _ = net.ParseMAC(fields[i])
+				}
+			case "router":
+				entry.Router = true
+			default:
+				// The states come last, an entry may have several such as "STALE PERMANENT"
+				if strings.ToUpper(fields[i]) == fields[i] && entry.State == "" {
+					entry.State = fields[i]
+				}
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// parseNetshNeighbors parses "netsh interface ipv6 show neighbors", states are mapped to the Linux names
+// "Interface 12: Ethernet"
+// "fe80::1                                       00-11-22-33-44-55  Reachable (Router)"
+func parseNetshNeighbors(output string) []NeighborEntry {
+	var entries []NeighborEntry
+	interfaceName := ""
+	for _, line := range strings.Split(output, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "Interface ") {
+			if i := strings.Index(trimmed, ":"); i >= 0 {
+				interfaceName = strings.TrimSpace(trimmed[i+1:])
+			}
+			continue
+		}
+
+		fields := strings.Fields(trimmed)
+		if len(fields) < 2 {
+			continue
+		}
+		ip := net.ParseIP(fields[0])
+		if ip == nil {
+			continue
+		}
+		entry := NeighborEntry{IP: ip, Interface: interfaceName}
+		// The physical address column is empty for entries without a link-layer address
+		if len(fields) > 2 {
+			if mac, err := parseLooseMAC(fields[1]); err == nil && !isZeroMAC(mac) {
+				entry.MAC = mac
+			}
+			fields = fields[1:]
+		}
+		state := strings.ToUpper(fields[1])
+		if state == "UNREACHABLE" {
+			state = "FAILED"
+		}
+		entry.State = state
+		entry.Router = strings.Contains(trimmed, "(Router)")
+		entries = append(entries, entry)
+	}
+	return entries
+}
@@ -0,0 +1,62 @@
+//go:build linux
+
+package network
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// broadcastARP sends count broadcast ARP requests for the target from the interface, one every interval,
+// and returns the distinct sender MAC addresses of the replies. Unlike the ARP cache, which keeps one
+// entry per address, every host answering for the target is seen. Requires CAP_NET_RAW.
+func broadcastARP(ctx context.Context, interf *net.Interface, source, target net.IP, count int, interval time.Duration) ([]net.HardwareAddr, error) {
+	if len(interf.HardwareAddr) != 6 {
+		return nil, fmt.Errorf("interface %s has no Ethernet address", interf.Name)
+	}
+	protocol := uint16(unix.ETH_P_ARP>>8 | unix.ETH_P_ARP&0xff<<8) // network byte order
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, int(protocol))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ARP socket: %w", err)
+	}
+	defer unix.Close(fd)
+	if err := unix.Bind(fd, &unix.SockaddrLinklayer{Protocol: protocol, Ifindex: interf.Index}); err != nil {
+		return nil, fmt.Errorf("failed to bind ARP socket to %s: %w", interf.Name, err)
+	}
+	wait := unix.NsecToTimeval((50 * time.Millisecond).Nanoseconds())
+	if err := unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &wait); err != nil {
+		return nil, fmt.Errorf("failed to set ARP socket timeout: %w", err)
+	}
+
+	broadcast := &unix.SockaddrLinklayer{Protocol: protocol, Ifindex: interf.Index, Halen: 6}
+	copy(broadcast.Addr[:], []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	request := arpRequest(interf.HardwareAddr, source, target)
+
+	var macs []net.HardwareAddr
+	seen := make(map[string]bool)
+	buf := make([]byte, 1500)
+	for sent := 0; sent < count && ctx.Err() == nil; sent++ {
+		if err := unix.Sendto(fd, request, 0, broadcast); err != nil {
+			return macs, fmt.Errorf("failed to send ARP request: %w", err)
+		}
+		for deadline := time.Now().Add(interval); time.Now().Before(deadline) && ctx.Err() == nil; {
+			n, _, err := unix.Recvfrom(fd, buf, 0)
+			if errors.Is(err, unix.EAGAIN) || errors.Is(err, unix.EINTR) {
+				continue
+			}
+			if err != nil {
+				return macs, fmt.Errorf("failed to read ARP reply: %w", err)
+			}
+			if mac := parseARPReply(buf[:n], target); mac != nil && !seen[mac.String()] {
+				seen[mac.String()] = true
+				macs = append(macs, mac)
+			}
+		}
+	}
+	return macs, nil
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package network
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"runtime"
+	"time"
+)
+
+// broadcastARP fails, raw ARP requests are sent on Linux only
+func broadcastARP(ctx context.Context, interf *net.Interface, source, target net.IP, count int, interval time.Duration) ([]net.HardwareAddr, error) {
+	return nil, fmt.Errorf("broadcast ARP is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,167 @@
+package network
+
+import (
+	"bytes"
+	"net"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestParseProcNetARP(t *testing.T) {
+	data := `IP address       HW type     Flags       HW address            Mask     Device
+192.168.1.1      0x1         0x2         00:11:22:33:44:55     *        eth0
+192.168.1.20     0x1         0x0         00:00:00:00:00:00     *        eth0
+192.168.1.30     0x1         0x6         aa:bb:cc:dd:ee:ff     *        eth0
+`
+	table := parseProcNetARP(data)
+	if len(table) != 2 {
+		t.Fatalf("parseProcNetARP() = %v, want 2 entries", table)
+	}
+	if table["192.168.1.1"].String() != "00:11:22:33:44:55" {
+		t.Errorf("192.168.1.1 = %v", table["192.168.1.1"])
+	}
+	if _, ok := table["192.168.1.20"]; ok {
+		t.Error("incomplete entry should be skipped")
+	}
+}
+
+func TestParseARPOutput(t *testing.T) {
+	windows := `
+Interface: 192.168.1.10 --- 0xb
+  Internet Address      Physical Address      Type
+  192.168.1.1           00-11-22-33-44-55     dynamic
+  192.168.1.255         ff-ff-ff-ff-ff-ff     static
+`
+	table := parseARPOutput(windows)
+	if table["192.168.1.1"].String() != "00:11:22:33:44:55" {
+		t.Errorf("windows 192.168.1.1 = %v", table["192.168.1.1"])
+	}
+	if _, ok := table["192.168.1.10"]; ok {
+		t.Error("interface line should not be parsed as entry")
+	}
+
+	darwin := `? (192.168.1.1) at 0:11:22:3:44:55 on en0 ifscope [ethernet]
+? (192.168.1.7) at (incomplete) on en0 ifscope [ethernet]
+`
+	table = parseARPOutput(darwin)
+	if table["192.168.1.1"].String() != "00:11:22:03:44:55" {
+		t.Errorf("darwin 192.168.1.1 = %v", table["192.168.1.1"])
+	}
+	if _, ok := table["192.168.1.7"]; ok {
+		t.Error("incomplete entry should be skipped")
+	}
+}
+
+func TestDetectIPConflictInvalid(t *testing.T) {
+	if _, _, err := DetectIPConflict(net.ParseIP("2001:db8::1"), time.Second); err == nil {
+		t.Error("expected error for IPv6 address")
+	}
+	if _, _, err := DetectIPConflict(net.ParseIP("127.0.0.1"), time.Second); err == nil {
+		t.Error("expected error for local address")
+	}
+}
+
+func TestParseIPNeigh(t *testing.T) {
+	output := `fe80::1 dev eth0 lladdr 00:11:22:33:44:55 router REACHABLE
+2001:db8::20 dev eth0 lladdr aa:bb:cc:dd:ee:ff STALE
+fe80::2 dev eth1 FAILED
+fe80::3 dev eth0 lladdr 00:11:22:33:44:66 PROBE
+`
+	entries := parseIPNeigh(output)
+	if len(entries) != 4 {
+		t.Fatalf("parseIPNeigh() returned %d entries: %+v", len(entries), entries)
+	}
+	if e := entries[0]; e.IP.String() != "fe80::1" || e.MAC.String() != "00:11:22:33:44:55" || e.Interface != "eth0" || !e.Router || e.State != "REACHABLE" {
+		t.Errorf("router entry = %+v", e)
+	}
+	if e := entries[1]; e.Router || e.State != "STALE" {
+		t.Errorf("stale entry = %+v", e)
+	}
+	if e := entries[2]; e.MAC != nil || e.Interface != "eth1" || e.State != "FAILED" {
+		t.Errorf("failed entry = %+v", e)
+	}
+}
+
+func TestParseNetshNeighbors(t *testing.T) {
+	output := `
+Interface 1: Loopback Pseudo-Interface 1
+
+
+Internet Address                              Physical Address   Type
+--------------------------------------------  -----------------  -----------
+ff02::c                                                          Permanent
+
+Interface 12: Ethernet
+
+
+Internet Address                              Physical Address   Type
+--------------------------------------------  -----------------  -----------
+fe80::1                                       00-11-22-33-44-55  Reachable (Router)
+fe80::2                                       00-00-00-00-00-00  Unreachable
+ff02::1                                       33-33-00-00-00-01  Permanent
+`
+	entries := parseNetshNeighbors(output)
+	if len(entries) != 4 {
+		t.Fatalf("parseNetshNeighbors() returned %d entries: %+v", len(entries), entries)
+	}
+	if e := entries[0]; e.IP.String() != "ff02::c" || e.MAC != nil || e.Interface != "Loopback Pseudo-Interface 1" || e.State != "PERMANENT" {
+		t.Errorf("loopback entry = %+v", e)
+	}
+	entries = entries[1:]
+	if e := entries[0]; e.IP.String() != "fe80::1" || e.MAC.String() != "00:11:22:33:44:55" || e.Interface != "Ethernet" || !e.Router || e.State != "REACHABLE" {
+		t.Errorf("router entry = %+v", e)
+	}
+	if e := entries[1]; e.MAC != nil || e.State != "FAILED" {
+		t.Errorf("unreachable entry = %+v", e)
+	}
+	if e := entries[2]; e.Router || e.State != "PERMANENT" {
+		t.Errorf("permanent entry = %+v", e)
+	}
+}
+
+func TestNeighborTable(t *testing.T) {
+	entries, err := NeighborTable()
+	if runtime.GOOS != "linux" && runtime.GOOS != "windows" {
+		if err == nil {
+			t.Error("NeighborTable() expected error on unsupported platform")
+		}
+		return
+	}
+	if err != nil {
+		t.Skipf("NeighborTable() error = %v", err)
+	}
+	for _, entry := range entries {
+		if entry.IP.To4() != nil || entry.State == "" {
+			t.Errorf("NeighborTable() invalid entry %+v", entry)
+		}
+	}
+}
+
+func TestARPRequestReply(t *testing.T) {
+	mac := net.HardwareAddr{0x02, 0x11, 0x22, 0x33, 0x44, 0x55}
+	request := arpRequest(mac, net.ParseIP("192.168.1.10"), net.ParseIP("192.168.1.1"))
+	want := []byte{0, 1, 8, 0, 6, 4, 0, 1, 0x02, 0x11, 0x22, 0x33, 0x44, 0x55, 192, 168, 1, 10, 0, 0, 0, 0, 0, 0, 192, 168, 1, 1}
+	if !bytes.Equal(request, want) {
+		t.Errorf("arpRequest() = % x, want % x", request, want)
+	}
+
+	// The reply swaps sender and target
+	router := net.HardwareAddr{0x00, 0x00, 0x5e, 0x00, 0x01, 0x01}
+	reply := append([]byte{0, 1, 8, 0, 6, 4, 0, 2}, router...)
+	reply = append(reply, 192, 168, 1, 1)
+	reply = append(reply, mac...)
+	reply = append(reply, 192, 168, 1, 10)
+	if got := parseARPReply(reply, net.ParseIP("192.168.1.1")); got.String() != router.String() {
+		t.Errorf("parseARPReply() = %v, want %v", got, router)
+	}
+	if got := parseARPReply(reply, net.ParseIP("192.168.1.2")); got != nil {
+		t.Errorf("parseARPReply() for another target = %v", got)
+	}
+	if got := parseARPReply(request, net.ParseIP("192.168.1.10")); got != nil {
+		t.Errorf("parseARPReply() of a request = %v", got)
+	}
+	if got := parseARPReply(reply[:20], net.ParseIP("192.168.1.1")); got != nil {
+		t.Errorf("parseARPReply() of a short packet = %v", got)
+	}
+}
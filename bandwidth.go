@@ -0,0 +1,169 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"time"
+)
+
+// BandwidthOptions configures EstimateBandwidth
+type BandwidthOptions struct {
+	Pairs    int           // Number of packet pairs (default: 10)
+	Size     int           // Payload size of each echo request in bytes (default: 1400)
+	Timeout  time.Duration // Time the replies of a pair are waited for (default: 1s)
+	Interval time.Duration // Pause between pairs (default: 100ms)
+}
+
+// BandwidthEstimate is the result of EstimateBandwidth, bandwidths are in bits per second
+type BandwidthEstimate struct {
+	Host        string
+	IP          net.IP
+	Pairs       int             // Pairs sent
+	Samples     int             // Pairs whose replies both arrived in order
+	Bandwidth   float64         // Median of the samples
+	Min         float64         // Lowest sample
+	Max         float64         // Highest sample
+	Dispersions []time.Duration // Spacing of the replies of each sample
+}
+
+// EstimateBandwidth estimates the capacity of the narrowest link on the path to the host and back by
+// ICMP packet-pair dispersion: two large echo requests are sent back-to-back, the bottleneck link spaces
+// them out by the time it needs to transmit one packet, and that spacing is kept by the replies.
+// The packet size divided by the spacing of the replies is one sample, the median of all samples is
+// reported. This is an estimate of the capacity, not of the free bandwidth: cross traffic queued between
+// the packets widens the spacing and lowers samples, interrupt coalescing and scheduling delays of the
+// receiving host distort them in both directions. Fast links (gigabit and above) can't be measured
+// reliably. An ICMP socket is required, see PingOptions.Native.
+func EstimateBandwidth(ctx context.Context, host string, opts *BandwidthOptions) (*BandwidthEstimate, error) {
+	options := BandwidthOptions{}
+	if opts != nil {
+		options = *opts
+	}
+	if options.Pairs <= 0 {
+		options.Pairs = 10
+	}
+	if options.Size <= 0 {
+		options.Size = 1400
+	}
+	if options.Size > 65000 {
+		return nil, fmt.Errorf("invalid size %d", options.Size)
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = time.Second
+	}
+	if options.Interval <= 0 {
+		options.Interval = 100 * time.Millisecond
+	}
+
+	target, err := resolvePingTarget(ctx, withZone(host), IPVersionAuto)
+	if err != nil {
+		return nil, err
+	}
+	sock, err := listenICMP(target.IP)
+	if err != nil {
+		return nil, err
+	}
+	defer sock.conn.Close()
+	sock.zone = target.Zone
+
+	// Unblock pending reads when the context is done
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			sock.conn.SetReadDeadline(time.Now())
+		case <-stop:
+		}
+	}()
+
+	id, matchID := sock.echoID(0)
+
+	result := &BandwidthEstimate{Host: host, IP: target.IP}
+	payload := make([]byte, options.Size)
+	buf := make([]byte, options.Size+1500)
+	for pair := 0; pair < options.Pairs && ctx.Err() == nil; pair++ {
+		if pair > 0 {
+			select {
+			case <-time.After(options.Interval):
+			case <-ctx.Done():
+			}
+		}
+
+		first := (2*pair + 1) & 0xffff
+		second := (first + 1) & 0xffff
+		if err := sock.sendEcho(target.IP, id, first, payload); err != nil {
+			return nil, fmt.Errorf("failed to send echo request to %s: %w", target.IP, err)
+		}
+		if err := sock.sendEcho(target.IP, id, second, payload); err != nil {
+			return nil, fmt.Errorf("failed to send echo request to %s: %w", target.IP, err)
+		}
+		result.Pairs++
+
+		var firstAt, secondAt time.Time
+		sock.conn.SetReadDeadline(time.Now().Add(options.Timeout))
+		for ctx.Err() == nil && (firstAt.IsZero() || secondAt.IsZero()) {
+			msg, _, _, err := sock.read(buf)
+			received := time.Now()
+			if err != nil {
+				if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+					break
+				}
+				continue
+			}
+			reply, ok := matchEchoReply(msg, matchID, sock.ipv6)
+			if !ok || reply.Error != "" {
+				continue
+			}
+			switch {
+			case reply.Seq == first && firstAt.IsZero():
+				firstAt = received
+			case reply.Seq == second && secondAt.IsZero():
+				secondAt = received
+			}
+		}
+
+		// Reordered replies don't show the dispersion of the bottleneck
+		if !firstAt.IsZero() && secondAt.After(firstAt) {
+			result.Dispersions = append(result.Dispersions, secondAt.Sub(firstAt))
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if len(result.Dispersions) == 0 {
+		return nil, fmt.Errorf("no packet pair to %s was answered in order", target.IP)
+	}
+
+	// The replies have the size of the requests: IP header, ICMP header and payload
+	headerLen := 20
+	if sock.ipv6 {
+		headerLen = 40
+	}
+	result.Samples = len(result.Dispersions)
+	result.Bandwidth, result.Min, result.Max = dispersionBandwidth((headerLen+8+options.Size)*8, result.Dispersions)
+	return result, nil
+}
+
+// dispersionBandwidth returns the median, lowest and highest bandwidth of packets of the size in bits
+// spaced by the dispersions
+func dispersionBandwidth(bits int, dispersions []time.Duration) (median, min, max float64) {
+	samples := make([]float64, 0, len(dispersions))
+	for _, dispersion := range dispersions {
+		if dispersion > 0 {
+			samples = append(samples, float64(bits)/dispersion.Seconds())
+		}
+	}
+	if len(samples) == 0 {
+		return 0, 0, 0
+	}
+	sort.Float64s(samples)
+
+	median = samples[len(samples)/2]
+	if len(samples)%2 == 0 {
+		median = (samples[len(samples)/2-1] + samples[len(samples)/2]) / 2
+	}
+	return median, samples[0], samples[len(samples)-1]
+}
@@ -0,0 +1,50 @@
+package network
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDispersionBandwidth(t *testing.T) {
+	// 1500 byte packets 1.2ms apart are 10 Mbit/s
+	dispersions := []time.Duration{1200 * time.Microsecond, 600 * time.Microsecond, 2400 * time.Microsecond, 0}
+	median, min, max := dispersionBandwidth(1500*8, dispersions)
+	if median != 10e6 || min != 5e6 || max != 20e6 {
+		t.Errorf("dispersionBandwidth() = %v, %v, %v, want 10e6, 5e6, 20e6", median, min, max)
+	}
+
+	median, _, _ = dispersionBandwidth(1500*8, dispersions[:2])
+	if median != 15e6 {
+		t.Errorf("dispersionBandwidth() median of two = %v, want 15e6", median)
+	}
+	if median, min, max := dispersionBandwidth(1500*8, nil); median != 0 || min != 0 || max != 0 {
+		t.Errorf("dispersionBandwidth(nil) = %v, %v, %v", median, min, max)
+	}
+}
+
+func TestEstimateBandwidth(t *testing.T) {
+	if _, err := EstimateBandwidth(context.Background(), "127.0.0.1", &BandwidthOptions{Size: 70000}); err == nil {
+		t.Error("EstimateBandwidth() accepted size 70000")
+	}
+	if !CanRawSocket() {
+		t.Skip("raw ICMP sockets are not permitted")
+	}
+
+	result, err := EstimateBandwidth(context.Background(), "127.0.0.1", &BandwidthOptions{Pairs: 5, Interval: time.Millisecond})
+	if err != nil {
+		t.Fatalf("EstimateBandwidth() error = %v", err)
+	}
+	if result.Pairs != 5 || result.Samples == 0 || result.Samples != len(result.Dispersions) {
+		t.Errorf("EstimateBandwidth() = %+v", result)
+	}
+	if result.Bandwidth <= 0 || result.Min > result.Bandwidth || result.Max < result.Bandwidth {
+		t.Errorf("EstimateBandwidth() bandwidth = %v (min %v, max %v)", result.Bandwidth, result.Min, result.Max)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := EstimateBandwidth(ctx, "127.0.0.1", nil); err == nil {
+		t.Error("EstimateBandwidth() expected error for canceled context")
+	}
+}
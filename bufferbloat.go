@@ -0,0 +1,95 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// LatencyStats are the RTT percentiles of a series of pings
+type LatencyStats struct {
+	Sent     int
+	Received int
+	P50      time.Duration
+	P90      time.Duration
+	P99      time.Duration
+}
+
+// LoadedLatency compares the latency of an idle link with the latency under load
+type LoadedLatency struct {
+	Baseline LatencyStats
+	Loaded   LatencyStats
+	Increase time.Duration // Median RTT increase under load, the bufferbloat of the link
+}
+
+// pingSeries sends the pings of PingUnderLoad, replaced in tests
+var pingSeries = func(ctx context.Context, host string, options *PingOptions) (*PingResult, error) {
+	return PingContext(ctx, host, options)
+}
+
+// PingUnderLoad measures the latency to the host while the link is idle and then while load runs,
+// both phases send options.Count pings. The context passed to load is canceled when the loaded phase
+// ends and PingUnderLoad waits for load to return. A median RTT rising by tens of milliseconds under
+// load points to oversized buffers (bufferbloat).
+func PingUnderLoad(ctx context.Context, host string, options *PingOptions, load func(ctx context.Context)) (*LoadedLatency, error) {
+	if load == nil {
+		return nil, fmt.Errorf("load cannot be nil")
+	}
+
+	baseline, err := pingSeries(ctx, host, options)
+	if err != nil {
+		return nil, err
+	}
+	if baseline.Received == 0 {
+		return nil, fmt.Errorf("no baseline reply from %s", host)
+	}
+
+	loadCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		load(loadCtx)
+	}()
+	loaded, err := pingSeries(ctx, host, options)
+	cancel()
+	<-done
+	if err != nil {
+		return nil, err
+	}
+
+	result := &LoadedLatency{
+		Baseline: latencyStats(baseline),
+		Loaded:   latencyStats(loaded),
+	}
+	if result.Loaded.Received > 0 {
+		result.Increase = result.Loaded.P50 - result.Baseline.P50
+	}
+	return result, nil
+}
+
+// latencyStats computes the nearest-rank RTT percentiles of the answered pings
+func latencyStats(result *PingResult) LatencyStats {
+	var rtts []time.Duration
+	for _, reply := range result.Replies {
+		if reply.Error == "" && reply.RTT > 0 {
+			rtts = append(rtts, reply.RTT)
+		}
+	}
+	stats := LatencyStats{Sent: result.Sent, Received: len(rtts)}
+	if len(rtts) == 0 {
+		return stats
+	}
+
+	sort.Slice(rtts, func(i, j int) bool { return rtts[i] < rtts[j] })
+	percentile := func(p float64) time.Duration {
+		rank := int(math.Ceil(p / 100 * float64(len(rtts))))
+		if rank < 1 {
+			rank = 1
+		}
+		return rtts[rank-1]
+	}
+	stats.P50, stats.P90, stats.P99 = percentile(50), percentile(90), percentile(99)
+	return stats
+}
@@ -0,0 +1,73 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLatencyStats(t *testing.T) {
+	result := &PingResult{Sent: 11}
+	for i := 10; i >= 1; i-- {
+		result.Replies = append(result.Replies, PingReply{Seq: i, RTT: time.Duration(i) * time.Millisecond})
+	}
+	result.Replies = append(result.Replies, PingReply{Seq: 11, Error: "timeout"})
+
+	stats := latencyStats(result)
+	if stats.Sent != 11 || stats.Received != 10 {
+		t.Errorf("latencyStats() counts = %+v", stats)
+	}
+	if stats.P50 != 5*time.Millisecond || stats.P90 != 9*time.Millisecond || stats.P99 != 10*time.Millisecond {
+		t.Errorf("latencyStats() percentiles = %+v", stats)
+	}
+
+	if stats := latencyStats(&PingResult{Sent: 2}); stats.Received != 0 || stats.P50 != 0 {
+		t.Errorf("latencyStats() without replies = %+v", stats)
+	}
+}
+
+func TestPingUnderLoad(t *testing.T) {
+	var loading, calls int32
+	original := pingSeries
+	defer func() { pingSeries = original }()
+	pingSeries = func(ctx context.Context, host string, options *PingOptions) (*PingResult, error) {
+		rtt := 10 * time.Millisecond
+		// The second series runs under load
+		if atomic.AddInt32(&calls, 1) == 2 {
+			rtt = 60 * time.Millisecond
+		}
+		result := &PingResult{Host: host, Sent: 3, Received: 3}
+		for i := 1; i <= 3; i++ {
+			result.Replies = append(result.Replies, PingReply{Seq: i, RTT: rtt})
+		}
+		return result, nil
+	}
+
+	result, err := PingUnderLoad(context.Background(), "192.0.2.1", nil, func(ctx context.Context) {
+		atomic.StoreInt32(&loading, 1)
+		<-ctx.Done()
+		atomic.StoreInt32(&loading, 0)
+	})
+	if err != nil {
+		t.Fatalf("PingUnderLoad() error = %v", err)
+	}
+	if result.Baseline.P50 != 10*time.Millisecond || result.Increase != 50*time.Millisecond {
+		t.Errorf("PingUnderLoad() = %+v", result)
+	}
+	if atomic.LoadInt32(&loading) != 0 {
+		t.Error("PingUnderLoad() returned before the load ended")
+	}
+
+	if _, err := PingUnderLoad(context.Background(), "192.0.2.1", nil, nil); err == nil {
+		t.Error("PingUnderLoad() expected error for nil load")
+	}
+
+	pingSeries = func(ctx context.Context, host string, options *PingOptions) (*PingResult, error) {
+		return nil, errors.New("ping failed")
+	}
+	if _, err := PingUnderLoad(context.Background(), "192.0.2.1", nil, func(context.Context) {}); err == nil {
+		t.Error("PingUnderLoad() expected error when ping fails")
+	}
+}
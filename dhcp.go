@@ -0,0 +1,230 @@
+package network
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Lease holds the data of a DHCP lease
+type Lease struct {
+	Interface  string
+	IP         net.IP
+	Router     net.IP
+	SubnetMask net.IP
+	DNS        []net.IP
+	Domain     string
+	LeaseTime  time.Duration
+	Renew      time.Duration // Renewal time (T1)
+	Rebind     time.Duration // Rebinding time (T2)
+	ServerID   net.IP        // Address of the DHCP server
+	Expiry     time.Time
+	Path       string // File the lease was read from
+}
+
+// DHCPLease returns the active DHCP lease of an interface. The lease files of dhclient,
+// NetworkManager and systemd-networkd are searched.
+func DHCPLease(iface string) (*Lease, error) {
+	if iface == "" {
+		return nil, fmt.Errorf("interface name cannot be empty")
+	}
+	// Interface name is used in file paths
+	if strings.ContainsAny(iface, "/\\;&|`$()\n") || strings.Contains(iface, "..") {
+		return nil, fmt.Errorf("invalid interface name")
+	}
+
+	for _, path := range leaseFiles(iface) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+
+		var lease *Lease
+		if strings.HasPrefix(path, "/run/systemd/netif/leases/") {
+			lease, err = parseNetworkdLease(string(data))
+		} else {
+			lease, err = parseDhclientLease(string(data), iface)
+		}
+		if err != nil {
+			continue
+		}
+		lease.Interface = iface
+		lease.Path = path
+		return lease, nil
+	}
+
+	return nil, fmt.Errorf("no DHCP lease found for %s", iface)
+}
+
+// leaseFiles returns the candidate lease files of an interface, most specific first
+func leaseFiles(iface string) []string {
+	paths := []string{
+		filepath.Join("/var/lib/dhcp", "dhclient."+iface+".leases"),
+		filepath.Join("/var/lib/dhcp", "dhclient-"+iface+".leases"),
+		filepath.Join("/var/lib/dhclient", "dhclient-"+iface+".leases"),
+		filepath.Join("/var/lib/dhclient", "dhclient."+iface+".leases"),
+	}
+
+	if matches, err := filepath.Glob(filepath.Join("/var/lib/NetworkManager", "dhclient-*-"+iface+".lease")); err == nil {
+		paths = append(paths, matches...)
+	}
+
+	if interf, err := net.InterfaceByName(iface); err == nil {
+		paths = append(paths, filepath.Join("/run/systemd/netif/leases", strconv.Itoa(interf.Index)))
+	}
+
+	return append(paths,
+		"/var/lib/dhcp/dhclient.leases",
+		"/var/lib/dhclient/dhclient.leases",
+	)
+}
+
+// parseDhclientLease parses the last lease block of the interface in a dhclient lease file
+func parseDhclientLease(data, iface string) (*Lease, error) {
+	var current, last *Lease
+	var currentIface string
+
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+
+		switch {
+		case strings.HasPrefix(line, "lease {"):
+			current = &Lease{}
+			currentIface = ""
+			continue
+		case line == "}":
+			if current != nil && (currentIface == "" || currentIface == iface) {
+				last = current
+			}
+			current = nil
+			continue
+		case current == nil:
+			continue
+		}
+
+		line = strings.TrimSuffix(line, ";")
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		switch fields[0] {
+		case "interface":
+			currentIface = strings.Trim(fields[1], `"`)
+		case "fixed-address":
+			current.IP = net.ParseIP(fields[1])
+		case "expire":
+			current.Expiry = parseLeaseTime(fields[1:])
+		case "option":
+			if len(fields) < 3 {
+				continue
+			}
+			value := strings.Join(fields[2:], " ")
+			switch fields[1] {
+			case "subnet-mask":
+				current.SubnetMask = net.ParseIP(value)
+			case "routers":
+				current.Router = net.ParseIP(strings.Split(value, ",")[0])
+			case "domain-name-servers":
+				current.DNS = nil
+				for _, item := range strings.Split(value, ",") {
+					if ip := net.ParseIP(strings.TrimSpace(item)); ip != nil {
+						current.DNS = append(current.DNS, ip)
+					}
+				}
+			case "domain-name":
+				current.Domain = firstField(strings.Trim(value, `"`))
+			case "dhcp-server-identifier":
+				current.ServerID = net.ParseIP(value)
+			case "dhcp-lease-time":
+				current.LeaseTime = parseSeconds(value)
+			case "dhcp-renewal-time":
+				current.Renew = parseSeconds(value)
+			case "dhcp-rebinding-time":
+				current.Rebind = parseSeconds(value)
+			}
+		}
+	}
+
+	if last == nil {
+		return nil, fmt.Errorf("no lease found")
+	}
+	return last, nil
+}
+
+// parseNetworkdLease parses a systemd-networkd lease file (KEY=VALUE lines)
+func parseNetworkdLease(data string) (*Lease, error) {
+	lease := &Lease{}
+	for _, line := range strings.Split(data, "\n") {
+		key, value, found := strings.Cut(strings.TrimSpace(line), "=")
+		if !found {
+			continue
+		}
+		switch key {
+		case "ADDRESS":
+			lease.IP = net.ParseIP(value)
+		case "NETMASK":
+			lease.SubnetMask = net.ParseIP(value)
+		case "ROUTER":
+			lease.Router = net.ParseIP(firstField(value))
+		case "SERVER_ADDRESS":
+			lease.ServerID = net.ParseIP(value)
+		case "DNS":
+			for _, item := range strings.Fields(value) {
+				if ip := net.ParseIP(item); ip != nil {
+					lease.DNS = append(lease.DNS, ip)
+				}
+			}
+		case "DOMAINNAME":
+			lease.Domain = value
+		case "LIFETIME":
+			lease.LeaseTime = parseSeconds(value)
+		case "T1":
+			lease.Renew = parseSeconds(value)
+		case "T2":
+			lease.Rebind = parseSeconds(value)
+		}
+	}
+
+	if lease.IP == nil {
+		return nil, fmt.Errorf("no lease address found")
+	}
+	return lease, nil
+}
+
+// parseLeaseTime parses dhclient dates "3 2024/01/03 10:00:00" (UTC) or "epoch 1704276000"
+func parseLeaseTime(fields []string) time.Time {
+	if len(fields) >= 2 && fields[0] == "epoch" {
+		if epoch, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+			return time.Unix(epoch, 0)
+		}
+		return time.Time{}
+	}
+	if len(fields) >= 3 {
+		if t, err := time.Parse("2006/01/02 15:04:05", fields[1]+" "+fields[2]); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// parseSeconds parses a number of seconds as duration
+func parseSeconds(value string) time.Duration {
+	seconds, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// firstField returns the first whitespace separated field of s or empty string
+func firstField(s string) string {
+	if fields := strings.Fields(s); len(fields) > 0 {
+		return fields[0]
+	}
+	return ""
+}
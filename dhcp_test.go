@@ -0,0 +1,129 @@
+package network
+
+import (
+	"testing"
+	"time"
+)
+
+const testDhclientLeases = `lease {
+  interface "eth0";
+  fixed-address 192.168.1.50;
+  option subnet-mask 255.255.255.0;
+  option routers 192.168.1.1;
+  option domain-name-servers 192.168.1.1;
+  option domain-name "old.lan";
+  expire 3 2024/01/03 10:00:00;
+}
+lease {
+  interface "wlan0";
+  fixed-address 10.0.0.20;
+  option domain-name-servers 10.0.0.1;
+}
+lease {
+  interface "eth0";
+  fixed-address 192.168.1.51;
+  option subnet-mask 255.255.255.0;
+  option routers 192.168.1.1;
+  option dhcp-lease-time 86400;
+  option dhcp-renewal-time 43200;
+  option dhcp-rebinding-time 75600;
+  option dhcp-server-identifier 192.168.1.1;
+  option domain-name-servers 1.1.1.1, 8.8.8.8;
+  option domain-name "home.lan";
+  expire epoch 1704276000;
+}
+`
+
+func TestParseDhclientLease(t *testing.T) {
+	lease, err := parseDhclientLease(testDhclientLeases, "eth0")
+	if err != nil {
+		t.Fatalf("parseDhclientLease() error = %v", err)
+	}
+
+	if got := lease.IP.String(); got != "192.168.1.51" {
+		t.Errorf("IP = %s, want 192.168.1.51 (last lease)", got)
+	}
+	if got := lease.Router.String(); got != "192.168.1.1" {
+		t.Errorf("Router = %s", got)
+	}
+	if got := lease.SubnetMask.String(); got != "255.255.255.0" {
+		t.Errorf("SubnetMask = %s", got)
+	}
+	if len(lease.DNS) != 2 || lease.DNS[0].String() != "1.1.1.1" || lease.DNS[1].String() != "8.8.8.8" {
+		t.Errorf("DNS = %v", lease.DNS)
+	}
+	if lease.Domain != "home.lan" {
+		t.Errorf("Domain = %q", lease.Domain)
+	}
+	if lease.LeaseTime != 24*time.Hour || lease.Renew != 12*time.Hour || lease.Rebind != 21*time.Hour {
+		t.Errorf("timers = %v/%v/%v", lease.LeaseTime, lease.Renew, lease.Rebind)
+	}
+	if got := lease.ServerID.String(); got != "192.168.1.1" {
+		t.Errorf("ServerID = %s", got)
+	}
+	if !lease.Expiry.Equal(time.Unix(1704276000, 0)) {
+		t.Errorf("Expiry = %v", lease.Expiry)
+	}
+
+	wlan, err := parseDhclientLease(testDhclientLeases, "wlan0")
+	if err != nil {
+		t.Fatalf("parseDhclientLease(wlan0) error = %v", err)
+	}
+	if got := wlan.IP.String(); got != "10.0.0.20" {
+		t.Errorf("wlan0 IP = %s", got)
+	}
+
+	if _, err := parseDhclientLease(testDhclientLeases, "eth1"); err == nil {
+		t.Error("expected error for interface without lease")
+	}
+}
+
+func TestParseLeaseTime(t *testing.T) {
+	got := parseLeaseTime([]string{"3", "2024/01/03", "10:00:00"})
+	want := time.Date(2024, 1, 3, 10, 0, 0, 0, time.UTC)
+	if !got.Equal(want) {
+		t.Errorf("parseLeaseTime() = %v, want %v", got, want)
+	}
+	if got := parseLeaseTime([]string{"never"}); !got.IsZero() {
+		t.Errorf("parseLeaseTime(never) = %v, want zero", got)
+	}
+}
+
+func TestParseNetworkdLease(t *testing.T) {
+	data := `# This is private data. Do not parse.
+ADDRESS=192.168.1.60
+NETMASK=255.255.255.0
+ROUTER=192.168.1.1
+SERVER_ADDRESS=192.168.1.1
+T1=1800
+T2=3150
+LIFETIME=3600
+DNS=192.168.1.1 9.9.9.9
+DOMAINNAME=example.lan
+`
+	lease, err := parseNetworkdLease(data)
+	if err != nil {
+		t.Fatalf("parseNetworkdLease() error = %v", err)
+	}
+	if got := lease.IP.String(); got != "192.168.1.60" {
+		t.Errorf("IP = %s", got)
+	}
+	if len(lease.DNS) != 2 || lease.DNS[1].String() != "9.9.9.9" {
+		t.Errorf("DNS = %v", lease.DNS)
+	}
+	if lease.Domain != "example.lan" || lease.LeaseTime != time.Hour || lease.Renew != 30*time.Minute {
+		t.Errorf("lease = %+v", lease)
+	}
+
+	if _, err := parseNetworkdLease("DNS=1.1.1.1\n"); err == nil {
+		t.Error("expected error for lease without address")
+	}
+}
+
+func TestDHCPLeaseInvalidInterface(t *testing.T) {
+	for _, iface := range []string{"", "../etc", "eth0/x", "eth0;rm"} {
+		if _, err := DHCPLease(iface); err == nil {
+			t.Errorf("DHCPLease(%q) expected error", iface)
+		}
+	}
+}
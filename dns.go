@@ -1,10 +1,24 @@
 package network
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
 	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -13,12 +27,41 @@ type DNSRecords struct {
 	Domain string
 	A      []string // IPv4 addresses
 	AAAA   []string // IPv6 addresses
-	CNAME  []string // Canonical names
+	CNAME  []string // Canonical name the domain is an alias of
 	MX     []MXRecord
 	NS     []string // Name servers
 	TXT    []string // Text records (includes SPF)
 	SOA    *SOARecord
 	PTR    []string // Pointer records
+	HINFO  []string // Host information "CPU OS", returned by servers refusing ANY queries (RFC 8482)
+	Server string   // Address (ip:port or DoH URL) of the DNS server which answered, empty when the system resolver was used
+
+	// Nameserver is the host name of the name server which answered, set by ResolveAuthoritative
+	Nameserver string
+
+	// Authenticated is set when every answer of a DNSSEC query had the AD bit set,
+	// meaning the server validated the signatures
+	Authenticated bool
+
+	// Authoritative is set when an answer came from a server authoritative for the zone (AA bit).
+	// Recursive is set when the server offered recursion (RA bit), its answers may come from a cache.
+	// Both are only known for queries sent directly to a server.
+	Authoritative bool
+	Recursive     bool
+
+	// Truncated is set when record sets were cut to MaxResults entries. MessageTruncated is set when
+	// a server response had the TC bit set and couldn't be retrieved completely over TCP.
+	Truncated        bool
+	MessageTruncated bool
+
+	// PTRByIP holds the PTR names of each A record, filled by ResolvePTRForA
+	PTRByIP map[string][]string
+
+	// RawResponses holds the complete wire format response of each query by record type ("A", "MX", ...,
+	// "ANY" for ResolveANY) for inspection with a hexdump or Wireshark, filled if QueryOptions.CaptureRaw
+	// or WithCaptureRaw is set. It replaces a single RawResponse field because one call sends a query
+	// per record type.
+	RawResponses map[string][]byte
 }
 
 // MXRecord represents a mail exchange record
@@ -45,9 +88,7 @@ func NSLookup(domain string) ([]string, error) {
 	}
 
 	// Remove protocol if present
-	domain = strings.TrimPrefix(domain, "http://")
-	domain = strings.TrimPrefix(domain, "https://")
-	domain = strings.TrimSuffix(domain, "/")
+	domain = cleanDomain(domain)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -62,178 +103,1863 @@ func NSLookup(domain string) ([]string, error) {
 	}
 
 	// Remove duplicates
-	uniqueIPs := make(map[string]bool)
-	var result []string
-	for _, ip := range ips {
-		if !uniqueIPs[ip] {
-			uniqueIPs[ip] = true
-			result = append(result, ip)
+	return uniqueStrings(ips), nil
+}
+
+// Matching modes of AssertResolvesMatch
+const (
+	ResolveMatchExact    = iota // The resolved IPs equal the expected IPs
+	ResolveMatchSubset          // Every resolved IP is expected, e.g. a CDN answering with part of its pool
+	ResolveMatchSuperset        // Every expected IP is resolved, further IPs are allowed
+)
+
+// AssertResolves resolves the domain and reports whether its IPs equal the expected IPs, the order
+// doesn't matter. The resolved IPs are returned in either case.
+func AssertResolves(ctx context.Context, domain string, expected []string) (bool, []string, error) {
+	return AssertResolvesMatch(ctx, domain, expected, ResolveMatchExact)
+}
+
+// AssertResolvesMatch resolves the domain and compares its IPs with the expected IPs using the matching
+// mode, see ResolveMatchExact, ResolveMatchSubset and ResolveMatchSuperset. The resolved IPs are returned
+// in either case, a failed lookup returns an error.
+func AssertResolvesMatch(ctx context.Context, domain string, expected []string, match int) (bool, []string, error) {
+	if domain == "" {
+		return false, nil, fmt.Errorf("domain cannot be empty")
+	}
+	if match < ResolveMatchExact || match > ResolveMatchSuperset {
+		return false, nil, fmt.Errorf("invalid match mode %d", match)
+	}
+	want := make(map[string]bool)
+	for _, s := range expected {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return false, nil, fmt.Errorf("invalid expected IP address: %s", s)
+		}
+		want[ip.String()] = true
+	}
+
+	domain = cleanDomain(domain)
+	addrs, err := lookupIPAddr(ctx, domain)
+	if err != nil {
+		return false, nil, fmt.Errorf("failed to lookup %s: %w", domain, err)
+	}
+	var actual []string
+	for _, addr := range addrs {
+		actual = append(actual, addr.IP.String())
+	}
+	actual = uniqueStrings(actual)
+
+	got := make(map[string]bool)
+	unexpected := false
+	for _, ip := range actual {
+		got[ip] = true
+		if !want[ip] {
+			unexpected = true
+		}
+	}
+	missing := false
+	for ip := range want {
+		if !got[ip] {
+			missing = true
 		}
 	}
 
-	return result, nil
+	switch match {
+	case ResolveMatchSubset:
+		return !unexpected, actual, nil
+	case ResolveMatchSuperset:
+		return !missing, actual, nil
+	}
+	return !unexpected && !missing, actual, nil
 }
 
-// Resolve gets a domain and returns all DNS records
-func Resolve(domain string) (*DNSRecords, error) {
+// DefaultFallbackServers is the resolver chain used by NSLookupFallback when no servers are given.
+// An empty entry stands for the system resolver.
+var DefaultFallbackServers = []string{"", "1.1.1.1", "8.8.8.8"}
+
+// NSLookupFallback tries each DNS server in order until one returns results.
+// An empty server entry uses the system resolver. If all servers fail, the errors are aggregated.
+func NSLookupFallback(ctx context.Context, domain string, servers []string) ([]string, error) {
 	if domain == "" {
 		return nil, fmt.Errorf("domain cannot be empty")
 	}
+	if len(servers) == 0 {
+		servers = DefaultFallbackServers
+	}
 
-	// Clean domain
-	domain = strings.TrimPrefix(domain, "http://")
-	domain = strings.TrimPrefix(domain, "https://")
-	domain = strings.TrimSuffix(domain, "/")
+	domain = cleanDomain(domain)
 
-	records := &DNSRecords{
-		Domain: domain,
+	var errs []error
+	for _, server := range servers {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+
+		lookupCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		ips, err := newResolver(server).LookupHost(lookupCtx, domain)
+		cancel()
+
+		name := server
+		if name == "" {
+			name = "system"
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			logger().Warn("DNS server failed, trying the next one", "server", name, "domain", domain, "error", err)
+			continue
+		}
+		if len(ips) == 0 {
+			errs = append(errs, fmt.Errorf("%s: no addresses returned", name))
+			logger().Warn("DNS server returned no addresses, trying the next one", "server", name, "domain", domain)
+			continue
+		}
+		return uniqueStrings(ips), nil
+	}
+
+	return nil, fmt.Errorf("failed to lookup %s: %w", domain, errors.Join(errs...))
+}
+
+// maxCNAMEChain limits the aliases followed by NSLookupWithOptions, resolvers give up at a similar depth
+const maxCNAMEChain = 16
+
+// NSLookupOptions configures NSLookupWithOptions
+type NSLookupOptions struct {
+	Server     string        // DNS server address, the system resolver is used if empty
+	Timeout    time.Duration // Timeout of the lookup (default: 10 seconds)
+	CNAMEChain bool          // Also return the CNAME chain the domain resolves through
+}
+
+// NSLookupWithOptions is like NSLookup but queries the server of the options. With CNAMEChain set the
+// aliases followed from the domain to its canonical name are returned in order, the last one is the
+// canonical name. The chain is empty if the domain is not an alias.
+func NSLookupWithOptions(ctx context.Context, domain string, options *NSLookupOptions) (ips []string, chain []string, err error) {
+	if domain == "" {
+		return nil, nil, fmt.Errorf("domain cannot be empty")
+	}
+	if options == nil {
+		options = &NSLookupOptions{}
+	}
+	timeout := options.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	domain = cleanDomain(domain)
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
+	addrs, err := newResolver(options.Server).LookupHost(ctx, domain)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to lookup %s: %w", domain, err)
+	}
+	ips = uniqueStrings(addrs)
+
+	if options.CNAMEChain {
+		chain, err = lookupCNAMEChain(ctx, domain, options.Server)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to lookup CNAME chain of %s: %w", domain, err)
+		}
+	}
+	return ips, chain, nil
+}
+
+// lookupCNAMEChain follows the CNAME records of the domain. Recursive servers return the whole chain
+// in the answer of an A query, a chain cut short is continued by querying its last name.
+func lookupCNAMEChain(ctx context.Context, domain, server string) ([]string, error) {
+	options, err := QueryOptions{Server: server}.normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	var chain []string
+	seen := map[string]bool{strings.ToLower(domain): true}
+	name := domain
+	for {
+		response, err := dnsExchange(ctx, options.Server, options.newQuery(name, dnsTypeA, true), options.Protocol, nil, options.tlsVerification())
+		if err != nil {
+			return nil, err
+		}
+
+		aliases := make(map[string]string)
+		resolved := false
+		for _, rr := range response.Answers {
+			switch rr.Type {
+			case dnsTypeCNAME:
+				aliases[strings.ToLower(strings.TrimSuffix(rr.Name, "."))] = strings.TrimSuffix(rr.Target, ".")
+			case dnsTypeA:
+				resolved = true
+			}
+		}
+
+		next := name
+		for {
+			target, ok := aliases[strings.ToLower(next)]
+			if !ok {
+				break
+			}
+			if seen[strings.ToLower(target)] {
+				return nil, fmt.Errorf("CNAME loop at %s", target)
+			}
+			if len(chain) == maxCNAMEChain {
+				return nil, fmt.Errorf("CNAME chain longer than %d", maxCNAMEChain)
+			}
+			seen[strings.ToLower(target)] = true
+			chain = append(chain, target)
+			next = target
+		}
+
+		// The chain ends at a name with addresses or without an alias
+		if next == name || resolved {
+			return chain, nil
+		}
+		name = next
+	}
+}
+
+// ReverseLookup returns the host names of an IP address using PTR records, the name queried is
+// ArpaName of the address
+func ReverseLookup(ctx context.Context, ip string) ([]string, error) {
+	if net.ParseIP(ip) == nil {
+		return nil, fmt.Errorf("invalid IP address: %s", ip)
+	}
+
+	names, err := lookupAddr(ctx, ip)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reverse lookup %s: %w", ip, err)
+	}
+
+	var result []string
+	for _, name := range names {
+		result = append(result, strings.TrimSuffix(name, "."))
+	}
+	return uniqueStrings(result), nil
+}
+
+// lookupAddr resolves the PTR records of an address, replaced in tests
+var lookupAddr = func(ctx context.Context, addr string) ([]string, error) {
 	resolver := &net.Resolver{
 		PreferGo: true,
 	}
+	return resolver.LookupAddr(ctx, addr)
+}
+
+// VerifyFCrDNS performs a forward-confirmed reverse DNS check: the PTR names of the IP are resolved
+// and the check passes if any of them resolves back to the same IP. The PTR names are returned
+// even when the check fails. Names that fail to resolve are skipped, an error is only returned when
+// the reverse lookup fails or none of the names could be resolved.
+func VerifyFCrDNS(ctx context.Context, ip net.IP) (bool, []string, error) {
+	if ip == nil {
+		return false, nil, fmt.Errorf("invalid IP address")
+	}
+
+	names, err := ReverseLookup(ctx, ip.String())
+	if err != nil {
+		return false, nil, err
+	}
 
-	// Get A records (IPv4)
-	if addrs, err := resolver.LookupHost(ctx, domain); err == nil {
+	var errs []error
+	for _, name := range names {
+		addrs, err := lookupIPAddr(ctx, name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
 		for _, addr := range addrs {
-			if ip := net.ParseIP(addr); ip != nil {
-				if ip.To4() != nil {
-					records.A = append(records.A, addr)
-				} else {
-					records.AAAA = append(records.AAAA, addr)
-				}
+			if addr.IP.Equal(ip) {
+				return true, names, nil
 			}
 		}
 	}
 
-	// Get CNAME records
-	if cname, err := resolver.LookupCNAME(ctx, domain); err == nil && cname != domain+"." {
-		records.CNAME = append(records.CNAME, strings.TrimSuffix(cname, "."))
+	if len(names) > 0 && len(errs) == len(names) {
+		return false, names, fmt.Errorf("failed to forward resolve %s: %w", ip, errors.Join(errs...))
 	}
+	return false, names, nil
+}
 
-	// Get MX records
-	if mxRecords, err := resolver.LookupMX(ctx, domain); err == nil {
-		for _, mx := range mxRecords {
-			records.MX = append(records.MX, MXRecord{
-				Host:     strings.TrimSuffix(mx.Host, "."),
-				Priority: mx.Pref,
-			})
-		}
+// ReverseLookupRange performs reverse lookups for every host in the CIDR range using at most
+// concurrency parallel lookups. Only addresses having PTR records are included in the result.
+func ReverseLookupRange(ctx context.Context, cidr string, concurrency int) (map[string][]string, error) {
+	_, ipnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CIDR %s: %w", cidr, err)
 	}
 
-	// Get NS records
-	if nsRecords, err := resolver.LookupNS(ctx, domain); err == nil {
-		for _, ns := range nsRecords {
-			records.NS = append(records.NS, strings.TrimSuffix(ns.Host, "."))
-		}
+	hosts, err := cidrHosts(ipnet, MaxRangeHosts)
+	if err != nil {
+		return nil, err
 	}
 
-	// Get TXT records (includes SPF)
-	if txtRecords, err := resolver.LookupTXT(ctx, domain); err == nil {
-		records.TXT = txtRecords
+	if concurrency <= 0 {
+		concurrency = 16
 	}
 
-	// Try to get SOA record
-	records.SOA = lookupSOA(domain)
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = make(map[string][]string)
+		jobs    = make(chan string)
+	)
 
-	// Get PTR records if the input is an IP
-	if ip := net.ParseIP(domain); ip != nil {
-		if names, err := resolver.LookupAddr(ctx, domain); err == nil {
-			records.PTR = names
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ip := range jobs {
+				lookupCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+				names, err := ReverseLookup(lookupCtx, ip)
+				cancel()
+				if err != nil || len(names) == 0 {
+					continue
+				}
+				mu.Lock()
+				results[ip] = names
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, host := range hosts {
+		if ctx.Err() != nil {
+			break
 		}
+		jobs <- host.String()
 	}
+	close(jobs)
+	wg.Wait()
 
-	return records, nil
+	if err := ctx.Err(); err != nil {
+		return results, err
+	}
+	return results, nil
 }
 
-// lookupSOA attempts to retrieve SOA record using DNS query
-func lookupSOA(domain string) *SOARecord {
-	// SOA records require more complex DNS queries
-	// For now, we'll use the basic resolver capabilities
-	resolver := &net.Resolver{
-		PreferGo: true,
+// DetectWildcard checks whether the domain uses wildcard DNS by resolving a few random subdomains.
+// The domain is considered wildcard if all of them resolve to the same set of addresses, which is
+// returned sorted. Random names resolving to different addresses are not answered by a wildcard record.
+func DetectWildcard(ctx context.Context, domain string) (bool, []string, error) {
+	if domain == "" {
+		return false, nil, fmt.Errorf("domain cannot be empty")
 	}
+	domain = cleanDomain(domain)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	var wildcardIPs []string
+	for i := 0; i < 3; i++ {
+		label := make([]byte, 8)
+		if _, err := rand.Read(label); err != nil {
+			return false, nil, err
+		}
+		name := fmt.Sprintf("%x.%s", label, domain)
 
-	// Try to get NS records which often include SOA information
-	if nsRecords, err := resolver.LookupNS(ctx, domain); err == nil && len(nsRecords) > 0 {
-		// Return a basic SOA record with available information
-		return &SOARecord{
-			NS: strings.TrimSuffix(nsRecords[0].Host, "."),
+		lookupCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		addrs, err := lookupIPAddr(lookupCtx, name)
+		cancel()
+
+		if err != nil {
+			var dnsErr *net.DNSError
+			if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+				return false, nil, nil
+			}
+			return false, nil, fmt.Errorf("failed to lookup %s: %w", name, err)
+		}
+		if len(addrs) == 0 {
+			return false, nil, nil
 		}
+
+		var ips []string
+		for _, addr := range addrs {
+			ips = append(ips, addr.IP.String())
+		}
+		ips = uniqueStrings(ips)
+		sort.Strings(ips)
+		if i > 0 && strings.Join(ips, ",") != strings.Join(wildcardIPs, ",") {
+			return false, nil, nil
+		}
+		wildcardIPs = ips
 	}
 
-	return nil
+	return true, wildcardIPs, nil
 }
 
-// String returns a formatted string representation of DNS records
-func (r *DNSRecords) String() string {
-	var result strings.Builder
+// EnumerateSubdomains resolves word.domain for every word using at most concurrency parallel lookups
+// and returns the subdomains that resolve. If the domain uses wildcard DNS, subdomains resolving only
+// to the wildcard addresses are left out.
+func EnumerateSubdomains(ctx context.Context, domain string, wordlist []string, concurrency int) (map[string][]string, error) {
+	if domain == "" {
+		return nil, fmt.Errorf("domain cannot be empty")
+	}
+	domain = cleanDomain(domain)
 
-	result.WriteString(fmt.Sprintf("DNS Records for %s:\n", r.Domain))
-	result.WriteString(strings.Repeat("-", 50) + "\n")
+	wildcard, wildcardIPs, err := DetectWildcard(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+	isWildcardIP := make(map[string]bool)
+	for _, ip := range wildcardIPs {
+		isWildcardIP[ip] = true
+	}
 
-	if len(r.A) > 0 {
-		result.WriteString(fmt.Sprintf("A Records (IPv4):\n"))
-		for _, a := range r.A {
-			result.WriteString(fmt.Sprintf("  - %s\n", a))
-		}
+	if concurrency <= 0 {
+		concurrency = 16
 	}
 
-	if len(r.AAAA) > 0 {
-		result.WriteString(fmt.Sprintf("AAAA Records (IPv6):\n"))
-		for _, aaaa := range r.AAAA {
-			result.WriteString(fmt.Sprintf("  - %s\n", aaaa))
-		}
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = make(map[string][]string)
+		jobs    = make(chan string)
+	)
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range jobs {
+				lookupCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+				addrs, err := lookupIPAddr(lookupCtx, name)
+				cancel()
+				if err != nil || len(addrs) == 0 {
+					continue
+				}
+
+				var ips []string
+				onlyWildcard := wildcard
+				for _, addr := range addrs {
+					ip := addr.IP.String()
+					ips = append(ips, ip)
+					if !isWildcardIP[ip] {
+						onlyWildcard = false
+					}
+				}
+				if onlyWildcard {
+					continue
+				}
+
+				mu.Lock()
+				results[name] = uniqueStrings(ips)
+				mu.Unlock()
+			}
+		}()
 	}
 
-	if len(r.CNAME) > 0 {
-		result.WriteString(fmt.Sprintf("CNAME Records:\n"))
-		for _, cname := range r.CNAME {
-			result.WriteString(fmt.Sprintf("  - %s\n", cname))
+	for _, word := range wordlist {
+		word = strings.Trim(strings.TrimSpace(word), ".")
+		if word == "" {
+			continue
+		}
+		select {
+		case jobs <- word + "." + domain:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
 		}
 	}
+	close(jobs)
+	wg.Wait()
 
-	if len(r.MX) > 0 {
-		result.WriteString(fmt.Sprintf("MX Records (Mail):\n"))
-		for _, mx := range r.MX {
-			result.WriteString(fmt.Sprintf("  - Priority %d: %s\n", mx.Priority, mx.Host))
+	return results, ctx.Err()
+}
+
+// newResolver returns a resolver which sends queries to the given server.
+// An empty server returns the system resolver.
+func newResolver(server string) *net.Resolver {
+	if server == "" {
+		return &net.Resolver{
+			PreferGo: true,
 		}
 	}
 
-	if len(r.NS) > 0 {
-		result.WriteString(fmt.Sprintf("NS Records (Name Servers):\n"))
-		for _, ns := range r.NS {
-			result.WriteString(fmt.Sprintf("  - %s\n", ns))
-		}
+	address := serverAddress(server, "53")
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			dialer := net.Dialer{}
+			return dialer.DialContext(ctx, network, address)
+		},
 	}
+}
 
-	if len(r.TXT) > 0 {
-		result.WriteString(fmt.Sprintf("TXT Records (includes SPF):\n"))
-		for _, txt := range r.TXT {
-			result.WriteString(fmt.Sprintf("  - %s\n", txt))
+// systemResolver returns the resolver used by Resolve, replaced in tests
+var systemResolver = func() *net.Resolver {
+	return newResolver("")
+}
+
+// serverAddress appends the default port to a DNS server address if it has none
+func serverAddress(server, defaultPort string) string {
+	if _, _, err := net.SplitHostPort(server); err == nil {
+		return server
+	}
+	return net.JoinHostPort(strings.Trim(server, "[]"), defaultPort)
+}
+
+// cleanDomain removes protocol prefix and trailing slash from a domain
+func cleanDomain(domain string) string {
+	domain = strings.TrimPrefix(domain, "http://")
+	domain = strings.TrimPrefix(domain, "https://")
+	return strings.TrimSuffix(domain, "/")
+}
+
+// uniqueStrings removes duplicated items while preserving order
+func uniqueStrings(items []string) []string {
+	seen := make(map[string]bool)
+	var result []string
+	for _, item := range items {
+		if !seen[item] {
+			seen[item] = true
+			result = append(result, item)
 		}
 	}
+	return result
+}
 
-	if r.SOA != nil {
-		result.WriteString(fmt.Sprintf("SOA Record:\n"))
-		result.WriteString(fmt.Sprintf("  - Primary NS: %s\n", r.SOA.NS))
-		if r.SOA.Mbox != "" {
-			result.WriteString(fmt.Sprintf("  - Contact: %s\n", r.SOA.Mbox))
+// Resolve gets a domain and returns all DNS records
+func Resolve(domain string, opts ...Option) (*DNSRecords, error) {
+	return ResolveContext(context.Background(), domain, opts...)
+}
+
+// ResolveContext gets a domain and returns all DNS records, the lookups are bound to the given context
+func ResolveContext(ctx context.Context, domain string, opts ...Option) (*DNSRecords, error) {
+	if domain == "" {
+		return nil, fmt.Errorf("domain cannot be empty")
+	}
+	options := applyOptions(opts)
+	namespace := options.namespace
+	if namespace != "" {
+		if err := validateNamespace(namespace); err != nil {
+			return nil, err
 		}
 	}
 
-	if len(r.PTR) > 0 {
-		result.WriteString(fmt.Sprintf("PTR Records (Reverse DNS):\n"))
-		for _, ptr := range r.PTR {
-			result.WriteString(fmt.Sprintf("  - %s\n", ptr))
+	// Clean domain
+	domain = cleanDomain(domain)
+
+	records := &DNSRecords{
+		Domain: domain,
+	}
+
+	parent := ctx
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	resolver := namespaceResolver(systemResolver(), namespace)
+
+	// Record types are queried concurrently, each goroutine writes only its own fields
+	var wg sync.WaitGroup
+	lookup := func(fn func()) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fn()
+		}()
+	}
+
+	// Get A and AAAA records
+	lookup(func() {
+		if addrs, err := resolver.LookupHost(ctx, domain); err == nil {
+			for _, addr := range addrs {
+				if ip := net.ParseIP(addr); ip != nil {
+					if ip.To4() != nil {
+						records.A = append(records.A, addr)
+					} else {
+						records.AAAA = append(records.AAAA, addr)
+					}
+				}
+			}
+		}
+	})
+
+	// Get CNAME records. LookupCNAME returns the canonical name at the end of the chain, or the queried
+	// name itself if it's no alias, it's recorded whenever it differs even if the domain has A records.
+	lookup(func() {
+		if cname, err := resolver.LookupCNAME(ctx, domain); err == nil {
+			cname = strings.TrimSuffix(cname, ".")
+			if cname != "" && !strings.EqualFold(cname, strings.TrimSuffix(domain, ".")) {
+				records.CNAME = append(records.CNAME, cname)
+			}
+		}
+	})
+
+	// Get MX records
+	lookup(func() {
+		if mxRecords, err := resolver.LookupMX(ctx, domain); err == nil {
+			for _, mx := range mxRecords {
+				records.MX = append(records.MX, MXRecord{
+					Host:     strings.TrimSuffix(mx.Host, "."),
+					Priority: mx.Pref,
+				})
+			}
+		}
+	})
+
+	// Get NS records
+	lookup(func() {
+		if nsRecords, err := resolver.LookupNS(ctx, domain); err == nil {
+			for _, ns := range nsRecords {
+				records.NS = append(records.NS, strings.TrimSuffix(ns.Host, "."))
+			}
+		}
+	})
+
+	// Get TXT records (includes SPF)
+	lookup(func() {
+		if txtRecords, err := resolver.LookupTXT(ctx, domain); err == nil {
+			records.TXT = txtRecords
 		}
+	})
+
+	// Try to get SOA record
+	lookup(func() {
+		records.SOA = lookupSOA(ctx, resolver, domain)
+	})
+
+	// Get PTR records if the input is an IP
+	if ip := net.ParseIP(domain); ip != nil {
+		lookup(func() {
+			if names, err := resolver.LookupAddr(ctx, domain); err == nil {
+				records.PTR = names
+			}
+		})
 	}
 
-	return result.String()
-}
\ No newline at end of file
+	wg.Wait()
+
+	// Records are incomplete if the caller gave up
+	if err := parent.Err(); err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", domain, err)
+	}
+
+	records.limit(options.maxResults)
+	return records, nil
+}
+
+// Resolve resolves all DNS records of the domain through the DNS servers of the configuration instead of
+// the system resolver. The servers are tried in order until one answers, DNSRecords.Server reports which
+// one did. This verifies that the discovered (e.g. DHCP provided) resolvers actually work.
+func (network *Network) Resolve(ctx context.Context, domain string) (*DNSRecords, error) {
+	if domain == "" {
+		return nil, fmt.Errorf("domain cannot be empty")
+	}
+	if len(network.DNS) == 0 {
+		return nil, fmt.Errorf("no DNS servers configured")
+	}
+
+	var errs []error
+	for _, server := range network.DNS {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+		records, err := ResolveQuery(ctx, domain, QueryOptions{Server: server})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", server, err))
+			continue
+		}
+		return records, nil
+	}
+	return nil, fmt.Errorf("failed to resolve %s: %w", cleanDomain(domain), errors.Join(errs...))
+}
+
+// WithMaxResults keeps at most n records of each record type in the result of Resolve, the first
+// records as answered by the server are kept. n <= 0 keeps all records.
+func WithMaxResults(n int) Option {
+	return func(o *callOptions) {
+		o.maxResults = n
+	}
+}
+
+// WithCaptureRaw keeps the wire format of the response in DNSRecords.RawResponses, honored by ResolveANY.
+// Use QueryOptions.CaptureRaw for ResolveQuery.
+func WithCaptureRaw() Option {
+	return func(o *callOptions) {
+		o.captureRaw = true
+	}
+}
+
+// ResolveRequire resolves a domain and returns an error if any of the required record types
+// (A, AAAA, CNAME, MX, NS, TXT, SOA, PTR) yielded no records
+func ResolveRequire(ctx context.Context, domain string, required []string) (*DNSRecords, error) {
+	for _, recordType := range required {
+		if _, err := (&DNSRecords{}).Count(recordType); err != nil {
+			return nil, err
+		}
+	}
+
+	records, err := ResolveContext(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	for _, recordType := range required {
+		if count, _ := records.Count(recordType); count == 0 {
+			missing = append(missing, strings.ToUpper(recordType))
+		}
+	}
+	if len(missing) > 0 {
+		return records, fmt.Errorf("%s has no %s records", records.Domain, strings.Join(missing, ", "))
+	}
+	return records, nil
+}
+
+// ResolvePTRForA looks up the PTR records of every A record and stores them in PTRByIP keyed by IP.
+// Addresses without PTR records are left out. Lookup failures are returned after all addresses
+// were tried, the names found are kept.
+func (r *DNSRecords) ResolvePTRForA(ctx context.Context) error {
+	if r.PTRByIP == nil {
+		r.PTRByIP = make(map[string][]string)
+	}
+
+	var errs []error
+	for _, ip := range r.A {
+		lookupCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		names, err := ReverseLookup(lookupCtx, ip)
+		cancel()
+
+		if err != nil {
+			var dnsErr *net.DNSError
+			if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		if len(names) > 0 {
+			r.PTRByIP[ip] = names
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Count returns the number of records of the given type
+func (r *DNSRecords) Count(recordType string) (int, error) {
+	switch strings.ToUpper(recordType) {
+	case "A":
+		return len(r.A), nil
+	case "AAAA":
+		return len(r.AAAA), nil
+	case "CNAME":
+		return len(r.CNAME), nil
+	case "MX":
+		return len(r.MX), nil
+	case "NS":
+		return len(r.NS), nil
+	case "TXT":
+		return len(r.TXT), nil
+	case "SOA":
+		if r.SOA != nil {
+			return 1, nil
+		}
+		return 0, nil
+	case "PTR":
+		return len(r.PTR), nil
+	case "HINFO":
+		return len(r.HINFO), nil
+	}
+	return 0, fmt.Errorf("unsupported record type %s", recordType)
+}
+
+// lookupSOA attempts to retrieve SOA record using DNS query
+func lookupSOA(ctx context.Context, resolver *net.Resolver, domain string) *SOARecord {
+	// SOA records require more complex DNS queries
+	// For now, we'll use the basic resolver capabilities
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	// Try to get NS records which often include SOA information
+	if nsRecords, err := resolver.LookupNS(ctx, domain); err == nil && len(nsRecords) > 0 {
+		// Return a basic SOA record with available information
+		return &SOARecord{
+			NS: strings.TrimSuffix(nsRecords[0].Host, "."),
+		}
+	}
+
+	return nil
+}
+
+// String returns a formatted string representation of DNS records
+func (r *DNSRecords) String() string {
+	var result strings.Builder
+
+	result.WriteString(fmt.Sprintf("DNS Records for %s:\n", r.Domain))
+	result.WriteString(strings.Repeat("-", 50) + "\n")
+
+	if len(r.A) > 0 {
+		result.WriteString(fmt.Sprintf("A Records (IPv4):\n"))
+		for _, a := range r.A {
+			result.WriteString(fmt.Sprintf("  - %s\n", a))
+		}
+	}
+
+	if len(r.AAAA) > 0 {
+		result.WriteString(fmt.Sprintf("AAAA Records (IPv6):\n"))
+		for _, aaaa := range r.AAAA {
+			result.WriteString(fmt.Sprintf("  - %s\n", aaaa))
+		}
+	}
+
+	if len(r.CNAME) > 0 {
+		result.WriteString(fmt.Sprintf("CNAME Records:\n"))
+		for _, cname := range r.CNAME {
+			result.WriteString(fmt.Sprintf("  - %s\n", cname))
+		}
+	}
+
+	if len(r.MX) > 0 {
+		result.WriteString(fmt.Sprintf("MX Records (Mail):\n"))
+		for _, mx := range r.MX {
+			result.WriteString(fmt.Sprintf("  - Priority %d: %s\n", mx.Priority, mx.Host))
+		}
+	}
+
+	if len(r.NS) > 0 {
+		result.WriteString(fmt.Sprintf("NS Records (Name Servers):\n"))
+		for _, ns := range r.NS {
+			result.WriteString(fmt.Sprintf("  - %s\n", ns))
+		}
+	}
+
+	if len(r.TXT) > 0 {
+		result.WriteString(fmt.Sprintf("TXT Records (includes SPF):\n"))
+		for _, txt := range r.TXT {
+			result.WriteString(fmt.Sprintf("  - %s\n", txt))
+		}
+	}
+
+	if r.SOA != nil {
+		result.WriteString(fmt.Sprintf("SOA Record:\n"))
+		result.WriteString(fmt.Sprintf("  - Primary NS: %s\n", r.SOA.NS))
+		if r.SOA.Mbox != "" {
+			result.WriteString(fmt.Sprintf("  - Contact: %s\n", r.SOA.Mbox))
+		}
+	}
+
+	if len(r.PTR) > 0 {
+		result.WriteString(fmt.Sprintf("PTR Records (Reverse DNS):\n"))
+		for _, ptr := range r.PTR {
+			result.WriteString(fmt.Sprintf("  - %s\n", ptr))
+		}
+	}
+
+	if len(r.PTRByIP) > 0 {
+		result.WriteString(fmt.Sprintf("PTR Records of A Records:\n"))
+		ips := make([]string, 0, len(r.PTRByIP))
+		for ip := range r.PTRByIP {
+			ips = append(ips, ip)
+		}
+		sort.Strings(ips)
+		for _, ip := range ips {
+			result.WriteString(fmt.Sprintf("  - %s: %s\n", ip, strings.Join(r.PTRByIP[ip], ", ")))
+		}
+	}
+
+	if len(r.HINFO) > 0 {
+		result.WriteString(fmt.Sprintf("HINFO Records:\n"))
+		for _, hinfo := range r.HINFO {
+			result.WriteString(fmt.Sprintf("  - %s\n", hinfo))
+		}
+	}
+
+	return result.String()
+}
+
+// ResolveOptions configures queries sent directly to a DNS server
+type ResolveOptions struct {
+	Server  string        // DNS server address, the first nameserver of resolv.conf is used if empty
+	UseTCP  bool          // Send queries over TCP instead of UDP
+	Timeout time.Duration // Timeout of each query (default: 5 seconds)
+}
+
+// ResolveWith queries a DNS server directly and returns all DNS records of the domain.
+// UDP responses with the truncated bit set are retried over TCP to get complete answers.
+// It is a shorthand of ResolveQuery for plain DNS.
+func ResolveWith(ctx context.Context, domain string, options *ResolveOptions) (*DNSRecords, error) {
+	if options == nil {
+		options = &ResolveOptions{}
+	}
+
+	protocol := "udp"
+	if options.UseTCP {
+		protocol = "tcp"
+	}
+	return ResolveQuery(ctx, domain, QueryOptions{
+		Server:   options.Server,
+		Protocol: protocol,
+		Timeout:  options.Timeout,
+	})
+}
+
+// QueryOptions configures queries sent directly to a DNS server by ResolveQuery
+type QueryOptions struct {
+	Server       string        // DNS server address or DoH URL, the first nameserver of resolv.conf is used if empty
+	Port         int           // Server port, overrides a port in Server (default: 53, 853 for tls, 443 for https)
+	Protocol     string        // "udp" (default), "tcp", "tls" (DNS over TLS) or "https" (DNS over HTTPS)
+	Timeout      time.Duration // Timeout of each query (default: 5 seconds)
+	Retries      int           // Number of times a failed or SERVFAIL query is retried
+	EDNS         bool          // Add an EDNS0 OPT record advertising a 4096 byte UDP payload size
+	ClientSubnet *net.IPNet    // EDNS Client Subnet sent to the server (RFC 7871), implies EDNS
+	DNSSEC       bool          // Set the DNSSEC OK bit, implies EDNS
+	MaxResults   int           // Keep at most this many records of each type, 0 keeps all
+	CaptureRaw   bool          // Keep the wire format of the responses in DNSRecords.RawResponses
+
+	// TLSPins are base64 SHA-256 hashes of the SubjectPublicKeyInfo of tls servers (RFC 7858 SPKI pins). If set,
+	// the server certificate must match a pin instead of being verified against the system roots.
+	// TLSInsecureSkipVerify disables the certificate verification of tls servers.
+	TLSPins               []string
+	TLSInsecureSkipVerify bool
+
+	// Headers are added to DoH requests, UserAgent overrides their User-Agent (default: DefaultUserAgent)
+	Headers   http.Header
+	UserAgent string
+}
+
+// dnsDefaultPorts maps the supported query protocols to their default port
+var dnsDefaultPorts = map[string]int{
+	"udp":   53,
+	"tcp":   53,
+	"tls":   853,
+	"https": 443,
+}
+
+// ResolveQuery queries a DNS server directly using the transport and extensions of the options
+// and returns all DNS records of the domain
+func ResolveQuery(ctx context.Context, domain string, options QueryOptions) (*DNSRecords, error) {
+	if domain == "" {
+		return nil, fmt.Errorf("domain cannot be empty")
+	}
+
+	options, err := options.normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	return queryRecords(ctx, cleanDomain(domain), true, options)
+}
+
+// ResolveDoT queries all DNS records of the domain from a DNS over TLS server (RFC 7858), port 853 unless
+// the server has a port. The first system nameserver is used if server is empty. The certificate is verified
+// against the system roots, use ResolveQuery with Protocol "tls" to pin or skip the verification.
+func ResolveDoT(ctx context.Context, domain, server string) (*DNSRecords, error) {
+	return ResolveQuery(ctx, domain, QueryOptions{Server: server, Protocol: "tls"})
+}
+
+// normalize validates the options and fills in the defaults. Server is replaced with the address
+// queries are sent to, host:port or the URL of a DoH server.
+func (o QueryOptions) normalize() (QueryOptions, error) {
+	o.Protocol = strings.ToLower(o.Protocol)
+	if o.Protocol == "" {
+		o.Protocol = "udp"
+	}
+	defaultPort, ok := dnsDefaultPorts[o.Protocol]
+	if !ok {
+		return o, fmt.Errorf("unsupported DNS protocol: %s", o.Protocol)
+	}
+	if o.Port < 0 || o.Port > 65535 {
+		return o, fmt.Errorf("invalid port: %d", o.Port)
+	}
+	if o.ClientSubnet != nil && o.ClientSubnet.IP == nil {
+		return o, fmt.Errorf("invalid client subnet")
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = 5 * time.Second
+	}
+	if o.Retries < 0 {
+		o.Retries = 0
+	}
+	if o.MaxResults < 0 {
+		return o, fmt.Errorf("invalid max results: %d", o.MaxResults)
+	}
+	if (len(o.TLSPins) > 0 || o.TLSInsecureSkipVerify) && o.Protocol != "tls" {
+		return o, fmt.Errorf("TLS verification options require the tls protocol")
+	}
+	for _, pin := range o.TLSPins {
+		if hash, err := base64.StdEncoding.DecodeString(pin); err != nil || len(hash) != sha256.Size {
+			return o, fmt.Errorf("invalid TLS pin %q", pin)
+		}
+	}
+
+	if o.Protocol == "https" && strings.HasPrefix(o.Server, "https://") {
+		u, err := url.Parse(o.Server)
+		if err != nil {
+			return o, fmt.Errorf("invalid DoH URL %s: %w", o.Server, err)
+		}
+		if o.Port != 0 {
+			u.Host = net.JoinHostPort(u.Hostname(), strconv.Itoa(o.Port))
+		}
+		o.Server = u.String()
+		return o, nil
+	}
+
+	server := o.Server
+	if server == "" {
+		servers := systemNameservers()
+		if len(servers) == 0 {
+			return o, fmt.Errorf("no DNS server configured")
+		}
+		server = servers[0]
+	}
+
+	address := serverAddress(server, strconv.Itoa(defaultPort))
+	if o.Port != 0 {
+		host, _, _ := net.SplitHostPort(address)
+		address = net.JoinHostPort(host, strconv.Itoa(o.Port))
+	}
+
+	o.Server = address
+	if o.Protocol == "https" {
+		o.Server = "https://" + address + "/dns-query"
+	}
+	return o, nil
+}
+
+// newQuery returns a query message with the EDNS extensions of the options
+func (o QueryOptions) newQuery(name string, qtype uint16, recursive bool) *dnsMessage {
+	query := newDNSQuery(name, qtype, recursive)
+	if o.EDNS || o.DNSSEC || o.ClientSubnet != nil {
+		query.setEDNS(4096, o.DNSSEC, o.ClientSubnet)
+	}
+	return query
+}
+
+// queryRecords queries all record types of the domain from the server of the normalized options.
+// SERVFAIL responses count as failed queries and are retried. An error is returned only if every query failed.
+func queryRecords(ctx context.Context, domain string, recursive bool, options QueryOptions) (*DNSRecords, error) {
+	server := options.Server
+	records := &DNSRecords{
+		Domain: domain,
+		Server: server,
+	}
+	authenticated := options.DNSSEC
+	header := requestHeader(options.Headers, options.UserAgent)
+
+	query := func(name string, qtype uint16) (response *dnsMessage, err error) {
+		for attempt := 0; attempt <= options.Retries; attempt++ {
+			if attempt > 0 {
+				logger().Info("retrying DNS query", "server", server, "name", name, "type", qtype, "attempt", attempt, "error", err)
+			}
+			queryCtx, cancel := context.WithTimeout(ctx, options.Timeout)
+			response, err = dnsExchange(queryCtx, server, options.newQuery(name, qtype, recursive), options.Protocol, header, options.tlsVerification())
+			cancel()
+			// The truncated answer is used, MessageTruncated reports it's incomplete
+			var truncated *truncatedError
+			if errors.As(err, &truncated) {
+				response, err = truncated.response, nil
+			}
+			// SERVFAIL is often temporary, such as a timeout of the upstream server, and is retried
+			if err == nil && response.RCode == dnsRCodeServFail {
+				response, err = nil, fmt.Errorf("server failure (SERVFAIL) for %s", name)
+			}
+			if err == nil || ctx.Err() != nil {
+				break
+			}
+		}
+		if err == nil {
+			records.Authoritative = records.Authoritative || response.Authoritative
+			records.Recursive = records.Recursive || response.RecursionAvailable
+			records.MessageTruncated = records.MessageTruncated || response.Truncated
+			authenticated = authenticated && response.AuthenticData
+			if options.CaptureRaw {
+				if records.RawResponses == nil {
+					records.RawResponses = make(map[string][]byte)
+				}
+				records.RawResponses[dnsTypeName(qtype)] = append([]byte(nil), response.raw...)
+			}
+		}
+		return response, err
+	}
+
+	types := []uint16{dnsTypeA, dnsTypeAAAA, dnsTypeCNAME, dnsTypeMX, dnsTypeNS, dnsTypeTXT, dnsTypeSOA}
+	var lastErr error
+	failed := 0
+	for _, qtype := range types {
+		response, err := query(domain, qtype)
+		if err != nil {
+			lastErr = err
+			failed++
+			continue
+		}
+		records.add(response.Answers, qtype)
+	}
+	if failed == len(types) {
+		return nil, fmt.Errorf("failed to resolve %s using %s: %w", domain, server, lastErr)
+	}
+	records.Authenticated = authenticated
+
+	// Get PTR records if the input is an IP
+	if ip := net.ParseIP(domain); ip != nil {
+		if name, err := ArpaName(ip); err == nil {
+			if response, err := query(name, dnsTypePTR); err == nil {
+				records.add(response.Answers, dnsTypePTR)
+			}
+		}
+	}
+
+	records.limit(options.MaxResults)
+	return records, nil
+}
+
+// dnsPort is the port name servers found by ResolveAuthoritative are queried on, replaced in tests
+var dnsPort = "53"
+
+// lookupNS returns the NS records of a domain, replaced in tests
+var lookupNS = func(ctx context.Context, domain string) ([]*net.NS, error) {
+	resolver := &net.Resolver{
+		PreferGo: true,
+	}
+	return resolver.LookupNS(ctx, domain)
+}
+
+// ResolveAuthoritative finds the name servers of the domain (or of its closest parent zone) and queries
+// them directly without recursion, bypassing resolver caches. DNSRecords.Nameserver reports the name server
+// which answered, DNSRecords.Server its address. Name servers which don't answer authoritatively (lame delegations) are skipped.
+func ResolveAuthoritative(ctx context.Context, domain string) (*DNSRecords, error) {
+	if domain == "" {
+		return nil, fmt.Errorf("domain cannot be empty")
+	}
+	domain = cleanDomain(domain)
+
+	nameservers, err := zoneNameservers(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	for _, ns := range nameservers {
+		addrs, err := lookupIPAddr(ctx, ns)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", ns, err))
+			continue
+		}
+		for _, addr := range addrs {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+
+			server := net.JoinHostPort(addr.IP.String(), dnsPort)
+			records, err := queryRecords(ctx, domain, false, QueryOptions{
+				Server:   server,
+				Protocol: "udp",
+				Timeout:  5 * time.Second,
+			})
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", ns, err))
+				continue
+			}
+			if !records.Authoritative {
+				errs = append(errs, fmt.Errorf("%s: answer is not authoritative", ns))
+				continue
+			}
+			records.Nameserver = ns
+			return records, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no authoritative answer for %s: %w", domain, errors.Join(errs...))
+}
+
+// zoneNameservers returns the NS records of the domain, walking up to the parent zones if it has none
+func zoneNameservers(ctx context.Context, domain string) ([]string, error) {
+	labels := strings.Split(domain, ".")
+	for i := range labels {
+		zone := strings.Join(labels[i:], ".")
+		records, err := lookupNS(ctx, zone)
+		if err != nil || len(records) == 0 {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			continue
+		}
+
+		var nameservers []string
+		for _, ns := range records {
+			nameservers = append(nameservers, strings.TrimSuffix(ns.Host, "."))
+		}
+		return nameservers, nil
+	}
+	return nil, fmt.Errorf("no name servers found for %s", domain)
+}
+
+// NSConsistencyReport is the result of CheckNSConsistency
+type NSConsistencyReport struct {
+	Domain        string
+	Answers       []NSAnswer // Answer of every address of every name server
+	Consistent    bool       // All name servers answered authoritatively with the same serial and addresses
+	Discrepancies []string   // Differences and failures found, empty if Consistent
+}
+
+// NSAnswer is what a single name server address returned for the domain
+type NSAnswer struct {
+	Nameserver    string
+	Address       string
+	Authoritative bool
+	Serial        uint32   // SOA serial of the zone, 0 if not returned
+	A             []string // Sorted IPv4 addresses
+	AAAA          []string // Sorted IPv6 addresses
+	Error         string
+}
+
+// CheckNSConsistency resolves the name servers of the domain (or of its closest parent zone) and queries
+// every address of each of them directly for the A, AAAA and SOA records of the domain. Differing SOA
+// serials show replication lag between the servers, differing address sets a zone which is out of sync.
+// Name servers which fail or answer without authority are reported as discrepancies too.
+func CheckNSConsistency(ctx context.Context, domain string) (*NSConsistencyReport, error) {
+	if domain == "" {
+		return nil, fmt.Errorf("domain cannot be empty")
+	}
+	domain = cleanDomain(domain)
+
+	nameservers, err := zoneNameservers(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &NSConsistencyReport{Domain: domain}
+	for _, ns := range nameservers {
+		addrs, err := lookupIPAddr(ctx, ns)
+		if err != nil {
+			report.Answers = append(report.Answers, NSAnswer{Nameserver: ns, Error: err.Error()})
+			continue
+		}
+		for _, addr := range addrs {
+			report.Answers = append(report.Answers, NSAnswer{Nameserver: ns, Address: addr.IP.String()})
+		}
+	}
+
+	// The name servers are queried concurrently, each goroutine writes only its own answer
+	var wg sync.WaitGroup
+	for i := range report.Answers {
+		if report.Answers[i].Address == "" {
+			continue
+		}
+		wg.Add(1)
+		go func(answer *NSAnswer) {
+			defer wg.Done()
+			answer.query(ctx, domain)
+		}(&report.Answers[i])
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	report.compare()
+	report.Consistent = len(report.Discrepancies) == 0
+	return report, nil
+}
+
+// query fills the answer with the A, AAAA and SOA records the name server returns for the domain
+func (a *NSAnswer) query(ctx context.Context, domain string) {
+	server := net.JoinHostPort(a.Address, dnsPort)
+	a.Authoritative = true
+	for _, qtype := range []uint16{dnsTypeSOA, dnsTypeA, dnsTypeAAAA} {
+		queryCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		response, err := dnsExchange(queryCtx, server, newDNSQuery(domain, qtype, false), "udp", nil, tlsVerification{})
+		cancel()
+		if err != nil {
+			a.Error = err.Error()
+			return
+		}
+		if response.RCode != dnsRCodeSuccess && response.RCode != dnsRCodeNXDomain {
+			a.Error = fmt.Sprintf("rcode %d", response.RCode)
+			return
+		}
+		a.Authoritative = a.Authoritative && response.Authoritative
+
+		// The SOA is in the authority section if the domain is not the apex of the zone
+		for _, rr := range append(response.Answers, response.Authorities...) {
+			switch {
+			case rr.Type == dnsTypeSOA && rr.SOA != nil && qtype == dnsTypeSOA:
+				a.Serial = rr.SOA.Serial
+			case rr.Type == dnsTypeA && qtype == dnsTypeA:
+				a.A = append(a.A, rr.IP.String())
+			case rr.Type == dnsTypeAAAA && qtype == dnsTypeAAAA:
+				a.AAAA = append(a.AAAA, rr.IP.String())
+			}
+		}
+	}
+	sort.Strings(a.A)
+	sort.Strings(a.AAAA)
+}
+
+// compare records failed answers and the differences between the answers
+func (r *NSConsistencyReport) compare() {
+	var answered []NSAnswer
+	for _, answer := range r.Answers {
+		name := answer.Nameserver
+		if answer.Address != "" {
+			name += " (" + answer.Address + ")"
+		}
+		switch {
+		case answer.Error != "":
+			r.Discrepancies = append(r.Discrepancies, fmt.Sprintf("%s: %s", name, answer.Error))
+		case !answer.Authoritative:
+			r.Discrepancies = append(r.Discrepancies, fmt.Sprintf("%s: answer is not authoritative", name))
+		default:
+			answered = append(answered, answer)
+		}
+	}
+
+	differ := func(kind string, value func(NSAnswer) string) {
+		var values []string
+		byValue := make(map[string][]string)
+		for _, answer := range answered {
+			v := value(answer)
+			if _, ok := byValue[v]; !ok {
+				values = append(values, v)
+			}
+			byValue[v] = append(byValue[v], answer.Nameserver+" ("+answer.Address+")")
+		}
+		if len(values) < 2 {
+			return
+		}
+		parts := make([]string, len(values))
+		for i, v := range values {
+			parts[i] = fmt.Sprintf("%s from %s", v, strings.Join(byValue[v], ", "))
+		}
+		r.Discrepancies = append(r.Discrepancies, fmt.Sprintf("%s differ: %s", kind, strings.Join(parts, "; ")))
+	}
+	differ("SOA serials", func(a NSAnswer) string { return strconv.FormatUint(uint64(a.Serial), 10) })
+	differ("A records", func(a NSAnswer) string { return "[" + strings.Join(a.A, " ") + "]" })
+	differ("AAAA records", func(a NSAnswer) string { return "[" + strings.Join(a.AAAA, " ") + "]" })
+}
+
+// queryServer returns the address of a DNS server to query, the first system nameserver if server is empty
+func queryServer(server string) (string, error) {
+	if server == "" {
+		servers := systemNameservers()
+		if len(servers) == 0 {
+			return "", fmt.Errorf("no DNS server configured")
+		}
+		server = servers[0]
+	}
+	return serverAddress(server, "53"), nil
+}
+
+// soaSerial returns the SOA serial of the zone, replaced in tests
+var soaSerial = func(ctx context.Context, domain string) (uint32, error) {
+	return querySOASerial(ctx, "", domain)
+}
+
+// WatchSerial queries the SOA serial of the zone of the domain every interval and sends it to the returned channel
+// when it changed, so a full Resolve is only needed after the zone was updated. The initial serial is
+// sent first, an error is returned if it can't be queried. Failed polls are skipped. The channel is
+// closed when the context is done.
+func WatchSerial(ctx context.Context, domain string, interval time.Duration) (<-chan uint32, error) {
+	if domain == "" {
+		return nil, fmt.Errorf("domain cannot be empty")
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("invalid interval %v", interval)
+	}
+
+	domain = cleanDomain(domain)
+	serial, err := soaSerial(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	serials := make(chan uint32, 1)
+	serials <- serial
+	go func() {
+		defer close(serials)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+
+			current, err := soaSerial(ctx, domain)
+			if err != nil || current == serial {
+				continue
+			}
+			serial = current
+			select {
+			case serials <- serial:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return serials, nil
+}
+
+// querySOASerial queries the SOA record of the zone from the server (the first system nameserver if empty).
+// For a name below the zone apex the SOA of its zone is taken from the authority section.
+func querySOASerial(ctx context.Context, server, domain string) (uint32, error) {
+	address, err := queryServer(server)
+	if err != nil {
+		return 0, err
+	}
+
+	queryCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	response, err := dnsExchange(queryCtx, address, newDNSQuery(domain, dnsTypeSOA, true), "udp", nil, tlsVerification{})
+	if err != nil {
+		return 0, fmt.Errorf("failed to query SOA of %s using %s: %w", domain, address, err)
+	}
+	if response.RCode != dnsRCodeSuccess {
+		return 0, fmt.Errorf("failed to query SOA of %s using %s: rcode %d", domain, address, response.RCode)
+	}
+	for _, rr := range append(response.Answers, response.Authorities...) {
+		if rr.Type == dnsTypeSOA && rr.SOA != nil {
+			return rr.SOA.Serial, nil
+		}
+	}
+	return 0, fmt.Errorf("%s has no SOA record", domain)
+}
+
+// ResolverBench is the benchmark result of a DNS server
+type ResolverBench struct {
+	Server      string
+	AvgLatency  time.Duration // Average latency of the successful queries
+	SuccessRate float64       // Percentage of queries answered with NOERROR or NXDOMAIN
+}
+
+// BenchmarkResolvers queries the A record of the domain rounds times on each server and returns
+// the results sorted by success rate and latency, fastest first
+func BenchmarkResolvers(ctx context.Context, domain string, servers []string, rounds int) ([]ResolverBench, error) {
+	if domain == "" {
+		return nil, fmt.Errorf("domain cannot be empty")
+	}
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("no DNS servers to benchmark")
+	}
+	if rounds <= 0 {
+		rounds = 3
+	}
+	domain = cleanDomain(domain)
+
+	var results []ResolverBench
+	for _, server := range servers {
+		address, err := queryServer(server)
+		if err != nil {
+			return nil, err
+		}
+
+		var total time.Duration
+		succeeded := 0
+		for i := 0; i < rounds; i++ {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+
+			queryCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			start := time.Now()
+			response, err := dnsExchange(queryCtx, address, newDNSQuery(domain, dnsTypeA, true), "udp", nil, tlsVerification{})
+			latency := time.Since(start)
+			cancel()
+
+			if err != nil || (response.RCode != dnsRCodeSuccess && response.RCode != dnsRCodeNXDomain) {
+				continue
+			}
+			succeeded++
+			total += latency
+		}
+
+		bench := ResolverBench{
+			Server:      server,
+			SuccessRate: float64(succeeded) / float64(rounds) * 100,
+		}
+		if succeeded > 0 {
+			bench.AvgLatency = total / time.Duration(succeeded)
+		}
+		results = append(results, bench)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].SuccessRate != results[j].SuccessRate {
+			return results[i].SuccessRate > results[j].SuccessRate
+		}
+		return results[i].AvgLatency < results[j].AvgLatency
+	})
+	return results, nil
+}
+
+// add stores the answer records of the requested type
+func (r *DNSRecords) add(answers []dnsRR, qtype uint16) {
+	for _, rr := range answers {
+		if rr.Type != qtype && qtype != dnsTypeANY {
+			continue
+		}
+		switch rr.Type {
+		case dnsTypeA:
+			r.A = append(r.A, rr.IP.String())
+		case dnsTypeAAAA:
+			r.AAAA = append(r.AAAA, rr.IP.String())
+		case dnsTypeCNAME:
+			r.CNAME = append(r.CNAME, rr.Target)
+		case dnsTypeMX:
+			r.MX = append(r.MX, MXRecord{Host: rr.Target, Priority: rr.Pref})
+		case dnsTypeNS:
+			r.NS = append(r.NS, rr.Target)
+		case dnsTypeTXT:
+			r.TXT = append(r.TXT, strings.Join(rr.Text, ""))
+		case dnsTypeSOA:
+			r.SOA = rr.SOA
+		case dnsTypePTR:
+			r.PTR = append(r.PTR, rr.Target)
+		case dnsTypeHINFO:
+			r.HINFO = append(r.HINFO, strings.Join(rr.Text, " "))
+		}
+	}
+}
+
+// ResolveANY sends a single ANY query for the domain to the server (the first system nameserver if empty)
+// and returns whatever records it answers with. Many servers refuse ANY queries as permitted by RFC 8482
+// and answer with a synthesized HINFO record instead, see ANYRefused. WithMaxResults and WithCaptureRaw
+// are honored.
+func ResolveANY(ctx context.Context, domain, server string, opts ...Option) (*DNSRecords, error) {
+	if domain == "" {
+		return nil, fmt.Errorf("domain cannot be empty")
+	}
+
+	address, err := queryServer(server)
+	if err != nil {
+		return nil, err
+	}
+
+	domain = cleanDomain(domain)
+	queryCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	response, err := dnsExchange(queryCtx, address, newDNSQuery(domain, dnsTypeANY, true), "udp", nil, tlsVerification{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s using %s: %w", domain, address, err)
+	}
+	if response.RCode != dnsRCodeSuccess && response.RCode != dnsRCodeNXDomain {
+		return nil, fmt.Errorf("failed to resolve %s using %s: rcode %d", domain, address, response.RCode)
+	}
+
+	records := &DNSRecords{
+		Domain:           domain,
+		Server:           address,
+		Authoritative:    response.Authoritative,
+		Recursive:        response.RecursionAvailable,
+		MessageTruncated: response.Truncated,
+	}
+	records.add(response.Answers, dnsTypeANY)
+	records.dedupe()
+
+	options := applyOptions(opts)
+	records.limit(options.maxResults)
+	if options.captureRaw {
+		records.RawResponses = map[string][]byte{dnsTypeName(dnsTypeANY): append([]byte(nil), response.raw...)}
+	}
+	return records, nil
+}
+
+// ANYRefused reports whether the records are the minimal answer of a server refusing ANY queries (RFC 8482)
+func (r *DNSRecords) ANYRefused() bool {
+	for _, hinfo := range r.HINFO {
+		if strings.HasPrefix(hinfo, "RFC8482") {
+			return true
+		}
+	}
+	return false
+}
+
+// dedupe removes duplicate values of every record type
+func (r *DNSRecords) dedupe() {
+	r.A = uniqueStrings(r.A)
+	r.AAAA = uniqueStrings(r.AAAA)
+	r.CNAME = uniqueStrings(r.CNAME)
+	r.NS = uniqueStrings(r.NS)
+	r.TXT = uniqueStrings(r.TXT)
+	r.PTR = uniqueStrings(r.PTR)
+	r.HINFO = uniqueStrings(r.HINFO)
+
+	seen := make(map[MXRecord]bool)
+	var mx []MXRecord
+	for _, record := range r.MX {
+		if !seen[record] {
+			seen[record] = true
+			mx = append(mx, record)
+		}
+	}
+	r.MX = mx
+}
+
+// limit cuts every record set to at most n entries and sets Truncated if records were dropped.
+// n <= 0 keeps all records.
+func (r *DNSRecords) limit(n int) {
+	if n <= 0 {
+		return
+	}
+	for _, set := range []*[]string{&r.A, &r.AAAA, &r.CNAME, &r.NS, &r.TXT, &r.PTR, &r.HINFO} {
+		if len(*set) > n {
+			*set = (*set)[:n]
+			r.Truncated = true
+		}
+	}
+	if len(r.MX) > n {
+		r.MX = r.MX[:n]
+		r.Truncated = true
+	}
+}
+
+// ArpaName returns the reverse lookup name of an IP address, the query name of its PTR record, such as
+// "1.1.168.192.in-addr.arpa." or "...8.b.d.0.1.0.0.2.ip6.arpa." with 32 nibbles for IPv6
+func ArpaName(ip net.IP) (string, error) {
+	if v4 := ip.To4(); v4 != nil {
+		return fmt.Sprintf("%d.%d.%d.%d.in-addr.arpa.", v4[3], v4[2], v4[1], v4[0]), nil
+	}
+	if len(ip) != net.IPv6len {
+		return "", fmt.Errorf("invalid IP address: %v", ip)
+	}
+
+	const hexDigits = "0123456789abcdef"
+	var name strings.Builder
+	for i := len(ip) - 1; i >= 0; i-- {
+		name.WriteByte(hexDigits[ip[i]&0xf])
+		name.WriteByte('.')
+		name.WriteByte(hexDigits[ip[i]>>4])
+		name.WriteByte('.')
+	}
+	name.WriteString("ip6.arpa.")
+	return name.String(), nil
+}
+
+// truncatedError is returned by dnsExchange when the TCP retry of a truncated UDP response failed,
+// it holds the truncated response
+type truncatedError struct {
+	response *dnsMessage
+	err      error
+}
+
+func (e *truncatedError) Error() string {
+	return fmt.Sprintf("response truncated and TCP retry failed: %v", e.err)
+}
+
+func (e *truncatedError) Unwrap() error {
+	return e.err
+}
+
+// dnsExchange sends a query to the server using the protocol ("udp", "tcp", "tls" or "https")
+// and returns its response. UDP responses with the truncated bit set are retried over TCP, a
+// *truncatedError holding the truncated response is returned if that fails. The header is only
+// sent with DoH requests.
+func dnsExchange(ctx context.Context, server string, query *dnsMessage, protocol string, header http.Header, verify tlsVerification) (*dnsMessage, error) {
+	// DoH queries use ID 0 to be cache friendly (RFC 8484)
+	query.ID = 0
+	if protocol != "https" {
+		id := make([]byte, 2)
+		if _, err := rand.Read(id); err != nil {
+			return nil, err
+		}
+		query.ID = binary.BigEndian.Uint16(id)
+	}
+
+	packed, err := query.pack()
+	if err != nil {
+		return nil, err
+	}
+
+	switch protocol {
+	case "tcp":
+		return dnsExchangeTCP(ctx, server, query.ID, packed)
+	case "tls":
+		return dnsExchangeTLS(ctx, server, query.ID, packed, verify)
+	case "https":
+		return dnsExchangeHTTPS(ctx, server, query.ID, packed, header)
+	}
+
+	response, err := dnsExchangeUDP(ctx, server, query.ID, packed)
+	if err != nil || !response.Truncated {
+		return response, err
+	}
+	logger().Info("DNS response truncated, retrying over TCP", "server", server)
+	tcpResponse, err := dnsExchangeTCP(ctx, server, query.ID, packed)
+	if err != nil {
+		return nil, &truncatedError{response: response, err: err}
+	}
+	return tcpResponse, nil
+}
+
+// dnsExchangeUDP sends a packed query over UDP
+func dnsExchangeUDP(ctx context.Context, server string, id uint16, packed []byte) (*dnsMessage, error) {
+	dialer := net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "udp", server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if _, err := conn.Write(packed); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 65535)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		response, err := unpackDNSMessage(buf[:n])
+		if err != nil || response.ID != id || !response.Response {
+			// Ignore malformed or unrelated packets
+			continue
+		}
+		return response, nil
+	}
+}
+
+// dnsExchangeTCP sends a packed query over TCP using the 2-byte length prefix framing
+func dnsExchangeTCP(ctx context.Context, server string, id uint16, packed []byte) (*dnsMessage, error) {
+	dialer := net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return dnsExchangeStream(ctx, conn, id, packed)
+}
+
+// dnsTLSConfig returns the TLS configuration of DNS over TLS connections, replaced in tests
+var dnsTLSConfig = func(serverName string) *tls.Config {
+	return &tls.Config{ServerName: serverName}
+}
+
+// tlsVerification configures how the certificate of a DNS over TLS server is verified, the zero value
+// verifies it against the roots of dnsTLSConfig
+type tlsVerification struct {
+	pins     []string
+	insecure bool
+}
+
+// tlsVerification returns the certificate verification of the options
+func (o QueryOptions) tlsVerification() tlsVerification {
+	return tlsVerification{pins: o.TLSPins, insecure: o.TLSInsecureSkipVerify}
+}
+
+// apply changes the TLS configuration to skip the verification or to check the pins
+func (v tlsVerification) apply(config *tls.Config) *tls.Config {
+	if len(v.pins) == 0 && !v.insecure {
+		return config
+	}
+	config = config.Clone()
+	config.InsecureSkipVerify = true
+	if len(v.pins) == 0 {
+		return config
+	}
+	config.VerifyConnection = func(state tls.ConnectionState) error {
+		for _, cert := range state.PeerCertificates {
+			hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+			pin := base64.StdEncoding.EncodeToString(hash[:])
+			for _, want := range v.pins {
+				if pin == want {
+					return nil
+				}
+			}
+		}
+		return fmt.Errorf("server certificate doesn't match the TLS pins")
+	}
+	return config
+}
+
+// dnsExchangeTLS sends a packed query over TLS (RFC 7858)
+func dnsExchangeTLS(ctx context.Context, server string, id uint16, packed []byte, verify tlsVerification) (*dnsMessage, error) {
+	host, _, err := net.SplitHostPort(server)
+	if err != nil {
+		return nil, err
+	}
+	dialer := tls.Dialer{Config: verify.apply(dnsTLSConfig(host))}
+	conn, err := dialer.DialContext(ctx, "tcp", server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return dnsExchangeStream(ctx, conn, id, packed)
+}
+
+// dohClient is the HTTP client of DNS over HTTPS queries, replaced in tests
+var dohClient = &http.Client{}
+
+// dnsExchangeHTTPS posts a packed query to a DoH server URL (RFC 8484)
+func dnsExchangeHTTPS(ctx context.Context, server string, id uint16, packed []byte, header http.Header) (*dnsMessage, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, server, bytes.NewReader(packed))
+	if err != nil {
+		return nil, err
+	}
+	if header != nil {
+		request.Header = header.Clone()
+	}
+	request.Header.Set("Content-Type", "application/dns-message")
+	request.Header.Set("Accept", "application/dns-message")
+
+	resp, err := dohClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DoH server returned %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 65535))
+	if err != nil {
+		return nil, err
+	}
+	response, err := unpackDNSMessage(body)
+	if err != nil {
+		return nil, err
+	}
+	if response.ID != id || !response.Response {
+		return nil, fmt.Errorf("unexpected dns response id %d", response.ID)
+	}
+	return response, nil
+}
+
+// dnsExchangeStream sends a packed query over a stream connection (TCP or TLS)
+func dnsExchangeStream(ctx context.Context, conn net.Conn, id uint16, packed []byte) (*dnsMessage, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	frame := binary.BigEndian.AppendUint16(nil, uint16(len(packed)))
+	if _, err := conn.Write(append(frame, packed...)); err != nil {
+		return nil, err
+	}
+
+	length := make([]byte, 2)
+	if _, err := io.ReadFull(conn, length); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, binary.BigEndian.Uint16(length))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return nil, err
+	}
+
+	response, err := unpackDNSMessage(buf)
+	if err != nil {
+		return nil, err
+	}
+	if response.ID != id || !response.Response {
+		return nil, fmt.Errorf("unexpected dns response id %d", response.ID)
+	}
+	return response, nil
+}
+
+// systemNameservers returns the nameservers configured in /etc/resolv.conf
+func systemNameservers() []string {
+	data, err := os.ReadFile("/etc/resolv.conf")
+	if err != nil {
+		return nil
+	}
+
+	var servers []string
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			servers = append(servers, fields[1])
+		}
+	}
+	return servers
+}
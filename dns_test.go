@@ -1,7 +1,20 @@
 package network
 
 import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -220,4 +233,1416 @@ func TestNSLookupConcurrent(t *testing.T) {
 			t.Error("Concurrent NSLookup timed out")
 		}
 	}
-}
\ No newline at end of file
+}
+
+func TestNSLookupFallback(t *testing.T) {
+	if _, err := NSLookupFallback(context.Background(), "", nil); err == nil {
+		t.Error("NSLookupFallback() expected error for empty domain")
+	}
+
+	// Both servers refuse the connection, so the errors of each should be reported
+	servers := []string{"127.0.0.1:1", "127.0.0.1:2"}
+	_, err := NSLookupFallback(context.Background(), "example.com", servers)
+	if err == nil {
+		t.Fatal("NSLookupFallback() expected error when all servers fail")
+	}
+	for _, server := range servers {
+		if !strings.Contains(err.Error(), server) {
+			t.Errorf("NSLookupFallback() error should mention %s, got %v", server, err)
+		}
+	}
+}
+
+func TestServerAddress(t *testing.T) {
+	tests := map[string]string{
+		"1.1.1.1":       "1.1.1.1:53",
+		"1.1.1.1:5353":  "1.1.1.1:5353",
+		"2001:db8::1":   "[2001:db8::1]:53",
+		"[2001:db8::1]": "[2001:db8::1]:53",
+		"[::1]:5353":    "[::1]:5353",
+		"dns.google":    "dns.google:53",
+	}
+	for input, want := range tests {
+		if got := serverAddress(input, "53"); got != want {
+			t.Errorf("serverAddress(%s) = %s, want %s", input, got, want)
+		}
+	}
+}
+
+func TestReverseLookupRange(t *testing.T) {
+	if _, err := ReverseLookupRange(context.Background(), "invalid", 4); err == nil {
+		t.Error("ReverseLookupRange() expected error for invalid CIDR")
+	}
+	if _, err := ReverseLookupRange(context.Background(), "10.0.0.0/8", 4); err == nil {
+		t.Error("ReverseLookupRange() expected error for oversized range")
+	}
+
+	// 127.0.0.1 is normally mapped to localhost in the hosts file
+	results, err := ReverseLookupRange(context.Background(), "127.0.0.1/32", 4)
+	if err != nil {
+		t.Fatalf("ReverseLookupRange() error = %v", err)
+	}
+	if len(results) == 0 {
+		t.Skip("no PTR for 127.0.0.1 in this environment")
+	}
+	if len(results["127.0.0.1"]) == 0 {
+		t.Errorf("ReverseLookupRange() missing names for 127.0.0.1: %v", results)
+	}
+}
+
+func TestResolveWithTCPFallback(t *testing.T) {
+	const txtCount = 60
+	var udpQueries int32
+
+	server := startTestDNSServer(t, func(query *dnsMessage, tcp bool) *dnsMessage {
+		if !tcp {
+			atomic.AddInt32(&udpQueries, 1)
+		}
+		q := query.Questions[0]
+		response := &dnsMessage{}
+		switch q.Type {
+		case dnsTypeA:
+			response.Answers = []dnsRR{{Name: q.Name, Type: dnsTypeA, Class: dnsClassINET, IP: net.ParseIP("192.0.2.1")}}
+		case dnsTypeTXT:
+			// The TXT set does not fit in a UDP response
+			if !tcp {
+				response.Truncated = true
+				return response
+			}
+			for i := 0; i < txtCount; i++ {
+				text := fmt.Sprintf("record-%02d-%s", i, strings.Repeat("x", 200))
+				response.Answers = append(response.Answers, dnsRR{Name: q.Name, Type: dnsTypeTXT, Class: dnsClassINET, Text: []string{text}})
+			}
+		}
+		return response
+	})
+
+	for _, useTCP := range []bool{false, true} {
+		atomic.StoreInt32(&udpQueries, 0)
+		records, err := ResolveWith(context.Background(), "many-txt.example.com", &ResolveOptions{Server: server, UseTCP: useTCP})
+		if err != nil {
+			t.Fatalf("ResolveWith(UseTCP=%v) error = %v", useTCP, err)
+		}
+		if len(records.TXT) != txtCount {
+			t.Errorf("ResolveWith(UseTCP=%v) returned %d TXT records, want %d", useTCP, len(records.TXT), txtCount)
+		}
+		if len(records.A) != 1 || records.A[0] != "192.0.2.1" {
+			t.Errorf("ResolveWith(UseTCP=%v) A = %v, want [192.0.2.1]", useTCP, records.A)
+		}
+		if useTCP && atomic.LoadInt32(&udpQueries) != 0 {
+			t.Errorf("ResolveWith(UseTCP=true) sent %d UDP queries", udpQueries)
+		}
+	}
+}
+
+func TestResolveWithUnreachableServer(t *testing.T) {
+	_, err := ResolveWith(context.Background(), "example.com", &ResolveOptions{Server: "127.0.0.1:1", Timeout: time.Second})
+	if err == nil {
+		t.Error("ResolveWith() expected error for unreachable server")
+	}
+}
+
+func TestResolveWithManyTXTRecords(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping external network test in short mode")
+	}
+
+	// google.com publishes a TXT set larger than a classic 512 byte UDP response
+	records, err := ResolveWith(context.Background(), "google.com", &ResolveOptions{Server: "8.8.8.8", UseTCP: true})
+	if err != nil {
+		t.Skipf("DNS server not reachable: %v", err)
+	}
+	if len(records.TXT) < 5 {
+		t.Errorf("ResolveWith() returned %d TXT records, expected a large set", len(records.TXT))
+	}
+}
+
+func TestResolveRequire(t *testing.T) {
+	if _, err := ResolveRequire(context.Background(), "localhost", []string{"BOGUS"}); err == nil {
+		t.Error("ResolveRequire() expected error for unsupported record type")
+	}
+
+	// localhost is answered from the hosts file
+	records, err := ResolveRequire(context.Background(), "localhost", []string{"a"})
+	if err != nil {
+		t.Fatalf("ResolveRequire() error = %v", err)
+	}
+	if len(records.A) == 0 {
+		t.Error("ResolveRequire() returned no A records for localhost")
+	}
+
+	records, err = ResolveRequire(context.Background(), "localhost", []string{"A", "MX"})
+	if err == nil {
+		t.Error("ResolveRequire() expected error when MX records are missing")
+	} else if !strings.Contains(err.Error(), "MX") {
+		t.Errorf("ResolveRequire() error should name the missing type, got %v", err)
+	}
+	if records == nil {
+		t.Error("ResolveRequire() should return the records along with the error")
+	}
+}
+
+func TestDNSRecordsCount(t *testing.T) {
+	records := &DNSRecords{
+		A:   []string{"192.0.2.1", "192.0.2.2"},
+		MX:  []MXRecord{{Host: "mail.example.com", Priority: 10}},
+		SOA: &SOARecord{NS: "ns1.example.com"},
+	}
+	for recordType, want := range map[string]int{"A": 2, "mx": 1, "SOA": 1, "TXT": 0} {
+		if got, err := records.Count(recordType); err != nil || got != want {
+			t.Errorf("Count(%s) = %d, %v, want %d", recordType, got, err, want)
+		}
+	}
+}
+
+func TestDetectWildcard(t *testing.T) {
+	original := lookupIPAddr
+	defer func() { lookupIPAddr = original }()
+
+	var mu sync.Mutex
+	lookups := 0
+
+	lookupIPAddr = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		switch {
+		case strings.HasSuffix(host, ".wildcard.example.com"):
+			return []net.IPAddr{{IP: net.ParseIP("192.0.2.10")}}, nil
+		case strings.HasSuffix(host, ".rotating.example.com"):
+			// Round-robin order of the same set of addresses
+			mu.Lock()
+			defer mu.Unlock()
+			lookups++
+			if lookups%2 == 0 {
+				return []net.IPAddr{{IP: net.ParseIP("192.0.2.21")}, {IP: net.ParseIP("192.0.2.20")}}, nil
+			}
+			return []net.IPAddr{{IP: net.ParseIP("192.0.2.20")}, {IP: net.ParseIP("192.0.2.21")}}, nil
+		case strings.HasSuffix(host, ".varying.example.com"):
+			// Every name has its own address, such as a service creating records on demand
+			mu.Lock()
+			defer mu.Unlock()
+			lookups++
+			return []net.IPAddr{{IP: net.IPv4(192, 0, 2, byte(lookups))}}, nil
+		case strings.HasSuffix(host, ".broken.example.com"):
+			return nil, &net.DNSError{Err: "server misbehaving", Name: host, IsTemporary: true}
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+
+	wildcard, ips, err := DetectWildcard(context.Background(), "wildcard.example.com")
+	if err != nil || !wildcard || len(ips) != 1 || ips[0] != "192.0.2.10" {
+		t.Errorf("DetectWildcard(wildcard) = %v, %v, %v", wildcard, ips, err)
+	}
+
+	wildcard, ips, err = DetectWildcard(context.Background(), "rotating.example.com")
+	if err != nil || !wildcard || strings.Join(ips, ",") != "192.0.2.20,192.0.2.21" {
+		t.Errorf("DetectWildcard(rotating) = %v, %v, %v", wildcard, ips, err)
+	}
+
+	wildcard, ips, err = DetectWildcard(context.Background(), "varying.example.com")
+	if err != nil || wildcard || ips != nil {
+		t.Errorf("DetectWildcard(varying) = %v, %v, %v, want no wildcard for differing addresses", wildcard, ips, err)
+	}
+
+	wildcard, ips, err = DetectWildcard(context.Background(), "example.com")
+	if err != nil || wildcard || ips != nil {
+		t.Errorf("DetectWildcard(example.com) = %v, %v, %v", wildcard, ips, err)
+	}
+
+	if _, _, err := DetectWildcard(context.Background(), "broken.example.com"); err == nil {
+		t.Error("DetectWildcard() expected error when the resolver fails")
+	}
+}
+
+func TestEnumerateSubdomains(t *testing.T) {
+	original := lookupIPAddr
+	defer func() { lookupIPAddr = original }()
+
+	records := map[string]string{
+		"www.example.com":  "192.0.2.1",
+		"mail.example.com": "192.0.2.2",
+		"www.wild.example": "192.0.2.50",
+		"api.wild.example": "192.0.2.60",
+	}
+	lookupIPAddr = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		if ip, ok := records[host]; ok {
+			return []net.IPAddr{{IP: net.ParseIP(ip)}}, nil
+		}
+		if strings.HasSuffix(host, ".wild.example") {
+			return []net.IPAddr{{IP: net.ParseIP("192.0.2.50")}}, nil
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+
+	words := []string{"www", "mail", "ftp", "", "api"}
+
+	results, err := EnumerateSubdomains(context.Background(), "example.com", words, 2)
+	if err != nil {
+		t.Fatalf("EnumerateSubdomains() error = %v", err)
+	}
+	if len(results) != 2 || results["www.example.com"][0] != "192.0.2.1" || results["mail.example.com"][0] != "192.0.2.2" {
+		t.Errorf("EnumerateSubdomains(example.com) = %v", results)
+	}
+
+	// Subdomains resolving to the wildcard address are filtered out
+	results, err = EnumerateSubdomains(context.Background(), "wild.example", words, 2)
+	if err != nil {
+		t.Fatalf("EnumerateSubdomains() error = %v", err)
+	}
+	if len(results) != 1 || results["api.wild.example"] == nil {
+		t.Errorf("EnumerateSubdomains(wild.example) = %v, want only api.wild.example", results)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := EnumerateSubdomains(ctx, "example.com", words, 2); err == nil {
+		t.Error("EnumerateSubdomains() expected error for cancelled context")
+	}
+}
+
+func TestBenchmarkResolvers(t *testing.T) {
+	answer := func(query *dnsMessage, tcp bool) *dnsMessage {
+		q := query.Questions[0]
+		return &dnsMessage{Answers: []dnsRR{{Name: q.Name, Type: dnsTypeA, Class: dnsClassINET, IP: net.ParseIP("192.0.2.1")}}}
+	}
+	slow := startTestDNSServer(t, func(query *dnsMessage, tcp bool) *dnsMessage {
+		time.Sleep(20 * time.Millisecond)
+		return answer(query, tcp)
+	})
+	fast := startTestDNSServer(t, answer)
+	failing := startTestDNSServer(t, func(query *dnsMessage, tcp bool) *dnsMessage {
+		response := &dnsMessage{}
+		response.RCode = dnsRCodeServFail
+		return response
+	})
+
+	results, err := BenchmarkResolvers(context.Background(), "example.com", []string{failing, slow, fast}, 3)
+	if err != nil {
+		t.Fatalf("BenchmarkResolvers() error = %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("BenchmarkResolvers() returned %d results", len(results))
+	}
+
+	if results[0].Server != fast || results[1].Server != slow || results[2].Server != failing {
+		t.Errorf("BenchmarkResolvers() order = %+v", results)
+	}
+	if results[0].SuccessRate != 100 || results[0].AvgLatency <= 0 {
+		t.Errorf("fast server = %+v", results[0])
+	}
+	if results[1].AvgLatency < 20*time.Millisecond {
+		t.Errorf("slow server latency = %v", results[1].AvgLatency)
+	}
+	if results[2].SuccessRate != 0 || results[2].AvgLatency != 0 {
+		t.Errorf("failing server = %+v", results[2])
+	}
+
+	if _, err := BenchmarkResolvers(context.Background(), "example.com", nil, 1); err == nil {
+		t.Error("expected error without servers")
+	}
+}
+
+func TestResolveANY(t *testing.T) {
+	server := startTestDNSServer(t, func(query *dnsMessage, tcp bool) *dnsMessage {
+		q := query.Questions[0]
+		if q.Type != dnsTypeANY {
+			t.Errorf("query type = %d, want ANY", q.Type)
+		}
+		return &dnsMessage{Answers: []dnsRR{
+			{Name: q.Name, Type: dnsTypeA, Class: dnsClassINET, IP: net.ParseIP("192.0.2.1")},
+			{Name: q.Name, Type: dnsTypeA, Class: dnsClassINET, IP: net.ParseIP("192.0.2.1")},
+			{Name: q.Name, Type: dnsTypeAAAA, Class: dnsClassINET, IP: net.ParseIP("2001:db8::1")},
+			{Name: q.Name, Type: dnsTypeMX, Class: dnsClassINET, Pref: 10, Target: "mail.example.com"},
+			{Name: q.Name, Type: dnsTypeMX, Class: dnsClassINET, Pref: 10, Target: "mail.example.com"},
+			{Name: q.Name, Type: dnsTypeTXT, Class: dnsClassINET, Text: []string{"v=spf1 -all"}},
+		}}
+	})
+
+	records, err := ResolveANY(context.Background(), "example.com", server)
+	if err != nil {
+		t.Fatalf("ResolveANY() error = %v", err)
+	}
+	if len(records.A) != 1 || len(records.AAAA) != 1 || len(records.MX) != 1 || len(records.TXT) != 1 {
+		t.Errorf("ResolveANY() = %+v", records)
+	}
+	if records.ANYRefused() {
+		t.Error("ANYRefused() = true for full answer")
+	}
+	if records.RawResponses != nil {
+		t.Errorf("RawResponses = %v without WithCaptureRaw", records.RawResponses)
+	}
+
+	records, err = ResolveANY(context.Background(), "example.com", server, WithCaptureRaw())
+	if err != nil {
+		t.Fatalf("ResolveANY(WithCaptureRaw) error = %v", err)
+	}
+	raw, err := unpackDNSMessage(records.RawResponses["ANY"])
+	if err != nil || len(raw.Answers) != 6 {
+		t.Errorf("RawResponses[ANY] = %v, %v", raw, err)
+	}
+}
+
+func TestResolveANYRefused(t *testing.T) {
+	server := startTestDNSServer(t, func(query *dnsMessage, tcp bool) *dnsMessage {
+		q := query.Questions[0]
+		return &dnsMessage{Answers: []dnsRR{
+			{Name: q.Name, Type: dnsTypeHINFO, Class: dnsClassINET, Text: []string{"RFC8482", ""}},
+		}}
+	})
+
+	records, err := ResolveANY(context.Background(), "example.com", server)
+	if err != nil {
+		t.Fatalf("ResolveANY() error = %v", err)
+	}
+	if !records.ANYRefused() {
+		t.Errorf("ANYRefused() = false, HINFO = %v", records.HINFO)
+	}
+	if n, _ := records.Count("HINFO"); n != 1 {
+		t.Errorf("Count(HINFO) = %d, want 1", n)
+	}
+}
+
+func TestResolveContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Now()
+	_, err := ResolveContext(ctx, "example.com")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("ResolveContext() error = %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("ResolveContext() took %v after cancel", elapsed)
+	}
+
+	start = time.Now()
+	if soa := lookupSOA(ctx, systemResolver(), "example.com"); soa != nil {
+		t.Errorf("lookupSOA() = %+v, want nil", soa)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("lookupSOA() took %v after cancel", elapsed)
+	}
+}
+
+func TestResolveAuthoritative(t *testing.T) {
+	originalNS, originalIP, originalPort := lookupNS, lookupIPAddr, dnsPort
+	defer func() { lookupNS, lookupIPAddr, dnsPort = originalNS, originalIP, originalPort }()
+
+	var recursiveQueries int32
+	authoritative := int32(1)
+	server := startTestDNSServer(t, func(query *dnsMessage, tcp bool) *dnsMessage {
+		if query.RecursionDesired {
+			atomic.AddInt32(&recursiveQueries, 1)
+		}
+		q := query.Questions[0]
+		response := &dnsMessage{}
+		response.Authoritative = atomic.LoadInt32(&authoritative) == 1
+		if q.Type == dnsTypeA {
+			response.Answers = []dnsRR{{Name: q.Name, Type: dnsTypeA, Class: dnsClassINET, IP: net.ParseIP("192.0.2.10")}}
+		}
+		return response
+	})
+	_, port, _ := net.SplitHostPort(server)
+	dnsPort = port
+
+	var nsQueries []string
+	lookupNS = func(ctx context.Context, domain string) ([]*net.NS, error) {
+		nsQueries = append(nsQueries, domain)
+		if domain == "example.com" {
+			return []*net.NS{{Host: "ns1.example.com."}}, nil
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: domain, IsNotFound: true}
+	}
+	lookupIPAddr = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		if host != "ns1.example.com" {
+			t.Errorf("lookupIPAddr(%q), want ns1.example.com", host)
+		}
+		return []net.IPAddr{{IP: net.ParseIP("127.0.0.1")}}, nil
+	}
+
+	records, err := ResolveAuthoritative(context.Background(), "www.example.com")
+	if err != nil {
+		t.Fatalf("ResolveAuthoritative() error = %v", err)
+	}
+	if records.Nameserver != "ns1.example.com" || records.Server != server {
+		t.Errorf("Nameserver = %q, Server = %q, want ns1.example.com and %s", records.Nameserver, records.Server, server)
+	}
+	if len(records.A) != 1 || records.A[0] != "192.0.2.10" {
+		t.Errorf("A = %v", records.A)
+	}
+	if strings.Join(nsQueries, ",") != "www.example.com,example.com" {
+		t.Errorf("NS lookups = %v", nsQueries)
+	}
+	if n := atomic.LoadInt32(&recursiveQueries); n != 0 {
+		t.Errorf("%d queries had recursion desired set", n)
+	}
+
+	// Lame delegation
+	atomic.StoreInt32(&authoritative, 0)
+	if _, err := ResolveAuthoritative(context.Background(), "www.example.com"); err == nil {
+		t.Error("expected error for non-authoritative answers")
+	}
+}
+
+// startSlowDNSServer starts a DNS server answering every query after the delay and points Resolve to it
+func startSlowDNSServer(tb testing.TB, delay time.Duration) {
+	server := startTestDNSServer(tb, func(query *dnsMessage, tcp bool) *dnsMessage {
+		time.Sleep(delay)
+		q := query.Questions[0]
+		response := &dnsMessage{}
+		rr := dnsRR{Name: q.Name, Type: q.Type, Class: dnsClassINET}
+		switch q.Type {
+		case dnsTypeA:
+			rr.IP = net.ParseIP("192.0.2.1")
+		case dnsTypeAAAA:
+			rr.IP = net.ParseIP("2001:db8::1")
+		case dnsTypeMX:
+			rr.Pref, rr.Target = 10, "mail.example.com"
+		case dnsTypeNS:
+			rr.Target = "ns1.example.com"
+		case dnsTypeTXT:
+			rr.Text = []string{"v=spf1 -all"}
+		default:
+			return response
+		}
+		response.Answers = []dnsRR{rr}
+		return response
+	})
+
+	original := systemResolver
+	systemResolver = func() *net.Resolver { return newResolver(server) }
+	tb.Cleanup(func() { systemResolver = original })
+}
+
+func TestResolveContextConcurrent(t *testing.T) {
+	const delay = 100 * time.Millisecond
+	startSlowDNSServer(t, delay)
+
+	start := time.Now()
+	records, err := ResolveContext(context.Background(), "example.com")
+	if err != nil {
+		t.Fatalf("ResolveContext() error = %v", err)
+	}
+	// Sequential lookups take at least 6 times the delay
+	if elapsed := time.Since(start); elapsed > 4*delay {
+		t.Errorf("ResolveContext() took %v, lookups don't run concurrently", elapsed)
+	}
+
+	want := "DNS Records for example.com:"
+	if got := records.String(); !strings.HasPrefix(got, want) {
+		t.Errorf("String() = %q", got)
+	}
+	if len(records.A) != 1 || len(records.AAAA) != 1 || len(records.MX) != 1 || len(records.NS) != 1 || len(records.TXT) != 1 {
+		t.Errorf("ResolveContext() = %+v", records)
+	}
+
+	// Results are the same on every run
+	again, err := ResolveContext(context.Background(), "example.com")
+	if err != nil {
+		t.Fatalf("ResolveContext() error = %v", err)
+	}
+	if again.String() != records.String() {
+		t.Errorf("ResolveContext() results differ:\n%s\n%s", records, again)
+	}
+}
+
+func TestResolveCNAMEWithAddresses(t *testing.T) {
+	// www.example.com is an alias of web.example.net, which has A records
+	server := startTestDNSServer(t, func(query *dnsMessage, tcp bool) *dnsMessage {
+		q := query.Questions[0]
+		response := &dnsMessage{}
+		name := strings.ToLower(strings.TrimSuffix(q.Name, "."))
+		if q.Type != dnsTypeA && q.Type != dnsTypeCNAME {
+			return response
+		}
+		switch name {
+		case "www.example.com":
+			response.Answers = append(response.Answers, dnsRR{Name: q.Name, Type: dnsTypeCNAME, Class: dnsClassINET, Target: "web.example.net"})
+			if q.Type == dnsTypeA {
+				response.Answers = append(response.Answers, dnsRR{Name: "web.example.net", Type: dnsTypeA, Class: dnsClassINET, IP: net.ParseIP("192.0.2.20")})
+			}
+		case "web.example.net":
+			if q.Type == dnsTypeA {
+				response.Answers = append(response.Answers, dnsRR{Name: q.Name, Type: dnsTypeA, Class: dnsClassINET, IP: net.ParseIP("192.0.2.20")})
+			}
+		}
+		return response
+	})
+	original := systemResolver
+	systemResolver = func() *net.Resolver { return newResolver(server) }
+	defer func() { systemResolver = original }()
+
+	records, err := ResolveContext(context.Background(), "www.example.com")
+	if err != nil {
+		t.Fatalf("ResolveContext() error = %v", err)
+	}
+	if len(records.A) != 1 || records.A[0] != "192.0.2.20" {
+		t.Errorf("A = %v, want [192.0.2.20]", records.A)
+	}
+	if len(records.CNAME) != 1 || records.CNAME[0] != "web.example.net" {
+		t.Errorf("CNAME = %v, want [web.example.net]", records.CNAME)
+	}
+
+	// The canonical name itself is no alias
+	records, err = ResolveContext(context.Background(), "WEB.example.net.")
+	if err != nil {
+		t.Fatalf("ResolveContext() error = %v", err)
+	}
+	if len(records.CNAME) != 0 {
+		t.Errorf("CNAME = %v, want none", records.CNAME)
+	}
+}
+
+func BenchmarkResolveContextConcurrent(b *testing.B) {
+	startSlowDNSServer(b, 10*time.Millisecond)
+	for i := 0; i < b.N; i++ {
+		ResolveContext(context.Background(), "example.com")
+	}
+}
+
+func TestVerifyFCrDNS(t *testing.T) {
+	originalAddr, originalIP := lookupAddr, lookupIPAddr
+	defer func() { lookupAddr, lookupIPAddr = originalAddr, originalIP }()
+
+	lookupAddr = func(ctx context.Context, addr string) ([]string, error) {
+		switch addr {
+		case "192.0.2.1":
+			return []string{"spoofed.example.", "mail.example."}, nil
+		case "192.0.2.2":
+			return []string{"other.example."}, nil
+		case "192.0.2.3":
+			return []string{"missing.example."}, nil
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: addr, IsNotFound: true}
+	}
+	lookupIPAddr = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		switch host {
+		case "mail.example":
+			return []net.IPAddr{{IP: net.ParseIP("198.51.100.7")}, {IP: net.ParseIP("192.0.2.1")}}, nil
+		case "spoofed.example", "other.example":
+			return []net.IPAddr{{IP: net.ParseIP("198.51.100.8")}}, nil
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+
+	ok, names, err := VerifyFCrDNS(context.Background(), net.ParseIP("192.0.2.1"))
+	if err != nil || !ok || len(names) != 2 || names[1] != "mail.example" {
+		t.Errorf("VerifyFCrDNS(confirmed) = %v, %v, %v", ok, names, err)
+	}
+
+	ok, names, err = VerifyFCrDNS(context.Background(), net.ParseIP("192.0.2.2"))
+	if err != nil || ok || len(names) != 1 {
+		t.Errorf("VerifyFCrDNS(mismatch) = %v, %v, %v", ok, names, err)
+	}
+
+	if ok, _, err := VerifyFCrDNS(context.Background(), net.ParseIP("192.0.2.3")); err == nil || ok {
+		t.Errorf("VerifyFCrDNS(unresolvable) = %v, %v, want error", ok, err)
+	}
+	if _, _, err := VerifyFCrDNS(context.Background(), net.ParseIP("192.0.2.4")); err == nil {
+		t.Error("VerifyFCrDNS(no PTR) expected error")
+	}
+	if _, _, err := VerifyFCrDNS(context.Background(), nil); err == nil {
+		t.Error("VerifyFCrDNS(nil) expected error")
+	}
+}
+
+func TestResolveQuery(t *testing.T) {
+	var lastOPT atomic.Value
+	handler := func(query *dnsMessage, tcp bool) *dnsMessage {
+		opt := dnsRR{}
+		for _, rr := range query.Additionals {
+			if rr.Type == dnsTypeOPT {
+				opt = rr
+			}
+		}
+		lastOPT.Store(opt)
+
+		response := &dnsMessage{dnsHeader: dnsHeader{AuthenticData: opt.TTL&(1<<15) != 0}}
+		if query.Questions[0].Type == dnsTypeA {
+			response.Answers = []dnsRR{{
+				Name: query.Questions[0].Name, Type: dnsTypeA, Class: dnsClassINET, TTL: 60,
+				IP: net.ParseIP("192.0.2.1"),
+			}}
+		}
+		return response
+	}
+
+	udpServer := startTestDNSServer(t, handler)
+	host, port, _ := net.SplitHostPort(udpServer)
+	portNumber, _ := strconv.Atoi(port)
+
+	tests := []struct {
+		name    string
+		options QueryOptions
+	}{
+		{"udp", QueryOptions{Server: udpServer}},
+		{"tcp with port", QueryOptions{Server: host, Port: portNumber, Protocol: "TCP"}},
+		{"tls", QueryOptions{Server: startTestDoTServer(t, handler), Protocol: "tls"}},
+		{"https", QueryOptions{Server: startTestDoHServer(t, handler), Protocol: "https"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := ResolveQuery(context.Background(), "example.com", tt.options)
+			if err != nil {
+				t.Fatalf("ResolveQuery() error = %v", err)
+			}
+			if len(records.A) != 1 || records.A[0] != "192.0.2.1" {
+				t.Errorf("A = %v", records.A)
+			}
+			if records.Authenticated {
+				t.Error("Authenticated set without DNSSEC")
+			}
+			if opt := lastOPT.Load().(dnsRR); opt.Type != 0 {
+				t.Errorf("OPT record sent without EDNS: %+v", opt)
+			}
+		})
+	}
+
+	_, subnet, _ := net.ParseCIDR("198.51.100.0/24")
+	records, err := ResolveQuery(context.Background(), "example.com", QueryOptions{
+		Server:       udpServer,
+		ClientSubnet: subnet,
+		DNSSEC:       true,
+	})
+	if err != nil {
+		t.Fatalf("ResolveQuery(DNSSEC) error = %v", err)
+	}
+	if !records.Authenticated {
+		t.Error("Authenticated = false, want true")
+	}
+	opt := lastOPT.Load().(dnsRR)
+	if opt.Type != dnsTypeOPT || opt.Class != 4096 || opt.TTL&(1<<15) == 0 || len(opt.Data) != 11 {
+		t.Errorf("OPT = %+v", opt)
+	}
+}
+
+func TestResolveQueryFlags(t *testing.T) {
+	tests := []struct {
+		name                     string
+		authoritative, recursive bool
+	}{
+		{"authoritative", true, false},
+		{"recursive", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := startTestDNSServer(t, func(query *dnsMessage, tcp bool) *dnsMessage {
+				return &dnsMessage{dnsHeader: dnsHeader{Authoritative: tt.authoritative, RecursionAvailable: tt.recursive}}
+			})
+			records, err := ResolveQuery(context.Background(), "example.com", QueryOptions{Server: server})
+			if err != nil {
+				t.Fatalf("ResolveQuery() error = %v", err)
+			}
+			if records.Authoritative != tt.authoritative || records.Recursive != tt.recursive {
+				t.Errorf("Authoritative = %v, Recursive = %v", records.Authoritative, records.Recursive)
+			}
+			if records.Server != server {
+				t.Errorf("Server = %q, want %q", records.Server, server)
+			}
+		})
+	}
+}
+
+func TestResolveMaxResults(t *testing.T) {
+	server := startTestDNSServer(t, func(query *dnsMessage, tcp bool) *dnsMessage {
+		q := query.Questions[0]
+		response := &dnsMessage{}
+		if q.Type == dnsTypeA {
+			for i := 1; i <= 5; i++ {
+				response.Answers = append(response.Answers, dnsRR{
+					Name: q.Name, Type: dnsTypeA, Class: dnsClassINET, TTL: 60,
+					IP: net.IPv4(192, 0, 2, byte(i)),
+				})
+			}
+		}
+		return response
+	})
+
+	records, err := ResolveQuery(context.Background(), "example.com", QueryOptions{Server: server, MaxResults: 2})
+	if err != nil {
+		t.Fatalf("ResolveQuery() error = %v", err)
+	}
+	if len(records.A) != 2 || records.A[0] != "192.0.2.1" || !records.Truncated {
+		t.Errorf("A = %v, Truncated = %v", records.A, records.Truncated)
+	}
+
+	records, err = ResolveQuery(context.Background(), "example.com", QueryOptions{Server: server, MaxResults: 5})
+	if err != nil {
+		t.Fatalf("ResolveQuery() error = %v", err)
+	}
+	if len(records.A) != 5 || records.Truncated {
+		t.Errorf("A = %v, Truncated = %v", records.A, records.Truncated)
+	}
+
+	original := systemResolver
+	defer func() { systemResolver = original }()
+	systemResolver = func() *net.Resolver { return newResolver(server) }
+
+	records, err = ResolveContext(context.Background(), "example.com", WithMaxResults(3))
+	if err != nil {
+		t.Fatalf("ResolveContext() error = %v", err)
+	}
+	if len(records.A) != 3 || !records.Truncated {
+		t.Errorf("A = %v, Truncated = %v", records.A, records.Truncated)
+	}
+
+	if _, err := ResolveQuery(context.Background(), "example.com", QueryOptions{Server: server, MaxResults: -1}); err == nil {
+		t.Error("ResolveQuery() accepted negative MaxResults")
+	}
+}
+
+func TestResolveQueryServFailRetry(t *testing.T) {
+	var mu sync.Mutex
+	failed := map[uint16]bool{}
+	server := startTestDNSServer(t, func(query *dnsMessage, tcp bool) *dnsMessage {
+		q := query.Questions[0]
+		response := &dnsMessage{}
+		mu.Lock()
+		defer mu.Unlock()
+		// Every type fails once before it's answered
+		if !failed[q.Type] {
+			failed[q.Type] = true
+			response.RCode = dnsRCodeServFail
+			return response
+		}
+		if q.Type == dnsTypeA {
+			response.Answers = []dnsRR{{Name: q.Name, Type: dnsTypeA, Class: dnsClassINET, TTL: 60, IP: net.ParseIP("192.0.2.1")}}
+		}
+		return response
+	})
+
+	if _, err := ResolveQuery(context.Background(), "example.com", QueryOptions{Server: server}); err == nil {
+		t.Error("ResolveQuery() succeeded with SERVFAIL responses only")
+	}
+
+	mu.Lock()
+	failed = map[uint16]bool{}
+	mu.Unlock()
+	records, err := ResolveQuery(context.Background(), "example.com", QueryOptions{Server: server, Retries: 1})
+	if err != nil {
+		t.Fatalf("ResolveQuery() error = %v", err)
+	}
+	if len(records.A) != 1 || records.A[0] != "192.0.2.1" {
+		t.Errorf("A = %v after retrying SERVFAIL", records.A)
+	}
+}
+
+func TestResolveQueryCaptureRaw(t *testing.T) {
+	server := startTestDNSServer(t, func(query *dnsMessage, tcp bool) *dnsMessage {
+		q := query.Questions[0]
+		response := &dnsMessage{}
+		if q.Type == dnsTypeA {
+			response.Answers = []dnsRR{{Name: q.Name, Type: dnsTypeA, Class: dnsClassINET, TTL: 60, IP: net.ParseIP("192.0.2.1")}}
+		}
+		return response
+	})
+
+	records, err := ResolveQuery(context.Background(), "example.com", QueryOptions{Server: server})
+	if err != nil {
+		t.Fatalf("ResolveQuery() error = %v", err)
+	}
+	if records.RawResponses != nil {
+		t.Errorf("RawResponses = %v without CaptureRaw", records.RawResponses)
+	}
+
+	records, err = ResolveQuery(context.Background(), "example.com", QueryOptions{Server: server, CaptureRaw: true})
+	if err != nil {
+		t.Fatalf("ResolveQuery() error = %v", err)
+	}
+	for _, name := range []string{"A", "AAAA", "CNAME", "MX", "NS", "TXT", "SOA"} {
+		if len(records.RawResponses[name]) == 0 {
+			t.Errorf("RawResponses[%q] is empty", name)
+		}
+	}
+
+	// The captured bytes are the complete message and decode to the same answers
+	response, err := unpackDNSMessage(records.RawResponses["A"])
+	if err != nil {
+		t.Fatalf("unpackDNSMessage() error = %v", err)
+	}
+	if !response.Response || len(response.Questions) != 1 || response.Questions[0].Type != dnsTypeA {
+		t.Errorf("raw response header = %+v, questions = %+v", response.dnsHeader, response.Questions)
+	}
+	if len(response.Answers) != 1 || !response.Answers[0].IP.Equal(net.ParseIP("192.0.2.1")) {
+		t.Errorf("raw response answers = %+v", response.Answers)
+	}
+}
+
+func TestResolveQueryMessageTruncated(t *testing.T) {
+	server := startTestDNSServer(t, func(query *dnsMessage, tcp bool) *dnsMessage {
+		// The TCP fallback fails, only the truncated UDP response is left
+		if tcp {
+			return nil
+		}
+		q := query.Questions[0]
+		response := &dnsMessage{}
+		if q.Type == dnsTypeA {
+			response.Truncated = true
+			response.Answers = []dnsRR{{Name: q.Name, Type: dnsTypeA, Class: dnsClassINET, IP: net.ParseIP("192.0.2.1")}}
+		}
+		return response
+	})
+
+	records, err := ResolveQuery(context.Background(), "example.com", QueryOptions{Server: server})
+	if err != nil {
+		t.Fatalf("ResolveQuery() error = %v", err)
+	}
+	if !records.MessageTruncated || len(records.A) != 1 {
+		t.Errorf("MessageTruncated = %v, A = %v", records.MessageTruncated, records.A)
+	}
+	if records.Truncated {
+		t.Error("Truncated set without MaxResults")
+	}
+
+	// Other callers of dnsExchange get the error of the TCP retry
+	_, err = dnsExchange(context.Background(), server, newDNSQuery("example.com", dnsTypeA, true), "udp", nil, tlsVerification{})
+	var truncated *truncatedError
+	if !errors.As(err, &truncated) || !truncated.response.Truncated || len(truncated.response.Answers) != 1 {
+		t.Errorf("dnsExchange() error = %v, want the truncated response with the TCP error", err)
+	}
+}
+
+func TestResolveQueryRetries(t *testing.T) {
+	var queries int32
+	server := startTestDNSServer(t, func(query *dnsMessage, tcp bool) *dnsMessage {
+		// The first query of each type is dropped
+		if atomic.AddInt32(&queries, 1)%2 == 1 {
+			return nil
+		}
+		return &dnsMessage{}
+	})
+
+	options := QueryOptions{Server: server, Protocol: "tcp", Timeout: time.Second, Retries: 1}
+	if _, err := ResolveQuery(context.Background(), "example.com", options); err != nil {
+		t.Fatalf("ResolveQuery() error = %v", err)
+	}
+	if got := atomic.LoadInt32(&queries); got != 14 {
+		t.Errorf("server received %d queries, want 14", got)
+	}
+}
+
+func TestResolveQueryOptions(t *testing.T) {
+	invalid := []QueryOptions{
+		{Server: "127.0.0.1", Protocol: "quic"},
+		{Server: "127.0.0.1", Port: 70000},
+		{Server: "127.0.0.1", ClientSubnet: &net.IPNet{}},
+	}
+	for _, options := range invalid {
+		if _, err := ResolveQuery(context.Background(), "example.com", options); err == nil {
+			t.Errorf("ResolveQuery(%+v) expected error", options)
+		}
+	}
+
+	tests := []struct {
+		options QueryOptions
+		want    string
+	}{
+		{QueryOptions{Server: "1.1.1.1"}, "1.1.1.1:53"},
+		{QueryOptions{Server: "1.1.1.1", Protocol: "tls"}, "1.1.1.1:853"},
+		{QueryOptions{Server: "1.1.1.1:5353", Port: 53}, "1.1.1.1:53"},
+		{QueryOptions{Server: "2606:4700::1111", Protocol: "tcp"}, "[2606:4700::1111]:53"},
+		{QueryOptions{Server: "1.1.1.1", Protocol: "https"}, "https://1.1.1.1:443/dns-query"},
+		{QueryOptions{Server: "https://dns.example/query", Protocol: "https", Port: 8443}, "https://dns.example:8443/query"},
+	}
+	for _, tt := range tests {
+		options, err := tt.options.normalize()
+		if err != nil || options.Server != tt.want {
+			t.Errorf("normalize(%+v) = %q, %v, want %q", tt.options, options.Server, err, tt.want)
+		}
+	}
+}
+
+func TestResolvePTRForA(t *testing.T) {
+	original := lookupAddr
+	defer func() { lookupAddr = original }()
+
+	lookupAddr = func(ctx context.Context, addr string) ([]string, error) {
+		switch addr {
+		case "192.0.2.1":
+			return []string{"web1.example.", "www.example."}, nil
+		case "192.0.2.3":
+			return nil, &net.DNSError{Err: "server misbehaving", Name: addr, IsTemporary: true}
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: addr, IsNotFound: true}
+	}
+
+	records := &DNSRecords{Domain: "example.com", A: []string{"192.0.2.1", "192.0.2.2"}}
+	if err := records.ResolvePTRForA(context.Background()); err != nil {
+		t.Fatalf("ResolvePTRForA() error = %v", err)
+	}
+	if len(records.PTRByIP) != 1 || strings.Join(records.PTRByIP["192.0.2.1"], ",") != "web1.example,www.example" {
+		t.Errorf("PTRByIP = %v", records.PTRByIP)
+	}
+	if !strings.Contains(records.String(), "192.0.2.1: web1.example, www.example") {
+		t.Errorf("String() = %q", records.String())
+	}
+
+	records.A = append(records.A, "192.0.2.3")
+	if err := records.ResolvePTRForA(context.Background()); err == nil {
+		t.Error("ResolvePTRForA() expected error for failing lookup")
+	}
+	if _, ok := records.PTRByIP["192.0.2.1"]; !ok {
+		t.Error("ResolvePTRForA() dropped names on error")
+	}
+}
+
+func TestResolveQueryHeaders(t *testing.T) {
+	received := make(chan http.Header, 16)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Clone()
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(testDNSRespond(t, func(query *dnsMessage, tcp bool) *dnsMessage {
+			return &dnsMessage{}
+		}, body, true))
+	}))
+	defer server.Close()
+
+	original := dohClient
+	dohClient = server.Client()
+	defer func() { dohClient = original }()
+
+	options := QueryOptions{
+		Server:   server.URL,
+		Protocol: "https",
+		Headers:  http.Header{"Authorization": {"Bearer secret"}},
+	}
+	if _, err := ResolveQuery(context.Background(), "example.com", options); err != nil {
+		t.Fatalf("ResolveQuery() error = %v", err)
+	}
+	header := <-received
+	if header.Get("Authorization") != "Bearer secret" || header.Get("User-Agent") != DefaultUserAgent {
+		t.Errorf("DoH request headers = %v", header)
+	}
+	if header.Get("Content-Type") != "application/dns-message" {
+		t.Errorf("Content-Type = %q", header.Get("Content-Type"))
+	}
+
+	options.UserAgent = "monitor/1.0"
+	for len(received) > 0 {
+		<-received
+	}
+	if _, err := ResolveQuery(context.Background(), "example.com", options); err != nil {
+		t.Fatalf("ResolveQuery() error = %v", err)
+	}
+	if got := (<-received).Get("User-Agent"); got != "monitor/1.0" {
+		t.Errorf("User-Agent = %q, want monitor/1.0", got)
+	}
+}
+
+func TestNSLookupWithOptionsCNAMEChain(t *testing.T) {
+	cnames := map[string]string{
+		"www.example.com":   "cdn.example.net",
+		"cdn.example.net":   "edge.example.org",
+		"short.example.com": "mid.example.net",
+		"mid.example.net":   "cdn.example.net",
+		"loop.example.com":  "loop2.example.com",
+		"loop2.example.com": "loop.example.com",
+	}
+	server := startTestDNSServer(t, func(query *dnsMessage, tcp bool) *dnsMessage {
+		q := query.Questions[0]
+		response := &dnsMessage{}
+		if q.Type != dnsTypeA {
+			return response
+		}
+		name := q.Name
+		for i := 0; i < 4; i++ {
+			target, ok := cnames[name]
+			if !ok {
+				break
+			}
+			response.Answers = append(response.Answers, dnsRR{Name: name, Type: dnsTypeCNAME, Class: dnsClassINET, Target: target})
+			name = target
+			// The test server cuts the chain of short.example.com after the first alias
+			if q.Name == "short.example.com" {
+				return response
+			}
+		}
+		if strings.HasPrefix(name, "loop") {
+			return response
+		}
+		response.Answers = append(response.Answers, dnsRR{Name: name, Type: dnsTypeA, Class: dnsClassINET, IP: net.ParseIP("192.0.2.5")})
+		return response
+	})
+
+	ips, chain, err := NSLookupWithOptions(context.Background(), "www.example.com", &NSLookupOptions{Server: server, CNAMEChain: true})
+	if err != nil {
+		t.Fatalf("NSLookupWithOptions() error = %v", err)
+	}
+	if strings.Join(ips, ",") != "192.0.2.5" || strings.Join(chain, ",") != "cdn.example.net,edge.example.org" {
+		t.Errorf("NSLookupWithOptions() = %v, %v", ips, chain)
+	}
+
+	ips, chain, err = NSLookupWithOptions(context.Background(), "edge.example.org", &NSLookupOptions{Server: server, CNAMEChain: true})
+	if err != nil || len(ips) != 1 || len(chain) != 0 {
+		t.Errorf("NSLookupWithOptions() without alias = %v, %v, %v", ips, chain, err)
+	}
+
+	_, chain, err = NSLookupWithOptions(context.Background(), "www.example.com", &NSLookupOptions{Server: server})
+	if err != nil || chain != nil {
+		t.Errorf("NSLookupWithOptions() without CNAMEChain = %v, %v", chain, err)
+	}
+
+	chain, err = lookupCNAMEChain(context.Background(), "short.example.com", server)
+	if err != nil || strings.Join(chain, ",") != "mid.example.net,cdn.example.net,edge.example.org" {
+		t.Errorf("lookupCNAMEChain() of a cut chain = %v, %v", chain, err)
+	}
+
+	if _, err := lookupCNAMEChain(context.Background(), "loop.example.com", server); err == nil {
+		t.Error("lookupCNAMEChain() expected error for CNAME loop")
+	}
+}
+
+func TestAssertResolves(t *testing.T) {
+	original := lookupIPAddr
+	defer func() { lookupIPAddr = original }()
+	lookupIPAddr = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		if host != "example.com" {
+			return nil, fmt.Errorf("no such host")
+		}
+		return []net.IPAddr{{IP: net.ParseIP("192.0.2.2")}, {IP: net.ParseIP("192.0.2.1")}, {IP: net.ParseIP("2001:db8::1")}}, nil
+	}
+
+	tests := []struct {
+		name     string
+		expected []string
+		match    int
+		want     bool
+	}{
+		{"exact", []string{"2001:db8:0::1", "192.0.2.1", "192.0.2.2"}, ResolveMatchExact, true},
+		{"exact with missing", []string{"192.0.2.1", "192.0.2.2"}, ResolveMatchExact, false},
+		{"subset", []string{"192.0.2.1", "192.0.2.2", "192.0.2.3", "2001:db8::1"}, ResolveMatchSubset, true},
+		{"subset with unexpected", []string{"192.0.2.1"}, ResolveMatchSubset, false},
+		{"superset", []string{"192.0.2.1"}, ResolveMatchSuperset, true},
+		{"superset with missing", []string{"192.0.2.3"}, ResolveMatchSuperset, false},
+	}
+	for _, tt := range tests {
+		ok, actual, err := AssertResolvesMatch(context.Background(), "https://example.com", tt.expected, tt.match)
+		if err != nil {
+			t.Fatalf("%s: AssertResolvesMatch() error = %v", tt.name, err)
+		}
+		if ok != tt.want || len(actual) != 3 || actual[0] != "192.0.2.2" {
+			t.Errorf("%s: AssertResolvesMatch() = %v, %v, want %v", tt.name, ok, actual, tt.want)
+		}
+	}
+
+	if ok, _, err := AssertResolves(context.Background(), "example.com", []string{"192.0.2.1", "192.0.2.2", "2001:db8::1"}); !ok || err != nil {
+		t.Errorf("AssertResolves() = %v, %v", ok, err)
+	}
+	if _, _, err := AssertResolves(context.Background(), "example.com", []string{"not-an-ip"}); err == nil {
+		t.Error("AssertResolves() accepted an invalid expected IP")
+	}
+	if _, _, err := AssertResolves(context.Background(), "unknown.example.com", nil); err == nil {
+		t.Error("AssertResolves() expected an error for a failed lookup")
+	}
+	if _, _, err := AssertResolvesMatch(context.Background(), "example.com", nil, 7); err == nil {
+		t.Error("AssertResolvesMatch() accepted an invalid match mode")
+	}
+}
+
+func TestNetworkResolve(t *testing.T) {
+	server := startTestDNSServer(t, func(query *dnsMessage, tcp bool) *dnsMessage {
+		q := query.Questions[0]
+		response := &dnsMessage{}
+		if q.Type == dnsTypeA {
+			response.Answers = []dnsRR{{Name: q.Name, Type: dnsTypeA, Class: dnsClassINET, IP: net.ParseIP("192.0.2.1")}}
+		}
+		return response
+	})
+
+	// The first server doesn't answer, the next one is used
+	network := &Network{DNS: []string{closedDNSServer(t), server}}
+	records, err := network.Resolve(context.Background(), "example.com")
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if len(records.A) != 1 || records.A[0] != "192.0.2.1" || records.Server != server {
+		t.Errorf("A = %v, Server = %q", records.A, records.Server)
+	}
+
+	network = &Network{DNS: []string{closedDNSServer(t)}}
+	if _, err := network.Resolve(context.Background(), "example.com"); err == nil {
+		t.Error("Resolve() expected an error when no server answers")
+	}
+	if _, err := (&Network{}).Resolve(context.Background(), "example.com"); err == nil {
+		t.Error("Resolve() expected an error without DNS servers")
+	}
+}
+
+// closedDNSServer returns the address of a TCP and UDP port nothing listens on
+func closedDNSServer(t *testing.T) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen udp: %v", err)
+	}
+	address := conn.LocalAddr().String()
+	conn.Close()
+	return address
+}
+
+func TestQuerySOASerial(t *testing.T) {
+	server := startTestDNSServer(t, func(query *dnsMessage, tcp bool) *dnsMessage {
+		q := query.Questions[0]
+		response := &dnsMessage{}
+		soa := dnsRR{Name: "example.com", Type: dnsTypeSOA, Class: dnsClassINET, SOA: &SOARecord{
+			NS: "ns1.example.com", Mbox: "hostmaster.example.com", Serial: 2024010101,
+		}}
+		switch {
+		case q.Type != dnsTypeSOA || q.Name == "missing.example.com":
+			response.RCode = dnsRCodeNXDomain
+		case q.Name == "example.com":
+			response.Answers = []dnsRR{soa}
+		default:
+			// Names below the apex have no SOA, the SOA of the zone is in the authority section
+			response.Authorities = []dnsRR{soa}
+		}
+		return response
+	})
+
+	serial, err := querySOASerial(context.Background(), server, "example.com")
+	if err != nil || serial != 2024010101 {
+		t.Errorf("querySOASerial() = %d, %v, want 2024010101", serial, err)
+	}
+	serial, err = querySOASerial(context.Background(), server, "www.example.com")
+	if err != nil || serial != 2024010101 {
+		t.Errorf("querySOASerial(www.example.com) = %d, %v, want the serial of the zone", serial, err)
+	}
+	if _, err := querySOASerial(context.Background(), server, "missing.example.com"); err == nil {
+		t.Error("querySOASerial() expected error for NXDOMAIN")
+	}
+}
+
+func TestWatchSerial(t *testing.T) {
+	var mu sync.Mutex
+	polls := []uint32{1, 1, 2, 2, 3}
+	original := soaSerial
+	defer func() { soaSerial = original }()
+	soaSerial = func(ctx context.Context, domain string) (uint32, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if domain != "example.com" {
+			return 0, fmt.Errorf("unexpected domain %s", domain)
+		}
+		if len(polls) == 0 {
+			return 0, fmt.Errorf("no SOA")
+		}
+		serial := polls[0]
+		polls = polls[1:]
+		return serial, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	serials, err := WatchSerial(ctx, "https://example.com/", time.Millisecond)
+	if err != nil {
+		t.Fatalf("WatchSerial() error = %v", err)
+	}
+	for _, want := range []uint32{1, 2, 3} {
+		select {
+		case got := <-serials:
+			if got != want {
+				t.Errorf("serial = %d, want %d", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("serial %d not received", want)
+		}
+	}
+
+	cancel()
+	for range serials {
+	}
+
+	if _, err := WatchSerial(context.Background(), "example.com", time.Second); err == nil {
+		t.Error("WatchSerial() expected error when the initial query fails")
+	}
+	if _, err := WatchSerial(context.Background(), "example.com", 0); err == nil {
+		t.Error("WatchSerial() expected error for zero interval")
+	}
+}
+
+func TestResolveDoT(t *testing.T) {
+	server := startTestDoTServer(t, func(query *dnsMessage, tcp bool) *dnsMessage {
+		response := &dnsMessage{}
+		if query.Questions[0].Type == dnsTypeA {
+			response.Answers = []dnsRR{{
+				Name: query.Questions[0].Name, Type: dnsTypeA, Class: dnsClassINET, TTL: 60,
+				IP: net.ParseIP("192.0.2.1"),
+			}}
+		}
+		return response
+	})
+
+	records, err := ResolveDoT(context.Background(), "example.com", server)
+	if err != nil {
+		t.Fatalf("ResolveDoT() error = %v", err)
+	}
+	if len(records.A) != 1 || records.A[0] != "192.0.2.1" {
+		t.Errorf("A = %v", records.A)
+	}
+
+	conn, err := tls.Dial("tcp", server, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("failed to connect to test server: %v", err)
+	}
+	hash := sha256.Sum256(conn.ConnectionState().PeerCertificates[0].RawSubjectPublicKeyInfo)
+	conn.Close()
+	pin := base64.StdEncoding.EncodeToString(hash[:])
+	otherPin := base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))
+
+	// The test certificate is not trusted without the roots of startTestDoTServer
+	dnsTLSConfig = func(serverName string) *tls.Config {
+		return &tls.Config{ServerName: serverName}
+	}
+	if _, err := ResolveDoT(context.Background(), "example.com", server); err == nil {
+		t.Error("ResolveDoT() accepted an untrusted certificate")
+	}
+
+	tests := []struct {
+		name    string
+		options QueryOptions
+		wantErr bool
+	}{
+		{"skip verify", QueryOptions{TLSInsecureSkipVerify: true}, false},
+		{"pinned", QueryOptions{TLSPins: []string{otherPin, pin}}, false},
+		{"wrong pin", QueryOptions{TLSPins: []string{otherPin}}, true},
+	}
+	for _, tt := range tests {
+		tt.options.Server, tt.options.Protocol = server, "tls"
+		_, err := ResolveQuery(context.Background(), "example.com", tt.options)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: ResolveQuery() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+
+	for _, options := range []QueryOptions{
+		{Server: server, Protocol: "tls", TLSPins: []string{"not-a-pin"}},
+		{Server: server, Protocol: "udp", TLSInsecureSkipVerify: true},
+	} {
+		if _, err := ResolveQuery(context.Background(), "example.com", options); err == nil {
+			t.Errorf("ResolveQuery(%+v) expected error", options)
+		}
+	}
+}
+
+func TestArpaName(t *testing.T) {
+	tests := []struct {
+		ip   net.IP
+		want string
+	}{
+		{net.ParseIP("192.168.1.1"), "1.1.168.192.in-addr.arpa."},
+		{net.IPv4(10, 0, 0, 254).To4(), "254.0.0.10.in-addr.arpa."},
+		{net.ParseIP("2001:db8::567:89ab"), "b.a.9.8.7.6.5.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa."},
+	}
+	for _, tt := range tests {
+		got, err := ArpaName(tt.ip)
+		if err != nil || got != tt.want {
+			t.Errorf("ArpaName(%v) = %q, %v, want %q", tt.ip, got, err, tt.want)
+		}
+	}
+	if _, err := ArpaName(net.IP{1, 2, 3}); err == nil {
+		t.Error("expected error for invalid IP")
+	}
+	if _, err := ArpaName(nil); err == nil {
+		t.Error("expected error for nil IP")
+	}
+}
+
+func TestCheckNSConsistency(t *testing.T) {
+	originalNS, originalIP, originalPort := lookupNS, lookupIPAddr, dnsPort
+	defer func() { lookupNS, lookupIPAddr, dnsPort = originalNS, originalIP, originalPort }()
+
+	// zone answers like an authoritative server of example.com with the serial and address
+	zone := func(serial uint32, ip string) testDNSHandler {
+		return func(query *dnsMessage, tcp bool) *dnsMessage {
+			q := query.Questions[0]
+			response := &dnsMessage{}
+			response.Authoritative = !query.RecursionDesired
+			soa := dnsRR{Name: "example.com", Type: dnsTypeSOA, Class: dnsClassINET, SOA: &SOARecord{
+				NS: "ns1.example.com", Mbox: "hostmaster.example.com", Serial: serial,
+			}}
+			switch q.Type {
+			case dnsTypeA:
+				response.Answers = []dnsRR{{Name: q.Name, Type: dnsTypeA, Class: dnsClassINET, IP: net.ParseIP(ip)}}
+			default:
+				// www is no zone apex, the SOA comes in the authority section
+				response.Authorities = []dnsRR{soa}
+			}
+			return response
+		}
+	}
+
+	var mu sync.Mutex
+	secondary := zone(2024010101, "192.0.2.10")
+	server := startTestDNSServer(t, func(query *dnsMessage, tcp bool) *dnsMessage {
+		mu.Lock()
+		handler := secondary
+		mu.Unlock()
+		return handler(query, tcp)
+	})
+	_, port, _ := net.SplitHostPort(server)
+	dnsPort = port
+
+	// The primary listens on the IPv6 loopback at the same port
+	primary, err := net.ListenPacket("udp", net.JoinHostPort("::1", port))
+	if err != nil {
+		t.Skipf("IPv6 loopback unavailable: %v", err)
+	}
+	defer primary.Close()
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, addr, err := primary.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if response := testDNSRespond(t, zone(2024010102, "192.0.2.20"), buf[:n], false); response != nil {
+				primary.WriteTo(response, addr)
+			}
+		}
+	}()
+
+	lookupNS = func(ctx context.Context, domain string) ([]*net.NS, error) {
+		if domain == "example.com" {
+			return []*net.NS{{Host: "ns1.example.com."}, {Host: "ns2.example.com."}}, nil
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: domain, IsNotFound: true}
+	}
+	lookupIPAddr = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		if host == "ns1.example.com" {
+			return []net.IPAddr{{IP: net.ParseIP("::1")}}, nil
+		}
+		return []net.IPAddr{{IP: net.ParseIP("127.0.0.1")}}, nil
+	}
+
+	report, err := CheckNSConsistency(context.Background(), "www.example.com")
+	if err != nil {
+		t.Fatalf("CheckNSConsistency() error = %v", err)
+	}
+	if len(report.Answers) != 2 || report.Answers[0].Serial != 2024010102 || report.Answers[1].Serial != 2024010101 {
+		t.Fatalf("Answers = %+v", report.Answers)
+	}
+	if report.Consistent || len(report.Discrepancies) != 2 {
+		t.Fatalf("Consistent/Discrepancies = %v/%q", report.Consistent, report.Discrepancies)
+	}
+	want := "SOA serials differ: 2024010102 from ns1.example.com (::1); 2024010101 from ns2.example.com (127.0.0.1)"
+	if report.Discrepancies[0] != want {
+		t.Errorf("Discrepancies[0] = %q, want %q", report.Discrepancies[0], want)
+	}
+	if !strings.HasPrefix(report.Discrepancies[1], "A records differ: [192.0.2.20] from ns1") {
+		t.Errorf("Discrepancies[1] = %q", report.Discrepancies[1])
+	}
+
+	// Once replicated the servers agree
+	mu.Lock()
+	secondary = zone(2024010102, "192.0.2.20")
+	mu.Unlock()
+	report, err = CheckNSConsistency(context.Background(), "www.example.com")
+	if err != nil {
+		t.Fatalf("CheckNSConsistency() error = %v", err)
+	}
+	if !report.Consistent || len(report.Discrepancies) != 0 {
+		t.Errorf("Consistent/Discrepancies = %v/%q, want true/none", report.Consistent, report.Discrepancies)
+	}
+
+	if _, err := CheckNSConsistency(context.Background(), ""); err == nil {
+		t.Error("expected error for empty domain")
+	}
+}
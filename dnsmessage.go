@@ -0,0 +1,498 @@
+package network
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// DNS record types used by the raw DNS client
+const (
+	dnsTypeA     uint16 = 1
+	dnsTypeNS    uint16 = 2
+	dnsTypeCNAME uint16 = 5
+	dnsTypeSOA   uint16 = 6
+	dnsTypePTR   uint16 = 12
+	dnsTypeHINFO uint16 = 13
+	dnsTypeMX    uint16 = 15
+	dnsTypeTXT   uint16 = 16
+	dnsTypeAAAA  uint16 = 28
+	dnsTypeSRV   uint16 = 33
+	dnsTypeOPT   uint16 = 41
+	dnsTypeANY   uint16 = 255
+
+	dnsClassINET uint16 = 1
+)
+
+// DNS response codes
+const (
+	dnsRCodeSuccess  uint8 = 0
+	dnsRCodeServFail uint8 = 2
+	dnsRCodeNXDomain uint8 = 3
+)
+
+// dnsTypes maps record type names to their numeric value
+var dnsTypes = map[string]uint16{
+	"A":     dnsTypeA,
+	"NS":    dnsTypeNS,
+	"CNAME": dnsTypeCNAME,
+	"SOA":   dnsTypeSOA,
+	"PTR":   dnsTypePTR,
+	"HINFO": dnsTypeHINFO,
+	"MX":    dnsTypeMX,
+	"TXT":   dnsTypeTXT,
+	"AAAA":  dnsTypeAAAA,
+	"SRV":   dnsTypeSRV,
+	"ANY":   dnsTypeANY,
+}
+
+// dnsTypeName returns the name of a record type, "TYPE" and the number for unknown types (RFC 3597)
+func dnsTypeName(qtype uint16) string {
+	for name, value := range dnsTypes {
+		if value == qtype {
+			return name
+		}
+	}
+	return fmt.Sprintf("TYPE%d", qtype)
+}
+
+// dnsHeader holds the header fields of a DNS message
+type dnsHeader struct {
+	ID                 uint16
+	Response           bool
+	Opcode             uint8
+	Authoritative      bool
+	Truncated          bool
+	RecursionDesired   bool
+	RecursionAvailable bool
+	AuthenticData      bool
+	RCode              uint8
+}
+
+// dnsQuestion is an entry of the question section
+type dnsQuestion struct {
+	Name  string
+	Type  uint16
+	Class uint16
+}
+
+// dnsRR is a resource record with its data decoded for the supported types
+type dnsRR struct {
+	Name  string
+	Type  uint16
+	Class uint16
+	TTL   uint32
+
+	IP     net.IP     // A, AAAA
+	Target string     // CNAME, NS, PTR, MX and SRV target
+	Pref   uint16     // MX preference, SRV priority
+	Weight uint16     // SRV weight
+	Port   uint16     // SRV port
+	Text   []string   // TXT strings, HINFO cpu and os
+	SOA    *SOARecord // SOA
+	Data   []byte     // raw data of other types
+}
+
+// dnsMessage is a DNS message as sent on the wire
+type dnsMessage struct {
+	dnsHeader
+	Questions   []dnsQuestion
+	Answers     []dnsRR
+	Authorities []dnsRR
+	Additionals []dnsRR
+
+	raw []byte // wire format of an unpacked message, may share the read buffer
+}
+
+// newDNSQuery returns a query message for a single name and type
+func newDNSQuery(name string, qtype uint16, recursive bool) *dnsMessage {
+	return &dnsMessage{
+		dnsHeader: dnsHeader{
+			RecursionDesired: recursive,
+		},
+		Questions: []dnsQuestion{{
+			Name:  strings.TrimSuffix(name, "."),
+			Type:  qtype,
+			Class: dnsClassINET,
+		}},
+	}
+}
+
+// setEDNS adds an EDNS0 OPT record (RFC 6891) advertising the UDP payload size, with the DNSSEC OK
+// bit and a client subnet option (RFC 7871) if given
+func (m *dnsMessage) setEDNS(payload uint16, dnssec bool, subnet *net.IPNet) {
+	opt := dnsRR{
+		Type:  dnsTypeOPT,
+		Class: payload,
+	}
+	if dnssec {
+		opt.TTL = 1 << 15
+	}
+
+	if subnet != nil {
+		family, ip := uint16(1), subnet.IP.To4()
+		if ip == nil {
+			family, ip = 2, subnet.IP.To16()
+		}
+		ones, bits := subnet.Mask.Size()
+		if family == 1 && bits == 128 {
+			ones -= 96
+		}
+		if ones < 0 || ones > len(ip)*8 {
+			ones = len(ip) * 8
+		}
+
+		// Only the bytes covered by the prefix are sent, with the host bits cleared
+		address := append([]byte(nil), ip[:(ones+7)/8]...)
+		if ones%8 != 0 {
+			address[len(address)-1] &= byte(0xff << (8 - ones%8))
+		}
+
+		opt.Data = binary.BigEndian.AppendUint16(opt.Data, 8)
+		opt.Data = binary.BigEndian.AppendUint16(opt.Data, uint16(4+len(address)))
+		opt.Data = binary.BigEndian.AppendUint16(opt.Data, family)
+		opt.Data = append(opt.Data, byte(ones), 0)
+		opt.Data = append(opt.Data, address...)
+	}
+
+	m.Additionals = append(m.Additionals, opt)
+}
+
+// pack encodes the message in wire format. Names are not compressed.
+func (m *dnsMessage) pack() ([]byte, error) {
+	buf := make([]byte, 12, 512)
+	binary.BigEndian.PutUint16(buf[0:], m.ID)
+
+	var flags uint16
+	if m.Response {
+		flags |= 1 << 15
+	}
+	flags |= uint16(m.Opcode&0xf) << 11
+	if m.Authoritative {
+		flags |= 1 << 10
+	}
+	if m.Truncated {
+		flags |= 1 << 9
+	}
+	if m.RecursionDesired {
+		flags |= 1 << 8
+	}
+	if m.RecursionAvailable {
+		flags |= 1 << 7
+	}
+	if m.AuthenticData {
+		flags |= 1 << 5
+	}
+	flags |= uint16(m.RCode & 0xf)
+	binary.BigEndian.PutUint16(buf[2:], flags)
+	binary.BigEndian.PutUint16(buf[4:], uint16(len(m.Questions)))
+	binary.BigEndian.PutUint16(buf[6:], uint16(len(m.Answers)))
+	binary.BigEndian.PutUint16(buf[8:], uint16(len(m.Authorities)))
+	binary.BigEndian.PutUint16(buf[10:], uint16(len(m.Additionals)))
+
+	var err error
+	for _, q := range m.Questions {
+		if buf, err = appendDNSName(buf, q.Name); err != nil {
+			return nil, err
+		}
+		buf = binary.BigEndian.AppendUint16(buf, q.Type)
+		buf = binary.BigEndian.AppendUint16(buf, q.Class)
+	}
+
+	for _, section := range [][]dnsRR{m.Answers, m.Authorities, m.Additionals} {
+		for i := range section {
+			if buf, err = appendDNSRR(buf, &section[i]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return buf, nil
+}
+
+// appendDNSName appends a domain name in uncompressed wire format
+func appendDNSName(buf []byte, name string) ([]byte, error) {
+	name = strings.TrimSuffix(name, ".")
+	if len(name) > 253 {
+		return nil, fmt.Errorf("domain name too long: %s", name)
+	}
+	if name != "" {
+		for _, label := range strings.Split(name, ".") {
+			if len(label) == 0 || len(label) > 63 {
+				return nil, fmt.Errorf("invalid domain name: %s", name)
+			}
+			buf = append(buf, byte(len(label)))
+			buf = append(buf, label...)
+		}
+	}
+	return append(buf, 0), nil
+}
+
+// appendDNSRR appends a resource record in wire format
+func appendDNSRR(buf []byte, rr *dnsRR) ([]byte, error) {
+	var err error
+	if buf, err = appendDNSName(buf, rr.Name); err != nil {
+		return nil, err
+	}
+	buf = binary.BigEndian.AppendUint16(buf, rr.Type)
+	buf = binary.BigEndian.AppendUint16(buf, rr.Class)
+	buf = binary.BigEndian.AppendUint32(buf, rr.TTL)
+
+	lengthOffset := len(buf)
+	buf = append(buf, 0, 0)
+
+	switch rr.Type {
+	case dnsTypeA:
+		ip := rr.IP.To4()
+		if ip == nil {
+			return nil, fmt.Errorf("invalid A record address: %v", rr.IP)
+		}
+		buf = append(buf, ip...)
+	case dnsTypeAAAA:
+		ip := rr.IP.To16()
+		if ip == nil {
+			return nil, fmt.Errorf("invalid AAAA record address: %v", rr.IP)
+		}
+		buf = append(buf, ip...)
+	case dnsTypeCNAME, dnsTypeNS, dnsTypePTR:
+		buf, err = appendDNSName(buf, rr.Target)
+	case dnsTypeMX:
+		buf = binary.BigEndian.AppendUint16(buf, rr.Pref)
+		buf, err = appendDNSName(buf, rr.Target)
+	case dnsTypeSRV:
+		buf = binary.BigEndian.AppendUint16(buf, rr.Pref)
+		buf = binary.BigEndian.AppendUint16(buf, rr.Weight)
+		buf = binary.BigEndian.AppendUint16(buf, rr.Port)
+		buf, err = appendDNSName(buf, rr.Target)
+	case dnsTypeTXT, dnsTypeHINFO:
+		for _, text := range rr.Text {
+			if len(text) > 255 {
+				return nil, fmt.Errorf("character string too long")
+			}
+			buf = append(buf, byte(len(text)))
+			buf = append(buf, text...)
+		}
+	case dnsTypeSOA:
+		if rr.SOA == nil {
+			return nil, fmt.Errorf("missing SOA data")
+		}
+		if buf, err = appendDNSName(buf, rr.SOA.NS); err != nil {
+			return nil, err
+		}
+		if buf, err = appendDNSName(buf, strings.Replace(rr.SOA.Mbox, "@", ".", 1)); err != nil {
+			return nil, err
+		}
+		for _, v := range []uint32{rr.SOA.Serial, rr.SOA.Refresh, rr.SOA.Retry, rr.SOA.Expire, rr.SOA.MinTTL} {
+			buf = binary.BigEndian.AppendUint32(buf, v)
+		}
+	default:
+		buf = append(buf, rr.Data...)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	length := len(buf) - lengthOffset - 2
+	if length > 0xffff {
+		return nil, fmt.Errorf("record data too long")
+	}
+	binary.BigEndian.PutUint16(buf[lengthOffset:], uint16(length))
+	return buf, nil
+}
+
+// unpackDNSMessage decodes a DNS message from wire format
+func unpackDNSMessage(msg []byte) (*dnsMessage, error) {
+	if len(msg) < 12 {
+		return nil, fmt.Errorf("dns message too short")
+	}
+
+	flags := binary.BigEndian.Uint16(msg[2:])
+	m := &dnsMessage{
+		dnsHeader: dnsHeader{
+			ID:                 binary.BigEndian.Uint16(msg[0:]),
+			Response:           flags&(1<<15) != 0,
+			Opcode:             uint8(flags>>11) & 0xf,
+			Authoritative:      flags&(1<<10) != 0,
+			Truncated:          flags&(1<<9) != 0,
+			RecursionDesired:   flags&(1<<8) != 0,
+			RecursionAvailable: flags&(1<<7) != 0,
+			AuthenticData:      flags&(1<<5) != 0,
+			RCode:              uint8(flags & 0xf),
+		},
+		raw: msg,
+	}
+
+	qdcount := int(binary.BigEndian.Uint16(msg[4:]))
+	counts := []int{
+		int(binary.BigEndian.Uint16(msg[6:])),
+		int(binary.BigEndian.Uint16(msg[8:])),
+		int(binary.BigEndian.Uint16(msg[10:])),
+	}
+
+	offset := 12
+	for i := 0; i < qdcount; i++ {
+		name, next, err := readDNSName(msg, offset)
+		if err != nil {
+			return nil, err
+		}
+		if next+4 > len(msg) {
+			return nil, fmt.Errorf("dns question truncated")
+		}
+		m.Questions = append(m.Questions, dnsQuestion{
+			Name:  name,
+			Type:  binary.BigEndian.Uint16(msg[next:]),
+			Class: binary.BigEndian.Uint16(msg[next+2:]),
+		})
+		offset = next + 4
+	}
+
+	sections := []*[]dnsRR{&m.Answers, &m.Authorities, &m.Additionals}
+	for i, section := range sections {
+		for j := 0; j < counts[i]; j++ {
+			rr, next, err := readDNSRR(msg, offset)
+			if err != nil {
+				return nil, err
+			}
+			*section = append(*section, rr)
+			offset = next
+		}
+	}
+	return m, nil
+}
+
+// readDNSName reads a possibly compressed name and returns it with the offset following it
+func readDNSName(msg []byte, offset int) (string, int, error) {
+	var labels []string
+	next := -1
+	jumps := 0
+
+	for {
+		if offset >= len(msg) {
+			return "", 0, fmt.Errorf("dns name out of bounds")
+		}
+		length := int(msg[offset])
+
+		switch length & 0xc0 {
+		case 0x00:
+			if length == 0 {
+				if next < 0 {
+					next = offset + 1
+				}
+				return strings.Join(labels, "."), next, nil
+			}
+			if offset+1+length > len(msg) {
+				return "", 0, fmt.Errorf("dns label out of bounds")
+			}
+			labels = append(labels, string(msg[offset+1:offset+1+length]))
+			offset += 1 + length
+		case 0xc0:
+			if offset+2 > len(msg) {
+				return "", 0, fmt.Errorf("dns pointer out of bounds")
+			}
+			if next < 0 {
+				next = offset + 2
+			}
+			jumps++
+			if jumps > 32 {
+				return "", 0, fmt.Errorf("too many dns compression pointers")
+			}
+			offset = int(binary.BigEndian.Uint16(msg[offset:]) & 0x3fff)
+		default:
+			return "", 0, fmt.Errorf("invalid dns label type")
+		}
+	}
+}
+
+// readDNSRR reads a resource record and returns it with the offset following it
+func readDNSRR(msg []byte, offset int) (dnsRR, int, error) {
+	var rr dnsRR
+
+	name, offset, err := readDNSName(msg, offset)
+	if err != nil {
+		return rr, 0, err
+	}
+	if offset+10 > len(msg) {
+		return rr, 0, fmt.Errorf("dns record header truncated")
+	}
+
+	rr.Name = name
+	rr.Type = binary.BigEndian.Uint16(msg[offset:])
+	rr.Class = binary.BigEndian.Uint16(msg[offset+2:])
+	rr.TTL = binary.BigEndian.Uint32(msg[offset+4:])
+	length := int(binary.BigEndian.Uint16(msg[offset+8:]))
+	start := offset + 10
+	end := start + length
+	if end > len(msg) {
+		return rr, 0, fmt.Errorf("dns record data truncated")
+	}
+	data := msg[start:end]
+
+	switch rr.Type {
+	case dnsTypeA, dnsTypeAAAA:
+		if len(data) != net.IPv4len && len(data) != net.IPv6len {
+			return rr, 0, fmt.Errorf("invalid address length %d", len(data))
+		}
+		rr.IP = append(net.IP(nil), data...)
+	case dnsTypeCNAME, dnsTypeNS, dnsTypePTR:
+		if rr.Target, _, err = readDNSName(msg, start); err != nil {
+			return rr, 0, err
+		}
+	case dnsTypeMX:
+		if len(data) < 3 {
+			return rr, 0, fmt.Errorf("invalid MX record")
+		}
+		rr.Pref = binary.BigEndian.Uint16(data)
+		if rr.Target, _, err = readDNSName(msg, start+2); err != nil {
+			return rr, 0, err
+		}
+	case dnsTypeSRV:
+		if len(data) < 7 {
+			return rr, 0, fmt.Errorf("invalid SRV record")
+		}
+		rr.Pref = binary.BigEndian.Uint16(data)
+		rr.Weight = binary.BigEndian.Uint16(data[2:])
+		rr.Port = binary.BigEndian.Uint16(data[4:])
+		if rr.Target, _, err = readDNSName(msg, start+6); err != nil {
+			return rr, 0, err
+		}
+	case dnsTypeTXT, dnsTypeHINFO:
+		for i := 0; i < len(data); {
+			l := int(data[i])
+			if i+1+l > len(data) {
+				return rr, 0, fmt.Errorf("invalid character string")
+			}
+			rr.Text = append(rr.Text, string(data[i+1:i+1+l]))
+			i += 1 + l
+		}
+	case dnsTypeSOA:
+		soa := &SOARecord{}
+		var next int
+		if soa.NS, next, err = readDNSName(msg, start); err != nil {
+			return rr, 0, err
+		}
+		if soa.Mbox, next, err = readDNSName(msg, next); err != nil {
+			return rr, 0, err
+		}
+		if next+20 > end {
+			return rr, 0, fmt.Errorf("invalid SOA record")
+		}
+		soa.Mbox = soaMailbox(soa.Mbox)
+		soa.Serial = binary.BigEndian.Uint32(msg[next:])
+		soa.Refresh = binary.BigEndian.Uint32(msg[next+4:])
+		soa.Retry = binary.BigEndian.Uint32(msg[next+8:])
+		soa.Expire = binary.BigEndian.Uint32(msg[next+12:])
+		soa.MinTTL = binary.BigEndian.Uint32(msg[next+16:])
+		rr.SOA = soa
+	default:
+		rr.Data = append([]byte(nil), data...)
+	}
+	return rr, end, nil
+}
+
+// soaMailbox converts the SOA RNAME (hostmaster.example.com) to an email address
+func soaMailbox(rname string) string {
+	if i := strings.Index(rname, "."); i > 0 {
+		return rname[:i] + "@" + rname[i+1:]
+	}
+	return rname
+}
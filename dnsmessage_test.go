@@ -0,0 +1,333 @@
+package network
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// testDNSHandler builds the response of the test DNS server for a query
+type testDNSHandler func(query *dnsMessage, tcp bool) *dnsMessage
+
+// startTestDNSServer starts a DNS server on localhost serving both UDP and TCP on the same port
+func startTestDNSServer(t testing.TB, handler testDNSHandler) string {
+	t.Helper()
+
+	var (
+		udp net.PacketConn
+		tcp net.Listener
+		err error
+	)
+	for i := 0; i < 10; i++ {
+		udp, err = net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("failed to listen udp: %v", err)
+		}
+		tcp, err = net.Listen("tcp", udp.LocalAddr().String())
+		if err == nil {
+			break
+		}
+		udp.Close()
+	}
+	if err != nil {
+		t.Fatalf("failed to listen tcp: %v", err)
+	}
+	t.Cleanup(func() {
+		udp.Close()
+		tcp.Close()
+	})
+
+	respond := func(packet []byte, isTCP bool) []byte {
+		return testDNSRespond(t, handler, packet, isTCP)
+	}
+
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, addr, err := udp.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			// Queries are answered concurrently like a real server would
+			packet := append([]byte(nil), buf[:n]...)
+			go func() {
+				if packed := respond(packet, false); packed != nil {
+					udp.WriteTo(packed, addr)
+				}
+			}()
+		}
+	}()
+
+	go func() {
+		for {
+			conn, err := tcp.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				for {
+					length := make([]byte, 2)
+					if _, err := io.ReadFull(conn, length); err != nil {
+						return
+					}
+					packet := make([]byte, binary.BigEndian.Uint16(length))
+					if _, err := io.ReadFull(conn, packet); err != nil {
+						return
+					}
+					packed := respond(packet, true)
+					if packed == nil {
+						return
+					}
+					conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(packed))), packed...))
+				}
+			}(conn)
+		}
+	}()
+
+	return udp.LocalAddr().String()
+}
+
+// testDNSRespond answers a packed query using the handler, nil means no answer
+func testDNSRespond(t testing.TB, handler testDNSHandler, packet []byte, tcp bool) []byte {
+	query, err := unpackDNSMessage(packet)
+	if err != nil {
+		return nil
+	}
+	response := handler(query, tcp)
+	if response == nil {
+		return nil
+	}
+	response.ID = query.ID
+	response.Response = true
+	if response.Questions == nil {
+		response.Questions = query.Questions
+	}
+	packed, err := response.pack()
+	if err != nil {
+		t.Errorf("failed to pack test response: %v", err)
+		return nil
+	}
+	return packed
+}
+
+// startTestDoTServer starts a DNS over TLS server on localhost trusted by dnsTLSConfig until the test ends
+func startTestDoTServer(t testing.TB, handler testDNSHandler) string {
+	t.Helper()
+
+	certServer := httptest.NewTLSServer(http.NotFoundHandler())
+	certServer.Close()
+	roots := certServer.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: certServer.TLS.Certificates})
+	if err != nil {
+		t.Fatalf("failed to listen tls: %v", err)
+	}
+
+	original := dnsTLSConfig
+	dnsTLSConfig = func(serverName string) *tls.Config {
+		return &tls.Config{ServerName: serverName, RootCAs: roots}
+	}
+	t.Cleanup(func() {
+		listener.Close()
+		dnsTLSConfig = original
+	})
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				for {
+					length := make([]byte, 2)
+					if _, err := io.ReadFull(conn, length); err != nil {
+						return
+					}
+					packet := make([]byte, binary.BigEndian.Uint16(length))
+					if _, err := io.ReadFull(conn, packet); err != nil {
+						return
+					}
+					packed := testDNSRespond(t, handler, packet, true)
+					if packed == nil {
+						return
+					}
+					conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(packed))), packed...))
+				}
+			}(conn)
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+// startTestDoHServer starts a DNS over HTTPS server used by dohClient until the test ends and returns its URL
+func startTestDoHServer(t testing.TB, handler testDNSHandler) string {
+	t.Helper()
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/dns-message" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return
+		}
+		packed := testDNSRespond(t, handler, body, true)
+		if packed == nil {
+			http.Error(w, "no answer", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(packed)
+	}))
+
+	original := dohClient
+	dohClient = server.Client()
+	t.Cleanup(func() {
+		server.Close()
+		dohClient = original
+	})
+
+	return server.URL + "/dns-query"
+}
+
+func TestDNSMessagePackUnpack(t *testing.T) {
+	msg := &dnsMessage{
+		dnsHeader: dnsHeader{
+			ID:                 0x1234,
+			Response:           true,
+			Authoritative:      true,
+			RecursionDesired:   true,
+			RecursionAvailable: true,
+		},
+		Questions: []dnsQuestion{{Name: "example.com", Type: dnsTypeANY, Class: dnsClassINET}},
+		Answers: []dnsRR{
+			{Name: "example.com", Type: dnsTypeA, Class: dnsClassINET, TTL: 60, IP: net.ParseIP("192.0.2.1")},
+			{Name: "example.com", Type: dnsTypeAAAA, Class: dnsClassINET, TTL: 60, IP: net.ParseIP("2001:db8::1")},
+			{Name: "www.example.com", Type: dnsTypeCNAME, Class: dnsClassINET, Target: "example.com"},
+			{Name: "example.com", Type: dnsTypeMX, Class: dnsClassINET, Pref: 10, Target: "mail.example.com"},
+			{Name: "example.com", Type: dnsTypeTXT, Class: dnsClassINET, Text: []string{"v=spf1 ", "-all"}},
+			{Name: "_sip._tcp.example.com", Type: dnsTypeSRV, Class: dnsClassINET, Pref: 1, Weight: 5, Port: 5060, Target: "sip.example.com"},
+			{Name: "example.com", Type: dnsTypeSOA, Class: dnsClassINET, SOA: &SOARecord{
+				NS: "ns1.example.com", Mbox: "hostmaster@example.com", Serial: 2024010101,
+				Refresh: 7200, Retry: 3600, Expire: 1209600, MinTTL: 300,
+			}},
+		},
+		Authorities: []dnsRR{{Name: "example.com", Type: dnsTypeNS, Class: dnsClassINET, Target: "ns1.example.com"}},
+	}
+
+	packed, err := msg.pack()
+	if err != nil {
+		t.Fatalf("pack() error = %v", err)
+	}
+	parsed, err := unpackDNSMessage(packed)
+	if err != nil {
+		t.Fatalf("unpackDNSMessage() error = %v", err)
+	}
+
+	if parsed.dnsHeader != msg.dnsHeader {
+		t.Errorf("header = %+v, want %+v", parsed.dnsHeader, msg.dnsHeader)
+	}
+	if len(parsed.Answers) != len(msg.Answers) || len(parsed.Authorities) != 1 {
+		t.Fatalf("parsed %d answers and %d authorities", len(parsed.Answers), len(parsed.Authorities))
+	}
+	if !parsed.Answers[0].IP.Equal(net.ParseIP("192.0.2.1")) || !parsed.Answers[1].IP.Equal(net.ParseIP("2001:db8::1")) {
+		t.Errorf("unexpected addresses: %v %v", parsed.Answers[0].IP, parsed.Answers[1].IP)
+	}
+	if parsed.Answers[3].Pref != 10 || parsed.Answers[3].Target != "mail.example.com" {
+		t.Errorf("unexpected MX: %+v", parsed.Answers[3])
+	}
+	if len(parsed.Answers[4].Text) != 2 || parsed.Answers[4].Text[1] != "-all" {
+		t.Errorf("unexpected TXT: %+v", parsed.Answers[4].Text)
+	}
+	if srv := parsed.Answers[5]; srv.Port != 5060 || srv.Weight != 5 || srv.Target != "sip.example.com" {
+		t.Errorf("unexpected SRV: %+v", srv)
+	}
+	if soa := parsed.Answers[6].SOA; soa == nil || *soa != *msg.Answers[6].SOA {
+		t.Errorf("unexpected SOA: %+v", soa)
+	}
+}
+
+func TestDNSTypeName(t *testing.T) {
+	if got := dnsTypeName(dnsTypeAAAA); got != "AAAA" {
+		t.Errorf("dnsTypeName(28) = %q, want AAAA", got)
+	}
+	if got := dnsTypeName(65); got != "TYPE65" {
+		t.Errorf("dnsTypeName(65) = %q, want TYPE65", got)
+	}
+}
+
+func TestReadDNSNameCompression(t *testing.T) {
+	// "example.com" at offset 12, then "www" followed by a pointer to offset 12
+	msg := make([]byte, 12)
+	msg = append(msg, 7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0)
+	pointerOffset := len(msg)
+	msg = append(msg, 3, 'w', 'w', 'w', 0xc0, 12)
+
+	name, next, err := readDNSName(msg, pointerOffset)
+	if err != nil {
+		t.Fatalf("readDNSName() error = %v", err)
+	}
+	if name != "www.example.com" || next != len(msg) {
+		t.Errorf("readDNSName() = %s, %d, want www.example.com, %d", name, next, len(msg))
+	}
+
+	// A pointer to itself must not loop forever
+	loop := append(make([]byte, 12), 0xc0, 12)
+	if _, _, err := readDNSName(loop, 12); err == nil {
+		t.Error("readDNSName() expected error for pointer loop")
+	}
+}
+
+func TestSetEDNS(t *testing.T) {
+	_, subnet, _ := net.ParseCIDR("192.0.2.77/24")
+	query := newDNSQuery("example.com", dnsTypeA, true)
+	query.setEDNS(4096, true, subnet)
+
+	packed, err := query.pack()
+	if err != nil {
+		t.Fatalf("pack() error = %v", err)
+	}
+	decoded, err := unpackDNSMessage(packed)
+	if err != nil {
+		t.Fatalf("unpackDNSMessage() error = %v", err)
+	}
+	if len(decoded.Additionals) != 1 {
+		t.Fatalf("Additionals = %v", decoded.Additionals)
+	}
+
+	opt := decoded.Additionals[0]
+	if opt.Type != dnsTypeOPT || opt.Name != "" || opt.Class != 4096 || opt.TTL != 1<<15 {
+		t.Errorf("OPT = %+v", opt)
+	}
+	want := []byte{0, 8, 0, 7, 0, 1, 24, 0, 192, 0, 2}
+	if !bytes.Equal(opt.Data, want) {
+		t.Errorf("OPT data = %v, want %v", opt.Data, want)
+	}
+
+	// IPv6 prefixes not ending on a byte boundary have their host bits cleared
+	query = newDNSQuery("example.com", dnsTypeA, true)
+	query.setEDNS(1232, false, &net.IPNet{IP: net.ParseIP("2001:db8:ffff::"), Mask: net.CIDRMask(36, 128)})
+	opt = query.Additionals[0]
+	want = []byte{0, 8, 0, 9, 0, 2, 36, 0, 0x20, 0x01, 0x0d, 0xb8, 0xf0}
+	if opt.TTL != 0 || !bytes.Equal(opt.Data, want) {
+		t.Errorf("IPv6 OPT = %+v, want data %v", opt, want)
+	}
+
+	// A 16 byte IPv4 address with an IPv6 length mask
+	query = newDNSQuery("example.com", dnsTypeA, true)
+	query.setEDNS(1232, false, &net.IPNet{IP: net.ParseIP("198.51.100.1"), Mask: net.CIDRMask(112, 128)})
+	want = []byte{0, 8, 0, 6, 0, 1, 16, 0, 198, 51}
+	if data := query.Additionals[0].Data; !bytes.Equal(data, want) {
+		t.Errorf("mapped IPv4 OPT data = %v, want %v", data, want)
+	}
+}
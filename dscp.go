@@ -0,0 +1,117 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"runtime"
+	"time"
+)
+
+// dscpProbeTimeout is how long VerifyDSCP waits for each echo reply
+var dscpProbeTimeout = time.Second
+
+// DSCPResult is the outcome of VerifyDSCP
+type DSCPResult struct {
+	Host     string
+	IP       net.IP
+	DSCP     int // DSCP of the echo requests
+	Sent     int
+	Received int
+	Remarked int // Replies which arrived with another DSCP
+	Replies  []DSCPReply
+}
+
+// DSCPReply is a received echo reply and the marking it arrived with
+type DSCPReply struct {
+	Seq  int
+	RTT  time.Duration
+	TOS  int // TOS byte (IPv4) or traffic class (IPv6) of the reply
+	DSCP int // Upper 6 bits of TOS
+}
+
+// Preserved reports whether replies were received and all of them carried the DSCP of the requests
+func (r *DSCPResult) Preserved() bool {
+	return r.Received > 0 && r.Remarked == 0
+}
+
+// VerifyDSCP sends count echo requests marked with the DSCP (0-63) and reads the TOS byte or traffic class
+// of every reply. Most hosts copy the marking of the request into the reply, so a reply with another DSCP
+// means a network on the way to the host or back rewrote it ("DSCP bleaching"). Hosts which don't copy the
+// marking look the same, compare with a host next to the target if in doubt. IPv4 requires a raw ICMP socket.
+func VerifyDSCP(ctx context.Context, host string, dscp, count int) (*DSCPResult, error) {
+	if dscp < 0 || dscp > 63 {
+		return nil, fmt.Errorf("invalid DSCP %d", dscp)
+	}
+	if count <= 0 {
+		count = 4
+	}
+	target, err := resolvePingTarget(ctx, withZone(host), IPVersionAuto)
+	if err != nil {
+		return nil, err
+	}
+
+	// IPv4 sockets only report the TOS of replies from the IP header of raw sockets
+	var sock *icmpSocket
+	if target.IP.To4() != nil {
+		sock, err = listenRawIPv4(nil, false, "")
+	} else {
+		sock, err = listenICMP(target.IP)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer sock.close()
+	sock.zone = target.Zone
+	if !sock.readTOS {
+		return nil, fmt.Errorf("traffic class of replies is not readable on %s", runtime.GOOS)
+	}
+	if err := sock.setTOS(dscp << 2); err != nil {
+		return nil, fmt.Errorf("failed to set DSCP: %w", err)
+	}
+
+	result := &DSCPResult{Host: host, IP: target.IP, DSCP: dscp}
+	id, matchID := sock.echoID(0)
+	payload := make([]byte, 56)
+	buf := make([]byte, 1500)
+	for seq := 1; seq <= count; seq++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		start := time.Now()
+		if err := sock.sendEcho(target.IP, id, seq, payload); err != nil {
+			return nil, fmt.Errorf("failed to send echo request to %s: %w", target.IP, err)
+		}
+		result.Sent++
+
+		deadline := start.Add(dscpProbeTimeout)
+		if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+			deadline = ctxDeadline
+		}
+		sock.setReadDeadline(deadline)
+		for {
+			msg, from, _, err := sock.read(buf)
+			if err != nil {
+				var netErr net.Error
+				if errors.As(err, &netErr) && netErr.Timeout() {
+					break
+				}
+				continue
+			}
+			echo, ok := matchEchoReply(msg, matchID, sock.ipv6)
+			if !ok || echo.Error != "" || echo.Seq != seq || !from.Equal(target.IP) {
+				continue
+			}
+
+			reply := DSCPReply{Seq: seq, RTT: time.Since(start), TOS: sock.replyTOS, DSCP: sock.replyTOS >> 2}
+			result.Replies = append(result.Replies, reply)
+			result.Received++
+			if reply.DSCP != dscp {
+				result.Remarked++
+			}
+			break
+		}
+	}
+	return result, nil
+}
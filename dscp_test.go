@@ -0,0 +1,51 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestVerifyDSCP(t *testing.T) {
+	if _, err := VerifyDSCP(context.Background(), "127.0.0.1", 64, 1); err == nil {
+		t.Error("VerifyDSCP() accepted DSCP 64")
+	}
+	if !CanRawSocket() {
+		if _, err := VerifyDSCP(context.Background(), "127.0.0.1", 46, 1); !errors.Is(err, ErrInsufficientPrivilege) {
+			t.Errorf("VerifyDSCP() without privileges error = %v, want ErrInsufficientPrivilege", err)
+		}
+		return
+	}
+
+	// Linux copies the TOS of echo requests into the replies
+	for _, host := range []string{"127.0.0.1", "::1"} {
+		result, err := VerifyDSCP(context.Background(), host, 46, 2)
+		if err != nil {
+			t.Fatalf("VerifyDSCP(%s) error = %v", host, err)
+		}
+		if result.Sent != 2 || result.Received != 2 || !result.Preserved() {
+			t.Errorf("VerifyDSCP(%s) = %+v", host, result)
+		}
+		for _, reply := range result.Replies {
+			if reply.TOS != 46<<2 || reply.DSCP != 46 || reply.RTT <= 0 {
+				t.Errorf("VerifyDSCP(%s) reply = %+v", host, reply)
+			}
+		}
+	}
+}
+
+func TestDSCPResultPreserved(t *testing.T) {
+	tests := []struct {
+		result DSCPResult
+		want   bool
+	}{
+		{DSCPResult{Sent: 2, Received: 2}, true},
+		{DSCPResult{Sent: 2, Received: 2, Remarked: 1}, false},
+		{DSCPResult{Sent: 2}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.result.Preserved(); got != tt.want {
+			t.Errorf("%+v.Preserved() = %v, want %v", tt.result, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+// GatewayHealthReport is the result of GatewayHealth
+type GatewayHealthReport struct {
+	Gateway    net.IP
+	Reachable  bool
+	RTT        time.Duration      // Average round-trip time of the pings
+	PacketLoss float64            // Percentage of unanswered pings
+	MAC        net.HardwareAddr   // Current ARP (IPv6: neighbor) entry of the gateway, nil if unresolved
+	MACs       []net.HardwareAddr // Distinct MAC addresses seen for the gateway, including the one detected with the configuration
+	// MultipleResponders is set if more than one MAC address answered for the gateway IP: two routers
+	// answering for the same virtual IP, a failover of an HA pair or an address conflict
+	MultipleResponders bool
+	// ARPBroadcast is set if broadcast ARP requests were sent, which every responder answers. Otherwise only
+	// the ARP entry was watched, which shows a change of the MAC but rarely a second responder.
+	ARPBroadcast bool
+}
+
+// gatewayPing pings the gateway for GatewayHealth, replaced in tests
+var gatewayPing = PingContext
+
+// readNeighborTable reads the IPv6 neighbor cache for GatewayHealth, replaced in tests
+var readNeighborTable = NeighborTable
+
+// gatewayARP sends the broadcast ARP requests of GatewayHealth, replaced in tests
+var gatewayARP = broadcastARP
+
+// gatewayPollInterval is how often GatewayHealth reads the ARP table while the pings run
+var gatewayPollInterval = 200 * time.Millisecond
+
+// GatewayHealth pings the default gateway and looks for every MAC address answering for it. On Linux broadcast
+// ARP requests are sent for an IPv4 gateway while the pings run, every router claiming the address answers
+// them. Without CAP_NET_RAW, on other platforms and for IPv6 the ARP entry (neighbor entry) is watched instead.
+// The kernel keeps one entry per address and refreshes it by unicast while it's reachable, so this detects a
+// MAC differing from the one detected with the configuration or an entry flapping between routers, but
+// rarely a second responder. A steady virtual MAC (VRRP 00:00:5e:00:01:xx) is the healthy state of an HA pair.
+func GatewayHealth(ctx context.Context) (*GatewayHealthReport, error) {
+	config, err := GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	if config.DefaultGateway == nil {
+		return nil, fmt.Errorf("default gateway is not detected")
+	}
+
+	report := &GatewayHealthReport{Gateway: config.DefaultGateway}
+	report.addMAC(config.DefaultGatewayHardwareAddress)
+
+	done := make(chan struct{})
+	var result *PingResult
+	var pingErr error
+	go func() {
+		defer close(done)
+		result, pingErr = gatewayPing(ctx, config.DefaultGateway.String(), &PingOptions{Count: 5, Timeout: time.Second})
+	}()
+
+	arpDone := make(chan struct{})
+	var arpMACs []net.HardwareAddr
+	var arpErr error
+	go func() {
+		defer close(arpDone)
+		if config.Interface == nil || config.DefaultGateway.To4() == nil || config.LocalIP.To4() == nil {
+			arpErr = fmt.Errorf("no IPv4 interface for broadcast ARP")
+			return
+		}
+		arpMACs, arpErr = gatewayARP(ctx, config.Interface, config.LocalIP.To4(), config.DefaultGateway.To4(), 5, time.Second)
+	}()
+
+	// The pings keep the entry fresh while it's watched
+	ticker := time.NewTicker(gatewayPollInterval)
+	defer ticker.Stop()
+	for polling := true; polling; {
+		select {
+		case <-ticker.C:
+		case <-done:
+			polling = false
+		}
+		report.addMAC(gatewayMAC(config.DefaultGateway))
+	}
+	<-arpDone
+	if pingErr != nil {
+		return nil, fmt.Errorf("failed to ping gateway %s: %w", config.DefaultGateway, pingErr)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if arpErr == nil {
+		report.ARPBroadcast = true
+		for _, mac := range arpMACs {
+			report.addMAC(mac)
+		}
+	} else {
+		logger().Warn("broadcast ARP failed, watching the ARP entry only", "gateway", config.DefaultGateway, "error", arpErr)
+	}
+
+	report.Reachable = result.Success
+	report.RTT = result.AvgRTT
+	report.PacketLoss = result.PacketLoss
+	report.MAC = gatewayMAC(config.DefaultGateway)
+	report.addMAC(report.MAC)
+	report.MultipleResponders = len(report.MACs) > 1
+	return report, nil
+}
+
+// gatewayMAC returns the current link-layer address of the gateway, nil if it's not resolved
+func gatewayMAC(gateway net.IP) net.HardwareAddr {
+	if gateway.To4() != nil {
+		table, err := readARPTable()
+		if err != nil {
+			return nil
+		}
+		return table[gateway.String()]
+	}
+
+	entries, err := readNeighborTable()
+	if err != nil {
+		return nil
+	}
+	for _, entry := range entries {
+		if entry.IP.Equal(gateway) && entry.MAC != nil {
+			return entry.MAC
+		}
+	}
+	return nil
+}
+
+// addMAC records a MAC address seen for the gateway
+func (r *GatewayHealthReport) addMAC(mac net.HardwareAddr) {
+	if len(mac) == 0 {
+		return
+	}
+	for _, seen := range r.MACs {
+		if seen.String() == mac.String() {
+			return
+		}
+	}
+	r.MACs = append(r.MACs, mac)
+}
@@ -0,0 +1,110 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGatewayHealth(t *testing.T) {
+	originalLoad, originalPing, originalARP, originalInterval := loadConfig, gatewayPing, readARPTable, gatewayPollInterval
+	originalBroadcast := gatewayARP
+	defer func() {
+		loadConfig, gatewayPing, readARPTable, gatewayPollInterval = originalLoad, originalPing, originalARP, originalInterval
+		gatewayARP = originalBroadcast
+		defaultDetector = &Detector{}
+	}()
+	defaultDetector = &Detector{}
+	gatewayPollInterval = 10 * time.Millisecond
+	gatewayARP = func(ctx context.Context, interf *net.Interface, source, target net.IP, count int, interval time.Duration) ([]net.HardwareAddr, error) {
+		return nil, errors.New("operation not permitted")
+	}
+
+	first, _ := net.ParseMAC("00:00:5e:00:01:01")
+	second, _ := net.ParseMAC("00:11:22:33:44:55")
+	loadConfig = func(string) (*Network, error) {
+		return &Network{
+			LocalIP:                       net.ParseIP("192.168.1.10"),
+			DefaultGateway:                net.ParseIP("192.168.1.1"),
+			DefaultGatewayHardwareAddress: first,
+		}, nil
+	}
+	gatewayPing = func(ctx context.Context, host string, options *PingOptions, opts ...Option) (*PingResult, error) {
+		if host != "192.168.1.1" {
+			t.Errorf("pinged %s, want the gateway", host)
+		}
+		time.Sleep(100 * time.Millisecond)
+		return &PingResult{Host: host, Success: true, Sent: 5, Received: 4, PacketLoss: 20, AvgRTT: 2 * time.Millisecond}, nil
+	}
+
+	// A steady virtual MAC is healthy
+	readARPTable = func() (map[string]net.HardwareAddr, error) {
+		return map[string]net.HardwareAddr{"192.168.1.1": first}, nil
+	}
+	report, err := GatewayHealth(context.Background())
+	if err != nil {
+		t.Fatalf("GatewayHealth() error = %v", err)
+	}
+	if !report.Reachable || report.RTT != 2*time.Millisecond || report.PacketLoss != 20 {
+		t.Errorf("Reachable/RTT/PacketLoss = %v/%v/%v", report.Reachable, report.RTT, report.PacketLoss)
+	}
+	if report.MultipleResponders || len(report.MACs) != 1 || report.MAC.String() != first.String() || report.ARPBroadcast {
+		t.Errorf("MAC/MACs/MultipleResponders/ARPBroadcast = %v/%v/%v/%v", report.MAC, report.MACs, report.MultipleResponders, report.ARPBroadcast)
+	}
+
+	// The entry flaps between two routers
+	var reads int32
+	readARPTable = func() (map[string]net.HardwareAddr, error) {
+		if atomic.AddInt32(&reads, 1)%2 == 0 {
+			return map[string]net.HardwareAddr{"192.168.1.1": second}, nil
+		}
+		return map[string]net.HardwareAddr{"192.168.1.1": first}, nil
+	}
+	report, err = GatewayHealth(context.Background())
+	if err != nil {
+		t.Fatalf("GatewayHealth() error = %v", err)
+	}
+	if !report.MultipleResponders || len(report.MACs) != 2 {
+		t.Errorf("MACs/MultipleResponders = %v/%v, want 2 MACs", report.MACs, report.MultipleResponders)
+	}
+
+	// A second router answers the broadcast requests while the ARP entry stays steady
+	defaultDetector = &Detector{}
+	interf := &net.Interface{Index: 2, Name: "eth0", HardwareAddr: net.HardwareAddr{0x02, 0, 0, 0, 0, 1}}
+	loadConfig = func(string) (*Network, error) {
+		return &Network{
+			LocalIP:                       net.ParseIP("192.168.1.10"),
+			DefaultGateway:                net.ParseIP("192.168.1.1"),
+			DefaultGatewayHardwareAddress: first,
+			Interface:                     interf,
+		}, nil
+	}
+	readARPTable = func() (map[string]net.HardwareAddr, error) {
+		return map[string]net.HardwareAddr{"192.168.1.1": first}, nil
+	}
+	gatewayARP = func(ctx context.Context, i *net.Interface, source, target net.IP, count int, interval time.Duration) ([]net.HardwareAddr, error) {
+		if i != interf || !source.Equal(net.ParseIP("192.168.1.10")) || !target.Equal(net.ParseIP("192.168.1.1")) {
+			t.Errorf("broadcast ARP from %s %s for %s", i.Name, source, target)
+		}
+		return []net.HardwareAddr{first, second}, nil
+	}
+	report, err = GatewayHealth(context.Background())
+	if err != nil {
+		t.Fatalf("GatewayHealth() error = %v", err)
+	}
+	if !report.ARPBroadcast || !report.MultipleResponders || len(report.MACs) != 2 || report.MAC.String() != first.String() {
+		t.Errorf("ARPBroadcast/MACs/MultipleResponders = %v/%v/%v, want both responders", report.ARPBroadcast, report.MACs, report.MultipleResponders)
+	}
+
+	// Without gateway there is nothing to check
+	defaultDetector = &Detector{}
+	loadConfig = func(string) (*Network, error) {
+		return &Network{LocalIP: net.ParseIP("192.168.1.10")}, nil
+	}
+	if _, err := GatewayHealth(context.Background()); err == nil {
+		t.Error("expected error without default gateway")
+	}
+}
@@ -1,3 +1,7 @@
 module github.com/getevo/network
 
 go 1.20
+
+require golang.org/x/net v0.35.0
+
+require golang.org/x/sys v0.30.0
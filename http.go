@@ -0,0 +1,173 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Version is the version of this library
+const Version = "0.1.0"
+
+// DefaultUserAgent is sent with HTTP requests which don't set a User-Agent
+var DefaultUserAgent = "getevo-network/" + Version
+
+// requestHeader returns the headers of an outgoing HTTP request. The user agent overrides a
+// User-Agent of the headers, DefaultUserAgent is used if neither sets one.
+func requestHeader(headers http.Header, userAgent string) http.Header {
+	header := headers.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	if userAgent != "" {
+		header.Set("User-Agent", userAgent)
+	} else if header.Get("User-Agent") == "" {
+		header.Set("User-Agent", DefaultUserAgent)
+	}
+	return header
+}
+
+// HTTPCheckOptions configures HTTPCheck
+type HTTPCheckOptions struct {
+	ProbeOptions // Timeout of each request (default: 10 seconds), retries and source address
+
+	// FollowRedirects follows the Location of 3xx responses, up to MaxRedirects (default: 10) redirects
+	FollowRedirects bool
+	MaxRedirects    int
+
+	// Headers are added to the requests, UserAgent overrides their User-Agent (default: DefaultUserAgent)
+	Headers   http.Header
+	UserAgent string
+}
+
+// RedirectStep is a request of the redirect chain of HTTPCheck
+type RedirectStep struct {
+	URL      string
+	Status   int
+	Duration time.Duration // Time until the response headers arrived
+}
+
+// HTTPCheckResult is the result of HTTPCheck
+type HTTPCheckResult struct {
+	URL    string         // URL of the last response
+	Status int            // Status code of the last response
+	Chain  []RedirectStep // Every request made, the redirects followed by the last response
+}
+
+// HTTPCheck sends a GET request to the URL and reports the status of the response. With FollowRedirects
+// the redirects are followed and recorded, so a chain such as http -> https -> www can be checked to end
+// at a healthy endpoint. Revisiting a URL of the chain is a redirect loop. The result is returned with
+// the chain so far if a request fails, the chain loops or exceeds MaxRedirects.
+func HTTPCheck(ctx context.Context, rawURL string, opts *HTTPCheckOptions) (*HTTPCheckResult, error) {
+	options := HTTPCheckOptions{}
+	if opts != nil {
+		options = *opts
+	}
+	if options.MaxRedirects <= 0 {
+		options.MaxRedirects = 10
+	}
+	probe, err := options.ProbeOptions.normalize(10 * time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL %q: %w", rawURL, err)
+	}
+	if (current.Scheme != "http" && current.Scheme != "https") || current.Host == "" {
+		return nil, fmt.Errorf("invalid URL %q: http or https URL expected", rawURL)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = probe.dialer().DialContext
+	defer transport.CloseIdleConnections()
+	client := &http.Client{
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	header := requestHeader(options.Headers, options.UserAgent)
+
+	result := &HTTPCheckResult{}
+	visited := map[string]bool{}
+	for {
+		visited[current.String()] = true
+		step, location, err := httpCheckRequest(ctx, client, current, header, probe)
+		if err != nil {
+			return result, err
+		}
+		result.Chain = append(result.Chain, step)
+		result.URL = step.URL
+		result.Status = step.Status
+
+		if !options.FollowRedirects || location == nil {
+			return result, nil
+		}
+		if visited[location.String()] {
+			return result, fmt.Errorf("redirect loop: %s redirects back to %s", current, location)
+		}
+		if len(result.Chain) > options.MaxRedirects {
+			return result, fmt.Errorf("stopped after %d redirects", options.MaxRedirects)
+		}
+		current = location
+	}
+}
+
+// httpCheckRequest requests the URL, repeating failed requests up to the retries of the options. The
+// target of a redirect response is returned, nil for other responses.
+func httpCheckRequest(ctx context.Context, client *http.Client, target *url.URL, header http.Header, probe ProbeOptions) (RedirectStep, *url.URL, error) {
+	step := RedirectStep{URL: target.String()}
+
+	var resp *http.Response
+	var err error
+	for attempt := 0; attempt <= probe.Retries; attempt++ {
+		if attempt > 0 {
+			logger().Info("retrying HTTP request", "url", step.URL, "attempt", attempt, "error", err)
+		}
+		requestCtx, cancel := context.WithTimeout(ctx, probe.Timeout)
+		var request *http.Request
+		request, err = http.NewRequestWithContext(requestCtx, http.MethodGet, step.URL, nil)
+		if err != nil {
+			cancel()
+			return step, nil, err
+		}
+		request.Header = header.Clone()
+
+		start := time.Now()
+		resp, err = client.Do(request)
+		step.Duration = time.Since(start)
+		if err == nil {
+			// The body is drained for the connection to be reused by the next request of the chain
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+			resp.Body.Close()
+			cancel()
+			break
+		}
+		cancel()
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if err != nil {
+		return step, nil, fmt.Errorf("failed to request %s: %w", step.URL, err)
+	}
+
+	step.Status = resp.StatusCode
+	if resp.StatusCode < 300 || resp.StatusCode > 399 {
+		return step, nil, nil
+	}
+	location := resp.Header.Get("Location")
+	if location == "" {
+		return step, nil, nil
+	}
+	next, err := target.Parse(location)
+	if err != nil {
+		return step, nil, fmt.Errorf("invalid redirect from %s to %q: %w", step.URL, location, err)
+	}
+	return step, next, nil
+}
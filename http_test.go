@@ -0,0 +1,136 @@
+package network
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestHeader(t *testing.T) {
+	header := requestHeader(nil, "")
+	if got := header.Get("User-Agent"); got != DefaultUserAgent {
+		t.Errorf("default User-Agent = %q, want %q", got, DefaultUserAgent)
+	}
+
+	headers := http.Header{"Authorization": {"Bearer token"}, "User-Agent": {"custom/1.0"}}
+	header = requestHeader(headers, "")
+	if header.Get("User-Agent") != "custom/1.0" || header.Get("Authorization") != "Bearer token" {
+		t.Errorf("requestHeader() = %v", header)
+	}
+
+	header = requestHeader(headers, "override/2.0")
+	if header.Get("User-Agent") != "override/2.0" {
+		t.Errorf("UserAgent did not override headers: %v", header)
+	}
+	if headers.Get("User-Agent") != "custom/1.0" {
+		t.Error("requestHeader() modified the caller's headers")
+	}
+}
+
+func TestHTTPCheck(t *testing.T) {
+	var userAgent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/":
+			userAgent = r.Header.Get("User-Agent")
+			http.Redirect(w, r, "/login", http.StatusMovedPermanently)
+		case r.URL.Path == "/login":
+			http.Redirect(w, r, "/home", http.StatusFound)
+		case r.URL.Path == "/home":
+			w.WriteHeader(http.StatusOK)
+		case r.URL.Path == "/a":
+			http.Redirect(w, r, "/b", http.StatusFound)
+		case r.URL.Path == "/b":
+			http.Redirect(w, r, "/a", http.StatusFound)
+		case strings.HasPrefix(r.URL.Path, "/hop/"):
+			n, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/hop/"))
+			http.Redirect(w, r, "/hop/"+strconv.Itoa(n+1), http.StatusTemporaryRedirect)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	ctx := context.Background()
+
+	result, err := HTTPCheck(ctx, server.URL+"/", &HTTPCheckOptions{FollowRedirects: true, UserAgent: "checker/1.0"})
+	if err != nil {
+		t.Fatalf("HTTPCheck() error = %v", err)
+	}
+	if result.URL != server.URL+"/home" || result.Status != http.StatusOK {
+		t.Errorf("HTTPCheck() ended at %s with %d", result.URL, result.Status)
+	}
+	wantChain := []RedirectStep{
+		{URL: server.URL + "/", Status: http.StatusMovedPermanently},
+		{URL: server.URL + "/login", Status: http.StatusFound},
+		{URL: server.URL + "/home", Status: http.StatusOK},
+	}
+	if len(result.Chain) != len(wantChain) {
+		t.Fatalf("Chain = %+v, want %d steps", result.Chain, len(wantChain))
+	}
+	for i, step := range result.Chain {
+		if step.URL != wantChain[i].URL || step.Status != wantChain[i].Status || step.Duration <= 0 {
+			t.Errorf("Chain[%d] = %+v, want %+v", i, step, wantChain[i])
+		}
+	}
+	if userAgent != "checker/1.0" {
+		t.Errorf("User-Agent = %q, want checker/1.0", userAgent)
+	}
+
+	// Without FollowRedirects the first response is reported
+	result, err = HTTPCheck(ctx, server.URL+"/", nil)
+	if err != nil || result.Status != http.StatusMovedPermanently || len(result.Chain) != 1 {
+		t.Errorf("HTTPCheck() without redirects = %+v, %v", result, err)
+	}
+
+	result, err = HTTPCheck(ctx, server.URL+"/a", &HTTPCheckOptions{FollowRedirects: true})
+	if err == nil || !strings.Contains(err.Error(), "redirect loop") {
+		t.Errorf("HTTPCheck() loop error = %v", err)
+	}
+	if result == nil || len(result.Chain) != 2 {
+		t.Errorf("HTTPCheck() loop result = %+v", result)
+	}
+
+	result, err = HTTPCheck(ctx, server.URL+"/hop/0", &HTTPCheckOptions{FollowRedirects: true, MaxRedirects: 3})
+	if err == nil || result == nil || len(result.Chain) != 4 {
+		t.Errorf("HTTPCheck() with MaxRedirects 3 = %+v, %v", result, err)
+	}
+
+	for _, invalid := range []string{"ftp://example.com/", "://", "example.com"} {
+		if _, err := HTTPCheck(ctx, invalid, nil); err == nil {
+			t.Errorf("HTTPCheck(%q) accepted an invalid URL", invalid)
+		}
+	}
+
+	result, err = HTTPCheck(ctx, "http://127.0.0.1:"+strconv.Itoa(closedPort(t))+"/", &HTTPCheckOptions{FollowRedirects: true})
+	if err == nil || result == nil || len(result.Chain) != 0 {
+		t.Errorf("HTTPCheck() of a closed port = %+v, %v", result, err)
+	}
+}
+
+func TestHTTPCheckInterfaceIPv6(t *testing.T) {
+	loopback, err := interfaceByIP(net.ParseIP("127.0.0.1"))
+	if err != nil {
+		t.Skipf("no loopback interface: %v", err)
+	}
+	listener, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 loopback unavailable: %v", err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Listener.Close()
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+
+	result, err := HTTPCheck(context.Background(), server.URL, &HTTPCheckOptions{
+		ProbeOptions: ProbeOptions{Timeout: time.Second, Interface: loopback.Name},
+	})
+	if err != nil || result.Status != http.StatusOK {
+		t.Errorf("HTTPCheck(%s) from %s = %+v, %v", server.URL, loopback.Name, result, err)
+	}
+}
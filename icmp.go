@@ -0,0 +1,890 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// ErrInsufficientPrivilege is returned by the native pinger when the ICMP socket can't be opened.
+// Raw ICMP sockets require root or the CAP_NET_RAW capability:
+//
+//	sudo setcap cap_net_raw+ep /path/to/binary
+//
+// On Linux unprivileged ICMP sockets can be allowed for all groups instead:
+//
+//	sudo sysctl -w net.ipv4.ping_group_range="0 2147483647"
+var ErrInsufficientPrivilege = errors.New("insufficient privilege to open ICMP socket: run as root, " +
+	"grant CAP_NET_RAW (setcap cap_net_raw+ep <binary>) or allow unprivileged ICMP via net.ipv4.ping_group_range")
+
+// nativePingInterval is the time between echo requests of the native pinger
+const nativePingInterval = time.Second
+
+// CanRawSocket reports whether the process may open raw ICMP sockets
+func CanRawSocket() bool {
+	conn, err := icmp.ListenPacket("ip4:icmp", "0.0.0.0")
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// Ping modes reported in PingResult.Mode
+const (
+	PingModeCommand      = "command"      // ping command was executed
+	PingModeUnprivileged = "unprivileged" // datagram ICMP socket, no privileges required
+	PingModeRaw          = "raw"          // raw ICMP socket
+)
+
+// icmpSocket is an ICMP socket of either IP version
+type icmpSocket struct {
+	conn *icmp.PacketConn
+	ipv6 bool
+	mode string
+	zone string // zone of IPv6 link-local destinations
+
+	readTOS  bool // The TOS byte or traffic class of received packets is known
+	replyTOS int  // TOS byte or traffic class of the last packet read
+
+	// Raw IPv4 sockets write and read whole packets to carry the source route option, conn is nil
+	raw        *ipv4.RawConn
+	route      []net.IP // Source route, empty to send directly
+	strict     bool
+	ttl        int
+	tos        int
+	replyRoute []net.IP // Source route option of the last packet read, nil if it had none
+}
+
+// listenICMP opens an ICMP socket matching the address family of ip. An unprivileged datagram socket
+// is tried first (Linux with net.ipv4.ping_group_range permitting the group, macOS), then a raw socket.
+func listenICMP(ip net.IP) (*icmpSocket, error) {
+	return listenICMPFrom(ip, "")
+}
+
+// listenICMPFrom is like listenICMP but binds the socket to the local address, any address if empty
+func listenICMPFrom(ip net.IP, local string) (*icmpSocket, error) {
+	ipv6Socket := ip.To4() == nil
+	network, address := "ip4:icmp", "0.0.0.0"
+	datagramNetwork := "udp4"
+	if ipv6Socket {
+		network, address = "ip6:ipv6-icmp", "::"
+		datagramNetwork = "udp6"
+	}
+	if local != "" {
+		address = local
+	}
+
+	mode := PingModeUnprivileged
+	var conn *icmp.PacketConn
+	err := fmt.Errorf("datagram ICMP sockets are not supported on %s", runtime.GOOS)
+	if runtime.GOOS != "windows" {
+		conn, err = icmp.ListenPacket(datagramNetwork, address)
+	}
+	if err != nil {
+		mode = PingModeRaw
+		conn, err = icmp.ListenPacket(network, address)
+	}
+	if err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			return nil, fmt.Errorf("%w (%v)", ErrInsufficientPrivilege, err)
+		}
+		return nil, fmt.Errorf("failed to open ICMP socket: %w", err)
+	}
+
+	// TTL and traffic class of replies are optional, ignore platforms not supporting them. IPv4 sockets
+	// don't deliver the TOS, it is only readable from the header on raw sockets.
+	sock := &icmpSocket{conn: conn, ipv6: ipv6Socket, mode: mode}
+	if ipv6Socket {
+		_ = conn.IPv6PacketConn().SetControlMessage(ipv6.FlagHopLimit, true)
+		sock.readTOS = conn.IPv6PacketConn().SetControlMessage(ipv6.FlagTrafficClass, true) == nil
+	} else {
+		_ = conn.IPv4PacketConn().SetControlMessage(ipv4.FlagTTL, true)
+	}
+	return sock, nil
+}
+
+// checkLocalAddr verifies that the local address is assigned to this host and has the IP version of dst
+func checkLocalAddr(local string, dst net.IP) error {
+	host, _, _ := strings.Cut(local, "%")
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("invalid local address %q", local)
+	}
+	if (ip.To4() == nil) != (dst.To4() == nil) {
+		return fmt.Errorf("local address %s can't reach %s, the IP versions differ", local, dst)
+	}
+	if _, err := interfaceByIP(ip); err != nil {
+		return fmt.Errorf("local address %s is not assigned to this host", local)
+	}
+	return nil
+}
+
+// listenRawIPv4 opens a raw IPv4 ICMP socket sending through the route if not empty, bound to the local
+// address if not empty. It reads the IP header of received packets.
+func listenRawIPv4(route []net.IP, strict bool, local string) (*icmpSocket, error) {
+	if local == "" {
+		local = "0.0.0.0"
+	}
+	conn, err := net.ListenPacket("ip4:icmp", local)
+	if err == nil {
+		var raw *ipv4.RawConn
+		if raw, err = ipv4.NewRawConn(conn); err == nil {
+			return &icmpSocket{mode: PingModeRaw, readTOS: true, raw: raw, route: route, strict: strict, ttl: 64}, nil
+		}
+		conn.Close()
+	}
+	if errors.Is(err, os.ErrPermission) {
+		return nil, fmt.Errorf("%w (%v)", ErrInsufficientPrivilege, err)
+	}
+	return nil, fmt.Errorf("failed to open raw ICMP socket: %w", err)
+}
+
+// sourceRouteOption returns the IP options carrying the loose or strict source route to dst. The first
+// router is the destination of the IP header, the option lists the rest and dst. A leading NOP aligns
+// the addresses to 4 bytes.
+func sourceRouteOption(route []net.IP, dst net.IP, strict bool) []byte {
+	hops := append(append([]net.IP(nil), route[1:]...), dst)
+	optionType := byte(0x83) // LSRR
+	if strict {
+		optionType = 0x89 // SSRR
+	}
+	option := []byte{1, optionType, byte(3 + 4*len(hops)), 4}
+	for _, hop := range hops {
+		option = append(option, hop.To4()...)
+	}
+	return option
+}
+
+// parseSourceRoute returns the addresses of the loose or strict source route option, nil if there is none
+func parseSourceRoute(options []byte) []net.IP {
+	for i := 0; i < len(options); {
+		switch options[i] {
+		case 0: // End of options
+			return nil
+		case 1: // NOP
+			i++
+			continue
+		}
+		if i+1 >= len(options) || options[i+1] < 2 || i+int(options[i+1]) > len(options) {
+			return nil
+		}
+		length := int(options[i+1])
+		if options[i] == 0x83 || options[i] == 0x89 {
+			var route []net.IP
+			for j := i + 3; j+4 <= i+length; j += 4 {
+				route = append(route, net.IP(append([]byte(nil), options[j:j+4]...)))
+			}
+			return route
+		}
+		i += length
+	}
+	return nil
+}
+
+// close closes the socket
+func (s *icmpSocket) close() error {
+	if s.raw != nil {
+		return s.raw.Close()
+	}
+	return s.conn.Close()
+}
+
+// setReadDeadline sets the deadline of pending and future reads
+func (s *icmpSocket) setReadDeadline(t time.Time) error {
+	if s.raw != nil {
+		return s.raw.SetReadDeadline(t)
+	}
+	return s.conn.SetReadDeadline(t)
+}
+
+// checkSourceRoute verifies that the route and its destination are IPv4 and fit the option
+func checkSourceRoute(route []net.IP, dst net.IP) error {
+	if dst.To4() == nil {
+		return fmt.Errorf("source route requires an IPv4 destination")
+	}
+	if len(route) > 9 {
+		return fmt.Errorf("source route is limited to 9 routers, got %d", len(route))
+	}
+	for _, hop := range route {
+		if hop.To4() == nil {
+			return fmt.Errorf("source route requires IPv4 routers, got %v", hop)
+		}
+	}
+	return nil
+}
+
+// setTTL sets the TTL/hop limit of outgoing packets
+func (s *icmpSocket) setTTL(ttl int) error {
+	if s.raw != nil {
+		s.ttl = ttl
+		return nil
+	}
+	if s.ipv6 {
+		return s.conn.IPv6PacketConn().SetHopLimit(ttl)
+	}
+	return s.conn.IPv4PacketConn().SetTTL(ttl)
+}
+
+// setTOS sets the TOS byte (IPv4) or traffic class (IPv6) of outgoing packets
+func (s *icmpSocket) setTOS(tos int) error {
+	if s.raw != nil {
+		s.tos = tos
+		return nil
+	}
+	if s.ipv6 {
+		return s.conn.IPv6PacketConn().SetTrafficClass(tos)
+	}
+	return s.conn.IPv4PacketConn().SetTOS(tos)
+}
+
+// echoID returns the identifier of echo requests, random if id is 0, and the identifier their replies
+// are matched with. The kernel replaces the identifier of datagram sockets and delivers their replies
+// only, so their replies match any identifier (-1).
+func (s *icmpSocket) echoID(id int) (int, int) {
+	if id == 0 {
+		id = rand.Intn(0xffff) + 1
+	}
+	if s.mode == PingModeUnprivileged {
+		return id, -1
+	}
+	return id, id
+}
+
+// sendEcho sends an echo request
+func (s *icmpSocket) sendEcho(ip net.IP, id, seq int, payload []byte) error {
+	msg := icmp.Message{
+		Type: ipv4.ICMPTypeEcho,
+		Body: &icmp.Echo{ID: id, Seq: seq, Data: payload},
+	}
+	if s.ipv6 {
+		msg.Type = ipv6.ICMPTypeEchoRequest
+	}
+
+	data, err := msg.Marshal(nil)
+	if err != nil {
+		return err
+	}
+	if s.raw != nil {
+		var options []byte
+		dst := ip.To4()
+		if len(s.route) > 0 {
+			options = sourceRouteOption(s.route, ip, s.strict)
+			dst = s.route[0].To4()
+		}
+		header := &ipv4.Header{
+			Version:  ipv4.Version,
+			Len:      ipv4.HeaderLen + len(options),
+			TOS:      s.tos,
+			TotalLen: ipv4.HeaderLen + len(options) + len(data),
+			TTL:      s.ttl,
+			Protocol: 1,
+			Dst:      dst,
+			Options:  options,
+		}
+		return s.raw.WriteTo(header, data, nil)
+	}
+	var dst net.Addr = &net.IPAddr{IP: ip, Zone: s.zone}
+	if s.mode == PingModeUnprivileged {
+		dst = &net.UDPAddr{IP: ip, Zone: s.zone}
+	}
+	_, err = s.conn.WriteTo(data, dst)
+	return err
+}
+
+// read reads an ICMP message and returns its sender and the TTL of the packet (0 if unknown). The TOS
+// byte or traffic class of the packet is kept in replyTOS if readTOS is set.
+func (s *icmpSocket) read(buf []byte) (*icmp.Message, net.IP, int, error) {
+	if s.raw != nil {
+		header, payload, _, err := s.raw.ReadFrom(buf)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		s.replyTOS = header.TOS
+		s.replyRoute = parseSourceRoute(header.Options)
+		msg, err := icmp.ParseMessage(1, payload)
+		return msg, header.Src, header.TTL, err
+	}
+
+	var (
+		n   int
+		ttl int
+		src net.Addr
+		err error
+	)
+	if s.ipv6 {
+		var cm *ipv6.ControlMessage
+		n, cm, src, err = s.conn.IPv6PacketConn().ReadFrom(buf)
+		if cm != nil {
+			ttl = cm.HopLimit
+			s.replyTOS = cm.TrafficClass
+		}
+	} else {
+		var cm *ipv4.ControlMessage
+		n, cm, src, err = s.conn.IPv4PacketConn().ReadFrom(buf)
+		if cm != nil {
+			ttl = cm.TTL
+		}
+	}
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	protocol := 1 // ICMP
+	if s.ipv6 {
+		protocol = 58 // ICMPv6
+	}
+	msg, err := icmp.ParseMessage(protocol, buf[:n])
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	return msg, addrIP(src), ttl, nil
+}
+
+// pingNative pings the host with ICMP sockets instead of the ping command, host names are resolved
+// in the network namespace
+func pingNative(ctx context.Context, host string, options *PingOptions, version int, namespace string) (*PingResult, error) {
+	if options.RecordRoute {
+		return nil, fmt.Errorf("record route is not supported by the native pinger")
+	}
+
+	target, err := resolveNamespacePingTarget(ctx, host, version, namespace)
+	if err != nil {
+		return nil, err
+	}
+	ip := target.IP
+
+	if options.LocalAddr != "" {
+		if err := checkLocalAddr(options.LocalAddr, ip); err != nil {
+			return nil, err
+		}
+	}
+	var sock *icmpSocket
+	if len(options.RouteVia) > 0 {
+		if err := checkSourceRoute(options.RouteVia, ip); err != nil {
+			return nil, err
+		}
+		sock, err = listenRawIPv4(options.RouteVia, options.StrictRoute, options.LocalAddr)
+	} else if options.DSCP > 0 && ip.To4() != nil {
+		// Read the TOS of the replies from their IP header, PingReply.TOS is -1 without privileges
+		if sock, err = listenRawIPv4(nil, false, options.LocalAddr); err != nil {
+			sock, err = listenICMPFrom(ip, options.LocalAddr)
+		}
+	} else {
+		sock, err = listenICMPFrom(ip, options.LocalAddr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer sock.close()
+	sock.zone = target.Zone
+
+	if options.TTL > 0 {
+		if err := sock.setTTL(options.TTL); err != nil {
+			return nil, fmt.Errorf("failed to set TTL: %w", err)
+		}
+	}
+	if options.DSCP > 0 {
+		if err := sock.setTOS(options.DSCP << 2); err != nil {
+			return nil, fmt.Errorf("failed to set DSCP: %w", err)
+		}
+	}
+
+	// Unblock pending reads when the context is done
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			sock.setReadDeadline(time.Now())
+		case <-stop:
+		}
+	}()
+
+	var (
+		result  = &PingResult{Host: host, Mode: sock.mode}
+		payload = pingPayload(options.Size, options.Pattern)
+		buf     = make([]byte, options.Size+1500)
+		sentAt  = make(map[int]time.Time)
+		done    = make(map[int]bool)
+		sent    []int
+		routed  = true // Every reply carried a source route option
+	)
+
+	id, matchID := sock.echoID(options.Identifier)
+	firstSeq := options.SequenceStart
+	if firstSeq == 0 {
+		firstSeq = 1
+	}
+
+	for i := 0; i < options.Count && ctx.Err() == nil; i++ {
+		seq := (firstSeq + i) & 0xffff
+		start := time.Now()
+		if err := sock.sendEcho(ip, id, seq, payload); err != nil {
+			return nil, fmt.Errorf("failed to send echo request to %s: %w", ip, err)
+		}
+		sentAt[seq] = start
+		sent = append(sent, seq)
+
+		// Wait for replies until the next request is due, the last request waits for the timeout.
+		// In adaptive mode the next request is sent as soon as this one is answered.
+		last := i == options.Count-1
+		waitUntil := start.Add(nativePingInterval)
+		if last || options.Adaptive {
+			waitUntil = start.Add(options.Timeout)
+		}
+
+		for ctx.Err() == nil && time.Now().Before(waitUntil) && !(last && len(done) == len(sent)) && !(options.Adaptive && done[seq]) {
+			sock.setReadDeadline(waitUntil)
+			msg, from, ttl, err := sock.read(buf)
+			if err != nil {
+				var netErr net.Error
+				if errors.As(err, &netErr) && netErr.Timeout() {
+					break
+				}
+				continue
+			}
+
+			reply, ok := matchEchoReply(msg, matchID, sock.ipv6)
+			if !ok || done[reply.Seq] {
+				continue
+			}
+			sentTime, pending := sentAt[reply.Seq]
+			if !pending {
+				continue
+			}
+			done[reply.Seq] = true
+
+			reply.From = from
+			if reply.Error != "" {
+				result.addICMPError(ICMPError{From: from, Seq: reply.Seq, Type: reply.Error})
+			} else {
+				reply.TTL = ttl
+				reply.RTT = time.Since(sentTime)
+				if options.DSCP > 0 {
+					reply.TOS = -1
+					if sock.readTOS {
+						reply.TOS = sock.replyTOS
+					}
+				}
+				if echo, ok := msg.Body.(*icmp.Echo); ok && !bytes.Equal(echo.Data, payload) {
+					result.Corrupted++
+				}
+				if len(sock.route) > 0 {
+					if result.ReturnRoute == nil {
+						result.ReturnRoute = sock.replyRoute
+					}
+					routed = routed && sock.replyRoute != nil
+				}
+			}
+			result.Replies = append(result.Replies, reply)
+		}
+	}
+
+	for _, seq := range sent {
+		if !done[seq] {
+			result.Replies = append(result.Replies, PingReply{Seq: seq, Error: "timeout"})
+		}
+	}
+
+	result.summarizeReplies()
+	result.OutOfOrder, result.MissingSeqs = sequenceGaps(sent, result.Replies)
+	result.RoutedVia = len(sock.route) > 0 && result.Received > 0 && routed
+	if result.Received == 0 {
+		result.ErrorMessage = fmt.Sprintf("no reply from %s", host)
+	}
+	return result, nil
+}
+
+// pingPayload returns a payload of the size filled with the repeated pattern
+func pingPayload(size int, pattern []byte) []byte {
+	payload := make([]byte, size)
+	if len(pattern) > 0 {
+		for i := range payload {
+			payload[i] = pattern[i%len(pattern)]
+		}
+	}
+	return payload
+}
+
+// matchEchoReply returns the reply or ICMP error for an echo request sent with the identifier,
+// a negative identifier matches any
+func matchEchoReply(msg *icmp.Message, id int, ipv6Message bool) (PingReply, bool) {
+	switch body := msg.Body.(type) {
+	case *icmp.Echo:
+		if msg.Type != ipv4.ICMPTypeEchoReply && msg.Type != ipv6.ICMPTypeEchoReply {
+			return PingReply{}, false
+		}
+		if id >= 0 && body.ID != id {
+			return PingReply{}, false
+		}
+		return PingReply{Seq: body.Seq}, true
+	case *icmp.TimeExceeded:
+		if seq, ok := quotedEchoSeq(body.Data, id, ipv6Message); ok {
+			return PingReply{Seq: seq, Error: "Time to live exceeded"}, true
+		}
+	case *icmp.DstUnreach:
+		if seq, ok := quotedEchoSeq(body.Data, id, ipv6Message); ok {
+			return PingReply{Seq: seq, Error: unreachableMessage(msg.Code, ipv6Message)}, true
+		}
+	}
+	return PingReply{}, false
+}
+
+// quotedEchoSeq returns the sequence of the echo request quoted in an ICMP error message
+func quotedEchoSeq(data []byte, id int, ipv6Message bool) (int, bool) {
+	offset := ipv6.HeaderLen
+	if !ipv6Message {
+		if len(data) == 0 {
+			return 0, false
+		}
+		offset = int(data[0]&0x0f) * 4
+	}
+	if len(data) < offset+8 {
+		return 0, false
+	}
+
+	echo := data[offset:]
+	if echo[0] != byte(ipv4.ICMPTypeEcho) && echo[0] != byte(ipv6.ICMPTypeEchoRequest) {
+		return 0, false
+	}
+	if id >= 0 && int(binary.BigEndian.Uint16(echo[4:6])) != id {
+		return 0, false
+	}
+	return int(binary.BigEndian.Uint16(echo[6:8])), true
+}
+
+// unreachableMessage returns the ping style message of a destination unreachable code
+func unreachableMessage(code int, ipv6Message bool) string {
+	if ipv6Message {
+		switch code {
+		case 0:
+			return "Destination Net Unreachable"
+		case 1:
+			return "Destination Net Prohibited"
+		case 3:
+			return "Destination Host Unreachable"
+		case 4:
+			return "Destination Port Unreachable"
+		}
+		return "Destination Unreachable"
+	}
+
+	switch code {
+	case 0:
+		return "Destination Net Unreachable"
+	case 1:
+		return "Destination Host Unreachable"
+	case 2:
+		return "Destination Protocol Unreachable"
+	case 3:
+		return "Destination Port Unreachable"
+	case 13:
+		return "Packet filtered"
+	}
+	return "Destination Unreachable"
+}
+
+// resolvePingTarget returns the address to ping, IPv4 is preferred unless IPv6 was requested.
+// The zone of an IPv6 address literal ("fe80::1%eth0") is kept.
+func resolvePingTarget(ctx context.Context, host string, version int) (*net.IPAddr, error) {
+	return resolveNamespacePingTarget(ctx, host, version, "")
+}
+
+// resolveNamespacePingTarget is like resolvePingTarget with host names resolved in the network namespace
+func resolveNamespacePingTarget(ctx context.Context, host string, version int, namespace string) (*net.IPAddr, error) {
+	var addrs []net.IPAddr
+	if ip, zone := splitZone(host); ip != nil {
+		addrs = []net.IPAddr{{IP: ip, Zone: zone}}
+	} else {
+		var err error
+		addrs, err = lookupNamespaceIPAddr(ctx, namespace, host)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s: %w", host, err)
+		}
+	}
+
+	var v6 *net.IPAddr
+	for i, addr := range addrs {
+		if addr.IP.To4() != nil {
+			if version != IPVersion6 {
+				return &addrs[i], nil
+			}
+		} else if v6 == nil {
+			v6 = &addrs[i]
+		}
+	}
+	if v6 != nil && version != IPVersion4 {
+		return v6, nil
+	}
+	return nil, fmt.Errorf("no usable address for %s", host)
+}
+
+// addrIP returns the IP of a socket address
+func addrIP(addr net.Addr) net.IP {
+	switch v := addr.(type) {
+	case *net.IPAddr:
+		return v.IP
+	case *net.UDPAddr:
+		return v.IP
+	}
+	return nil
+}
+
+// icmpTimestampTimeout is how long ICMPTimestamp waits for a reply if the context has no earlier deadline
+const icmpTimestampTimeout = 3 * time.Second
+
+// msPerDay is the range of ICMP timestamps, milliseconds since midnight UT
+const msPerDay = 24 * 60 * 60 * 1000
+
+// ICMPTimestamp sends an ICMP timestamp request (type 13) to the IPv4 host and estimates the offset of
+// its clock from the timestamps of the reply (type 14), the same way NTP does. A positive offset means
+// the remote clock is ahead. Timestamps have millisecond resolution and many hosts and firewalls don't
+// answer timestamp requests at all. A raw ICMP socket is required.
+func ICMPTimestamp(ctx context.Context, host string) (offset time.Duration, rtt time.Duration, err error) {
+	ts, err := newTimestamper(ctx, host)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer ts.close()
+
+	sample, err := ts.exchange(ctx, 1)
+	if err != nil {
+		return 0, 0, err
+	}
+	return sample.offset(), sample.rtt, nil
+}
+
+// AsymmetryResult holds the one-way delays estimated by LatencyAsymmetry
+type AsymmetryResult struct {
+	Host     string
+	IP       net.IP
+	Sent     int
+	Received int
+
+	Forward   time.Duration // Delay from this host to the remote host, the minimum of all samples
+	Return    time.Duration // Delay from the remote host back to this host, the minimum of all samples
+	RTT       time.Duration // Minimum round trip time
+	Asymmetry time.Duration // Forward minus Return, positive if the forward path is slower
+}
+
+// LatencyAsymmetry sends samples ICMP timestamp requests to the IPv4 host and estimates the forward and
+// return path delays from the originate, receive and transmit timestamps. The split is only meaningful
+// if both clocks are synchronized (e.g. by NTP): a clock offset shifts delay from one direction to the
+// other, so an offset of 5ms reads as 5ms more on one path and 5ms less on the other. Timestamps have
+// millisecond resolution, the minimum of each direction is used to filter out queuing delay. Many hosts
+// and firewalls don't answer timestamp requests, an error is returned if no sample was answered.
+// A raw ICMP socket is required.
+func LatencyAsymmetry(ctx context.Context, host string, samples int) (*AsymmetryResult, error) {
+	if samples <= 0 {
+		samples = 5
+	}
+	ts, err := newTimestamper(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	defer ts.close()
+
+	var answered []timestampSample
+	var lastErr error
+	for seq := 1; seq <= samples; seq++ {
+		sample, err := ts.exchange(ctx, seq)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		answered = append(answered, sample)
+	}
+	if len(answered) == 0 {
+		return nil, lastErr
+	}
+
+	result := asymmetryFromSamples(answered)
+	result.Host = host
+	result.IP = ts.ip
+	result.Sent = samples
+	return result, nil
+}
+
+// asymmetryFromSamples returns the minimum forward, return and round trip delays of the samples
+func asymmetryFromSamples(samples []timestampSample) *AsymmetryResult {
+	result := &AsymmetryResult{Received: len(samples)}
+	for i, sample := range samples {
+		forward := time.Duration(timestampDiff(sample.originate, sample.receive)) * time.Millisecond
+		back := time.Duration(timestampDiff(sample.transmit, sample.returned)) * time.Millisecond
+		if i == 0 || forward < result.Forward {
+			result.Forward = forward
+		}
+		if i == 0 || back < result.Return {
+			result.Return = back
+		}
+		if i == 0 || sample.rtt < result.RTT {
+			result.RTT = sample.rtt
+		}
+	}
+	result.Asymmetry = result.Forward - result.Return
+	return result
+}
+
+// timestampSample holds the four timestamps of an answered timestamp request
+type timestampSample struct {
+	originate, receive, transmit, returned uint32
+	rtt                                    time.Duration
+}
+
+// offset estimates the clock offset of the remote host
+func (s timestampSample) offset() time.Duration {
+	return timestampOffset(s.originate, s.receive, s.transmit, s.returned)
+}
+
+// timestamper sends ICMP timestamp requests to a host
+type timestamper struct {
+	host string
+	ip   net.IP
+	conn *icmp.PacketConn
+	sock *icmpSocket
+	id   int
+	stop chan struct{}
+}
+
+// newTimestamper resolves the IPv4 host and opens the raw ICMP socket. Pending reads are
+// unblocked when the context is done.
+func newTimestamper(ctx context.Context, host string) (*timestamper, error) {
+	target, err := resolvePingTarget(ctx, host, IPVersion4)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := icmp.ListenPacket("ip4:icmp", "0.0.0.0")
+	if err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			return nil, fmt.Errorf("%w (%v)", ErrInsufficientPrivilege, err)
+		}
+		return nil, fmt.Errorf("failed to open ICMP socket: %w", err)
+	}
+	ts := &timestamper{
+		host: host,
+		ip:   target.IP,
+		conn: conn,
+		sock: &icmpSocket{conn: conn, mode: PingModeRaw},
+		id:   rand.Intn(0xffff) + 1,
+		stop: make(chan struct{}),
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetReadDeadline(time.Now())
+		case <-ts.stop:
+		}
+	}()
+	return ts, nil
+}
+
+// close closes the socket
+func (ts *timestamper) close() {
+	close(ts.stop)
+	ts.conn.Close()
+}
+
+// exchange sends a timestamp request with the sequence number and waits for its reply
+func (ts *timestamper) exchange(ctx context.Context, seq int) (timestampSample, error) {
+	deadline := time.Now().Add(icmpTimestampTimeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	if ctx.Err() != nil {
+		return timestampSample{}, ctx.Err()
+	}
+	ts.conn.SetReadDeadline(deadline)
+
+	start := time.Now()
+	sample := timestampSample{originate: icmpTimestamp(start)}
+
+	data := make([]byte, 16)
+	binary.BigEndian.PutUint16(data[0:], uint16(ts.id))
+	binary.BigEndian.PutUint16(data[2:], uint16(seq))
+	binary.BigEndian.PutUint32(data[4:], sample.originate)
+	msg := icmp.Message{Type: ipv4.ICMPTypeTimestamp, Body: &icmp.RawBody{Data: data}}
+	packet, err := msg.Marshal(nil)
+	if err != nil {
+		return timestampSample{}, err
+	}
+	if _, err := ts.conn.WriteTo(packet, &net.IPAddr{IP: ts.ip}); err != nil {
+		return timestampSample{}, fmt.Errorf("failed to send timestamp request to %s: %w", ts.ip, err)
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		reply, _, _, err := ts.sock.read(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				if ctx.Err() != nil {
+					return timestampSample{}, ctx.Err()
+				}
+				return timestampSample{}, fmt.Errorf("no ICMP timestamp reply from %s, the host may not answer timestamp requests", ts.host)
+			}
+			continue
+		}
+
+		body, ok := reply.Body.(*icmp.RawBody)
+		if reply.Type != ipv4.ICMPTypeTimestampReply || !ok || len(body.Data) < 16 {
+			continue
+		}
+		if int(binary.BigEndian.Uint16(body.Data[0:])) != ts.id || int(binary.BigEndian.Uint16(body.Data[2:])) != seq {
+			continue
+		}
+
+		returned := time.Now()
+		sample.receive = binary.BigEndian.Uint32(body.Data[8:])
+		sample.transmit = binary.BigEndian.Uint32(body.Data[12:])
+		// The high bit marks timestamps which are not milliseconds since midnight UT
+		if sample.receive&(1<<31) != 0 || sample.transmit&(1<<31) != 0 {
+			return timestampSample{}, fmt.Errorf("%s replied with non-standard timestamps", ts.host)
+		}
+		sample.returned = icmpTimestamp(returned)
+		sample.rtt = returned.Sub(start)
+		return sample, nil
+	}
+}
+
+// icmpTimestamp returns the ICMP timestamp of t, milliseconds since midnight UT
+func icmpTimestamp(t time.Time) uint32 {
+	t = t.UTC()
+	year, month, day := t.Date()
+	return uint32(t.Sub(time.Date(year, month, day, 0, 0, 0, 0, time.UTC)) / time.Millisecond)
+}
+
+// timestampOffset estimates the clock offset of the remote host from the originate, receive,
+// transmit and return timestamps
+func timestampOffset(originate, receive, transmit, returned uint32) time.Duration {
+	offset := timestampDiff(originate, receive) + timestampDiff(returned, transmit)
+	return time.Duration(offset) * time.Millisecond / 2
+}
+
+// timestampDiff returns b-a in milliseconds, taking the wrap around midnight into account
+func timestampDiff(a, b uint32) int64 {
+	diff := (int64(b) - int64(a)) % msPerDay
+	if diff >= msPerDay/2 {
+		diff -= msPerDay
+	} else if diff < -msPerDay/2 {
+		diff += msPerDay
+	}
+	return diff
+}
@@ -0,0 +1,422 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+func TestPingNative(t *testing.T) {
+	options := &PingOptions{Count: 2, Timeout: 2 * time.Second, Size: 32, Native: true}
+	result, err := PingContext(context.Background(), "127.0.0.1", options)
+	if !CanRawSocket() {
+		if !errors.Is(err, ErrInsufficientPrivilege) {
+			t.Errorf("PingContext() error = %v, want ErrInsufficientPrivilege", err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("PingContext() error = %v", err)
+	}
+
+	if !result.Success || result.Sent != 2 || result.Received != 2 {
+		t.Errorf("PingContext() = %+v", result)
+	}
+	if result.Mode != PingModeUnprivileged && result.Mode != PingModeRaw {
+		t.Errorf("Mode = %q", result.Mode)
+	}
+	if len(result.MissingSeqs) != 0 {
+		t.Errorf("MissingSeqs = %v", result.MissingSeqs)
+	}
+	for _, reply := range result.Replies {
+		if !reply.From.Equal(net.ParseIP("127.0.0.1")) || reply.RTT <= 0 {
+			t.Errorf("reply = %+v", reply)
+		}
+	}
+}
+
+func TestPingNativeLocalAddr(t *testing.T) {
+	ctx := context.Background()
+	errorCases := []struct {
+		local string
+		want  string
+	}{
+		{"192.0.2.55", "not assigned"},
+		{"::1", "IP versions differ"},
+		{"not-an-ip", "invalid local address"},
+	}
+	for _, tt := range errorCases {
+		options := &PingOptions{Count: 1, Timeout: time.Second, Native: true, LocalAddr: tt.local}
+		if _, err := PingContext(ctx, "127.0.0.1", options); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("PingContext(LocalAddr %q) error = %v, want %q", tt.local, err, tt.want)
+		}
+	}
+	if _, err := PingContext(ctx, "127.0.0.1", &PingOptions{Count: 1, LocalAddr: "127.0.0.1"}); err == nil {
+		t.Error("expected error for local address without the native pinger")
+	}
+
+	if !CanRawSocket() {
+		t.Skip("raw ICMP sockets not permitted")
+	}
+	options := &PingOptions{Count: 1, Timeout: 2 * time.Second, Native: true, LocalAddr: "127.0.0.1"}
+	result, err := PingContext(ctx, "127.0.0.1", options)
+	if err != nil {
+		t.Fatalf("PingContext() error = %v", err)
+	}
+	if !result.Success || result.Received != 1 {
+		t.Errorf("PingContext() = %+v", result)
+	}
+}
+
+func TestSourceRouteOption(t *testing.T) {
+	route := []net.IP{net.ParseIP("192.0.2.1"), net.ParseIP("198.51.100.1")}
+	dst := net.ParseIP("203.0.113.5")
+
+	option := sourceRouteOption(route, dst, false)
+	want := []byte{1, 0x83, 11, 4, 198, 51, 100, 1, 203, 0, 113, 5}
+	if !bytes.Equal(option, want) {
+		t.Errorf("sourceRouteOption() = %v, want %v", option, want)
+	}
+	if len(option)%4 != 0 {
+		t.Errorf("option length %d is not a multiple of 4", len(option))
+	}
+	if strict := sourceRouteOption(route, dst, true); strict[1] != 0x89 {
+		t.Errorf("strict option type = %#x, want 0x89", strict[1])
+	}
+
+	parsed := parseSourceRoute(option)
+	if len(parsed) != 2 || !parsed[0].Equal(route[1]) || !parsed[1].Equal(dst) {
+		t.Errorf("parseSourceRoute() = %v", parsed)
+	}
+	// Record route (7) is skipped, a truncated option is ignored
+	if got := parseSourceRoute(append([]byte{7, 7, 4, 0, 0, 0, 0}, option...)); len(got) != 2 {
+		t.Errorf("parseSourceRoute() after record route = %v", got)
+	}
+	if got := parseSourceRoute([]byte{0x83, 11, 4, 1}); got != nil {
+		t.Errorf("parseSourceRoute() of truncated option = %v", got)
+	}
+	if got := parseSourceRoute(nil); got != nil {
+		t.Errorf("parseSourceRoute(nil) = %v", got)
+	}
+}
+
+func TestPingNativeRouteVia(t *testing.T) {
+	ctx := context.Background()
+	if _, err := PingContext(ctx, "127.0.0.1", &PingOptions{Count: 1, RouteVia: []net.IP{net.ParseIP("127.0.0.1")}}); err == nil {
+		t.Error("expected error for source route without the native pinger")
+	}
+	errorCases := [][]net.IP{
+		{net.ParseIP("::1")},
+		make([]net.IP, 10),
+	}
+	for _, route := range errorCases {
+		options := &PingOptions{Count: 1, Timeout: time.Second, Native: true, RouteVia: route}
+		if _, err := PingContext(ctx, "127.0.0.1", options); err == nil {
+			t.Errorf("PingContext(RouteVia %v) expected error", route)
+		}
+	}
+
+	if !CanRawSocket() {
+		t.Skip("raw ICMP sockets not permitted")
+	}
+	// Hosts drop source routed packets by default, only the request is checked
+	options := &PingOptions{Count: 1, Timeout: 300 * time.Millisecond, Native: true, RouteVia: []net.IP{net.ParseIP("127.0.0.1")}}
+	result, err := PingContext(ctx, "127.0.0.1", options)
+	if err != nil {
+		t.Fatalf("PingContext() error = %v", err)
+	}
+	if result.Mode != PingModeRaw || result.Sent != 1 {
+		t.Errorf("PingContext() = %+v", result)
+	}
+	if result.Received > 0 && !result.RoutedVia {
+		t.Errorf("reply without source route option: %+v", result)
+	}
+}
+
+func TestPingNativeCanceled(t *testing.T) {
+	if !CanRawSocket() {
+		t.Skip("raw ICMP sockets not permitted")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	result, err := PingContext(ctx, "127.0.0.1", &PingOptions{Count: 10, Timeout: 5 * time.Second, Native: true})
+	if err != nil {
+		t.Fatalf("PingContext() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("PingContext() took %v after cancel", elapsed)
+	}
+	if result.Sent >= 10 {
+		t.Errorf("Sent = %d, want pinging to stop on cancel", result.Sent)
+	}
+}
+
+func TestEchoID(t *testing.T) {
+	raw := &icmpSocket{mode: PingModeRaw}
+	if id, matchID := raw.echoID(42); id != 42 || matchID != 42 {
+		t.Errorf("raw echoID(42) = %d, %d", id, matchID)
+	}
+	if id, matchID := raw.echoID(0); id < 1 || id > 0xffff || matchID != id {
+		t.Errorf("raw echoID(0) = %d, %d", id, matchID)
+	}
+	datagram := &icmpSocket{mode: PingModeUnprivileged}
+	if id, matchID := datagram.echoID(42); id != 42 || matchID != -1 {
+		t.Errorf("datagram echoID(42) = %d, %d", id, matchID)
+	}
+}
+
+func TestMatchEchoReply(t *testing.T) {
+	reply, ok := matchEchoReply(&icmp.Message{
+		Type: ipv4.ICMPTypeEchoReply,
+		Body: &icmp.Echo{ID: 7, Seq: 3},
+	}, 7, false)
+	if !ok || reply.Seq != 3 || reply.Error != "" {
+		t.Errorf("echo reply = %+v, %v", reply, ok)
+	}
+
+	if _, ok := matchEchoReply(&icmp.Message{Type: ipv4.ICMPTypeEchoReply, Body: &icmp.Echo{ID: 8, Seq: 3}}, 7, false); ok {
+		t.Error("reply of another identifier matched")
+	}
+	if _, ok := matchEchoReply(&icmp.Message{Type: ipv4.ICMPTypeEcho, Body: &icmp.Echo{ID: 7, Seq: 3}}, 7, false); ok {
+		t.Error("echo request matched")
+	}
+
+	// IPv4 header (20 bytes) followed by the first 8 bytes of the echo request
+	quoted := make([]byte, 28)
+	quoted[0] = 0x45
+	quoted[20] = byte(ipv4.ICMPTypeEcho)
+	binary.BigEndian.PutUint16(quoted[24:], 7)
+	binary.BigEndian.PutUint16(quoted[26:], 5)
+
+	reply, ok = matchEchoReply(&icmp.Message{
+		Type: ipv4.ICMPTypeTimeExceeded,
+		Body: &icmp.TimeExceeded{Data: quoted},
+	}, 7, false)
+	if !ok || reply.Seq != 5 || reply.Error != "Time to live exceeded" {
+		t.Errorf("time exceeded = %+v, %v", reply, ok)
+	}
+
+	reply, ok = matchEchoReply(&icmp.Message{
+		Type: ipv4.ICMPTypeDestinationUnreachable,
+		Code: 1,
+		Body: &icmp.DstUnreach{Data: quoted},
+	}, 7, false)
+	if !ok || reply.Error != "Destination Host Unreachable" {
+		t.Errorf("unreachable = %+v, %v", reply, ok)
+	}
+}
+
+func TestResolvePingTarget(t *testing.T) {
+	original := lookupIPAddr
+	defer func() { lookupIPAddr = original }()
+	lookupIPAddr = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		return []net.IPAddr{{IP: net.ParseIP("2001:db8::1")}, {IP: net.ParseIP("192.0.2.1")}}, nil
+	}
+
+	tests := []struct {
+		version int
+		want    string
+	}{
+		{IPVersionAuto, "192.0.2.1"},
+		{IPVersion4, "192.0.2.1"},
+		{IPVersion6, "2001:db8::1"},
+	}
+	for _, tt := range tests {
+		ip, err := resolvePingTarget(context.Background(), "dual.example.com", tt.version)
+		if err != nil || ip.String() != tt.want {
+			t.Errorf("resolvePingTarget(%d) = %v, %v, want %s", tt.version, ip, err, tt.want)
+		}
+	}
+
+	if _, err := resolvePingTarget(context.Background(), "192.0.2.1", IPVersion6); err == nil {
+		t.Error("expected error for IPv4 address with IPv6 ping")
+	}
+}
+
+func TestPingPayload(t *testing.T) {
+	if got := pingPayload(5, []byte{0xab, 0xcd}); !bytes.Equal(got, []byte{0xab, 0xcd, 0xab, 0xcd, 0xab}) {
+		t.Errorf("pingPayload() = %x", got)
+	}
+	if got := pingPayload(3, nil); !bytes.Equal(got, []byte{0, 0, 0}) {
+		t.Errorf("pingPayload() = %x", got)
+	}
+}
+
+func TestPingNativePattern(t *testing.T) {
+	if !CanRawSocket() {
+		t.Skip("raw ICMP sockets not permitted")
+	}
+
+	options := &PingOptions{Count: 1, Timeout: 2 * time.Second, Size: 64, Native: true, Pattern: []byte("network")}
+	result, err := PingContext(context.Background(), "127.0.0.1", options)
+	if err != nil {
+		t.Fatalf("PingContext() error = %v", err)
+	}
+	if result.Received != 1 || result.Corrupted != 0 {
+		t.Errorf("Received = %d, Corrupted = %d", result.Received, result.Corrupted)
+	}
+}
+
+func TestPingNativeTOS(t *testing.T) {
+	if !CanRawSocket() {
+		t.Skip("raw ICMP sockets not permitted")
+	}
+
+	// Linux copies the TOS of echo requests into the replies
+	for _, host := range []string{"127.0.0.1", "::1"} {
+		options := &PingOptions{Count: 1, Timeout: 2 * time.Second, Size: 56, Native: true, DSCP: 46}
+		result, err := PingContext(context.Background(), host, options)
+		if err != nil {
+			t.Fatalf("PingContext(%s) error = %v", host, err)
+		}
+		if result.Received != 1 || result.Replies[0].TOS != 46<<2 {
+			t.Errorf("PingContext(%s) replies = %+v", host, result.Replies)
+		}
+	}
+
+	result, err := PingContext(context.Background(), "127.0.0.1", &PingOptions{Count: 1, Timeout: 2 * time.Second, Native: true})
+	if err != nil {
+		t.Fatalf("PingContext() error = %v", err)
+	}
+	if result.Received != 1 || result.Replies[0].TOS != 0 {
+		t.Errorf("PingContext() without DSCP replies = %+v", result.Replies)
+	}
+}
+
+func TestICMPTimestamp(t *testing.T) {
+	if !CanRawSocket() {
+		if _, _, err := ICMPTimestamp(context.Background(), "127.0.0.1"); !errors.Is(err, ErrInsufficientPrivilege) {
+			t.Errorf("ICMPTimestamp() without privileges error = %v, want ErrInsufficientPrivilege", err)
+		}
+		return
+	}
+
+	offset, rtt, err := ICMPTimestamp(context.Background(), "127.0.0.1")
+	if err != nil {
+		t.Fatalf("ICMPTimestamp() error = %v", err)
+	}
+	if rtt <= 0 || offset < -time.Second || offset > time.Second {
+		t.Errorf("ICMPTimestamp() offset = %v, rtt = %v", offset, rtt)
+	}
+
+	if _, _, err := ICMPTimestamp(context.Background(), "::1"); err == nil {
+		t.Error("ICMPTimestamp() expected error for IPv6 host")
+	}
+}
+
+func TestLatencyAsymmetry(t *testing.T) {
+	if !CanRawSocket() {
+		if _, err := LatencyAsymmetry(context.Background(), "127.0.0.1", 2); !errors.Is(err, ErrInsufficientPrivilege) {
+			t.Errorf("LatencyAsymmetry() without privileges error = %v, want ErrInsufficientPrivilege", err)
+		}
+		return
+	}
+
+	result, err := LatencyAsymmetry(context.Background(), "127.0.0.1", 3)
+	if err != nil {
+		t.Fatalf("LatencyAsymmetry() error = %v", err)
+	}
+	if result.Sent != 3 || result.Received != 3 || result.RTT <= 0 || !result.IP.Equal(net.ParseIP("127.0.0.1")) {
+		t.Errorf("LatencyAsymmetry() = %+v", result)
+	}
+	// Both directions share the local clock
+	if result.Forward < 0 || result.Return < 0 || result.Forward > time.Second || result.Return > time.Second {
+		t.Errorf("Forward = %v, Return = %v", result.Forward, result.Return)
+	}
+}
+
+func TestAsymmetryFromSamples(t *testing.T) {
+	samples := []timestampSample{
+		{originate: 1000, receive: 1030, transmit: 1031, returned: 1045, rtt: 45 * time.Millisecond},
+		{originate: 2000, receive: 2025, transmit: 2025, returned: 2040, rtt: 40 * time.Millisecond},
+		{originate: msPerDay - 10, receive: 20, transmit: 21, returned: 32, rtt: 42 * time.Millisecond},
+	}
+	result := asymmetryFromSamples(samples)
+	if result.Received != 3 || result.Forward != 25*time.Millisecond || result.Return != 11*time.Millisecond {
+		t.Errorf("Forward = %v, Return = %v, Received = %d", result.Forward, result.Return, result.Received)
+	}
+	if result.RTT != 40*time.Millisecond || result.Asymmetry != 14*time.Millisecond {
+		t.Errorf("RTT = %v, Asymmetry = %v", result.RTT, result.Asymmetry)
+	}
+}
+
+func TestTimestampOffset(t *testing.T) {
+	tests := []struct {
+		name                                   string
+		originate, receive, transmit, returned uint32
+		want                                   time.Duration
+	}{
+		{"in sync", 1000, 1010, 1010, 1020, 0},
+		{"ahead", 1000, 6010, 6010, 1020, 5 * time.Second},
+		{"behind", 1000, 510, 511, 1021, -500 * time.Millisecond},
+		{"across midnight", msPerDay - 10, 5, 5, 0, 10 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := timestampOffset(tt.originate, tt.receive, tt.transmit, tt.returned); got != tt.want {
+			t.Errorf("%s: timestampOffset() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	noon := time.Date(2024, 5, 1, 12, 0, 0, 5e6, time.UTC)
+	if got := icmpTimestamp(noon); got != msPerDay/2+5 {
+		t.Errorf("icmpTimestamp() = %d", got)
+	}
+}
+
+func TestPingNativeIdentifier(t *testing.T) {
+	for _, options := range []*PingOptions{{Identifier: -1}, {Identifier: 0x10000}, {SequenceStart: 70000}} {
+		options.Native = true
+		if _, err := PingContext(context.Background(), "127.0.0.1", options); err == nil {
+			t.Errorf("PingContext(%+v) expected error", options)
+		}
+	}
+	if !CanRawSocket() {
+		t.Skip("raw ICMP sockets not permitted")
+	}
+
+	// Echo requests to the loopback address are received by raw sockets as well
+	conn, err := icmp.ListenPacket("ip4:icmp", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer conn.Close()
+
+	options := &PingOptions{Count: 2, Timeout: 2 * time.Second, Native: true, Identifier: 4242, SequenceStart: 100}
+	result, err := PingContext(context.Background(), "127.0.0.1", options)
+	if err != nil {
+		t.Fatalf("PingContext() error = %v", err)
+	}
+	if result.Received != 2 || result.Replies[0].Seq != 100 || result.Replies[1].Seq != 101 {
+		t.Errorf("PingContext() replies = %+v", result.Replies)
+	}
+	if result.Mode != PingModeRaw {
+		return
+	}
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 1500)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatal("echo request of the pinger not received")
+		}
+		msg, err := icmp.ParseMessage(1, buf[:n])
+		if err != nil || msg.Type != ipv4.ICMPTypeEcho {
+			continue
+		}
+		if echo := msg.Body.(*icmp.Echo); echo.ID == 4242 && echo.Seq == 100 {
+			return
+		}
+	}
+}
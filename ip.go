@@ -0,0 +1,490 @@
+package network
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MaxRangeHosts is the maximum number of addresses a range may expand to
+var MaxRangeHosts = 65536
+
+// IPClass is a bitmask describing the kind of an IP address
+type IPClass uint16
+
+// IPClassUnknown is returned for nil or malformed addresses
+const IPClassUnknown IPClass = 0
+
+const (
+	IPClassLoopback      IPClass = 1 << iota // 127.0.0.0/8, ::1
+	IPClassPrivate                           // RFC1918, fc00::/7 (ULA)
+	IPClassLinkLocal                         // 169.254.0.0/16, fe80::/10
+	IPClassCGNAT                             // 100.64.0.0/10 (RFC6598)
+	IPClassMulticast                         // 224.0.0.0/4, ff00::/8
+	IPClassDocumentation                     // RFC5737, 2001:db8::/32
+	IPClassUnspecified                       // 0.0.0.0, ::
+	IPClassGlobalUnicast                     // publicly routable unicast
+)
+
+var ipClassNames = []struct {
+	class IPClass
+	name  string
+}{
+	{IPClassLoopback, "loopback"},
+	{IPClassPrivate, "private"},
+	{IPClassLinkLocal, "link-local"},
+	{IPClassCGNAT, "cgnat"},
+	{IPClassMulticast, "multicast"},
+	{IPClassDocumentation, "documentation"},
+	{IPClassUnspecified, "unspecified"},
+	{IPClassGlobalUnicast, "global-unicast"},
+}
+
+var (
+	cgnatNet = mustParseCIDR("100.64.0.0/10")
+
+	documentationNets = []*net.IPNet{
+		mustParseCIDR("192.0.2.0/24"),
+		mustParseCIDR("198.51.100.0/24"),
+		mustParseCIDR("203.0.113.0/24"),
+		mustParseCIDR("2001:db8::/32"),
+	}
+)
+
+// Has reports whether all bits of other are set in c
+func (c IPClass) Has(other IPClass) bool {
+	return other != 0 && c&other == other
+}
+
+// String returns the class names joined by "|"
+func (c IPClass) String() string {
+	if c == IPClassUnknown {
+		return "unknown"
+	}
+	var names []string
+	for _, item := range ipClassNames {
+		if c.Has(item.class) {
+			names = append(names, item.name)
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+// ClassifyIP returns the classes the given IP address belongs to
+func ClassifyIP(ip net.IP) IPClass {
+	if ip == nil || (ip.To4() == nil && len(ip) != net.IPv6len) {
+		return IPClassUnknown
+	}
+
+	var class IPClass
+	if ip.IsUnspecified() {
+		class |= IPClassUnspecified
+	}
+	if ip.IsLoopback() {
+		class |= IPClassLoopback
+	}
+	if ip.IsPrivate() {
+		class |= IPClassPrivate
+	}
+	if ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() {
+		class |= IPClassLinkLocal
+	}
+	if ip.IsMulticast() {
+		class |= IPClassMulticast
+	}
+	if cgnatNet.Contains(ip) {
+		class |= IPClassCGNAT
+	}
+	for _, ipnet := range documentationNets {
+		if ipnet.Contains(ip) {
+			class |= IPClassDocumentation
+			break
+		}
+	}
+
+	// Only addresses that fall into none of the special ranges are globally routable
+	if class == IPClassUnknown && ip.IsGlobalUnicast() {
+		class |= IPClassGlobalUnicast
+	}
+	return class
+}
+
+// LocalIPClass returns the class of the detected local IP address
+func (network *Network) LocalIPClass() IPClass {
+	return ClassifyIP(network.LocalIP)
+}
+
+// SameSubnet reports whether both addresses are in the same subnet of the mask. IPv4 masks may be given
+// in 4 or 16 byte form (net.ParseIP("255.255.255.0")). Addresses of different IP versions, or a mask which
+// doesn't fit their version, are never in the same subnet.
+func SameSubnet(ipA, ipB net.IP, mask net.IPMask) bool {
+	a4, b4 := ipA.To4(), ipB.To4()
+	if (a4 == nil) != (b4 == nil) {
+		return false
+	}
+	if a4 != nil {
+		ipA, ipB = a4, b4
+		if len(mask) == net.IPv6len && net.IP(mask).To4() != nil {
+			mask = mask[12:]
+		}
+	}
+
+	maskedA := ipA.Mask(mask)
+	if maskedA == nil {
+		return false
+	}
+	return maskedA.Equal(ipB.Mask(mask))
+}
+
+// SameSubnetAsLocal reports whether the address is in the subnet of the detected local IP address
+func (network *Network) SameSubnetAsLocal(ip net.IP) (bool, error) {
+	if network.LocalIP == nil || network.SubnetMask == nil {
+		return false, fmt.Errorf("local IP address or subnet mask is not detected")
+	}
+	return SameSubnet(network.LocalIP, ip, net.IPMask(network.SubnetMask)), nil
+}
+
+// UsableHostCount returns the number of host addresses in the subnet of the detected local IP address.
+// IPv4 subnets lose the network and broadcast addresses, except /31 point-to-point links (RFC 3021)
+// with 2 hosts and /32 with 1. IPv6 subnets have no broadcast address, all addresses are counted. The
+// count is capped at math.MaxUint64, which is returned for the usual /64 and larger IPv6 subnets.
+func (network *Network) UsableHostCount() (uint64, error) {
+	if network.LocalIP == nil || network.SubnetMask == nil {
+		return 0, fmt.Errorf("local IP address or subnet mask is not detected")
+	}
+	ones, bits := network.localMask().Size()
+	if bits == 0 {
+		return 0, fmt.Errorf("invalid subnet mask %v", network.SubnetMask)
+	}
+	if (bits == 32) != (network.LocalIP.To4() != nil) {
+		return 0, fmt.Errorf("subnet mask %v doesn't fit %v", network.SubnetMask, network.LocalIP)
+	}
+
+	hostBits := bits - ones
+	if hostBits >= 64 {
+		return math.MaxUint64, nil
+	}
+	count := uint64(1) << uint(hostBits)
+	if bits == 32 && hostBits > 1 {
+		count -= 2
+	}
+	return count, nil
+}
+
+// mustParseCIDR parses a constant CIDR and panics on failure
+func mustParseCIDR(s string) *net.IPNet {
+	_, ipnet, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return ipnet
+}
+
+// cidrHosts returns the host addresses of a network. For IPv4 networks larger than /31
+// the network and broadcast addresses are skipped.
+func cidrHosts(ipnet *net.IPNet, limit int) ([]net.IP, error) {
+	ones, bits := ipnet.Mask.Size()
+	if bits == 0 {
+		return nil, fmt.Errorf("invalid network mask")
+	}
+
+	size := new(big.Int).Lsh(big.NewInt(1), uint(bits-ones))
+	if size.Cmp(big.NewInt(int64(limit)+2)) > 0 {
+		return nil, fmt.Errorf("range %s is too large (limit %d hosts)", ipnet.String(), limit)
+	}
+
+	first := ipnet.IP.Mask(ipnet.Mask)
+	if bits == 32 {
+		first = first.To4()
+	}
+
+	count := int(size.Int64())
+	start := 0
+	if bits == 32 && ones < 31 {
+		start = 1
+		count--
+	}
+	if count-start > limit {
+		return nil, fmt.Errorf("range %s is too large (limit %d hosts)", ipnet.String(), limit)
+	}
+
+	var hosts []net.IP
+	for i := start; i < count; i++ {
+		hosts = append(hosts, addToIP(first, uint64(i)))
+	}
+	return hosts, nil
+}
+
+// addToIP returns ip + n
+func addToIP(ip net.IP, n uint64) net.IP {
+	result := make(net.IP, len(ip))
+	copy(result, ip)
+	for i := len(result) - 1; i >= 0 && n > 0; i-- {
+		sum := uint64(result[i]) + (n & 0xff)
+		result[i] = byte(sum)
+		n = (n >> 8) + (sum >> 8)
+	}
+	return result
+}
+
+// Aggregate summarizes the addresses into the smallest list of covering prefixes, e.g. for firewall
+// rules. Only the given addresses are covered, adjacent addresses are merged into larger prefixes.
+// IPv4 and IPv6 are aggregated separately, the IPv4 prefixes come first. Invalid addresses are skipped.
+func Aggregate(ips []net.IP) []*net.IPNet {
+	var v4, v6 []*big.Int
+	for _, ip := range ips {
+		if ip4 := ip.To4(); ip4 != nil {
+			v4 = append(v4, new(big.Int).SetBytes(ip4))
+		} else if ip16 := ip.To16(); ip16 != nil {
+			v6 = append(v6, new(big.Int).SetBytes(ip16))
+		}
+	}
+	return append(aggregateFamily(v4, 32), aggregateFamily(v6, 128)...)
+}
+
+// aggregateFamily merges the addresses of one IP version into ranges of consecutive addresses
+// and returns their prefixes
+func aggregateFamily(addrs []*big.Int, bits int) []*net.IPNet {
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i].Cmp(addrs[j]) < 0 })
+
+	var result []*net.IPNet
+	next := new(big.Int)
+	for i := 0; i < len(addrs); {
+		start, end := addrs[i], addrs[i]
+		for i++; i < len(addrs); i++ {
+			next.Add(end, big.NewInt(1))
+			if cmp := addrs[i].Cmp(next); cmp > 0 {
+				break
+			} else if cmp == 0 {
+				end = addrs[i]
+			}
+		}
+		result = append(result, rangePrefixes(start, end, bits)...)
+	}
+	return result
+}
+
+// rangePrefixes returns the smallest list of prefixes covering the addresses from start to end
+func rangePrefixes(start, end *big.Int, bits int) []*net.IPNet {
+	var result []*net.IPNet
+	current := new(big.Int).Set(start)
+	for current.Cmp(end) <= 0 {
+		// The largest block which starts at the address and doesn't extend past the end
+		remaining := new(big.Int).Sub(end, current)
+		remaining.Add(remaining, big.NewInt(1))
+		size := remaining.BitLen() - 1
+		if current.Sign() != 0 && int(current.TrailingZeroBits()) < size {
+			size = int(current.TrailingZeroBits())
+		}
+
+		ip := make(net.IP, bits/8)
+		current.FillBytes(ip)
+		result = append(result, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits-size, bits)})
+		current.Add(current, new(big.Int).Lsh(big.NewInt(1), uint(size)))
+	}
+	return result
+}
+
+// ExpandTargets expands a comma separated list of targets into addresses. Each entry is a single IP,
+// a CIDR (network and broadcast addresses skipped for IPv4) or a range "start-end", where the end of
+// an IPv4 range may be given as last octet only ("10.0.0.1-50"). Duplicates are removed and at most
+// MaxRangeHosts addresses are returned.
+func ExpandTargets(spec string) ([]net.IP, error) {
+	var (
+		result []net.IP
+		seen   = make(map[string]bool)
+	)
+
+	add := func(ips ...net.IP) error {
+		for _, ip := range ips {
+			if seen[ip.String()] {
+				continue
+			}
+			if len(result) >= MaxRangeHosts {
+				return fmt.Errorf("targets %s are too large (limit %d hosts)", spec, MaxRangeHosts)
+			}
+			seen[ip.String()] = true
+			result = append(result, ip)
+		}
+		return nil
+	}
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		var (
+			ips []net.IP
+			err error
+		)
+		switch {
+		case strings.Contains(entry, "/"):
+			var ipnet *net.IPNet
+			if _, ipnet, err = net.ParseCIDR(entry); err != nil {
+				return nil, fmt.Errorf("invalid CIDR %s: %w", entry, err)
+			}
+			ips, err = cidrHosts(ipnet, MaxRangeHosts)
+		case strings.Contains(entry, "-"):
+			ips, err = expandRange(entry, MaxRangeHosts)
+		default:
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address %s", entry)
+			}
+			ips = []net.IP{ip}
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := add(ips...); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(result) == 0 {
+		return nil, fmt.Errorf("no targets in %q", spec)
+	}
+	return result, nil
+}
+
+// expandRange returns the addresses of a "start-end" range
+func expandRange(entry string, limit int) ([]net.IP, error) {
+	startText, endText, _ := strings.Cut(entry, "-")
+	start := net.ParseIP(strings.TrimSpace(startText))
+	if start == nil {
+		return nil, fmt.Errorf("invalid range start in %s", entry)
+	}
+
+	endText = strings.TrimSpace(endText)
+	end := net.ParseIP(endText)
+	if end == nil && start.To4() != nil {
+		// Last octet shorthand: 10.0.0.1-50
+		if octet, err := strconv.Atoi(endText); err == nil && octet >= 0 && octet <= 255 {
+			end = net.IPv4(start.To4()[0], start.To4()[1], start.To4()[2], byte(octet))
+		}
+	}
+	if end == nil {
+		return nil, fmt.Errorf("invalid range end in %s", entry)
+	}
+
+	if v4 := start.To4(); v4 != nil {
+		start = v4
+		if end = end.To4(); end == nil {
+			return nil, fmt.Errorf("mixed IP versions in range %s", entry)
+		}
+	} else if end.To4() != nil {
+		return nil, fmt.Errorf("mixed IP versions in range %s", entry)
+	}
+
+	size := new(big.Int).Sub(new(big.Int).SetBytes(end), new(big.Int).SetBytes(start))
+	if size.Sign() < 0 {
+		return nil, fmt.Errorf("range start is after end in %s", entry)
+	}
+	if size.Cmp(big.NewInt(int64(limit))) >= 0 {
+		return nil, fmt.Errorf("range %s is too large (limit %d hosts)", entry, limit)
+	}
+
+	count := size.Uint64() + 1
+	ips := make([]net.IP, 0, count)
+	for i := uint64(0); i < count; i++ {
+		ips = append(ips, addToIP(start, i))
+	}
+	return ips, nil
+}
+
+// splitZone parses an IP address literal with an optional IPv6 zone ("fe80::1%eth0")
+func splitZone(host string) (net.IP, string) {
+	address, zone := host, ""
+	if i := strings.LastIndex(host, "%"); i >= 0 {
+		address, zone = host[:i], host[i+1:]
+	}
+	ip := net.ParseIP(address)
+	if ip == nil || (zone != "" && ip.To4() != nil) {
+		return nil, ""
+	}
+	return ip, zone
+}
+
+// isLinkLocalIPv6 reports whether the address is an IPv6 link-local unicast or multicast address,
+// which are only meaningful together with the interface (zone) they are reached on
+func isLinkLocalIPv6(ip net.IP) bool {
+	return ip != nil && ip.To4() == nil && (ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast())
+}
+
+// defaultZone returns the zone of link-local destinations given without one in the network namespace,
+// the interface of the default route or the first interface with an IPv6 link-local address.
+// Replaced in tests.
+var defaultZone = func(namespace string) string {
+	if config, err := GetConfig(WithNamespace(namespace)); err == nil && config.Interface != nil {
+		return zoneName(config.Interface)
+	}
+	var zone string
+	_ = inNamespace(namespace, func() error {
+		zone = linkLocalZone()
+		return nil
+	})
+	return zone
+}
+
+// linkLocalZone returns the zone of the first interface with an IPv6 link-local address
+func linkLocalZone() string {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return ""
+	}
+	for i := range interfaces {
+		interf := &interfaces[i]
+		if interf.Flags&net.FlagUp == 0 || interf.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, _ := interf.Addrs()
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok && isLinkLocalIPv6(ipnet.IP) {
+				return zoneName(interf)
+			}
+		}
+	}
+	return ""
+}
+
+// zoneName returns the zone of an interface, Windows tools expect the interface index
+func zoneName(interf *net.Interface) string {
+	if runtime.GOOS == "windows" {
+		return strconv.Itoa(interf.Index)
+	}
+	return interf.Name
+}
+
+// withZone appends the default zone to IPv6 link-local address literals without a zone, other hosts
+// are returned unchanged. Without a zone the kernel can't tell which link the address is on.
+func withZone(host string) string {
+	return withNamespaceZone(host, "")
+}
+
+// withNamespaceZone is like withZone with the default zone of the network namespace
+func withNamespaceZone(host, namespace string) string {
+	ip, zone := splitZone(host)
+	if zone != "" || !isLinkLocalIPv6(ip) {
+		return host
+	}
+	if zone := defaultZone(namespace); zone != "" {
+		return host + "%" + zone
+	}
+	return host
+}
+
+// localMask returns the subnet mask in the length of the local IP address, IPv4 masks are stored in 16 bytes
+func (network *Network) localMask() net.IPMask {
+	mask := net.IPMask(network.SubnetMask)
+	if network.LocalIP.To4() != nil && len(mask) == net.IPv6len && net.IP(mask).To4() != nil {
+		mask = mask[12:]
+	}
+	return mask
+}
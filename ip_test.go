@@ -0,0 +1,382 @@
+package network
+
+import (
+	"context"
+	"math"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestClassifyIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want IPClass
+	}{
+		{"127.0.0.1", IPClassLoopback},
+		{"::1", IPClassLoopback},
+		{"10.1.2.3", IPClassPrivate},
+		{"172.16.0.1", IPClassPrivate},
+		{"192.168.1.1", IPClassPrivate},
+		{"fd00::1", IPClassPrivate},
+		{"169.254.10.1", IPClassLinkLocal},
+		{"fe80::1", IPClassLinkLocal},
+		{"100.64.0.1", IPClassCGNAT},
+		{"100.127.255.254", IPClassCGNAT},
+		{"224.0.0.251", IPClassMulticast | IPClassLinkLocal},
+		{"239.1.1.1", IPClassMulticast},
+		{"ff02::1", IPClassMulticast | IPClassLinkLocal},
+		{"192.0.2.10", IPClassDocumentation},
+		{"2001:db8::1", IPClassDocumentation},
+		{"0.0.0.0", IPClassUnspecified},
+		{"8.8.8.8", IPClassGlobalUnicast},
+		{"2606:4700:4700::1111", IPClassGlobalUnicast},
+	}
+
+	for _, tt := range tests {
+		got := ClassifyIP(net.ParseIP(tt.ip))
+		if got != tt.want {
+			t.Errorf("ClassifyIP(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+
+	if got := ClassifyIP(nil); got != IPClassUnknown {
+		t.Errorf("ClassifyIP(nil) = %v, want unknown", got)
+	}
+}
+
+func TestIPClassString(t *testing.T) {
+	class := IPClassMulticast | IPClassLinkLocal
+	if !class.Has(IPClassMulticast) || class.Has(IPClassPrivate) {
+		t.Errorf("Has() returned unexpected result for %v", class)
+	}
+	if class.String() != "link-local|multicast" {
+		t.Errorf("String() = %s, want link-local|multicast", class.String())
+	}
+	if IPClassUnknown.String() != "unknown" {
+		t.Errorf("String() = %s, want unknown", IPClassUnknown.String())
+	}
+}
+
+func TestLocalIPClass(t *testing.T) {
+	n := &Network{LocalIP: net.ParseIP("192.168.1.10")}
+	if n.LocalIPClass() != IPClassPrivate {
+		t.Errorf("LocalIPClass() = %v, want private", n.LocalIPClass())
+	}
+}
+
+func TestSameSubnet(t *testing.T) {
+	mask24 := net.CIDRMask(24, 32)
+	tests := []struct {
+		a, b string
+		mask net.IPMask
+		want bool
+	}{
+		{"192.168.1.10", "192.168.1.200", mask24, true},
+		{"192.168.1.10", "192.168.2.10", mask24, false},
+		{"192.168.1.10", "192.168.2.10", net.CIDRMask(16, 32), true},
+		{"192.168.1.10", "::ffff:192.168.1.20", mask24, true},
+		{"192.168.1.10", "192.168.1.20", net.IPMask(net.ParseIP("255.255.255.0")), true},
+		{"192.168.1.10", "192.168.1.20", net.CIDRMask(120, 128), true},
+		{"192.168.1.10", "2001:db8::1", mask24, false},
+		{"2001:db8::1", "2001:db8::ffff", net.CIDRMask(64, 128), true},
+		{"2001:db8::1", "2001:db8:1::1", net.CIDRMask(64, 128), false},
+		{"2001:db8::1", "2001:db8::2", mask24, false},
+	}
+	for _, tt := range tests {
+		if got := SameSubnet(net.ParseIP(tt.a), net.ParseIP(tt.b), tt.mask); got != tt.want {
+			t.Errorf("SameSubnet(%s, %s, %s) = %v, want %v", tt.a, tt.b, tt.mask, got, tt.want)
+		}
+	}
+	if SameSubnet(nil, nil, mask24) {
+		t.Error("SameSubnet(nil, nil) = true")
+	}
+}
+
+func TestSameSubnetAsLocal(t *testing.T) {
+	n := &Network{LocalIP: net.ParseIP("192.168.1.10"), SubnetMask: net.ParseIP("255.255.255.0")}
+	if same, err := n.SameSubnetAsLocal(net.ParseIP("192.168.1.1")); err != nil || !same {
+		t.Errorf("SameSubnetAsLocal(192.168.1.1) = %v, %v", same, err)
+	}
+	if same, err := n.SameSubnetAsLocal(net.ParseIP("10.0.0.1")); err != nil || same {
+		t.Errorf("SameSubnetAsLocal(10.0.0.1) = %v, %v", same, err)
+	}
+	if _, err := (&Network{LocalIP: n.LocalIP}).SameSubnetAsLocal(net.ParseIP("192.168.1.1")); err == nil {
+		t.Error("SameSubnetAsLocal() expected error without subnet mask")
+	}
+}
+
+func TestUsableHostCount(t *testing.T) {
+	tests := []struct {
+		ip   string
+		mask string
+		want uint64
+		ok   bool
+	}{
+		{"192.168.1.10", "255.255.255.0", 254, true},
+		{"10.0.0.1", "255.255.0.0", 65534, true},
+		{"10.0.0.1", "0.0.0.0", 4294967294, true},
+		{"192.0.2.0", "255.255.255.254", 2, true},
+		{"192.0.2.7", "255.255.255.255", 1, true},
+		{"192.0.2.1", "255.255.255.252", 2, true},
+		{"2001:db8::1", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ff00", 256, true},
+		{"2001:db8::1", "ffff:ffff:ffff:ff00::", math.MaxUint64, true},
+		{"2001:db8::1", "ffff:ffff:ffff:ffff::", math.MaxUint64, true},
+		{"2001:db8::1", "ffff:ffff:ffff:ffff:8000::", 1 << 63, true},
+		{"192.168.1.10", "255.0.255.0", 0, false},
+	}
+	for _, tt := range tests {
+		n := &Network{LocalIP: net.ParseIP(tt.ip), SubnetMask: net.ParseIP(tt.mask)}
+		got, err := n.UsableHostCount()
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("UsableHostCount(%s/%s) = %d, %v, want %d", tt.ip, tt.mask, got, err, tt.want)
+		}
+	}
+
+	// 4 byte masks work as well
+	n := &Network{LocalIP: net.ParseIP("192.168.1.10"), SubnetMask: net.IP(net.CIDRMask(28, 32))}
+	if got, err := n.UsableHostCount(); err != nil || got != 14 {
+		t.Errorf("UsableHostCount(/28) = %d, %v, want 14", got, err)
+	}
+	if _, err := (&Network{LocalIP: n.LocalIP}).UsableHostCount(); err == nil {
+		t.Error("UsableHostCount() expected error without subnet mask")
+	}
+}
+
+func TestCIDRHosts(t *testing.T) {
+	tests := []struct {
+		cidr  string
+		first string
+		last  string
+		count int
+	}{
+		{"192.168.1.0/30", "192.168.1.1", "192.168.1.2", 2},
+		{"192.168.1.0/31", "192.168.1.0", "192.168.1.1", 2},
+		{"192.168.1.7/32", "192.168.1.7", "192.168.1.7", 1},
+		{"10.0.0.0/23", "10.0.0.1", "10.0.1.254", 510},
+		{"2001:db8::/126", "2001:db8::", "2001:db8::3", 4},
+	}
+
+	for _, tt := range tests {
+		_, ipnet, _ := net.ParseCIDR(tt.cidr)
+		hosts, err := cidrHosts(ipnet, MaxRangeHosts)
+		if err != nil {
+			t.Errorf("cidrHosts(%s) error = %v", tt.cidr, err)
+			continue
+		}
+		if len(hosts) != tt.count {
+			t.Errorf("cidrHosts(%s) returned %d hosts, want %d", tt.cidr, len(hosts), tt.count)
+			continue
+		}
+		if hosts[0].String() != tt.first || hosts[len(hosts)-1].String() != tt.last {
+			t.Errorf("cidrHosts(%s) range = %s-%s, want %s-%s", tt.cidr, hosts[0], hosts[len(hosts)-1], tt.first, tt.last)
+		}
+	}
+
+	_, large, _ := net.ParseCIDR("10.0.0.0/8")
+	if _, err := cidrHosts(large, MaxRangeHosts); err == nil {
+		t.Error("cidrHosts() should reject oversized ranges")
+	}
+}
+
+func TestExpandTargets(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    []string
+		wantErr bool
+	}{
+		{spec: "192.0.2.1", want: []string{"192.0.2.1"}},
+		{spec: "10.0.0.1-10.0.0.3", want: []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}},
+		{spec: "10.0.0.254-2", wantErr: true},
+		{spec: "10.0.0.9-11", want: []string{"10.0.0.9", "10.0.0.10", "10.0.0.11"}},
+		{spec: "10.0.0.255-10.0.1.1", want: []string{"10.0.0.255", "10.0.1.0", "10.0.1.1"}},
+		{spec: "192.0.2.0/30, 192.0.2.9", want: []string{"192.0.2.1", "192.0.2.2", "192.0.2.9"}},
+		{spec: "192.0.2.1,192.0.2.1-192.0.2.2", want: []string{"192.0.2.1", "192.0.2.2"}},
+		{spec: "2001:db8::1-2001:db8::2", want: []string{"2001:db8::1", "2001:db8::2"}},
+		{spec: "10.0.0.5-10.0.0.1", wantErr: true},
+		{spec: "10.0.0.1-2001:db8::1", wantErr: true},
+		{spec: "10.0.0.0/8", wantErr: true},
+		{spec: "2001:db8::-2001:db8::ffff:ffff", wantErr: true},
+		{spec: "not-an-ip", wantErr: true},
+		{spec: " , ", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		ips, err := ExpandTargets(tt.spec)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ExpandTargets(%q) expected error, got %v", tt.spec, ips)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ExpandTargets(%q) error = %v", tt.spec, err)
+			continue
+		}
+		var got []string
+		for _, ip := range ips {
+			got = append(got, ip.String())
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("ExpandTargets(%q) = %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	tests := []struct {
+		ips  []string
+		want []string
+	}{
+		{nil, nil},
+		{[]string{"192.0.2.1"}, []string{"192.0.2.1/32"}},
+		{[]string{"192.0.2.0", "192.0.2.1", "192.0.2.2", "192.0.2.3"}, []string{"192.0.2.0/30"}},
+		{[]string{"192.0.2.3", "192.0.2.1", "192.0.2.2", "192.0.2.2"}, []string{"192.0.2.1/32", "192.0.2.2/31"}},
+		{[]string{"10.0.0.255", "10.0.1.0"}, []string{"10.0.0.255/32", "10.0.1.0/32"}},
+		{[]string{"192.0.2.9", "192.0.2.1", "::ffff:192.0.2.8"}, []string{"192.0.2.1/32", "192.0.2.8/31"}},
+		{[]string{"2001:db8::1", "10.0.0.1", "2001:db8::"}, []string{"10.0.0.1/32", "2001:db8::/127"}},
+	}
+
+	for _, tt := range tests {
+		var ips []net.IP
+		for _, s := range tt.ips {
+			ips = append(ips, net.ParseIP(s))
+		}
+		var got []string
+		for _, ipnet := range Aggregate(ips) {
+			got = append(got, ipnet.String())
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("Aggregate(%v) = %v, want %v", tt.ips, got, tt.want)
+		}
+	}
+
+	// A whole /24 collapses into one prefix, one missing address splits it
+	ips, _ := cidrHosts(mustParseCIDR("198.51.100.0/31"), 2)
+	hosts, _ := ExpandTargets("198.51.100.2-255")
+	ips = append(ips, hosts...)
+	if got := Aggregate(ips); len(got) != 1 || got[0].String() != "198.51.100.0/24" {
+		t.Errorf("Aggregate(/24) = %v", got)
+	}
+	ips = append(ips[:10], ips[11:]...)
+	if got := Aggregate(ips); len(got) != 8 {
+		t.Errorf("Aggregate(/24 without .10) = %v, want 8 prefixes", got)
+	}
+}
+
+func TestExpandTargetsLimit(t *testing.T) {
+	original := MaxRangeHosts
+	defer func() { MaxRangeHosts = original }()
+	MaxRangeHosts = 4
+
+	if _, err := ExpandTargets("10.0.0.1-3,10.0.1.1-3"); err == nil {
+		t.Error("expected error when the total exceeds MaxRangeHosts")
+	}
+	if ips, err := ExpandTargets("10.0.0.1-4"); err != nil || len(ips) != 4 {
+		t.Errorf("ExpandTargets() = %v, %v", ips, err)
+	}
+}
+
+func TestWithZone(t *testing.T) {
+	original := defaultZone
+	defer func() { defaultZone = original }()
+	defaultZone = func(string) string { return "eth0" }
+
+	tests := map[string]string{
+		"fe80::1":      "fe80::1%eth0",
+		"ff02::1":      "ff02::1%eth0",
+		"fe80::1%eth1": "fe80::1%eth1",
+		"2001:db8::1":  "2001:db8::1",
+		"169.254.1.1":  "169.254.1.1",
+		"example.com":  "example.com",
+	}
+	for host, want := range tests {
+		if got := withZone(host); got != want {
+			t.Errorf("withZone(%q) = %q, want %q", host, got, want)
+		}
+	}
+
+	defaultZone = func(string) string { return "" }
+	if got := withZone("fe80::1"); got != "fe80::1" {
+		t.Errorf("withZone() without default zone = %q", got)
+	}
+
+	defaultZone = func(namespace string) string { return "veth-" + namespace }
+	if got := withNamespaceZone("fe80::1", "blue"); got != "fe80::1%veth-blue" {
+		t.Errorf("withNamespaceZone() = %q, want the zone of the namespace", got)
+	}
+}
+
+func TestSplitZone(t *testing.T) {
+	if ip, zone := splitZone("fe80::1%eth0"); !ip.Equal(net.ParseIP("fe80::1")) || zone != "eth0" {
+		t.Errorf("splitZone() = %v, %q", ip, zone)
+	}
+	if ip, zone := splitZone("192.0.2.1"); !ip.Equal(net.ParseIP("192.0.2.1")) || zone != "" {
+		t.Errorf("splitZone() = %v, %q", ip, zone)
+	}
+	for _, host := range []string{"192.0.2.1%eth0", "example.com", "fe80::zz%eth0"} {
+		if ip, _ := splitZone(host); ip != nil {
+			t.Errorf("splitZone(%q) = %v, want nil", host, ip)
+		}
+	}
+}
+
+// linkLocalTarget returns a link-local address of this host and its interface
+func linkLocalTarget(t *testing.T) (net.IP, string) {
+	t.Helper()
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		t.Fatalf("net.Interfaces() error = %v", err)
+	}
+	for _, interf := range interfaces {
+		if interf.Flags&net.FlagUp == 0 {
+			continue
+		}
+		addrs, _ := interf.Addrs()
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.To4() == nil && ipnet.IP.IsLinkLocalUnicast() {
+				return ipnet.IP, interf.Name
+			}
+		}
+	}
+	t.Skip("no interface with an IPv6 link-local address")
+	return nil, ""
+}
+
+func TestLinkLocalTarget(t *testing.T) {
+	ip, name := linkLocalTarget(t)
+
+	original := defaultZone
+	defer func() { defaultZone = original }()
+	defaultZone = func(string) string { return name }
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(ip.String()+"%"+name, "0"))
+	if err != nil {
+		t.Skipf("failed to listen on %s: %v", ip, err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	// The target is given without zone
+	port := listener.Addr().(*net.TCPAddr).Port
+	result, err := TCPPing(context.Background(), ip.String(), port, &TCPPingOptions{Count: 1})
+	if err != nil {
+		t.Fatalf("TCPPing() error = %v", err)
+	}
+	if result.Received != 1 {
+		t.Errorf("TCPPing() to link-local address = %+v", result)
+	}
+
+	target, err := resolvePingTarget(context.Background(), withZone(ip.String()), IPVersionAuto)
+	if err != nil || !target.IP.Equal(ip) || target.Zone != name {
+		t.Errorf("resolvePingTarget() = %v, %v", target, err)
+	}
+}
@@ -0,0 +1,202 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LANScanOptions configures ScanLAN
+type LANScanOptions struct {
+	Network     string            // CIDR to scan (default: the network of the local IP, see GetConfig)
+	Timeout     time.Duration     // Time each host is waited for (default: 1s)
+	Concurrency int               // Parallel pings and reverse lookups (default: 64)
+	Native      bool              // Ping with an ICMP socket instead of the ping command, see PingOptions.Native
+	Vendors     map[string]string // Additional vendors by OUI ("00:11:22"), consulted before the built-in table
+}
+
+// LANHost is a host found by ScanLAN
+type LANHost struct {
+	IP       net.IP
+	MAC      net.HardwareAddr // nil if the host is not in the ARP table, such as this host
+	Vendor   string           // Manufacturer of the MAC address, empty if unknown
+	Hostname string           // First PTR name
+	Alive    bool             // The host answered the ping, hosts found in the ARP table only are not alive
+	RTT      time.Duration
+}
+
+// lanSweep pings the hosts of ScanLAN, replaced in tests
+var lanSweep = PingHosts
+
+// ScanLAN builds an inventory of an IPv4 network: every address is pinged, the ARP table filled by the
+// sweep supplies the MAC addresses, and hosts are named by their PTR record and the vendor of their MAC
+// address. Hosts which drop pings but answered ARP are reported too, with Alive false. The hosts are
+// sorted by address.
+func ScanLAN(ctx context.Context, opts *LANScanOptions) ([]LANHost, error) {
+	options := LANScanOptions{}
+	if opts != nil {
+		options = *opts
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = time.Second
+	}
+	if options.Concurrency <= 0 {
+		options.Concurrency = 64
+	}
+
+	ipnet, err := lanNetwork(options.Network)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := cidrHosts(ipnet, MaxRangeHosts)
+	if err != nil {
+		return nil, err
+	}
+
+	hosts := make([]string, len(ips))
+	for i, ip := range ips {
+		hosts[i] = ip.String()
+	}
+	pingOptions := &PingOptions{Count: 1, Timeout: options.Timeout, Native: options.Native}
+	results, err := lanSweep(ctx, hosts, pingOptions, options.Concurrency)
+	if err != nil {
+		return nil, err
+	}
+	table, err := readARPTable()
+	if err != nil {
+		return nil, err
+	}
+
+	var found []LANHost
+	for _, ip := range ips {
+		host := LANHost{IP: ip}
+		if result := results[ip.String()]; result != nil && result.Success {
+			host.Alive = true
+			host.RTT = result.AvgRTT
+		}
+		host.MAC = table[ip.String()]
+		if host.MAC == nil && host.Alive {
+			if interf, err := interfaceByIP(ip); err == nil && len(interf.HardwareAddr) > 0 {
+				host.MAC = interf.HardwareAddr
+			}
+		}
+		if !host.Alive && host.MAC == nil {
+			continue
+		}
+		host.Vendor = lanVendor(host.MAC, options.Vendors)
+		found = append(found, host)
+	}
+
+	resolveLANNames(ctx, found, options.Concurrency)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(found, func(i, j int) bool {
+		return bytes.Compare(found[i].IP, found[j].IP) < 0
+	})
+	return found, nil
+}
+
+// lanNetwork parses the network to scan, the network of the local IP if empty
+func lanNetwork(cidr string) (*net.IPNet, error) {
+	if cidr == "" {
+		config, err := GetConfig()
+		if err != nil {
+			return nil, fmt.Errorf("failed to detect local network: %w", err)
+		}
+		if config.LocalIP.To4() == nil || config.SubnetMask == nil {
+			return nil, fmt.Errorf("local IPv4 address or subnet mask is not detected")
+		}
+		mask := net.IPMask(config.SubnetMask.To4())
+		return &net.IPNet{IP: config.LocalIP.To4().Mask(mask), Mask: mask}, nil
+	}
+
+	_, ipnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid network %q: %w", cidr, err)
+	}
+	if ipnet.IP.To4() == nil {
+		return nil, fmt.Errorf("LAN scan requires an IPv4 network, got %s", cidr)
+	}
+	return ipnet, nil
+}
+
+// resolveLANNames sets the hostnames of the hosts from their PTR records
+func resolveLANNames(ctx context.Context, hosts []LANHost, concurrency int) {
+	var wg sync.WaitGroup
+	jobs := make(chan *LANHost)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for host := range jobs {
+				if names, err := lookupAddr(ctx, host.IP.String()); err == nil && len(names) > 0 {
+					host.Hostname = strings.TrimSuffix(names[0], ".")
+				}
+			}
+		}()
+	}
+	for i := range hosts {
+		if ctx.Err() != nil {
+			break
+		}
+		jobs <- &hosts[i]
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// lanVendor returns the vendor of the MAC address from the extra table or the built-in one
+func lanVendor(mac net.HardwareAddr, extra map[string]string) string {
+	if len(mac) < 3 {
+		return ""
+	}
+	for oui, vendor := range extra {
+		if prefix, err := parseLooseMAC(oui + ":00:00:00"); err == nil && bytes.Equal(prefix[:3], mac[:3]) {
+			return vendor
+		}
+	}
+	return MACVendor(mac)
+}
+
+// ouiVendors are well-known organizationally unique identifiers, mostly of virtual machines and
+// small devices common in a LAN
+var ouiVendors = map[string]string{
+	"00:00:0c": "Cisco",
+	"00:03:93": "Apple",
+	"00:05:69": "VMware",
+	"00:0c:29": "VMware",
+	"00:11:32": "Synology",
+	"00:15:5d": "Microsoft Hyper-V",
+	"00:16:3e": "Xen",
+	"00:1a:11": "Google",
+	"00:1c:42": "Parallels",
+	"00:50:56": "VMware",
+	"08:00:27": "VirtualBox",
+	"24:0a:c4": "Espressif",
+	"24:a4:3c": "Ubiquiti",
+	"28:cd:c1": "Raspberry Pi",
+	"30:ae:a4": "Espressif",
+	"52:54:00": "QEMU/KVM",
+	"84:f3:eb": "Espressif",
+	"b8:27:eb": "Raspberry Pi",
+	"d8:3a:dd": "Raspberry Pi",
+	"dc:a6:32": "Raspberry Pi",
+	"e4:5f:01": "Raspberry Pi",
+	"f0:9f:c2": "Ubiquiti",
+}
+
+// MACVendor returns the manufacturer of the MAC address from a small built-in table of well-known
+// OUIs, empty if unknown. The random addresses of phones and other private addresses have no
+// manufacturer.
+func MACVendor(mac net.HardwareAddr) string {
+	if len(mac) < 3 {
+		return ""
+	}
+	return ouiVendors[mac[:3].String()]
+}
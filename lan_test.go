@@ -0,0 +1,101 @@
+package network
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScanLAN(t *testing.T) {
+	originalSweep, originalARP, originalAddr := lanSweep, readARPTable, lookupAddr
+	defer func() { lanSweep, readARPTable, lookupAddr = originalSweep, originalARP, originalAddr }()
+
+	var swept []string
+	lanSweep = func(ctx context.Context, hosts []string, options *PingOptions, concurrency int) (map[string]*PingResult, error) {
+		swept = hosts
+		if options.Count != 1 || options.Timeout != 200*time.Millisecond {
+			t.Errorf("sweep options = %+v", options)
+		}
+		return map[string]*PingResult{
+			"192.0.2.1":  {Host: "192.0.2.1", Success: true, AvgRTT: time.Millisecond},
+			"192.0.2.5":  {Host: "192.0.2.5", Success: true, AvgRTT: 2 * time.Millisecond},
+			"192.0.2.10": {Host: "192.0.2.10", Success: false, PacketLoss: 100},
+		}, nil
+	}
+	readARPTable = func() (map[string]net.HardwareAddr, error) {
+		mac := func(s string) net.HardwareAddr {
+			m, _ := net.ParseMAC(s)
+			return m
+		}
+		return map[string]net.HardwareAddr{
+			"192.0.2.1":    mac("b8:27:eb:00:00:01"),
+			"192.0.2.10":   mac("00:aa:bb:00:00:10"), // drops pings
+			"198.51.100.1": mac("00:00:0c:00:00:01"), // outside the network
+		}, nil
+	}
+	lookupAddr = func(ctx context.Context, addr string) ([]string, error) {
+		if addr == "192.0.2.1" {
+			return []string{"pi.lan."}, nil
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: addr, IsNotFound: true}
+	}
+
+	hosts, err := ScanLAN(context.Background(), &LANScanOptions{
+		Network: "192.0.2.0/28",
+		Timeout: 200 * time.Millisecond,
+		Vendors: map[string]string{"00-AA-BB": "Example Corp"},
+	})
+	if err != nil {
+		t.Fatalf("ScanLAN() error = %v", err)
+	}
+	if len(swept) != 14 {
+		t.Errorf("swept %d hosts, want 14", len(swept))
+	}
+
+	var got []string
+	for _, host := range hosts {
+		got = append(got, strings.Join([]string{host.IP.String(), host.MAC.String(), host.Vendor, host.Hostname}, "|"))
+	}
+	want := []string{
+		"192.0.2.1|b8:27:eb:00:00:01|Raspberry Pi|pi.lan",
+		"192.0.2.5|||",
+		"192.0.2.10|00:aa:bb:00:00:10|Example Corp|",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("ScanLAN() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if len(hosts) == 3 {
+		if !hosts[0].Alive || hosts[0].RTT != time.Millisecond || !hosts[1].Alive || hosts[2].Alive {
+			t.Errorf("Alive/RTT = %+v", hosts)
+		}
+	}
+
+	if _, err := ScanLAN(context.Background(), &LANScanOptions{Network: "2001:db8::/120"}); err == nil {
+		t.Error("expected error for IPv6 network")
+	}
+	if _, err := ScanLAN(context.Background(), &LANScanOptions{Network: "invalid"}); err == nil {
+		t.Error("expected error for invalid network")
+	}
+}
+
+func TestMACVendor(t *testing.T) {
+	tests := []struct {
+		mac  string
+		want string
+	}{
+		{"52:54:00:12:34:56", "QEMU/KVM"},
+		{"00:0C:29:AB:CD:EF", "VMware"},
+		{"02:00:00:00:00:01", ""},
+	}
+	for _, tt := range tests {
+		mac, _ := net.ParseMAC(tt.mac)
+		if got := MACVendor(mac); got != tt.want {
+			t.Errorf("MACVendor(%s) = %q, want %q", tt.mac, got, tt.want)
+		}
+	}
+	if got := MACVendor(nil); got != "" {
+		t.Errorf("MACVendor(nil) = %q", got)
+	}
+}
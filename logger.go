@@ -0,0 +1,41 @@
+package network
+
+import "sync"
+
+// Logger receives the key events of the library, such as executed commands, fallbacks and retries.
+// kv holds alternating keys and values, *slog.Logger satisfies the interface.
+type Logger interface {
+	Debug(msg string, kv ...interface{})
+	Info(msg string, kv ...interface{})
+	Warn(msg string, kv ...interface{})
+}
+
+// nopLogger discards all events, it's the default
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...interface{}) {}
+func (nopLogger) Info(string, ...interface{})  {}
+func (nopLogger) Warn(string, ...interface{})  {}
+
+var (
+	loggerMu     sync.RWMutex
+	activeLogger Logger = nopLogger{}
+)
+
+// SetLogger sets the logger the library reports its decisions to: commands are logged at debug level,
+// retries at info level, fallbacks at warn level. nil discards the events, which is the default.
+func SetLogger(l Logger) {
+	if l == nil {
+		l = nopLogger{}
+	}
+	loggerMu.Lock()
+	activeLogger = l
+	loggerMu.Unlock()
+}
+
+// logger returns the logger set with SetLogger
+func logger() Logger {
+	loggerMu.RLock()
+	defer loggerMu.RUnlock()
+	return activeLogger
+}
@@ -0,0 +1,69 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingLogger collects the events as "level msg kv..."
+type recordingLogger struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (l *recordingLogger) record(level, msg string, kv []interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, strings.TrimSpace(fmt.Sprintln(append([]interface{}{level, msg}, kv...)...)))
+}
+
+func (l *recordingLogger) Debug(msg string, kv ...interface{}) { l.record("DEBUG", msg, kv) }
+func (l *recordingLogger) Info(msg string, kv ...interface{})  { l.record("INFO", msg, kv) }
+func (l *recordingLogger) Warn(msg string, kv ...interface{})  { l.record("WARN", msg, kv) }
+
+func (l *recordingLogger) find(prefix string) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, event := range l.events {
+		if strings.HasPrefix(event, prefix) {
+			return event
+		}
+	}
+	return ""
+}
+
+func TestSetLogger(t *testing.T) {
+	recorder := &recordingLogger{}
+	SetLogger(recorder)
+	defer SetLogger(nil)
+
+	command(context.Background(), "echo", "hello", "world")
+	if event := recorder.find("DEBUG executing command"); event != "DEBUG executing command name echo args hello world" {
+		t.Errorf("command event = %q", event)
+	}
+
+	network := &Network{}
+	network.warn("gateway unavailable: %s", "no route")
+	if event := recorder.find("WARN network detection incomplete"); !strings.Contains(event, "gateway unavailable: no route") {
+		t.Errorf("warning event = %q", event)
+	}
+
+	// Retries of failed queries are logged
+	server := startTestDNSServer(t, func(query *dnsMessage, tcp bool) *dnsMessage {
+		return nil
+	})
+	ResolveQuery(context.Background(), "example.com", QueryOptions{Server: server, Retries: 1, Timeout: 50 * time.Millisecond})
+	if event := recorder.find("INFO retrying DNS query"); !strings.Contains(event, "attempt 1") {
+		t.Errorf("retry event = %q", event)
+	}
+
+	// nil restores the no-op logger
+	SetLogger(nil)
+	if _, ok := logger().(nopLogger); !ok {
+		t.Errorf("logger() = %T after SetLogger(nil)", logger())
+	}
+}
@@ -0,0 +1,97 @@
+package network
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MailServerCheck is the outcome of checking a mail server of a domain
+type MailServerCheck struct {
+	Host      string        // Mail server host name of the MX record
+	Priority  uint16        // MX preference, lower is preferred
+	Reachable bool          // TCP connection to port 25 succeeded
+	Banner    string        // SMTP greeting line, empty if none was received
+	Latency   time.Duration // Time to establish the connection
+	Error     string        // Error message if the server is unreachable or sent no greeting
+}
+
+// mailCheckTimeout is the timeout of connecting to a mail server and reading its greeting
+const mailCheckTimeout = 10 * time.Second
+
+// smtpPort is the port mail servers are checked on, replaced in tests
+var smtpPort = "25"
+
+// CheckMailServers takes the MX records of the domain from ResolveContext and checks concurrently whether each mail
+// server accepts connections on port 25 and sends an SMTP greeting. Results are in MX preference order.
+// Note that many networks block outgoing connections to port 25.
+func CheckMailServers(ctx context.Context, domain string) ([]MailServerCheck, error) {
+	if domain == "" {
+		return nil, fmt.Errorf("domain cannot be empty")
+	}
+	domain = cleanDomain(domain)
+
+	records, err := ResolveContext(ctx, domain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lookup MX records of %s: %w", domain, err)
+	}
+	if len(records.MX) == 0 {
+		return nil, fmt.Errorf("no MX records found for %s", domain)
+	}
+	// A single "." MX record means the domain doesn't accept mail (RFC 7505)
+	if len(records.MX) == 1 && records.MX[0].Host == "" {
+		return nil, fmt.Errorf("%s does not accept mail", domain)
+	}
+
+	results := make([]MailServerCheck, len(records.MX))
+	var wg sync.WaitGroup
+	for i, mx := range records.MX {
+		results[i] = MailServerCheck{
+			Host:     mx.Host,
+			Priority: mx.Priority,
+		}
+		wg.Add(1)
+		go func(check *MailServerCheck) {
+			defer wg.Done()
+			checkMailServer(ctx, check)
+		}(&results[i])
+	}
+	wg.Wait()
+
+	return results, ctx.Err()
+}
+
+// checkMailServer connects to the SMTP port of the server and reads its greeting
+func checkMailServer(ctx context.Context, check *MailServerCheck) {
+	checkCtx, cancel := context.WithTimeout(ctx, mailCheckTimeout)
+	defer cancel()
+
+	conn, reply := tcpDial(checkCtx, newDirectDialer(mailCheckTimeout, nil), net.JoinHostPort(check.Host, smtpPort), 1, mailCheckTimeout, false)
+	if reply.Error != "" {
+		check.Error = reply.Error
+		return
+	}
+	defer conn.Close()
+	check.Latency = reply.RTT
+	check.Reachable = true
+
+	if deadline, ok := checkCtx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	check.Banner = strings.TrimSpace(line)
+	if err != nil && check.Banner == "" {
+		check.Error = fmt.Sprintf("no SMTP greeting: %v", err)
+		return
+	}
+	if !strings.HasPrefix(check.Banner, "220") {
+		check.Error = fmt.Sprintf("unexpected SMTP greeting: %s", check.Banner)
+	}
+
+	// Leave politely, the reply doesn't matter
+	conn.Write([]byte("QUIT\r\n"))
+}
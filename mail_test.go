@@ -0,0 +1,98 @@
+package network
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// startTestSMTPServer accepts connections on localhost and greets them with the banner
+func startTestSMTPServer(t testing.TB, banner string) int {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte(banner))
+			conn.Close()
+		}
+	}()
+
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestCheckMailServers(t *testing.T) {
+	originalResolver, originalPort := systemResolver, smtpPort
+	defer func() { systemResolver, smtpPort = originalResolver, originalPort }()
+
+	smtpPort = strconv.Itoa(startTestSMTPServer(t, "220 mx.example.com ESMTP ready\r\n"))
+	server := startTestDNSServer(t, func(query *dnsMessage, tcp bool) *dnsMessage {
+		q := query.Questions[0]
+		response := &dnsMessage{}
+		if q.Type != dnsTypeMX {
+			return response
+		}
+		switch q.Name {
+		case "example.com":
+			response.Answers = []dnsRR{
+				{Name: q.Name, Type: dnsTypeMX, Class: dnsClassINET, Pref: 20, Target: "unreachable.invalid."},
+				{Name: q.Name, Type: dnsTypeMX, Class: dnsClassINET, Pref: 10, Target: "localhost."},
+			}
+		case "nullmx.example":
+			response.Answers = []dnsRR{{Name: q.Name, Type: dnsTypeMX, Class: dnsClassINET, Pref: 0, Target: "."}}
+		default:
+			response.RCode = dnsRCodeNXDomain
+		}
+		return response
+	})
+	systemResolver = func() *net.Resolver { return newResolver(server) }
+
+	checks, err := CheckMailServers(context.Background(), "example.com")
+	if err != nil {
+		t.Fatalf("CheckMailServers() error = %v", err)
+	}
+	if len(checks) != 2 {
+		t.Fatalf("CheckMailServers() returned %d checks", len(checks))
+	}
+
+	first := checks[0]
+	if first.Host != "localhost" || first.Priority != 10 || !first.Reachable || first.Latency <= 0 || first.Error != "" {
+		t.Errorf("reachable server = %+v", first)
+	}
+	if first.Banner != "220 mx.example.com ESMTP ready" {
+		t.Errorf("Banner = %q", first.Banner)
+	}
+	if second := checks[1]; second.Reachable || second.Error == "" || second.Priority != 20 {
+		t.Errorf("unreachable server = %+v", second)
+	}
+
+	if _, err := CheckMailServers(context.Background(), "nullmx.example"); err == nil || !strings.Contains(err.Error(), "does not accept mail") {
+		t.Errorf("CheckMailServers(null MX) error = %v", err)
+	}
+	if _, err := CheckMailServers(context.Background(), "missing.example"); err == nil {
+		t.Error("CheckMailServers() expected error for domain without MX records")
+	}
+}
+
+func TestCheckMailServerBadGreeting(t *testing.T) {
+	originalPort := smtpPort
+	defer func() { smtpPort = originalPort }()
+
+	smtpPort = strconv.Itoa(startTestSMTPServer(t, "554 no service\r\n"))
+	check := &MailServerCheck{Host: "127.0.0.1"}
+	checkMailServer(context.Background(), check)
+	if !check.Reachable || check.Banner != "554 no service" || !strings.Contains(check.Error, "unexpected SMTP greeting") {
+		t.Errorf("checkMailServer() = %+v", check)
+	}
+}
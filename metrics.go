@@ -0,0 +1,116 @@
+package network
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// pingMetric is a metric family of the OpenMetrics output of ping results
+type pingMetric struct {
+	name  string
+	help  string
+	value func(r *PingResult) []pingSample
+}
+
+// pingSample is a sample of a metric family with its extra labels
+type pingSample struct {
+	labels [][2]string
+	value  float64
+}
+
+var pingMetrics = []pingMetric{
+	{"ping_up", "Whether any echo reply was received.", func(r *PingResult) []pingSample {
+		up := 0.0
+		if r.Success {
+			up = 1
+		}
+		return []pingSample{{value: up}}
+	}},
+	{"ping_packets_sent", "Number of echo requests sent.", func(r *PingResult) []pingSample {
+		return []pingSample{{value: float64(r.Sent)}}
+	}},
+	{"ping_packets_received", "Number of echo replies received.", func(r *PingResult) []pingSample {
+		return []pingSample{{value: float64(r.Received)}}
+	}},
+	{"ping_packet_loss_ratio", "Ratio of echo requests without reply.", func(r *PingResult) []pingSample {
+		return []pingSample{{value: r.PacketLoss / 100}}
+	}},
+	{"ping_rtt_seconds", "Round trip time statistics of the echo replies.", func(r *PingResult) []pingSample {
+		if r.Received == 0 {
+			return nil
+		}
+		stats := []struct {
+			name  string
+			value time.Duration
+		}{{"min", r.MinRTT}, {"avg", r.AvgRTT}, {"max", r.MaxRTT}, {"stddev", r.StdDevRTT}}
+		samples := make([]pingSample, 0, len(stats))
+		for _, stat := range stats {
+			samples = append(samples, pingSample{labels: [][2]string{{"stat", stat.name}}, value: stat.value.Seconds()})
+		}
+		return samples
+	}},
+}
+
+// labelName matches the valid label names of the OpenMetrics text format
+var labelName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// OpenMetrics renders the result in the OpenMetrics text format for textfile collectors and the
+// Pushgateway. The labels are added to every sample together with the host label of the result.
+func (r *PingResult) OpenMetrics(labels map[string]string) (string, error) {
+	return PingResultsOpenMetrics(map[string]*PingResult{r.Host: r}, labels)
+}
+
+// PingResultsOpenMetrics renders the results of PingHosts in the OpenMetrics text format, the samples
+// of each host carry its host label and the given labels. An error is returned for invalid label names
+// and for the host and stat labels, which are set by the output and would make samples of different
+// hosts collide.
+func PingResultsOpenMetrics(results map[string]*PingResult, labels map[string]string) (string, error) {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		if !labelName.MatchString(name) {
+			return "", fmt.Errorf("invalid label name %q", name)
+		}
+		if name == "host" || name == "stat" {
+			return "", fmt.Errorf("label %q is reserved", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	hosts := make([]string, 0, len(results))
+	for host, result := range results {
+		if result != nil {
+			hosts = append(hosts, host)
+		}
+	}
+	sort.Strings(hosts)
+
+	var buf strings.Builder
+	for _, metric := range pingMetrics {
+		buf.WriteString("# HELP " + metric.name + " " + metric.help + "\n")
+		buf.WriteString("# TYPE " + metric.name + " gauge\n")
+		for _, host := range hosts {
+			for _, sample := range metric.value(results[host]) {
+				buf.WriteString(metric.name + "{host=\"" + escapeLabelValue(host) + "\"")
+				for _, name := range names {
+					buf.WriteString("," + name + "=\"" + escapeLabelValue(labels[name]) + "\"")
+				}
+				for _, label := range sample.labels {
+					buf.WriteString("," + label[0] + "=\"" + escapeLabelValue(label[1]) + "\"")
+				}
+				buf.WriteString("} " + strconv.FormatFloat(sample.value, 'g', -1, 64) + "\n")
+			}
+		}
+	}
+	buf.WriteString("# EOF\n")
+	return buf.String(), nil
+}
+
+// escapeLabelValue escapes backslashes, double quotes and line feeds of a label value
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
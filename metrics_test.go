@@ -0,0 +1,100 @@
+package network
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPingResultOpenMetrics(t *testing.T) {
+	result := &PingResult{
+		Host:       "192.0.2.1",
+		Sent:       4,
+		Received:   3,
+		Lost:       1,
+		PacketLoss: 25,
+		MinRTT:     10 * time.Millisecond,
+		AvgRTT:     12500 * time.Microsecond,
+		MaxRTT:     15 * time.Millisecond,
+		StdDevRTT:  2 * time.Millisecond,
+		Success:    true,
+	}
+	got, err := result.OpenMetrics(map[string]string{"site": "ber\"1", "job": "ping"})
+	if err != nil {
+		t.Fatalf("OpenMetrics() error = %v", err)
+	}
+	want := `# HELP ping_up Whether any echo reply was received.
+# TYPE ping_up gauge
+ping_up{host="192.0.2.1",job="ping",site="ber\"1"} 1
+# HELP ping_packets_sent Number of echo requests sent.
+# TYPE ping_packets_sent gauge
+ping_packets_sent{host="192.0.2.1",job="ping",site="ber\"1"} 4
+# HELP ping_packets_received Number of echo replies received.
+# TYPE ping_packets_received gauge
+ping_packets_received{host="192.0.2.1",job="ping",site="ber\"1"} 3
+# HELP ping_packet_loss_ratio Ratio of echo requests without reply.
+# TYPE ping_packet_loss_ratio gauge
+ping_packet_loss_ratio{host="192.0.2.1",job="ping",site="ber\"1"} 0.25
+# HELP ping_rtt_seconds Round trip time statistics of the echo replies.
+# TYPE ping_rtt_seconds gauge
+ping_rtt_seconds{host="192.0.2.1",job="ping",site="ber\"1",stat="min"} 0.01
+ping_rtt_seconds{host="192.0.2.1",job="ping",site="ber\"1",stat="avg"} 0.0125
+ping_rtt_seconds{host="192.0.2.1",job="ping",site="ber\"1",stat="max"} 0.015
+ping_rtt_seconds{host="192.0.2.1",job="ping",site="ber\"1",stat="stddev"} 0.002
+# EOF
+`
+	if got != want {
+		t.Errorf("OpenMetrics() = %s\nwant %s", got, want)
+	}
+}
+
+func TestPingResultsOpenMetrics(t *testing.T) {
+	results := map[string]*PingResult{
+		"b.example.com": {Host: "b.example.com", Sent: 2, Received: 2, Success: true, AvgRTT: time.Millisecond},
+		"a.example.com": {Host: "a.example.com", Sent: 2, PacketLoss: 100},
+		"c.example.com": nil,
+	}
+	got, err := PingResultsOpenMetrics(results, nil)
+	if err != nil {
+		t.Fatalf("PingResultsOpenMetrics() error = %v", err)
+	}
+
+	if !strings.Contains(got, "ping_up{host=\"a.example.com\"} 0\nping_up{host=\"b.example.com\"} 1\n") {
+		t.Errorf("PingResultsOpenMetrics() hosts are not sorted or labeled:\n%s", got)
+	}
+	if strings.Contains(got, "c.example.com") || strings.Contains(got, "ping_rtt_seconds{host=\"a.example.com\"") {
+		t.Errorf("PingResultsOpenMetrics() contains samples of failed hosts:\n%s", got)
+	}
+	if strings.Count(got, "# TYPE ping_up gauge") != 1 || !strings.HasSuffix(got, "# EOF\n") {
+		t.Errorf("PingResultsOpenMetrics() families are not grouped:\n%s", got)
+	}
+}
+
+func TestPingResultsOpenMetricsLabels(t *testing.T) {
+	results := map[string]*PingResult{
+		"a.example.com": {Host: "a.example.com", Sent: 1, Received: 1, Success: true},
+		"b.example.com": {Host: "b.example.com", Sent: 1, Received: 1, Success: true},
+	}
+
+	// A host label would give every host the same label set
+	for _, labels := range []map[string]string{
+		{"host": "pinger"},
+		{"stat": "x"},
+		{"1site": "office"},
+		{"site-name": "office"},
+		{"": "office"},
+	} {
+		if got, err := PingResultsOpenMetrics(results, labels); err == nil {
+			t.Errorf("PingResultsOpenMetrics(%v) accepted invalid labels:\n%s", labels, got)
+		}
+	}
+
+	got, err := PingResultsOpenMetrics(results, map[string]string{"_site2": "office"})
+	if err != nil {
+		t.Fatalf("PingResultsOpenMetrics() error = %v", err)
+	}
+	if !strings.Contains(got, `ping_up{host="a.example.com",_site2="office"} 1`) ||
+		!strings.Contains(got, `ping_up{host="b.example.com",_site2="office"} 1`) {
+		t.Errorf("PingResultsOpenMetrics() host labels:\n%s", got)
+	}
+}
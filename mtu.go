@@ -0,0 +1,202 @@
+package network
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+// Path MTU probing limits, 68 is the minimum MTU of IPv4 and 65535 the maximum packet size
+const (
+	minPathMTU = 68
+	maxPathMTU = 65535
+)
+
+// pathMTUProbeTimeout is how long a path MTU probe waits for the echo reply
+var pathMTUProbeTimeout = time.Second
+
+// pathMTUAttempts is how often a packet size is probed before it counts as too large, so a lost
+// echo request doesn't lower the result
+const pathMTUAttempts = 3
+
+// PathMTUResult is the result of PathMTUTo
+type PathMTUResult struct {
+	MTU          int // Largest packet size, including the IP header, which reaches the destination
+	InterfaceMTU int // Packet size the search started from, n.MTU limited to 65535 (1500 if unknown)
+	// BelowInterfaceMTU is set if the path MTU is lower than the interface MTU: a tunnel, VPN or PPPoE
+	// link on the path reduces the packet size
+	BelowInterfaceMTU bool
+}
+
+// PathMTUTo discovers the path MTU to the IPv4 destination by sending echo requests with the
+// Don't Fragment bit set, the packet sizes are searched between 68 bytes and n.MTU. Each size is
+// probed up to three times before it counts as too large.
+// The destination must answer echo requests and a raw ICMP socket is required.
+func (n *Network) PathMTUTo(ctx context.Context, dst net.IP) (*PathMTUResult, error) {
+	if dst = dst.To4(); dst == nil {
+		return nil, fmt.Errorf("path MTU probing requires an IPv4 address")
+	}
+	high := n.MTU
+	if high <= 0 {
+		high = 1500
+	}
+	if high > maxPathMTU {
+		high = maxPathMTU
+	}
+
+	conn, err := net.ListenPacket("ip4:icmp", "0.0.0.0")
+	if err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			return nil, fmt.Errorf("%w (%v)", ErrInsufficientPrivilege, err)
+		}
+		return nil, fmt.Errorf("failed to open ICMP socket: %w", err)
+	}
+	defer conn.Close()
+	raw, err := ipv4.NewRawConn(conn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ICMP socket: %w", err)
+	}
+	p := &mtuProber{conn: raw, dst: dst, id: rand.Intn(0xffff) + 1}
+	probe := func(size int) (bool, int, error) {
+		return p.probe(ctx, size)
+	}
+
+	// The smallest packet tells whether the destination answers at all
+	fits, _, err := probeSize(probe, minPathMTU)
+	if err != nil {
+		return nil, err
+	}
+	if !fits {
+		return nil, fmt.Errorf("no echo reply from %s", dst)
+	}
+
+	mtu, err := searchPathMTU(high, probe)
+	if err != nil {
+		return nil, err
+	}
+	return &PathMTUResult{MTU: mtu, InterfaceMTU: high, BelowInterfaceMTU: mtu < high}, nil
+}
+
+// searchPathMTU returns the largest packet size up to high which fits through the path.
+// The high size fits most paths and is probed first, then the range is halved.
+func searchPathMTU(high int, probe func(size int) (fits bool, nextHop int, err error)) (int, error) {
+	low, size := minPathMTU, high
+	for low < high {
+		fits, nextHop, err := probeSize(probe, size)
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case fits:
+			low = size
+		case nextHop >= low && nextHop < size:
+			// A router reported the MTU of its next hop, which likely fits the remaining path
+			high, size = nextHop, nextHop
+			continue
+		default:
+			high = size - 1
+		}
+		size = (low + high + 1) / 2
+	}
+	return low, nil
+}
+
+// probeSize probes the size until it fits or a router reports its next hop MTU, up to pathMTUAttempts times
+func probeSize(probe func(size int) (fits bool, nextHop int, err error), size int) (fits bool, nextHop int, err error) {
+	for attempt := 1; attempt <= pathMTUAttempts; attempt++ {
+		fits, nextHop, err = probe(size)
+		if err != nil || fits || nextHop > 0 {
+			return fits, nextHop, err
+		}
+	}
+	return false, 0, nil
+}
+
+// mtuProber sends echo requests of a given size with the Don't Fragment bit set
+type mtuProber struct {
+	conn *ipv4.RawConn
+	dst  net.IP
+	id   int
+	seq  int
+}
+
+// probe reports whether an echo request of size bytes, including the IP header, was answered.
+// nextHop is the MTU of a router which reported "fragmentation needed", 0 if unknown.
+func (p *mtuProber) probe(ctx context.Context, size int) (fits bool, nextHop int, err error) {
+	if err := ctx.Err(); err != nil {
+		return false, 0, err
+	}
+	p.seq++
+	seq := p.seq & 0xffff
+
+	msg := icmp.Message{
+		Type: ipv4.ICMPTypeEcho,
+		Body: &icmp.Echo{ID: p.id, Seq: seq, Data: make([]byte, size-ipv4.HeaderLen-8)},
+	}
+	payload, err := msg.Marshal(nil)
+	if err != nil {
+		return false, 0, err
+	}
+	header := &ipv4.Header{
+		Version:  ipv4.Version,
+		Len:      ipv4.HeaderLen,
+		TotalLen: size,
+		Flags:    ipv4.DontFragment,
+		TTL:      64,
+		Protocol: 1,
+		Dst:      p.dst,
+	}
+
+	start := time.Now()
+	if err := p.conn.WriteTo(header, payload, nil); err != nil {
+		// The kernel refuses packets exceeding the MTU of the interface or a known path MTU
+		if errors.Is(err, syscall.EMSGSIZE) {
+			return false, 0, nil
+		}
+		return false, 0, fmt.Errorf("failed to send echo request to %s: %w", p.dst, err)
+	}
+
+	deadline := start.Add(pathMTUProbeTimeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	p.conn.SetReadDeadline(deadline)
+
+	buf := make([]byte, maxPathMTU)
+	for {
+		_, data, _, err := p.conn.ReadFrom(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return false, 0, ctx.Err()
+			}
+			return false, 0, fmt.Errorf("failed to read echo reply: %w", err)
+		}
+		reply, err := icmp.ParseMessage(1, data)
+		if err != nil {
+			continue
+		}
+
+		if reply.Type == ipv4.ICMPTypeEchoReply {
+			if echo, ok := reply.Body.(*icmp.Echo); ok && echo.ID == p.id && echo.Seq == seq {
+				return true, 0, nil
+			}
+			continue
+		}
+		// "Fragmentation needed" carries the next hop MTU in the otherwise unused header field
+		if reply.Type == ipv4.ICMPTypeDestinationUnreachable && reply.Code == 4 && len(data) >= 8 {
+			if quoted, ok := quotedEchoSeq(data[8:], p.id, false); ok && quoted == seq {
+				return false, int(binary.BigEndian.Uint16(data[6:8])), nil
+			}
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package network
+
+import (
+	"context"
+	"net"
+	"testing"
+)
+
+func TestPathMTUToInvalid(t *testing.T) {
+	n := &Network{MTU: 1500}
+	if _, err := n.PathMTUTo(context.Background(), net.ParseIP("2001:db8::1")); err == nil {
+		t.Error("PathMTUTo() expected error for IPv6 address")
+	}
+}
+
+func TestPathMTUTo(t *testing.T) {
+	if !CanRawSocket() {
+		t.Skip("raw ICMP sockets are not permitted")
+	}
+
+	for _, mtu := range []int{1500, 1280, 65536} {
+		n := &Network{MTU: mtu}
+		got, err := n.PathMTUTo(context.Background(), net.ParseIP("127.0.0.1"))
+		if err != nil {
+			t.Fatalf("PathMTUTo() error = %v", err)
+		}
+		want := mtu
+		if want > maxPathMTU {
+			want = maxPathMTU
+		}
+		if got.MTU != want || got.InterfaceMTU != want || got.BelowInterfaceMTU {
+			t.Errorf("PathMTUTo() with MTU %d = %+v, want %d", mtu, got, want)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	n := &Network{MTU: 1500}
+	if _, err := n.PathMTUTo(ctx, net.ParseIP("127.0.0.1")); err == nil {
+		t.Error("PathMTUTo() expected error for canceled context")
+	}
+}
+
+func TestSearchPathMTU(t *testing.T) {
+	tests := []struct {
+		name    string
+		high    int
+		path    int
+		nextHop bool
+		lossy   bool
+		probes  int
+	}{
+		{"interface MTU fits", 1500, 1500, false, false, 1},
+		{"PPPoE", 1500, 1492, false, false, 18},
+		{"tunnel with next hop MTU", 1500, 1420, true, false, 2},
+		{"minimum", 1500, minPathMTU, false, false, 33},
+		{"first probe of each size lost", 1500, 1492, false, true, 27},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			probes := 0
+			sent := map[int]bool{}
+			got, err := searchPathMTU(tt.high, func(size int) (bool, int, error) {
+				probes++
+				if tt.lossy && !sent[size] {
+					sent[size] = true
+					return false, 0, nil
+				}
+				if size <= tt.path {
+					return true, 0, nil
+				}
+				if tt.nextHop {
+					return false, tt.path, nil
+				}
+				return false, 0, nil
+			})
+			if err != nil || got != tt.path {
+				t.Errorf("searchPathMTU() = %d, %v, want %d", got, err, tt.path)
+			}
+			if probes > tt.probes {
+				t.Errorf("searchPathMTU() sent %d probes, want at most %d", probes, tt.probes)
+			}
+		})
+	}
+}
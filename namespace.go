@@ -0,0 +1,96 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"path/filepath"
+	"regexp"
+)
+
+// Option configures a call, see WithNamespace, WithMaxResults, WithCaptureRaw and WithStrategy
+type Option func(*callOptions)
+
+type callOptions struct {
+	namespace  string
+	maxResults int
+	captureRaw bool
+	strategy   ResolveStrategy
+}
+
+// WithNamespace runs the operation inside the named Linux network namespace (/var/run/netns/<name>,
+// as created by "ip netns add"). Sockets and external commands are created by a thread which entered
+// the namespace, the resolver configuration of the host (/etc/resolv.conf) is used as-is.
+func WithNamespace(name string) Option {
+	return func(o *callOptions) {
+		o.namespace = name
+	}
+}
+
+// applyOptions collects the options of a call
+func applyOptions(opts []Option) callOptions {
+	var o callOptions
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&o)
+		}
+	}
+	return o
+}
+
+// netnsDir holds the named network namespaces, replaced in tests
+var netnsDir = "/var/run/netns"
+
+var namespaceNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,254}$`)
+
+// validateNamespace checks the namespace name is a plain file name of netnsDir
+func validateNamespace(name string) error {
+	if !namespaceNameRegexp.MatchString(name) {
+		return fmt.Errorf("invalid network namespace name %q", name)
+	}
+	return nil
+}
+
+// inNamespace runs fn inside the network namespace, an empty name runs fn in the current namespace.
+// Goroutines started by fn run in the current namespace, sockets they use must be created by fn.
+func inNamespace(name string, fn func() error) error {
+	if name == "" {
+		return fn()
+	}
+	if err := validateNamespace(name); err != nil {
+		return err
+	}
+	return runInNamespace(filepath.Join(netnsDir, name), fn)
+}
+
+// lookupNamespaceIPAddr resolves host names with DNS queries sent from inside the network namespace,
+// lookupIPAddr is used in the current namespace
+func lookupNamespaceIPAddr(ctx context.Context, namespace, host string) ([]net.IPAddr, error) {
+	if namespace == "" {
+		return lookupIPAddr(ctx, host)
+	}
+	return namespaceResolver(systemResolver(), namespace).LookupIPAddr(ctx, host)
+}
+
+// namespaceResolver returns a resolver which dials the DNS servers of base from inside the namespace
+func namespaceResolver(base *net.Resolver, name string) *net.Resolver {
+	if name == "" {
+		return base
+	}
+	dial := base.Dial
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	return &net.Resolver{
+		PreferGo:     true,
+		StrictErrors: base.StrictErrors,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			var conn net.Conn
+			err := inNamespace(name, func() (err error) {
+				conn, err = dial(ctx, network, address)
+				return err
+			})
+			return conn, err
+		},
+	}
+}
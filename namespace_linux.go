@@ -0,0 +1,47 @@
+//go:build linux
+
+package network
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+
+	"golang.org/x/sys/unix"
+)
+
+// runInNamespace runs fn on a dedicated thread which entered the network namespace at path. The thread
+// returns to its original namespace afterwards, if that fails it is destroyed together with its goroutine
+// instead of running other goroutines inside the namespace.
+func runInNamespace(path string, fn func() error) error {
+	target, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open network namespace: %w", err)
+	}
+	defer target.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		current, err := os.Open(fmt.Sprintf("/proc/self/task/%d/ns/net", unix.Gettid()))
+		if err != nil {
+			runtime.UnlockOSThread()
+			done <- fmt.Errorf("failed to open current network namespace: %w", err)
+			return
+		}
+		defer current.Close()
+
+		if err := unix.Setns(int(target.Fd()), unix.CLONE_NEWNET); err != nil {
+			runtime.UnlockOSThread()
+			done <- fmt.Errorf("failed to enter network namespace: %w", err)
+			return
+		}
+		err = fn()
+		// Exiting while locked destroys the thread which is stuck in the namespace
+		if unix.Setns(int(current.Fd()), unix.CLONE_NEWNET) == nil {
+			runtime.UnlockOSThread()
+		}
+		done <- err
+	}()
+	return <-done
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package network
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// runInNamespace fails, network namespaces exist on Linux only
+func runInNamespace(path string, fn func() error) error {
+	return fmt.Errorf("network namespaces are not supported on %s", runtime.GOOS)
+}
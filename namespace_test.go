@@ -0,0 +1,114 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestValidateNamespace(t *testing.T) {
+	for _, name := range []string{"blue", "ns-1", "ns_2.test", "0"} {
+		if err := validateNamespace(name); err != nil {
+			t.Errorf("validateNamespace(%q) error = %v", name, err)
+		}
+	}
+	for _, name := range []string{"", ".", "..", "../net", "a/b", ".hidden", "ns 1", "ns;rm", strings.Repeat("a", 256)} {
+		if err := validateNamespace(name); err == nil {
+			t.Errorf("validateNamespace(%q) expected error", name)
+		}
+	}
+}
+
+// useOwnNamespace points netnsDir to /proc/self/ns so the namespace "net" is the current one
+func useOwnNamespace(t *testing.T) {
+	t.Helper()
+	if runtime.GOOS != "linux" {
+		t.Skip("network namespaces require Linux")
+	}
+	original := netnsDir
+	netnsDir = "/proc/self/ns"
+	t.Cleanup(func() { netnsDir = original })
+
+	if err := inNamespace("net", func() error { return nil }); err != nil {
+		t.Skipf("cannot enter network namespace: %v", err)
+	}
+}
+
+func TestInNamespace(t *testing.T) {
+	called := false
+	if err := inNamespace("", func() error { called = true; return nil }); err != nil || !called {
+		t.Errorf("inNamespace(\"\") error = %v, called = %v", err, called)
+	}
+	if err := inNamespace("../net", func() error { return nil }); err == nil {
+		t.Error("inNamespace() expected error for invalid name")
+	}
+
+	original := netnsDir
+	netnsDir = t.TempDir()
+	defer func() { netnsDir = original }()
+	if err := inNamespace("missing", func() error { return nil }); err == nil {
+		t.Error("inNamespace() expected error for missing namespace")
+	}
+}
+
+func TestRunInNamespaceThread(t *testing.T) {
+	useOwnNamespace(t)
+
+	// fn runs on a dedicated goroutine, its error is returned to the caller
+	want := errors.New("failed")
+	if err := inNamespace("net", func() error { return want }); err != want {
+		t.Errorf("inNamespace() error = %v, want %v", err, want)
+	}
+}
+
+func TestWithNamespace(t *testing.T) {
+	if _, err := Ping("127.0.0.1", nil, WithNamespace("a/b")); err == nil {
+		t.Error("Ping() expected error for invalid namespace")
+	}
+	if _, err := Resolve("example.com", WithNamespace("a/b")); err == nil {
+		t.Error("Resolve() expected error for invalid namespace")
+	}
+	if _, err := GetConfig(WithNamespace("a/b")); err == nil {
+		t.Error("GetConfig() expected error for invalid namespace")
+	}
+
+	useOwnNamespace(t)
+	startSlowDNSServer(t, 0)
+
+	records, err := ResolveContext(context.Background(), "example.com", WithNamespace("net"))
+	if err != nil {
+		t.Fatalf("ResolveContext() error = %v", err)
+	}
+	if len(records.A) != 1 || records.A[0] != "192.0.2.1" {
+		t.Errorf("ResolveContext() A = %v", records.A)
+	}
+
+	addrs, err := lookupNamespaceIPAddr(context.Background(), "net", "example.com")
+	if err != nil || len(addrs) == 0 {
+		t.Fatalf("lookupNamespaceIPAddr() = %v, %v", addrs, err)
+	}
+	if version, err := selectIPVersion(context.Background(), "example.com", IPVersionAuto, "net"); err != nil || version != IPVersionAuto {
+		t.Errorf("selectIPVersion() = %d, %v", version, err)
+	}
+
+	config, err := GetConfig(WithNamespace("net"))
+	if err != nil {
+		t.Fatalf("GetConfig() error = %v", err)
+	}
+	if config.LocalIP == nil {
+		t.Error("GetConfig() LocalIP is nil")
+	}
+
+	options := DefaultPingOptions()
+	options.Native = true
+	options.Count = 1
+	result, err := Ping("127.0.0.1", options, WithNamespace("net"))
+	if err != nil {
+		t.Fatalf("Ping() error = %v", err)
+	}
+	if result.Sent != 1 {
+		t.Errorf("Ping() sent %d packets", result.Sent)
+	}
+}
@@ -1,13 +1,19 @@
 package network
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"net"
+	"os"
 	"os/exec"
-	"path/filepath"
+	"reflect"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 // Network is the interface which store network configuration data
@@ -20,30 +26,160 @@ type Network struct {
 	InterfaceName                 string
 	HardwareAddress               net.HardwareAddr
 	Suffix                        string
+	SearchDomains                 []string // DNS search list, Suffix is the first entry
 	Interface                     *net.Interface
+	MTU                           int       // MTU of the interface
+	DHCPServer                    net.IP    // DHCP server of the lease, nil for static addresses
+	LeaseExpiry                   time.Time // Expiry of the DHCP lease, zero for static addresses
+	Warnings                      []string  // Fields which could not be detected and why
 }
 
-var (
-	instance *Network
-	mu       sync.Mutex
-)
+// Detector detects a network configuration and caches it until it is refreshed.
+// Independent detectors don't share their cache or change callbacks.
+type Detector struct {
+	// Load detects the configuration, the configuration of the current platform is detected if nil
+	Load func() (*Network, error)
+	// WindowsConfigSource selects how gateway, DNS and subnet mask are read on Windows when Load is nil,
+	// WindowsConfigIPConfig if empty
+	WindowsConfigSource string
+
+	mu        sync.Mutex
+	instance  *Network
+	callbacks []func(old, new *Network)
+}
+
+// NewDetector returns a detector using load to detect the configuration, nil detects the
+// configuration of the current platform
+func NewDetector(load func() (*Network, error)) *Detector {
+	return &Detector{Load: load}
+}
+
+// defaultDetector is used by the package-level functions
+var defaultDetector = &Detector{}
+
+// Config returns the cached configuration, detecting it on the first call
+func (d *Detector) Config() (*Network, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.instance != nil {
+		return d.instance, nil
+	}
+
+	network, err := d.detect()
+	if err != nil {
+		return nil, err
+	}
+	d.instance = network
+	return network, nil
+}
+
+// detect detects the configuration without caching it
+func (d *Detector) detect() (*Network, error) {
+	if d.Load != nil {
+		return d.Load()
+	}
+	return loadConfig(d.WindowsConfigSource)
+}
+
+// Refresh detects the configuration again and invokes the change callbacks if it differs
+// from the previous one or nothing was cached. The cached configuration is kept if detection fails.
+func (d *Detector) Refresh() (*Network, error) {
+	network, err := d.detect()
+	if err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	old := d.instance
+	d.instance = network
+	d.mu.Unlock()
+
+	if old == nil || !old.equal(network) {
+		d.notifyChange(old, network)
+	}
+	return network, nil
+}
+
+// Clear drops the cached configuration without fetching a new one
+func (d *Detector) Clear() {
+	d.mu.Lock()
+	d.instance = nil
+	d.mu.Unlock()
+}
+
+// OnChange registers a callback which is invoked by Refresh when the refreshed configuration
+// differs from the previous one, old is nil if nothing was cached. Callbacks are called outside
+// of the lock and may call Config.
+func (d *Detector) OnChange(fn func(old, new *Network)) {
+	if fn == nil {
+		return
+	}
+	d.mu.Lock()
+	d.callbacks = append(d.callbacks, fn)
+	d.mu.Unlock()
+}
+
+// notifyChange calls the registered change callbacks
+func (d *Detector) notifyChange(old, new *Network) {
+	d.mu.Lock()
+	callbacks := make([]func(old, new *Network), len(d.callbacks))
+	copy(callbacks, d.callbacks)
+	d.mu.Unlock()
+
+	for _, fn := range callbacks {
+		fn(old, new)
+	}
+}
 
 // RefreshConfig refetch network configuration
 func RefreshConfig() (*Network, error) {
-	mu.Lock()
-	instance = nil
-	mu.Unlock()
-	return GetConfig()
+	return defaultDetector.Refresh()
+}
+
+// ClearCache drops the cached configuration without fetching a new one,
+// the next GetConfig call detects the configuration again
+func ClearCache() {
+	defaultDetector.Clear()
 }
 
-// GetConfig return  instance of network configuration.
-func GetConfig() (*Network, error) {
-	mu.Lock()
-	defer mu.Unlock()
+// OnChange registers a callback which is invoked by RefreshConfig when the refreshed configuration
+// differs from the previous one, old is nil if nothing was cached. Callbacks are called outside
+// of the lock and may call GetConfig.
+func OnChange(fn func(old, new *Network)) {
+	defaultDetector.OnChange(fn)
+}
 
-	if instance != nil {
-		return instance, nil
+// equal reports whether two configurations have the same values in every field. LeaseExpiry is
+// compared by instant, the other fields deeply.
+func (network *Network) equal(other *Network) bool {
+	a, b := *network, *other
+	if !a.LeaseExpiry.Equal(b.LeaseExpiry) {
+		return false
 	}
+	a.LeaseExpiry, b.LeaseExpiry = time.Time{}, time.Time{}
+	return reflect.DeepEqual(a, b)
+}
+
+// GetConfig return  instance of network configuration. The configuration of another network namespace
+// (see WithNamespace) is detected on every call and not cached.
+func GetConfig(opts ...Option) (*Network, error) {
+	namespace := applyOptions(opts).namespace
+	if namespace == "" {
+		return defaultDetector.Config()
+	}
+
+	var network *Network
+	err := inNamespace(namespace, func() (err error) {
+		network, err = loadConfig(WindowsConfigIPConfig)
+		return err
+	})
+	return network, err
+}
+
+// loadConfig detects the network configuration of the current platform, windowsSource is the
+// WindowsConfigSource of the detector. Replaced in tests.
+var loadConfig = func(windowsSource string) (*Network, error) {
 	network := Network{}
 
 	if runtime.GOOS == "windows" {
@@ -72,12 +208,13 @@ func GetConfig() (*Network, error) {
 						network.InterfaceName = interf.Name
 						network.HardwareAddress = interf.HardwareAddr
 						network.Interface = &interf
+						network.MTU = interf.MTU
 					}
 				}
 			}
 		}
 
-		err = network.getWindows()
+		err = network.getWindows(windowsSource)
 		if err != nil {
 			return nil, err
 		}
@@ -87,7 +224,6 @@ func GetConfig() (*Network, error) {
 			return nil, err
 		}
 	}
-	instance = &network
 	return &network, nil
 }
 
@@ -99,7 +235,7 @@ func (network *Network) getLinux() error {
 		return fmt.Errorf("ip command not found")
 	}
 
-	out, err := exec.Command(ipCmd, "route", "get", "8.8.8.8").Output()
+	out, err := command(context.Background(), ipCmd, "route", "get", "8.8.8.8").Output()
 
 	if err != nil {
 		return err
@@ -116,6 +252,7 @@ func (network *Network) getLinux() error {
 	if err == nil {
 		network.HardwareAddress = interf.HardwareAddr
 		network.Interface = interf
+		network.MTU = interf.MTU
 
 	} else {
 		return err
@@ -124,13 +261,11 @@ func (network *Network) getLinux() error {
 	// Try common locations for ifconfig command
 	ifconfigCmd := findCommand("ifconfig", []string{"/sbin/ifconfig", "/bin/ifconfig", "/usr/sbin/ifconfig", "/usr/bin/ifconfig"})
 	if ifconfigCmd == "" {
-		// ifconfig might not be available, skip subnet mask detection
 		// Some modern systems don't have ifconfig by default
-		ifconfigCmd = "ifconfig"
-	}
-
-	out, err = exec.Command(ifconfigCmd, network.InterfaceName).Output()
-	if err == nil {
+		network.warn("subnet mask unavailable: ifconfig not found")
+	} else if out, err = command(context.Background(), ifconfigCmd, network.InterfaceName).Output(); err != nil {
+		network.warn("subnet mask unavailable: ifconfig failed: %v", err)
+	} else {
 		lines := strings.Split(string(out), "\n")
 
 		if len(lines) > 1 {
@@ -139,52 +274,37 @@ func (network *Network) getLinux() error {
 				network.SubnetMask = net.ParseIP(fields[4])
 			}
 		}
-	} else {
-		return err
+		if network.SubnetMask == nil {
+			network.warn("subnet mask unavailable: unexpected ifconfig output")
+		}
 	}
 
 	// Sanitize interface name to prevent command injection
 	if strings.ContainsAny(network.InterfaceName, ";&|`$()\n") {
 		return fmt.Errorf("invalid interface name")
 	}
-	leasePath := filepath.Join("/var/lib/dhcp", "dhclient."+network.InterfaceName+".leases")
-	out, err = exec.Command("grep", "domain-name", leasePath).Output()
-
-	if err == nil {
-		dnslist := ""
-		lines := strings.Split(strings.TrimSpace(string(out)), "\n")
-		for _, line := range lines {
-			if strings.Contains(line, "domain-name-servers") {
-				trimmedLine := strings.TrimSpace(line)
-				if len(trimmedLine) > 26 {
-					line = strings.TrimRight(trimmedLine[26:], ";")
-					list := strings.Split(line, ",")
-					for _, dnsitem := range list {
-						if !strings.Contains(dnslist, dnsitem) {
-							dnslist += dnsitem + ","
-						}
-					}
-				}
-
-			} else {
-				trimmedLine := strings.TrimSpace(line)
-				if len(trimmedLine) > 18 {
-					network.Suffix = strings.TrimRight(trimmedLine[18:], ";")
-				}
-			}
-			dnslist = strings.TrimRight(dnslist, ",")
+	if lease, err := DHCPLease(network.InterfaceName); err != nil {
+		network.warn("DNS servers unavailable: %v", err)
+	} else {
+		network.DNS = nil
+		for _, ip := range lease.DNS {
+			network.DNS = append(network.DNS, ip.String())
 		}
+		network.Suffix = lease.Domain
+		network.DHCPServer = lease.ServerID
+		network.LeaseExpiry = lease.Expiry
+	}
 
-		network.DNS = strings.Split(dnslist, ",")
-	} else {
-		return err
+	if data, err := os.ReadFile("/etc/resolv.conf"); err == nil {
+		network.setSearchDomains(parseSearchDomains(string(data)))
 	}
+
 	// Validate IP before using in command
 	if network.DefaultGateway == nil {
 		// Skip ARP lookup if no default gateway
 		return nil
 	}
-	out, err = exec.Command("arp", "-e", network.DefaultGateway.String()).Output()
+	out, err = command(context.Background(), "arp", "-e", network.DefaultGateway.String()).Output()
 	if err == nil {
 		lines := strings.Split(string(out), "\n")
 
@@ -195,15 +315,129 @@ func (network *Network) getLinux() error {
 			}
 		}
 	} else {
-		return err
+		network.warn("gateway hardware address unavailable: arp failed: %v", err)
 	}
 	return nil
 }
 
+// warn records a detection problem which doesn't fail the whole configuration
+func (network *Network) warn(format string, args ...interface{}) {
+	warning := fmt.Sprintf(format, args...)
+	network.Warnings = append(network.Warnings, warning)
+	logger().Warn("network detection incomplete", "warning", warning)
+}
+
+// InterfaceForDestination returns the interface and source IP used to reach the destination.
+// On Linux the routing table is queried with "ip route get", otherwise the route is resolved by
+// connecting a UDP socket, which does not send any packets.
+func InterfaceForDestination(dst net.IP) (*net.Interface, net.IP, error) {
+	if dst == nil {
+		return nil, nil, fmt.Errorf("destination cannot be empty")
+	}
+
+	if runtime.GOOS == "linux" {
+		if ipCmd := findCommand("ip", []string{"/bin/ip", "/sbin/ip", "/usr/bin/ip", "/usr/sbin/ip"}); ipCmd != "" {
+			if out, err := command(context.Background(), ipCmd, "route", "get", dst.String()).Output(); err == nil {
+				if dev, src := parseRouteGet(string(out)); dev != "" && src != nil {
+					if interf, err := net.InterfaceByName(dev); err == nil {
+						return interf, src, nil
+					}
+				}
+			}
+		}
+	}
+
+	conn, err := net.Dial("udp", net.JoinHostPort(dst.String(), "9"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("no route to %s: %w", dst, err)
+	}
+	defer conn.Close()
+
+	udpAddr, ok := conn.LocalAddr().(*net.UDPAddr)
+	if !ok {
+		return nil, nil, fmt.Errorf("failed to get local UDP address")
+	}
+	interf, err := interfaceByIP(udpAddr.IP)
+	if err != nil {
+		return nil, nil, err
+	}
+	return interf, udpAddr.IP, nil
+}
+
+// parseRouteGet returns the device and source address of "ip route get" output
+// "8.8.8.8 via 192.168.1.1 dev eth0 src 192.168.1.10 uid 1000"
+func parseRouteGet(output string) (string, net.IP) {
+	var dev string
+	var src net.IP
+	fields := strings.Fields(output)
+	for i := 0; i+1 < len(fields); i++ {
+		switch fields[i] {
+		case "dev":
+			dev = fields[i+1]
+		case "src":
+			src = net.ParseIP(fields[i+1])
+		}
+	}
+	return dev, src
+}
+
+// interfaceByIP returns the interface the address is assigned to
+func interfaceByIP(ip net.IP) (*net.Interface, error) {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get network interfaces: %w", err)
+	}
+	for i := range interfaces {
+		addrs, err := interfaces[i].Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.Equal(ip) {
+				return &interfaces[i], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no interface has address %s", ip)
+}
+
+// Addresses return all addresses assigned to the network interface including link-local and secondary addresses
+func (network *Network) Addresses() ([]net.IPNet, error) {
+	if network.Interface == nil {
+		return nil, fmt.Errorf("network interface is not detected")
+	}
+
+	addrs, err := network.Interface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get addresses of %s: %w", network.Interface.Name, err)
+	}
+
+	var result []net.IPNet
+	for _, addr := range addrs {
+		switch v := addr.(type) {
+		case *net.IPNet:
+			result = append(result, *v)
+		case *net.IPAddr:
+			bits := 8 * net.IPv6len
+			if v.IP.To4() != nil {
+				bits = 8 * net.IPv4len
+			}
+			result = append(result, net.IPNet{IP: v.IP, Mask: net.CIDRMask(bits, bits)})
+		}
+	}
+	return result, nil
+}
+
 // String return network information as string
 func (network *Network) String() string {
 	res := "InterfaceName:" + network.InterfaceName + "\r\n"
 
+	if index := network.InterfaceIndex(); index > 0 {
+		res += "InterfaceIndex:" + strconv.Itoa(index) + "\r\n"
+	} else {
+		res += "InterfaceIndex:<nil>\r\n"
+	}
+
 	if network.HardwareAddress != nil {
 		res += "HardwareAddress:" + network.HardwareAddress.String() + "\r\n"
 	} else {
@@ -238,19 +472,199 @@ func (network *Network) String() string {
 
 	res += "Suffix:" + network.Suffix + "\r\n"
 
+	if network.DHCPServer != nil {
+		res += "DHCPServer:" + network.DHCPServer.String() + "\r\n"
+	} else {
+		res += "DHCPServer:<nil>\r\n"
+	}
+
+	if !network.LeaseExpiry.IsZero() {
+		res += "LeaseExpiry:" + network.LeaseExpiry.Format(time.RFC3339) + "\r\n"
+	} else {
+		res += "LeaseExpiry:<nil>\r\n"
+	}
+
+	if len(network.Warnings) > 0 {
+		res += "Warnings:" + strings.Join(network.Warnings, "; ") + "\r\n"
+	}
+
 	return res
 }
 
-// getWindows read network data in windows
-func (network *Network) getWindows() error {
-	out, err := exec.Command("ipconfig", "/all").Output()
+// Summary returns the interface, local address with prefix length and gateway in one line for logging,
+// such as "eth0 192.168.1.10/24 gw 192.168.1.1". Undetected parts are omitted.
+func (network *Network) Summary() string {
+	var parts []string
+	if network.InterfaceName != "" {
+		parts = append(parts, network.InterfaceName)
+	}
+	if network.LocalIP != nil {
+		address := network.LocalIP.String()
+		if network.SubnetMask != nil {
+			if ones, bits := network.localMask().Size(); bits > 0 {
+				address += "/" + strconv.Itoa(ones)
+			}
+		}
+		parts = append(parts, address)
+	}
+	if network.DefaultGateway != nil {
+		parts = append(parts, "gw "+network.DefaultGateway.String())
+	}
+	return strings.Join(parts, " ")
+}
+
+// Map return every field as a string keyed by field name, unknown values are empty. Lists are joined
+// with commas, Warnings with "; ". Interface is exported as its InterfaceIndex.
+func (network *Network) Map() map[string]string {
+	return map[string]string{
+		"InterfaceName":                 network.InterfaceName,
+		"InterfaceIndex":                formatPositive(network.InterfaceIndex()),
+		"HardwareAddress":               stringOrEmpty(network.HardwareAddress),
+		"LocalIP":                       stringOrEmpty(network.LocalIP),
+		"DNS":                           strings.Join(network.DNS, ","),
+		"SubnetMask":                    stringOrEmpty(network.SubnetMask),
+		"DefaultGateway":                stringOrEmpty(network.DefaultGateway),
+		"DefaultGatewayHardwareAddress": stringOrEmpty(network.DefaultGatewayHardwareAddress),
+		"Suffix":                        network.Suffix,
+		"SearchDomains":                 strings.Join(network.SearchDomains, ","),
+		"MTU":                           formatPositive(network.MTU),
+		"DHCPServer":                    stringOrEmpty(network.DHCPServer),
+		"LeaseExpiry":                   formatLeaseExpiry(network.LeaseExpiry),
+		"Warnings":                      strings.Join(network.Warnings, "; "),
+	}
+}
+
+// InterfaceIndex returns the index of the interface, 0 if it is unknown
+func (network *Network) InterfaceIndex() int {
+	if network.Interface != nil {
+		return network.Interface.Index
+	}
+	if network.InterfaceName != "" {
+		if interf, err := net.InterfaceByName(network.InterfaceName); err == nil {
+			return interf.Index
+		}
+	}
+	return 0
+}
+
+// tunnelPrefixes are the name prefixes of VPN and tunnel interfaces: tun/tap (OpenVPN), ppp (PPTP, L2TP),
+// wg (WireGuard), utun (macOS VPNs), ipsec and gpd (GlobalProtect)
+var tunnelPrefixes = []string{"tun", "tap", "ppp", "wg", "utun", "ipsec", "gpd"}
+
+// tunnelKeywords name VPN adapters of Windows, whose interface names are free text
+var tunnelKeywords = []string{"vpn", "wireguard", "tap-windows", "openvpn", "tunnel"}
+
+// isTunnelInterface reports whether the interface is a VPN or tunnel by its name or point-to-point flag
+func isTunnelInterface(name string, flags net.Flags) bool {
+	if flags&net.FlagLoopback != 0 {
+		return false
+	}
+	if flags&net.FlagPointToPoint != 0 {
+		return true
+	}
+	name = strings.ToLower(name)
+	for _, prefix := range tunnelPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	for _, keyword := range tunnelKeywords {
+		if strings.Contains(name, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsTunnel reports whether the detected interface is a VPN or tunnel interface, judged by its name
+// (tun, tap, ppp, wg, utun, ...) and point-to-point flag. Traffic through a tunnel explains unexpected
+// routes and a smaller MTU.
+func (network *Network) IsTunnel() bool {
+	if network.Interface != nil {
+		return isTunnelInterface(network.Interface.Name, network.Interface.Flags)
+	}
+	return network.InterfaceName != "" && isTunnelInterface(network.InterfaceName, 0)
+}
+
+// ActiveVPNInterfaces returns the names of the VPN and tunnel interfaces which are up, see IsTunnel
+func ActiveVPNInterfaces() ([]string, error) {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get network interfaces: %w", err)
+	}
+	var names []string
+	for _, interf := range interfaces {
+		if interf.Flags&net.FlagUp != 0 && isTunnelInterface(interf.Name, interf.Flags) {
+			names = append(names, interf.Name)
+		}
+	}
+	return names, nil
+}
+
+// MarshalJSON encodes the configuration with the interface index as a top level InterfaceIndex field
+func (network Network) MarshalJSON() ([]byte, error) {
+	type plain Network
+	return json.Marshal(struct {
+		plain
+		InterfaceIndex int
+	}{plain(network), network.InterfaceIndex()})
+}
+
+// formatPositive returns an interface index or MTU as string or empty string if it is unknown
+func formatPositive(value int) string {
+	if value <= 0 {
+		return ""
+	}
+	return strconv.Itoa(value)
+}
+
+// formatLeaseExpiry returns the lease expiry in RFC 3339 format or empty string if it is not set
+func formatLeaseExpiry(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// stringOrEmpty return the string form of an address or empty string if it is not set
+func stringOrEmpty(value fmt.Stringer) string {
+	switch v := value.(type) {
+	case net.IP:
+		if v == nil {
+			return ""
+		}
+	case net.HardwareAddr:
+		if v == nil {
+			return ""
+		}
+	}
+	return value.String()
+}
+
+// getWindows read network data in windows from the source, see WindowsConfigPowerShell
+func (network *Network) getWindows(source string) error {
+	if source == WindowsConfigPowerShell {
+		err := network.getWindowsPowerShell()
+		if err == nil {
+			return nil
+		}
+		network.warn("PowerShell configuration unavailable, using ipconfig: %v", err)
+	}
+
+	out, err := command(context.Background(), "ipconfig", "/all").Output()
 	if err != nil {
 		return err
 	}
 	items := strings.Split(string(out), "Ethernet adapter ")
-	for _, item := range items {
+	var globalSearch []string
+	for i, item := range items {
 		lines := strings.Split(item, "\r\n")
+		if i == 0 {
+			// Windows IP Configuration section holds the global search list
+			globalSearch = nonEmpty(extractDotted(lines, "DNS Suffix Search List"))
+		}
 		if strings.HasPrefix(item, network.InterfaceName) {
+			network.SearchDomains = nonEmpty(extractDotted(lines, "Connection-specific DNS Suffix Search List"))
 
 			network.DNS = extractDotted(lines, "DNS Servers")
 			if network.Suffix == "" {
@@ -263,6 +677,7 @@ func (network *Network) getWindows() error {
 			if len(subnetMasks) > 0 {
 				network.SubnetMask = net.ParseIP(subnetMasks[0])
 			}
+			network.DHCPServer, network.LeaseExpiry = parseIPConfigLease(lines)
 
 		}
 		for _, line := range lines {
@@ -278,13 +693,16 @@ func (network *Network) getWindows() error {
 		}
 	}
 
+	network.setSearchDomains(uniqueStrings(append(network.SearchDomains, globalSearch...)))
+
 	if network.DefaultGateway == nil {
 		// Skip ARP lookup if no default gateway
 		return nil
 	}
-	out, err = exec.Command("arp", "-a", network.DefaultGateway.String()).Output()
+	out, err = command(context.Background(), "arp", "-a", network.DefaultGateway.String()).Output()
 	if err != nil {
-		return err
+		network.warn("gateway hardware address unavailable: arp failed: %v", err)
+		return nil
 	}
 	chunks := strings.Split(string(out), network.DefaultGateway.String())
 
@@ -297,6 +715,199 @@ func (network *Network) getWindows() error {
 	return nil
 }
 
+// ipconfigTimeLayout is the format of the lease times of English "ipconfig /all"
+const ipconfigTimeLayout = "Monday, January 2, 2006 3:04:05 PM"
+
+// parseIPConfigLease returns the DHCP server and lease expiry of an adapter section of "ipconfig /all",
+// both are zero if DHCP is disabled
+// "   DHCP Server . . . . . . . . . . . : 192.168.1.1"
+// "   Lease Expires . . . . . . . . . . : Saturday, May 4, 2024 10:15:30 AM"
+func parseIPConfigLease(lines []string) (net.IP, time.Time) {
+	if enabled := extractDotted(lines, "DHCP Enabled"); len(enabled) == 0 || !strings.EqualFold(enabled[0], "Yes") {
+		return nil, time.Time{}
+	}
+	var server net.IP
+	if servers := extractDotted(lines, "DHCP Server"); len(servers) > 0 {
+		server = net.ParseIP(servers[0])
+	}
+	var expiry time.Time
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "   Lease Expires") {
+			continue
+		}
+		if idx := strings.Index(line, ": "); idx >= 0 {
+			expiry, _ = time.ParseInLocation(ipconfigTimeLayout, strings.TrimSpace(line[idx+2:]), time.Local)
+		}
+	}
+	return server, expiry
+}
+
+// Sources of the Windows configuration selected by Detector.WindowsConfigSource
+const (
+	WindowsConfigIPConfig   = "ipconfig"   // parse the text of "ipconfig /all", which is localized
+	WindowsConfigPowerShell = "powershell" // query Get-NetIPConfiguration as JSON, ipconfig is used if it fails
+)
+
+// windowsConfigScript prints the configuration of the interface with index {{index}} as JSON
+const windowsConfigScript = `$ErrorActionPreference = 'Stop'
+$c = Get-NetIPConfiguration -InterfaceIndex {{index}} -Detailed
+$gw = @($c.IPv4DefaultGateway | ForEach-Object { $_.NextHop })
+$mac = $null
+if ($gw.Count -gt 0) { $mac = (Get-NetNeighbor -IPAddress $gw[0] -ErrorAction SilentlyContinue | Select-Object -First 1).LinkLayerAddress }
+$a = Get-CimInstance Win32_NetworkAdapterConfiguration -Filter "InterfaceIndex={{index}}"
+$expires = $null
+if ($a.DHCPEnabled -and $a.DHCPLeaseExpires) { $expires = $a.DHCPLeaseExpires.ToUniversalTime().ToString('o') }
+[pscustomobject]@{
+  Gateway = $gw
+  GatewayMAC = $mac
+  DNS = @($c.DNSServer | Where-Object { $_.AddressFamily -eq 2 } | ForEach-Object { $_.ServerAddresses })
+  PrefixLength = @($c.IPv4Address | ForEach-Object { [int]$_.PrefixLength })
+  Suffix = (Get-DnsClient -InterfaceIndex {{index}}).ConnectionSpecificSuffix
+  SearchList = @((Get-DnsClientGlobalSetting).SuffixSearchList)
+  DHCPServer = $a.DHCPServer
+  LeaseExpires = $expires
+} | ConvertTo-Json -Compress`
+
+// windowsConfig is the JSON printed by windowsConfigScript
+type windowsConfig struct {
+	Gateway      jsonStrings
+	GatewayMAC   string
+	DNS          jsonStrings
+	PrefixLength jsonInts
+	Suffix       string
+	SearchList   jsonStrings
+	DHCPServer   string
+	LeaseExpires string // Round-trip format in UTC, empty for static addresses
+}
+
+// jsonStrings decodes a JSON string array, PowerShell may print single values without the array
+type jsonStrings []string
+
+// UnmarshalJSON accepts null, a string or an array of strings
+func (s *jsonStrings) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*s = nonEmpty([]string{single})
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*s = nonEmpty(list)
+	return nil
+}
+
+// jsonInts decodes a JSON number array, PowerShell prints a single value without the array
+type jsonInts []int
+
+// UnmarshalJSON accepts null, a number or an array of numbers
+func (s *jsonInts) UnmarshalJSON(data []byte) error {
+	var single int
+	if err := json.Unmarshal(data, &single); err == nil {
+		if !bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+			*s = jsonInts{single}
+		}
+		return nil
+	}
+	var list []int
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*s = list
+	return nil
+}
+
+// getWindowsPowerShell reads the network data of Windows with Get-NetIPConfiguration, unlike
+// ipconfig its output doesn't depend on the display language
+func (network *Network) getWindowsPowerShell() error {
+	if network.Interface == nil {
+		return fmt.Errorf("interface of %s not found", network.LocalIP)
+	}
+	script := strings.ReplaceAll(windowsConfigScript, "{{index}}", strconv.Itoa(network.Interface.Index))
+	out, err := command(context.Background(), "powershell", "-NoProfile", "-NonInteractive", "-Command", script).Output()
+	if err != nil {
+		return err
+	}
+	return network.parseWindowsConfig(out)
+}
+
+// parseWindowsConfig sets the fields of the JSON printed by windowsConfigScript
+func (network *Network) parseWindowsConfig(data []byte) error {
+	var config windowsConfig
+	if err := json.Unmarshal(bytes.TrimSpace(data), &config); err != nil {
+		return fmt.Errorf("unexpected PowerShell output: %w", err)
+	}
+
+	for _, gateway := range config.Gateway {
+		if ip := net.ParseIP(gateway); ip != nil {
+			network.DefaultGateway = ip
+			break
+		}
+	}
+	if config.GatewayMAC != "" {
+		network.DefaultGatewayHardwareAddress, _ = net.ParseMAC(config.GatewayMAC)
+	}
+	if network.DefaultGateway != nil && network.DefaultGatewayHardwareAddress == nil {
+		network.warn("gateway hardware address unavailable: no neighbor entry")
+	}
+	network.DNS = config.DNS
+	if len(config.PrefixLength) > 0 && config.PrefixLength[0] >= 0 && config.PrefixLength[0] <= 32 {
+		network.SubnetMask = net.IP(net.CIDRMask(config.PrefixLength[0], 32))
+	}
+	network.Suffix = config.Suffix
+	network.setSearchDomains(uniqueStrings(config.SearchList))
+	if config.LeaseExpires != "" {
+		network.DHCPServer = net.ParseIP(config.DHCPServer)
+		network.LeaseExpiry, _ = time.Parse(time.RFC3339Nano, config.LeaseExpires)
+	}
+	return nil
+}
+
+// setSearchDomains sets the DNS search list and keeps Suffix as its first entry
+func (network *Network) setSearchDomains(domains []string) {
+	if len(domains) == 0 {
+		if network.Suffix != "" {
+			network.SearchDomains = []string{network.Suffix}
+		}
+		return
+	}
+	if network.Suffix != "" && network.Suffix != domains[0] {
+		domains = append([]string{network.Suffix}, domains...)
+	}
+	network.SearchDomains = uniqueStrings(domains)
+	network.Suffix = network.SearchDomains[0]
+}
+
+// parseSearchDomains returns the search list of resolv.conf, the last search or domain line wins
+func parseSearchDomains(data string) []string {
+	var domains []string
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "search":
+			domains = fields[1:]
+		case "domain":
+			domains = fields[1:2]
+		}
+	}
+	return domains
+}
+
+// nonEmpty removes empty and blank items
+func nonEmpty(items []string) []string {
+	var result []string
+	for _, item := range items {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
 // extractDotted extract data of ipconfig
 func extractDotted(lines []string, key string) []string {
 	result := ""
@@ -305,7 +916,14 @@ func extractDotted(lines []string, key string) []string {
 	for _, line := range lines {
 		if !found {
 			if strings.HasPrefix(line, "   "+key) && len(line) > 39 {
-				result = line[39:] + ""
+				// Value follows the colon, long keys such as "Connection-specific DNS Suffix Search List :"
+				// don't fit the dotted column
+				rest := line[len("   "+key):]
+				if idx := strings.Index(rest, ":"); idx >= 0 {
+					result = strings.TrimSpace(rest[idx+1:])
+				} else {
+					result = line[39:]
+				}
 				found = true
 			}
 		} else {
@@ -321,6 +939,119 @@ func extractDotted(lines []string, key string) []string {
 	return strings.Split(strings.Trim(result, ","), ",")
 }
 
+var (
+	commandLoggerMu sync.RWMutex
+	commandLogger   func(name string, args []string) error
+)
+
+// SetCommandLogger sets a function which is called with the name and arguments of every external
+// command (ip, ifconfig, arp, ping, ...) right before it is executed. A non-nil error vetoes the
+// command, it isn't executed and running it fails with the error. nil disables logging.
+func SetCommandLogger(fn func(name string, args []string) error) {
+	commandLoggerMu.Lock()
+	commandLogger = fn
+	commandLoggerMu.Unlock()
+}
+
+var (
+	commandSlotsMu sync.RWMutex
+	commandSlots   chan struct{}
+)
+
+// SetMaxConcurrentCommands limits the number of external commands (ip, arp, ping, ...) running at
+// the same time across all callers, further commands wait for a running one to exit. n <= 0 removes
+// the limit, which is the default. Commands already running or waiting keep the previous limit.
+func SetMaxConcurrentCommands(n int) {
+	commandSlotsMu.Lock()
+	defer commandSlotsMu.Unlock()
+	if n <= 0 {
+		commandSlots = nil
+		return
+	}
+	commandSlots = make(chan struct{}, n)
+}
+
+// acquireCommandSlot waits for a free command slot and returns the function releasing it
+func acquireCommandSlot(ctx context.Context) (func(), error) {
+	commandSlotsMu.RLock()
+	slots := commandSlots
+	commandSlotsMu.RUnlock()
+
+	if slots == nil {
+		return func() {}, nil
+	}
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// limitedCmd is an external command which holds a command slot while it runs
+type limitedCmd struct {
+	*exec.Cmd
+	ctx    context.Context
+	vetoed error // Error of the command logger, the command is not run if set
+}
+
+// acquire returns the error of the command logger or waits for a free command slot
+func (c *limitedCmd) acquire() (func(), error) {
+	if c.vetoed != nil {
+		return nil, c.vetoed
+	}
+	return acquireCommandSlot(c.ctx)
+}
+
+// Run starts the command once a command slot is free and waits for it to exit
+func (c *limitedCmd) Run() error {
+	release, err := c.acquire()
+	if err != nil {
+		return err
+	}
+	defer release()
+	return c.Cmd.Run()
+}
+
+// Output runs the command like Run and returns its standard output
+func (c *limitedCmd) Output() ([]byte, error) {
+	release, err := c.acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return c.Cmd.Output()
+}
+
+// CombinedOutput runs the command like Run and returns its standard output and error
+func (c *limitedCmd) CombinedOutput() ([]byte, error) {
+	release, err := c.acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return c.Cmd.CombinedOutput()
+}
+
+// command returns the command to execute and passes it to the command logger first, running a
+// command vetoed by the logger fails. The command waits for a slot of SetMaxConcurrentCommands when it is run.
+func command(ctx context.Context, name string, args ...string) *limitedCmd {
+	commandLoggerMu.RLock()
+	fn := commandLogger
+	commandLoggerMu.RUnlock()
+
+	cmd := &limitedCmd{Cmd: exec.CommandContext(ctx, name, args...), ctx: ctx}
+	if fn != nil {
+		if err := fn(name, append([]string(nil), args...)); err != nil {
+			cmd.vetoed = fmt.Errorf("command %s rejected: %w", name, err)
+			logger().Debug("command rejected", "name", name, "args", strings.Join(args, " "), "error", err)
+			return cmd
+		}
+	}
+	logger().Debug("executing command", "name", name, "args", strings.Join(args, " "))
+	return cmd
+}
+
 // findCommand searches for a command in common locations
 func findCommand(name string, paths []string) string {
 	for _, path := range paths {
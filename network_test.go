@@ -1,11 +1,17 @@
 package network
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"net"
+	"reflect"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 )
 
 func TestGetConfig(t *testing.T) {
@@ -128,7 +134,7 @@ func TestString(t *testing.T) {
 
 func TestConcurrency(t *testing.T) {
 	// Reset instance for clean test
-	instance = nil
+	ClearCache()
 
 	var wg sync.WaitGroup
 	configs := make([]*Network, 10)
@@ -250,4 +256,725 @@ func BenchmarkString(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		_ = config.String()
 	}
-}
\ No newline at end of file
+}
+
+func TestAddresses(t *testing.T) {
+	if _, err := (&Network{}).Addresses(); err == nil {
+		t.Error("Addresses() expected error when interface is nil")
+	}
+
+	loopback, err := net.InterfaceByName("lo")
+	if err != nil {
+		t.Skip("loopback interface not available")
+	}
+
+	addrs, err := (&Network{Interface: loopback}).Addresses()
+	if err != nil {
+		t.Fatalf("Addresses() error = %v", err)
+	}
+
+	found := false
+	for _, addr := range addrs {
+		if addr.IP.Equal(net.ParseIP("127.0.0.1")) {
+			found = true
+			if ones, _ := addr.Mask.Size(); ones != 8 {
+				t.Errorf("Addresses() 127.0.0.1 mask = /%d, want /8", ones)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("Addresses() missing 127.0.0.1: %v", addrs)
+	}
+}
+
+func TestMap(t *testing.T) {
+	mac, _ := net.ParseMAC("00:11:22:33:44:55")
+	config := &Network{
+		InterfaceName:   "eth0",
+		HardwareAddress: mac,
+		LocalIP:         net.ParseIP("192.168.1.10"),
+		DNS:             []string{"8.8.8.8", "1.1.1.1"},
+		SubnetMask:      net.ParseIP("255.255.255.0"),
+		DefaultGateway:  net.ParseIP("192.168.1.1"),
+		Suffix:          "example.com",
+		SearchDomains:   []string{"example.com", "corp.example.com"},
+		MTU:             1500,
+		Warnings:        []string{"a", "b"},
+	}
+
+	m := config.Map()
+	want := map[string]string{
+		"InterfaceName":                 "eth0",
+		"HardwareAddress":               "00:11:22:33:44:55",
+		"LocalIP":                       "192.168.1.10",
+		"DNS":                           "8.8.8.8,1.1.1.1",
+		"SubnetMask":                    "255.255.255.0",
+		"DefaultGateway":                "192.168.1.1",
+		"DefaultGatewayHardwareAddress": "",
+		"Suffix":                        "example.com",
+		"SearchDomains":                 "example.com,corp.example.com",
+		"MTU":                           "1500",
+		"DHCPServer":                    "",
+		"LeaseExpiry":                   "",
+		"Warnings":                      "a; b",
+	}
+	for key, value := range want {
+		if m[key] != value {
+			t.Errorf("Map()[%s] = %q, want %q", key, m[key], value)
+		}
+	}
+
+	// Every exported field is exported, Interface as its index
+	fields := reflect.TypeOf(Network{})
+	for i := 0; i < fields.NumField(); i++ {
+		name := fields.Field(i).Name
+		if name == "Interface" {
+			name = "InterfaceIndex"
+		}
+		if _, ok := m[name]; !ok {
+			t.Errorf("Map() is missing field %s", name)
+		}
+	}
+}
+
+func TestParseSearchDomains(t *testing.T) {
+	data := "# generated\nnameserver 127.0.0.53\nsearch corp.example.com example.com\noptions edns0\n"
+	got := parseSearchDomains(data)
+	if strings.Join(got, ",") != "corp.example.com,example.com" {
+		t.Errorf("parseSearchDomains() = %v", got)
+	}
+
+	// The last search or domain line wins
+	got = parseSearchDomains("search a.example.com\ndomain b.example.com\n")
+	if strings.Join(got, ",") != "b.example.com" {
+		t.Errorf("parseSearchDomains() = %v", got)
+	}
+
+	if got := parseSearchDomains("nameserver 1.1.1.1\n"); len(got) != 0 {
+		t.Errorf("parseSearchDomains() = %v, want empty", got)
+	}
+}
+
+func TestSetSearchDomains(t *testing.T) {
+	network := &Network{}
+	network.setSearchDomains([]string{"corp.example.com", "example.com"})
+	if network.Suffix != "corp.example.com" || len(network.SearchDomains) != 2 {
+		t.Errorf("Suffix = %q, SearchDomains = %v", network.Suffix, network.SearchDomains)
+	}
+
+	network = &Network{Suffix: "lan"}
+	network.setSearchDomains([]string{"corp.example.com", "lan"})
+	if strings.Join(network.SearchDomains, ",") != "lan,corp.example.com" || network.Suffix != "lan" {
+		t.Errorf("Suffix = %q, SearchDomains = %v", network.Suffix, network.SearchDomains)
+	}
+
+	network = &Network{Suffix: "lan"}
+	network.setSearchDomains(nil)
+	if strings.Join(network.SearchDomains, ",") != "lan" {
+		t.Errorf("SearchDomains = %v, want [lan]", network.SearchDomains)
+	}
+}
+
+func TestExtractDottedSearchList(t *testing.T) {
+	lines := []string{
+		"   Connection-specific DNS Suffix  . : corp.example.com",
+		"   Connection-specific DNS Suffix Search List :",
+		strings.Repeat(" ", 39) + "corp.example.com",
+		strings.Repeat(" ", 39) + "example.com",
+		"   Description . . . . . . . . . . . : Ethernet Adapter",
+	}
+	got := nonEmpty(extractDotted(lines, "Connection-specific DNS Suffix Search List"))
+	if strings.Join(got, ",") != "corp.example.com,example.com" {
+		t.Errorf("search list = %v", got)
+	}
+}
+
+func TestDetectorWindowsConfigSource(t *testing.T) {
+	originalLoad := loadConfig
+	defer func() { loadConfig = originalLoad }()
+
+	var sources []string
+	loadConfig = func(windowsSource string) (*Network, error) {
+		sources = append(sources, windowsSource)
+		return &Network{InterfaceName: "Ethernet"}, nil
+	}
+
+	if _, err := (&Detector{WindowsConfigSource: WindowsConfigPowerShell}).Config(); err != nil {
+		t.Fatalf("Config() error = %v", err)
+	}
+	if _, err := NewDetector(nil).Config(); err != nil {
+		t.Fatalf("Config() error = %v", err)
+	}
+	if strings.Join(sources, ",") != WindowsConfigPowerShell+"," {
+		t.Errorf("sources = %q", sources)
+	}
+}
+
+func TestOnChange(t *testing.T) {
+	originalLoad := loadConfig
+	defer func() {
+		loadConfig = originalLoad
+		defaultDetector = &Detector{}
+	}()
+
+	gateway := "192.168.1.1"
+	loadConfig = func(string) (*Network, error) {
+		return &Network{
+			InterfaceName:  "eth0",
+			LocalIP:        net.ParseIP("192.168.1.10"),
+			DefaultGateway: net.ParseIP(gateway),
+		}, nil
+	}
+
+	ClearCache()
+	if _, err := GetConfig(); err != nil {
+		t.Fatalf("GetConfig() error = %v", err)
+	}
+
+	var calls int
+	var oldGateway, newGateway string
+	OnChange(func(old, new *Network) {
+		calls++
+		oldGateway, newGateway = old.DefaultGateway.String(), new.DefaultGateway.String()
+		// Callbacks run outside of the lock
+		if _, err := GetConfig(); err != nil {
+			t.Errorf("GetConfig() in callback error = %v", err)
+		}
+	})
+
+	if _, err := RefreshConfig(); err != nil {
+		t.Fatalf("RefreshConfig() error = %v", err)
+	}
+	if calls != 0 {
+		t.Errorf("callback called %d times for unchanged config", calls)
+	}
+
+	gateway = "192.168.1.254"
+	if _, err := RefreshConfig(); err != nil {
+		t.Fatalf("RefreshConfig() error = %v", err)
+	}
+	if calls != 1 || oldGateway != "192.168.1.1" || newGateway != "192.168.1.254" {
+		t.Errorf("calls = %d, old = %s, new = %s", calls, oldGateway, newGateway)
+	}
+}
+
+func TestParseRouteGet(t *testing.T) {
+	tests := []struct {
+		output string
+		dev    string
+		src    string
+	}{
+		{"8.8.8.8 via 192.168.1.1 dev eth0 src 192.168.1.10 uid 1000 \n    cache", "eth0", "192.168.1.10"},
+		{"local 127.0.0.1 dev lo src 127.0.0.1 uid 0 \n    cache <local>", "lo", "127.0.0.1"},
+		{"10.8.0.5 dev tun0 table 51820 src 10.8.0.2 uid 0", "tun0", "10.8.0.2"},
+		{"2001:db8::1 from :: via fe80::1 dev wlan0 proto ra src 2001:db8::10 metric 600 pref medium", "wlan0", "2001:db8::10"},
+	}
+
+	for _, tt := range tests {
+		dev, src := parseRouteGet(tt.output)
+		if dev != tt.dev || src.String() != tt.src {
+			t.Errorf("parseRouteGet(%q) = %s, %v, want %s, %s", tt.output, dev, src, tt.dev, tt.src)
+		}
+	}
+
+	if dev, src := parseRouteGet("RTNETLINK answers: Network is unreachable"); dev != "" || src != nil {
+		t.Errorf("parseRouteGet() = %s, %v, want empty", dev, src)
+	}
+}
+
+func TestInterfaceForDestination(t *testing.T) {
+	interf, src, err := InterfaceForDestination(net.ParseIP("127.0.0.1"))
+	if err != nil {
+		t.Fatalf("InterfaceForDestination() error = %v", err)
+	}
+	if interf.Flags&net.FlagLoopback == 0 {
+		t.Errorf("InterfaceForDestination() interface = %s, want loopback", interf.Name)
+	}
+	if !src.IsLoopback() {
+		t.Errorf("InterfaceForDestination() source = %v, want loopback", src)
+	}
+
+	if _, _, err := InterfaceForDestination(nil); err == nil {
+		t.Error("expected error for nil destination")
+	}
+}
+
+func TestNetworkSummary(t *testing.T) {
+	tests := []struct {
+		network *Network
+		want    string
+	}{
+		{
+			network: &Network{
+				InterfaceName:  "eth0",
+				LocalIP:        net.ParseIP("192.168.1.10"),
+				SubnetMask:     net.ParseIP("255.255.255.0"),
+				DefaultGateway: net.ParseIP("192.168.1.1"),
+			},
+			want: "eth0 192.168.1.10/24 gw 192.168.1.1",
+		},
+		{
+			network: &Network{
+				InterfaceName: "wg0",
+				LocalIP:       net.ParseIP("fd00::2"),
+				SubnetMask:    net.IP(net.CIDRMask(64, 128)),
+			},
+			want: "wg0 fd00::2/64",
+		},
+		{
+			network: &Network{InterfaceName: "eth1", LocalIP: net.ParseIP("10.0.0.5")},
+			want:    "eth1 10.0.0.5",
+		},
+		{
+			network: &Network{},
+			want:    "",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := tt.network.Summary(); got != tt.want {
+			t.Errorf("Summary() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestStringWarnings(t *testing.T) {
+	network := &Network{}
+	if str := network.String(); strings.Contains(str, "Warnings:") {
+		t.Errorf("String() without warnings = %q", str)
+	}
+
+	network.warn("subnet mask unavailable: %s", "ifconfig not found")
+	network.warn("DNS servers unavailable")
+	want := "Warnings:subnet mask unavailable: ifconfig not found; DNS servers unavailable\r\n"
+	if str := network.String(); !strings.HasSuffix(str, want) {
+		t.Errorf("String() = %q, want suffix %q", str, want)
+	}
+}
+
+func TestClearCache(t *testing.T) {
+	originalLoad := loadConfig
+	defer func() {
+		loadConfig = originalLoad
+		ClearCache()
+	}()
+
+	loads := 0
+	loadConfig = func(string) (*Network, error) {
+		loads++
+		return &Network{InterfaceName: "eth0"}, nil
+	}
+
+	ClearCache()
+	first, err := GetConfig()
+	if err != nil {
+		t.Fatalf("GetConfig() error = %v", err)
+	}
+
+	ClearCache()
+	if loads != 1 {
+		t.Errorf("ClearCache() loaded the configuration, loads = %d", loads)
+	}
+
+	second, err := GetConfig()
+	if err != nil {
+		t.Fatalf("GetConfig() error = %v", err)
+	}
+	if loads != 2 || first == second {
+		t.Errorf("GetConfig() after ClearCache() returned the cached instance, loads = %d", loads)
+	}
+}
+
+func TestDetector(t *testing.T) {
+	gateways := map[string]string{"ns1": "10.0.1.1", "ns2": "10.0.2.1"}
+	detectors := make(map[string]*Detector)
+	for name := range gateways {
+		name := name
+		detectors[name] = NewDetector(func() (*Network, error) {
+			return &Network{InterfaceName: name, DefaultGateway: net.ParseIP(gateways[name])}, nil
+		})
+	}
+
+	for name, detector := range detectors {
+		config, err := detector.Config()
+		if err != nil {
+			t.Fatalf("%s Config() error = %v", name, err)
+		}
+		if config.InterfaceName != name || config.DefaultGateway.String() != gateways[name] {
+			t.Errorf("%s Config() = %+v", name, config)
+		}
+		if again, _ := detector.Config(); again != config {
+			t.Errorf("%s Config() should return the cached instance", name)
+		}
+	}
+
+	var changes []string
+	detectors["ns1"].OnChange(func(old, new *Network) {
+		changes = append(changes, old.DefaultGateway.String()+"->"+new.DefaultGateway.String())
+	})
+
+	gateways["ns1"] = "10.0.1.254"
+	gateways["ns2"] = "10.0.2.254"
+	if _, err := detectors["ns1"].Refresh(); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if len(changes) != 1 || changes[0] != "10.0.1.1->10.0.1.254" {
+		t.Errorf("changes = %v", changes)
+	}
+
+	// The other detector keeps its cache until it is cleared
+	if config, _ := detectors["ns2"].Config(); config.DefaultGateway.String() != "10.0.2.1" {
+		t.Errorf("ns2 gateway = %s, want cached 10.0.2.1", config.DefaultGateway)
+	}
+	detectors["ns2"].Clear()
+	if config, _ := detectors["ns2"].Config(); config.DefaultGateway.String() != "10.0.2.254" {
+		t.Errorf("ns2 gateway after Clear() = %s", config.DefaultGateway)
+	}
+	if len(changes) != 1 {
+		t.Errorf("ns2 changes reached ns1 callbacks: %v", changes)
+	}
+}
+
+func TestDetectorRefresh(t *testing.T) {
+	var loadErr error
+	mtu := 1500
+	expiry := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	detector := NewDetector(func() (*Network, error) {
+		if loadErr != nil {
+			return nil, loadErr
+		}
+		return &Network{InterfaceName: "eth0", MTU: mtu, DHCPServer: net.ParseIP("192.168.1.1"), LeaseExpiry: expiry}, nil
+	})
+
+	var changes []string
+	detector.OnChange(func(old, new *Network) {
+		if old == nil {
+			changes = append(changes, "nil->"+strconv.Itoa(new.MTU))
+			return
+		}
+		changes = append(changes, strconv.Itoa(old.MTU)+"->"+strconv.Itoa(new.MTU))
+	})
+
+	// The first refresh has nothing cached to compare with
+	first, err := detector.Refresh()
+	if err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+
+	// A failed refresh keeps the cached configuration
+	loadErr = errors.New("detection failed")
+	if _, err := detector.Refresh(); err != loadErr {
+		t.Errorf("Refresh() error = %v, want %v", err, loadErr)
+	}
+	if config, err := detector.Config(); err != nil || config != first {
+		t.Errorf("Config() after failed Refresh() = %v, %v, want the cached instance", config, err)
+	}
+
+	loadErr = nil
+	mtu = 1400
+	if _, err := detector.Refresh(); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if len(changes) != 2 || changes[0] != "nil->1500" || changes[1] != "1500->1400" {
+		t.Errorf("changes = %v", changes)
+	}
+
+	// A renewed DHCP lease is a change
+	expiry = expiry.Add(time.Hour)
+	if _, err := detector.Refresh(); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if len(changes) != 3 {
+		t.Errorf("lease renewal changes = %v", changes)
+	}
+}
+
+func TestNetworkEqual(t *testing.T) {
+	expiry := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	base := Network{InterfaceName: "eth0", LeaseExpiry: expiry, DHCPServer: net.ParseIP("192.168.1.1")}
+
+	same := base
+	same.LeaseExpiry = expiry.In(time.FixedZone("CET", 3600))
+	if !base.equal(&same) {
+		t.Error("equal() = false for the same lease expiry in another zone")
+	}
+
+	// Every exported field takes part in the comparison
+	changes := []func(n *Network){
+		func(n *Network) { n.SearchDomains = []string{"example.com"} },
+		func(n *Network) { n.MTU = 1400 },
+		func(n *Network) { n.DHCPServer = net.ParseIP("192.168.1.2") },
+		func(n *Network) { n.LeaseExpiry = expiry.Add(time.Hour) },
+		func(n *Network) { n.Warnings = []string{"arp failed"} },
+	}
+	for i, change := range changes {
+		other := base
+		change(&other)
+		if base.equal(&other) {
+			t.Errorf("equal() = true after change %d: %+v", i, other)
+		}
+	}
+}
+
+func TestSetCommandLogger(t *testing.T) {
+	defer SetCommandLogger(nil)
+
+	var logged []string
+	SetCommandLogger(func(name string, args []string) error {
+		logged = append(logged, name+" "+strings.Join(args, " "))
+		args[0] = "modified"
+		return nil
+	})
+
+	cmd := command(context.Background(), "arp", "-a", "192.168.1.1")
+	if len(logged) != 1 || logged[0] != "arp -a 192.168.1.1" {
+		t.Errorf("logged = %v", logged)
+	}
+	if strings.Join(cmd.Args, " ") != "arp -a 192.168.1.1" {
+		t.Errorf("logger modified the command arguments: %v", cmd.Args)
+	}
+
+	// A vetoed command fails without being executed
+	denied := errors.New("not allowed")
+	SetCommandLogger(func(name string, args []string) error {
+		logged = append(logged, name)
+		return denied
+	})
+	cmd = command(context.Background(), "sh", "-c", "exit 0")
+	if err := cmd.Run(); !errors.Is(err, denied) || cmd.ProcessState != nil {
+		t.Errorf("Run() of a vetoed command = %v, process %v", err, cmd.ProcessState)
+	}
+	if _, err := command(context.Background(), "sh", "-c", "exit 0").Output(); !errors.Is(err, denied) {
+		t.Errorf("Output() of a vetoed command = %v", err)
+	}
+	if _, err := command(context.Background(), "sh", "-c", "exit 0").CombinedOutput(); !errors.Is(err, denied) {
+		t.Errorf("CombinedOutput() of a vetoed command = %v", err)
+	}
+
+	SetCommandLogger(nil)
+	command(context.Background(), "arp", "-a")
+	if len(logged) != 4 {
+		t.Errorf("command logged after SetCommandLogger(nil): %v", logged)
+	}
+}
+
+func TestSetMaxConcurrentCommands(t *testing.T) {
+	defer SetMaxConcurrentCommands(0)
+
+	SetMaxConcurrentCommands(2)
+	var releases []func()
+	for i := 0; i < 2; i++ {
+		release, err := acquireCommandSlot(context.Background())
+		if err != nil {
+			t.Fatalf("acquireCommandSlot() error = %v", err)
+		}
+		releases = append(releases, release)
+	}
+
+	// All slots are taken, the next command waits until its context expires
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := command(ctx, "arp", "-a").Output(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Output() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	releases[0]()
+	release, err := acquireCommandSlot(context.Background())
+	if err != nil {
+		t.Fatalf("acquireCommandSlot() after release error = %v", err)
+	}
+	release()
+	releases[1]()
+
+	SetMaxConcurrentCommands(0)
+	if _, err := acquireCommandSlot(ctx); err != nil {
+		t.Errorf("acquireCommandSlot() without limit error = %v", err)
+	}
+}
+
+func TestInterfaceIndex(t *testing.T) {
+	loopback, err := net.InterfaceByName("lo")
+	if err != nil {
+		interfaces, _ := net.Interfaces()
+		if len(interfaces) == 0 {
+			t.Skip("no network interfaces")
+		}
+		loopback = &interfaces[0]
+	}
+
+	network := &Network{InterfaceName: loopback.Name, Interface: loopback}
+	if network.InterfaceIndex() != loopback.Index {
+		t.Errorf("InterfaceIndex() = %d, want %d", network.InterfaceIndex(), loopback.Index)
+	}
+	// The index is looked up by name if the interface is not set
+	if index := (&Network{InterfaceName: loopback.Name}).InterfaceIndex(); index != loopback.Index {
+		t.Errorf("InterfaceIndex() by name = %d, want %d", index, loopback.Index)
+	}
+	if index := (&Network{}).InterfaceIndex(); index != 0 {
+		t.Errorf("InterfaceIndex() without interface = %d, want 0", index)
+	}
+
+	want := strconv.Itoa(loopback.Index)
+	if !strings.Contains(network.String(), "InterfaceIndex:"+want+"\r\n") {
+		t.Errorf("String() = %q", network.String())
+	}
+	if network.Map()["InterfaceIndex"] != want {
+		t.Errorf("Map()[InterfaceIndex] = %q, want %q", network.Map()["InterfaceIndex"], want)
+	}
+
+	for _, value := range []interface{}{network, *network} {
+		data, err := json.Marshal(value)
+		if err != nil {
+			t.Fatalf("json.Marshal() error = %v", err)
+		}
+		var decoded struct {
+			InterfaceName  string
+			InterfaceIndex int
+		}
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("json.Unmarshal() error = %v", err)
+		}
+		if decoded.InterfaceIndex != loopback.Index || decoded.InterfaceName != loopback.Name {
+			t.Errorf("JSON = %s", data)
+		}
+	}
+}
+
+func TestIsTunnel(t *testing.T) {
+	tests := []struct {
+		name  string
+		flags net.Flags
+		want  bool
+	}{
+		{"tun0", net.FlagUp, true},
+		{"tap1", net.FlagUp, true},
+		{"ppp0", net.FlagUp | net.FlagPointToPoint, true},
+		{"wg0", net.FlagUp, true},
+		{"utun3", net.FlagUp, true},
+		{"gre1", net.FlagUp | net.FlagPointToPoint, true},
+		{"WireGuard Tunnel", net.FlagUp, true},
+		{"Ethernet 2 (OpenVPN TAP-Windows6)", net.FlagUp, true},
+		{"eth0", net.FlagUp | net.FlagBroadcast, false},
+		{"wlan0", net.FlagUp, false},
+		{"lo", net.FlagUp | net.FlagLoopback, false},
+	}
+	for _, tt := range tests {
+		if got := isTunnelInterface(tt.name, tt.flags); got != tt.want {
+			t.Errorf("isTunnelInterface(%q, %v) = %v, want %v", tt.name, tt.flags, got, tt.want)
+		}
+	}
+
+	if !(&Network{InterfaceName: "wg0"}).IsTunnel() {
+		t.Error("IsTunnel() by name = false, want true")
+	}
+	if (&Network{Interface: &net.Interface{Name: "eth0", Flags: net.FlagUp}}).IsTunnel() {
+		t.Error("IsTunnel() of eth0 = true, want false")
+	}
+	if (&Network{}).IsTunnel() {
+		t.Error("IsTunnel() without interface = true, want false")
+	}
+
+	names, err := ActiveVPNInterfaces()
+	if err != nil {
+		t.Fatalf("ActiveVPNInterfaces() error = %v", err)
+	}
+	for _, name := range names {
+		if name == "lo" {
+			t.Errorf("ActiveVPNInterfaces() = %v, includes the loopback", names)
+		}
+	}
+}
+
+func TestParseIPConfigLease(t *testing.T) {
+	section := "Ethernet:\r\n\r\n" +
+		"   DHCP Enabled. . . . . . . . . . . : Yes\r\n" +
+		"   IPv4 Address. . . . . . . . . . . : 192.168.1.10(Preferred) \r\n" +
+		"   Lease Obtained. . . . . . . . . . : Friday, May 3, 2024 10:15:30 AM\r\n" +
+		"   Lease Expires . . . . . . . . . . : Saturday, May 4, 2024 10:15:30 PM\r\n" +
+		"   DHCP Server . . . . . . . . . . . : 192.168.1.1\r\n"
+
+	server, expiry := parseIPConfigLease(strings.Split(section, "\r\n"))
+	if server.String() != "192.168.1.1" {
+		t.Errorf("DHCP server = %v, want 192.168.1.1", server)
+	}
+	if want := time.Date(2024, 5, 4, 22, 15, 30, 0, time.Local); !expiry.Equal(want) {
+		t.Errorf("lease expiry = %v, want %v", expiry, want)
+	}
+
+	static := strings.Replace(section, ": Yes", ": No", 1)
+	if server, expiry := parseIPConfigLease(strings.Split(static, "\r\n")); server != nil || !expiry.IsZero() {
+		t.Errorf("static address has DHCP server %v and lease expiry %v", server, expiry)
+	}
+}
+
+func TestParseWindowsConfigLease(t *testing.T) {
+	data := `{"Gateway":"192.168.1.1","DHCPServer":"192.168.1.1","LeaseExpires":"2024-05-04T10:15:30.0000000Z"}`
+	network := &Network{}
+	if err := network.parseWindowsConfig([]byte(data)); err != nil {
+		t.Fatalf("parseWindowsConfig() error = %v", err)
+	}
+	if network.DHCPServer.String() != "192.168.1.1" || !network.LeaseExpiry.Equal(time.Date(2024, 5, 4, 10, 15, 30, 0, time.UTC)) {
+		t.Errorf("DHCPServer = %v, LeaseExpiry = %v", network.DHCPServer, network.LeaseExpiry)
+	}
+	if !strings.Contains(network.String(), "DHCPServer:192.168.1.1\r\n") || network.Map()["LeaseExpiry"] == "" {
+		t.Errorf("String() = %q", network.String())
+	}
+
+	// A static address has no lease
+	network = &Network{}
+	if err := network.parseWindowsConfig([]byte(`{"DHCPServer":"255.255.255.255","LeaseExpires":null}`)); err != nil {
+		t.Fatalf("parseWindowsConfig() error = %v", err)
+	}
+	if network.DHCPServer != nil || !network.LeaseExpiry.IsZero() {
+		t.Errorf("DHCPServer = %v, LeaseExpiry = %v", network.DHCPServer, network.LeaseExpiry)
+	}
+	if !strings.Contains(network.String(), "LeaseExpiry:<nil>\r\n") || network.Map()["LeaseExpiry"] != "" {
+		t.Errorf("String() = %q", network.String())
+	}
+}
+
+func TestParseWindowsConfig(t *testing.T) {
+	data := `{"Gateway":["192.168.1.1"],"GatewayMAC":"00-11-22-33-44-55","DNS":["192.168.1.1","8.8.8.8"],` +
+		`"PrefixLength":[24],"Suffix":"corp.example.com","SearchList":["corp.example.com","example.com"]}` + "\r\n"
+	network := &Network{}
+	if err := network.parseWindowsConfig([]byte(data)); err != nil {
+		t.Fatalf("parseWindowsConfig() error = %v", err)
+	}
+	if network.DefaultGateway.String() != "192.168.1.1" || network.DefaultGatewayHardwareAddress.String() != "00:11:22:33:44:55" {
+		t.Errorf("gateway = %v %v", network.DefaultGateway, network.DefaultGatewayHardwareAddress)
+	}
+	if strings.Join(network.DNS, ",") != "192.168.1.1,8.8.8.8" || network.SubnetMask.String() != "255.255.255.0" {
+		t.Errorf("DNS = %v, SubnetMask = %v", network.DNS, network.SubnetMask)
+	}
+	if network.Suffix != "corp.example.com" || strings.Join(network.SearchDomains, ",") != "corp.example.com,example.com" {
+		t.Errorf("Suffix = %q, SearchDomains = %v", network.Suffix, network.SearchDomains)
+	}
+	if len(network.Warnings) != 0 {
+		t.Errorf("Warnings = %v", network.Warnings)
+	}
+
+	// PowerShell prints single values without the array and missing values as null
+	network = &Network{}
+	data = `{"Gateway":"10.0.0.1","GatewayMAC":null,"DNS":"10.0.0.53","PrefixLength":16,"Suffix":"","SearchList":null}`
+	if err := network.parseWindowsConfig([]byte(data)); err != nil {
+		t.Fatalf("parseWindowsConfig() error = %v", err)
+	}
+	if network.DefaultGateway.String() != "10.0.0.1" || strings.Join(network.DNS, ",") != "10.0.0.53" || network.SubnetMask.String() != "255.255.0.0" {
+		t.Errorf("parseWindowsConfig() = %+v", network)
+	}
+	if network.SearchDomains != nil || len(network.Warnings) != 1 {
+		t.Errorf("SearchDomains = %v, Warnings = %v", network.SearchDomains, network.Warnings)
+	}
+
+	network = &Network{}
+	if err := network.parseWindowsConfig([]byte(`{"PrefixLength":null}`)); err != nil {
+		t.Fatalf("parseWindowsConfig() error = %v", err)
+	}
+	if network.SubnetMask != nil {
+		t.Errorf("SubnetMask = %v without prefix length", network.SubnetMask)
+	}
+
+	if err := (&Network{}).parseWindowsConfig([]byte("Get-NetIPConfiguration : not recognized")); err == nil {
+		t.Error("parseWindowsConfig() expected error for non-JSON output")
+	}
+}
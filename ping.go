@@ -1,12 +1,20 @@
 package network
 
 import (
+	"bytes"
+	"context"
+	"encoding/hex"
 	"fmt"
-	"os/exec"
+	"math"
+	"net"
+	"os"
 	"regexp"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"text/tabwriter"
 	"time"
 )
 
@@ -23,6 +31,64 @@ type PingResult struct {
 	StdDevRTT    time.Duration
 	Success      bool
 	ErrorMessage string
+
+	// RecordedRoute holds the route recorded by the IP record-route option (Linux only)
+	RecordedRoute []net.IP
+
+	// ICMPErrors holds the ICMP error replies (e.g. Destination Host Unreachable) sent by routers
+	ICMPErrors []ICMPError
+
+	// Replies holds the individual replies when the probe method reports them
+	Replies []PingReply
+
+	// OutOfOrder counts replies which arrived after a reply with a higher sequence number
+	OutOfOrder int
+
+	// MissingSeqs lists the sequence numbers which were sent but never answered
+	MissingSeqs []int
+
+	// TTLExceededFrom is the router which reported "Time to live exceeded" for the probes
+	TTLExceededFrom net.IP
+
+	// Mode is how the echo requests were sent, see PingModeCommand, PingModeUnprivileged and PingModeRaw
+	Mode string
+
+	// Corrupted counts replies whose payload did not match the sent pattern (Linux ping and native only)
+	Corrupted int
+
+	// FragmentationNeeded is set when a packet with the Don't Fragment bit set was too large for the path.
+	// NextHopMTU is the MTU reported along with it, 0 if unknown (Windows ping doesn't print it).
+	FragmentationNeeded bool
+	NextHopMTU          int
+
+	// ReturnRoute is the source route option carried by the first echo reply when PingOptions.RouteVia was
+	// set, routers record the addresses of their outgoing interfaces in it. RoutedVia is set if every reply
+	// carried the option, which shows that the host honored the route and answered along it.
+	ReturnRoute []net.IP
+	RoutedVia   bool
+}
+
+// PingReply is the outcome of a single probe
+type PingReply struct {
+	Seq   int           // Sequence number of the probe
+	From  net.IP        // Address the reply was received from, nil for TCPPing through a proxy
+	TTL   int           // TTL of the reply, 0 if unknown
+	RTT   time.Duration // Round trip time, 0 if no reply was received
+	Error string        // Error message if no reply was received
+
+	// TOS is the TOS byte (IPv4) or traffic class (IPv6) of native replies when PingOptions.DSCP is set,
+	// -1 if the socket can't read it (IPv4 without a raw socket)
+	TOS int
+
+	// Timing is the connection setup breakdown of TCPPing replies, nil for ICMP
+	Timing *ConnectTiming
+}
+
+// ICMPError is an ICMP error reply received instead of an echo reply
+type ICMPError struct {
+	From net.IP // Address of the router or host which sent the error
+	Seq  int    // Sequence number of the failed request, 0 if unknown
+	Type string // Error as reported by ping, e.g. "Destination Host Unreachable"
 }
 
 // PingOptions configures ping behavior
@@ -30,6 +96,77 @@ type PingOptions struct {
 	Count   int           // Number of packets to send (default: 4)
 	Timeout time.Duration // Timeout for each packet (default: 4 seconds)
 	Size    int           // Packet size in bytes (default: 32 on Windows, 56 on Linux)
+
+	// RecordRoute enables the IP record-route option (ping -R, not supported by Windows and BusyBox). The IP header
+	// has room for 9 hops only and many routers drop or ignore packets carrying the option.
+	RecordRoute bool
+
+	// IPVersion selects IPv4 or IPv6 ping. With IPVersionAuto a name resolving to IPv6
+	// addresses only is pinged over IPv6.
+	IPVersion int
+
+	// TTL sets the outgoing TTL/hop limit (ping -t on Linux, -m on BSD, -i on Windows), 0 uses the system default.
+	// Routers dropping the packet report "Time to live exceeded", see PingResult.TTLExceededFrom.
+	TTL int
+
+	// Native sends the echo requests with ICMP sockets instead of executing ping. Unprivileged datagram
+	// ICMP sockets are used when permitted, raw ICMP sockets require root or CAP_NET_RAW otherwise
+	// ErrInsufficientPrivilege is returned.
+	Native bool
+
+	// Pattern fills the payload with the repeated bytes (ping -p on Linux, at most 16 bytes) and echoed
+	// payloads are verified, see PingResult.Corrupted. Windows ping has no pattern option, use Native.
+	Pattern []byte
+
+	// Identifier is the ICMP identifier of the native pinger's echo requests, 0 picks a random identifier so
+	// concurrent pingers don't receive each other's replies. It only takes effect on raw sockets: the kernel
+	// overwrites it on the unprivileged datagram sockets tried first (PingResult.Mode "unprivileged").
+	// SequenceStart is the first sequence number (default: 1), later requests count up from it.
+	Identifier    int
+	SequenceStart int
+
+	// Quiet collects only the summary statistics (ping -q on Linux) and skips parsing of the reply lines.
+	// Per-reply data such as Replies and MissingSeqs is not available in Quiet mode, ICMPErrors only where
+	// ping prints the error replies (Windows).
+	Quiet bool
+
+	// Adaptive sends the next echo request as soon as the previous reply arrived instead of once per
+	// second (ping -A, Linux iputils only). Windows ping has no adaptive mode, use Native which
+	// sends the next request right after each reply.
+	Adaptive bool
+
+	// DSCP marks the echo requests with the DiffServ code point 0-63 (ping -Q on Linux, -z on BSD),
+	// 0 leaves the marking unchanged. Windows ping ignores TOS settings, use Native. See VerifyDSCP
+	// to check whether the marking survives the path.
+	DSCP int
+
+	// LocalAddr binds the native pinger's ICMP socket to one of the host's addresses, which becomes the
+	// source address of the echo requests on interfaces with several addresses. Link-local IPv6 addresses
+	// may carry their zone ("fe80::1%eth0"). Requires Native.
+	LocalAddr string
+
+	// RouteVia sends the echo requests through the routers in order with the loose source route IP option
+	// (LSRR), or the strict one (SSRR) with StrictRoute where each router must be the next hop of the previous.
+	// IPv4 only, at most 9 routers, requires Native with a raw socket. Most networks drop source routed
+	// packets and hosts ignore them (net.ipv4.conf.*.accept_source_route is 0 by default), see
+	// PingResult.RoutedVia.
+	RouteVia    []net.IP
+	StrictRoute bool
+}
+
+// IP versions used by PingOptions.IPVersion
+const (
+	IPVersionAuto = 0
+	IPVersion4    = 4
+	IPVersion6    = 6
+)
+
+// lookupIPAddr resolves host names, replaced in tests
+var lookupIPAddr = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+	resolver := &net.Resolver{
+		PreferGo: true,
+	}
+	return resolver.LookupIPAddr(ctx, host)
 }
 
 // DefaultPingOptions returns default ping options
@@ -46,13 +183,40 @@ func DefaultPingOptions() *PingOptions {
 }
 
 // Ping sends ICMP echo requests to a host and returns statistics
-func Ping(host string, options *PingOptions) (*PingResult, error) {
+func Ping(host string, options *PingOptions, opts ...Option) (*PingResult, error) {
+	return PingContext(context.Background(), host, options, opts...)
+}
+
+// PingContext is like Ping but the ping process is killed when the context is done
+func PingContext(ctx context.Context, host string, options *PingOptions, opts ...Option) (*PingResult, error) {
+	namespace := applyOptions(opts).namespace
+	if namespace == "" {
+		return ping(ctx, host, options, "")
+	}
+
+	var result *PingResult
+	err := inNamespace(namespace, func() (err error) {
+		result, err = ping(ctx, host, options, namespace)
+		return err
+	})
+	return result, err
+}
+
+// ping runs PingContext on a thread in the network namespace, host names and the default zone are
+// looked up in the namespace
+func ping(ctx context.Context, host string, options *PingOptions, namespace string) (*PingResult, error) {
 	if host == "" {
 		return nil, fmt.Errorf("host cannot be empty")
 	}
+	// Link-local destinations are unreachable without the interface
+	host = withNamespaceZone(host, namespace)
 
 	if options == nil {
 		options = DefaultPingOptions()
+	} else {
+		// Copy so the defaults below don't modify options shared between calls
+		copied := *options
+		options = &copied
 	}
 
 	// Validate options
@@ -65,95 +229,410 @@ func Ping(host string, options *PingOptions) (*PingResult, error) {
 	if options.Size <= 0 {
 		options.Size = 32
 	}
+	if options.TTL < 0 || options.TTL > 255 {
+		return nil, fmt.Errorf("invalid TTL %d", options.TTL)
+	}
+	if options.Identifier < 0 || options.Identifier > 0xffff {
+		return nil, fmt.Errorf("invalid ICMP identifier %d", options.Identifier)
+	}
+	if options.SequenceStart < 0 || options.SequenceStart > 0xffff {
+		return nil, fmt.Errorf("invalid sequence start %d", options.SequenceStart)
+	}
+	if options.DSCP < 0 || options.DSCP > 63 {
+		return nil, fmt.Errorf("invalid DSCP %d", options.DSCP)
+	}
+	if options.LocalAddr != "" && !options.Native {
+		return nil, fmt.Errorf("local address requires the native pinger")
+	}
+	if len(options.RouteVia) > 0 && !options.Native {
+		return nil, fmt.Errorf("source route requires the native pinger")
+	}
+	if options.DSCP > 0 && !options.Native && runtime.GOOS == "windows" {
+		return nil, fmt.Errorf("DSCP marking is not supported by Windows ping, use the native pinger")
+	}
+	if len(options.Pattern) > 16 && !options.Native {
+		return nil, fmt.Errorf("pattern is limited to 16 bytes, got %d", len(options.Pattern))
+	}
+	if len(options.Pattern) > 0 && !options.Native && runtime.GOOS == "windows" {
+		return nil, fmt.Errorf("payload pattern is not supported by Windows ping, use the native pinger")
+	}
+	if options.Adaptive && !options.Native && runtime.GOOS == "windows" {
+		return nil, fmt.Errorf("adaptive interval is not supported by Windows ping, use the native pinger")
+	}
+
+	version, err := selectIPVersion(ctx, host, options.IPVersion, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	if options.Native {
+		return pingNative(ctx, host, options, version, namespace)
+	}
 
 	result := &PingResult{
 		Host: host,
+		Mode: PingModeCommand,
 	}
 
-	var output []byte
-	var err error
+	var output, stderr []byte
 
 	if runtime.GOOS == "windows" {
-		output, err = pingWindows(host, options)
+		output, stderr, err = pingWindows(ctx, host, options, version)
 	} else {
-		output, err = pingLinux(host, options)
-	}
-
-	if err != nil {
-		// Even if ping fails, try to parse partial output
-		if output != nil && len(output) > 0 {
-			if runtime.GOOS == "windows" {
-				parseWindowsPingOutput(string(output), result)
-			} else {
-				parseLinuxPingOutput(string(output), result)
-			}
-		}
-		
-		// If we couldn't reach the host at all
-		if result.Sent == 0 || result.Received == 0 {
-			result.Success = false
-			result.ErrorMessage = fmt.Sprintf("failed to ping %s: %v", host, err)
-			return result, nil
+		variant := PingVariant()
+		args, argsErr := pingArgs(variant, options, version)
+		if argsErr != nil {
+			return nil, argsErr
 		}
+		output, stderr, err = pingLinux(ctx, host, variant, args, version)
 	}
 
-	// Parse the output
+	// Parse the output, even if ping fails it may contain partial statistics
 	if runtime.GOOS == "windows" {
-		parseWindowsPingOutput(string(output), result)
+		parseWindowsPingOutput(string(output), result, options.Quiet)
 	} else {
-		parseLinuxPingOutput(string(output), result)
+		parseLinuxPingOutput(string(output), result, options.Quiet)
+		parseLinuxPingStderr(string(stderr), result)
 	}
+	finishCommandResult(result, pingCommandError(err, stderr), stderr)
+	return result, nil
+}
 
-	// Calculate packet loss
+// finishCommandResult calculates the packet loss of a parsed ping command and records the error of the
+// command. Without replies ping exits with an error, that's a host down result if the statistics were
+// printed and a failure if ping printed no statistics or complained on standard error.
+func finishCommandResult(result *PingResult, err error, stderr []byte) {
 	if result.Sent > 0 {
 		result.Lost = result.Sent - result.Received
 		result.PacketLoss = float64(result.Lost) / float64(result.Sent) * 100
 		result.Success = result.Received > 0
 	}
+	if err != nil && (result.Sent == 0 || (result.Received == 0 && len(bytes.TrimSpace(stderr)) > 0)) {
+		result.Success = false
+		result.ErrorMessage = fmt.Sprintf("failed to ping %s: %v", result.Host, err)
+	}
+}
 
-	return result, nil
+// PingHosts pings the hosts using at most concurrency parallel pings and returns the results keyed by host.
+// Hosts that could not be pinged have a result with ErrorMessage set.
+func PingHosts(ctx context.Context, hosts []string, options *PingOptions, concurrency int) (map[string]*PingResult, error) {
+	if concurrency <= 0 {
+		concurrency = 8
+	}
+
+	var mu sync.Mutex
+	results := make(map[string]*PingResult)
+	forEachHost(ctx, hosts, concurrency, func(host string) {
+		result, err := PingContext(ctx, host, options)
+		if err != nil {
+			result = &PingResult{Host: host, ErrorMessage: err.Error()}
+		}
+		mu.Lock()
+		results[host] = result
+		mu.Unlock()
+	})
+	return results, ctx.Err()
+}
+
+// forEachHost calls fn for every distinct host using at most concurrency goroutines, so fn may run
+// concurrently. Hosts not started before the context was done are skipped.
+func forEachHost(ctx context.Context, hosts []string, concurrency int, fn func(host string)) {
+	var wg sync.WaitGroup
+	jobs := make(chan string)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for host := range jobs {
+				fn(host)
+			}
+		}()
+	}
+
+	seen := make(map[string]bool)
+	for _, host := range hosts {
+		if ctx.Err() != nil {
+			break
+		}
+		if seen[host] {
+			continue
+		}
+		seen[host] = true
+		jobs <- host
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// summarizeReplies fills the packet and RTT statistics of the result from its replies
+func (r *PingResult) summarizeReplies() {
+	r.Sent = len(r.Replies)
+	r.Received = 0
+	r.MinRTT, r.MaxRTT, r.AvgRTT, r.StdDevRTT = 0, 0, 0, 0
+
+	var sum, sumSquares float64
+	for _, reply := range r.Replies {
+		if reply.Error != "" {
+			continue
+		}
+		r.Received++
+		if r.MinRTT == 0 || reply.RTT < r.MinRTT {
+			r.MinRTT = reply.RTT
+		}
+		if reply.RTT > r.MaxRTT {
+			r.MaxRTT = reply.RTT
+		}
+		sum += float64(reply.RTT)
+		sumSquares += float64(reply.RTT) * float64(reply.RTT)
+	}
+
+	if r.Received > 0 {
+		mean := sum / float64(r.Received)
+		r.AvgRTT = time.Duration(mean)
+		r.StdDevRTT = time.Duration(math.Sqrt(math.Max(sumSquares/float64(r.Received)-mean*mean, 0)))
+	}
+
+	r.Lost = r.Sent - r.Received
+	if r.Sent > 0 {
+		r.PacketLoss = float64(r.Lost) / float64(r.Sent) * 100
+	}
+	r.Success = r.Received > 0
 }
 
-// pingWindows executes ping command on Windows
-func pingWindows(host string, options *PingOptions) ([]byte, error) {
+// pingWindows executes ping command on Windows and returns its standard output and error
+func pingWindows(ctx context.Context, host string, options *PingOptions, version int) ([]byte, []byte, error) {
 	args := []string{
 		"-n", strconv.Itoa(options.Count),
 		"-w", strconv.Itoa(int(options.Timeout.Milliseconds())),
 		"-l", strconv.Itoa(options.Size),
-		host,
 	}
+	if version != IPVersionAuto {
+		args = append(args, "-"+strconv.Itoa(version))
+	}
+	if options.TTL > 0 {
+		args = append(args, "-i", strconv.Itoa(options.TTL))
+	}
+	args = append(args, host)
 
-	cmd := exec.Command("ping", args...)
-	return cmd.CombinedOutput()
+	return runPingCommand(command(ctx, "ping", args...))
 }
 
-// pingLinux executes ping command on Linux
-func pingLinux(host string, options *PingOptions) ([]byte, error) {
-	// Find ping command
+// Ping command variants reported by PingVariant
+const (
+	PingVariantIputils = "iputils" // Linux iputils ping
+	PingVariantBusybox = "busybox" // BusyBox ping (Alpine, embedded systems)
+	PingVariantBSD     = "bsd"     // macOS and BSD ping
+	PingVariantUnknown = "unknown" // only the count is passed to ping
+)
+
+var (
+	pingVariantOnce     sync.Once
+	detectedPingVariant string
+)
+
+// PingVariant detects the variant of the ping command used on Unix systems, the result is cached
+func PingVariant() string {
+	pingVariantOnce.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		// Only iputils knows -V, the others print their usage which names BusyBox
+		output, _ := command(ctx, pingCommand(), "-V").CombinedOutput()
+		detectedPingVariant = classifyPingVariant(string(output), runtime.GOOS)
+		if detectedPingVariant == PingVariantUnknown {
+			logger().Warn("unknown ping variant, only the packet count is passed to ping")
+		}
+	})
+	return detectedPingVariant
+}
+
+// classifyPingVariant returns the ping variant from the output of "ping -V" and the platform
+func classifyPingVariant(output, goos string) string {
+	switch {
+	case strings.Contains(output, "iputils"):
+		return PingVariantIputils
+	case strings.Contains(output, "BusyBox"):
+		return PingVariantBusybox
+	}
+	switch goos {
+	case "darwin", "freebsd", "netbsd", "openbsd", "dragonfly":
+		return PingVariantBSD
+	}
+	return PingVariantUnknown
+}
+
+// pingCommand returns the path of the ping command
+func pingCommand() string {
 	pingCmd := findCommand("ping", []string{"/bin/ping", "/sbin/ping", "/usr/bin/ping", "/usr/sbin/ping"})
 	if pingCmd == "" {
 		pingCmd = "ping"
 	}
+	return pingCmd
+}
+
+// pingLinux executes the ping command of Unix systems with the flags built by pingArgs and returns
+// its standard output and error
+func pingLinux(ctx context.Context, host, variant string, args []string, version int) ([]byte, []byte, error) {
+	pingCmd := pingCommand()
+	// BSD ping is IPv4 only, IPv6 has its own command
+	if variant == PingVariantBSD && version == IPVersion6 {
+		pingCmd = "ping6"
+	}
 
-	args := []string{
-		"-c", strconv.Itoa(options.Count),
-		"-W", strconv.Itoa(int(options.Timeout.Seconds())),
-		"-s", strconv.Itoa(options.Size),
-		host,
+	return runPingCommand(command(ctx, pingCmd, append(args, host)...))
+}
+
+// runPingCommand runs the ping command capturing standard output and error separately, so error
+// messages such as "ping: socket: Operation not permitted" don't mix with the replies
+func runPingCommand(cmd *limitedCmd) ([]byte, []byte, error) {
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	return output, stderr.Bytes(), err
+}
+
+// pingCommandError adds the error message ping printed to the error of the command
+func pingCommandError(err error, stderr []byte) error {
+	message := strings.TrimSpace(string(stderr))
+	if err == nil || message == "" {
+		return err
+	}
+	return fmt.Errorf("%w: %s", err, message)
+}
+
+// pingArgs maps the options to the flags of the ping variant. Options the variant doesn't support
+// return an error, the unknown variant gets the count only.
+func pingArgs(variant string, options *PingOptions, version int) ([]string, error) {
+	args := []string{"-c", strconv.Itoa(options.Count)}
+	if variant == PingVariantUnknown {
+		return args, nil
+	}
+
+	// Timeout of each reply, in milliseconds for BSD
+	if variant == PingVariantBSD {
+		args = append(args, "-W", strconv.FormatInt(options.Timeout.Milliseconds(), 10))
+	} else {
+		args = append(args, "-W", strconv.Itoa(int(options.Timeout.Seconds())))
+	}
+	args = append(args, "-s", strconv.Itoa(options.Size))
+
+	if options.RecordRoute {
+		if variant == PingVariantBusybox {
+			return nil, fmt.Errorf("record route is not supported by %s ping", variant)
+		}
+		args = append(args, "-R")
+	}
+	if version != IPVersionAuto && variant != PingVariantBSD {
+		args = append(args, "-"+strconv.Itoa(version))
+	}
+	if options.TTL > 0 {
+		if variant == PingVariantBSD {
+			args = append(args, "-m", strconv.Itoa(options.TTL))
+		} else {
+			args = append(args, "-t", strconv.Itoa(options.TTL))
+		}
+	}
+	if len(options.Pattern) > 0 {
+		// BusyBox fills the payload with a single byte
+		if variant == PingVariantBusybox && len(options.Pattern) > 1 {
+			return nil, fmt.Errorf("%s ping supports a single byte pattern only", variant)
+		}
+		args = append(args, "-p", hex.EncodeToString(options.Pattern))
+	}
+	if options.DSCP > 0 {
+		// The TOS byte carries the DSCP in its upper 6 bits
+		switch variant {
+		case PingVariantIputils:
+			args = append(args, "-Q", strconv.Itoa(options.DSCP<<2))
+		case PingVariantBSD:
+			args = append(args, "-z", strconv.Itoa(options.DSCP<<2))
+		default:
+			return nil, fmt.Errorf("DSCP marking is not supported by %s ping", variant)
+		}
+	}
+	if options.Adaptive {
+		if variant != PingVariantIputils {
+			return nil, fmt.Errorf("adaptive interval is not supported by %s ping", variant)
+		}
+		args = append(args, "-A")
+	}
+	if options.Quiet {
+		args = append(args, "-q")
+	}
+	return args, nil
+}
+
+// selectIPVersion returns the IP version flag to ping the host with, IPVersionAuto leaves the choice to ping.
+// For host names the resolved address families are checked so IPv6-only names use IPv6 ping, and a version
+// which the host has no address for is reported as an error.
+func selectIPVersion(ctx context.Context, host string, version int, namespace string) (int, error) {
+	if version != IPVersionAuto && version != IPVersion4 && version != IPVersion6 {
+		return 0, fmt.Errorf("invalid IP version %d", version)
+	}
+
+	if ip := net.ParseIP(strings.SplitN(host, "%", 2)[0]); ip != nil {
+		family := IPVersion6
+		if ip.To4() != nil {
+			family = IPVersion4
+		}
+		if version != IPVersionAuto && version != family {
+			return 0, fmt.Errorf("cannot ping IPv%d address %s using IPv%d", family, host, version)
+		}
+		return version, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	addrs, err := lookupNamespaceIPAddr(ctx, namespace, host)
+	if err != nil || len(addrs) == 0 {
+		// Let ping report the resolution failure
+		return version, nil
+	}
+
+	has4, has6 := false, false
+	for _, addr := range addrs {
+		if addr.IP.To4() != nil {
+			has4 = true
+		} else {
+			has6 = true
+		}
 	}
 
-	cmd := exec.Command(pingCmd, args...)
-	return cmd.CombinedOutput()
+	switch {
+	case version == IPVersion4 && !has4:
+		return 0, fmt.Errorf("no A records for IPv4 ping of %s", host)
+	case version == IPVersion6 && !has6:
+		return 0, fmt.Errorf("no AAAA records for IPv6 ping of %s", host)
+	case version != IPVersionAuto || has4:
+		return version, nil
+	default:
+		return IPVersion6, nil
+	}
 }
 
 // parseWindowsPingOutput parses Windows ping output
-func parseWindowsPingOutput(output string, result *PingResult) {
+func parseWindowsPingOutput(output string, result *PingResult, quiet bool) {
 	lines := strings.Split(output, "\n")
 
 	// Parse packet statistics
 	for _, line := range lines {
 		line = strings.TrimSpace(line)
 
+		// Look for ICMP error replies, also in quiet mode as they correct the received count below
+		// "Reply from 192.168.1.1: Destination host unreachable."
+		if icmpErr, ok := parseWindowsICMPError(line); ok {
+			result.addICMPError(icmpErr)
+			continue
+		}
+		if quiet && strings.HasPrefix(line, "Reply from") {
+			continue
+		}
+
+		// "Packet needs to be fragmented but DF set."
+		if strings.HasPrefix(line, "Packet needs to be fragmented") {
+			result.FragmentationNeeded = true
+		}
+
 		// Look for packet statistics line
 		// "Packets: Sent = 4, Received = 4, Lost = 0 (0% loss),"
 		if strings.Contains(line, "Packets:") {
@@ -184,19 +663,74 @@ func parseWindowsPingOutput(output string, result *PingResult) {
 			}
 		}
 	}
+
+	// Windows counts ICMP error replies as received packets
+	if len(result.ICMPErrors) > 0 && result.Received >= len(result.ICMPErrors) {
+		result.Received -= len(result.ICMPErrors)
+		result.Lost = result.Sent - result.Received
+	}
 }
 
 // parseLinuxPingOutput parses Linux ping output
-func parseLinuxPingOutput(output string, result *PingResult) {
+func parseLinuxPingOutput(output string, result *PingResult, quiet bool) {
 	lines := strings.Split(output, "\n")
+	inRecordRoute := false
+	zeroBased := false
 
 	for _, line := range lines {
 		line = strings.TrimSpace(line)
 
+		// Only the summary is parsed in quiet mode, ping -q prints nothing else anyway
+		if quiet && !strings.Contains(line, "packets transmitted") && !isRTTSummary(line) {
+			continue
+		}
+
+		// Parse record route block, only the first one is kept as the others are "(same route)"
+		// "RR: 	192.168.1.10"
+		// "	10.0.0.1"
+		if strings.HasPrefix(line, "RR:") {
+			inRecordRoute = result.RecordedRoute == nil
+			line = strings.TrimSpace(strings.TrimPrefix(line, "RR:"))
+		}
+		if inRecordRoute {
+			if ip := parseRouteHop(line); ip != nil {
+				result.RecordedRoute = append(result.RecordedRoute, ip)
+				continue
+			}
+			inRecordRoute = false
+		}
+
+		// Parse ICMP error replies
+		// "From 192.168.1.1 icmp_seq=1 Destination Host Unreachable"
+		if icmpErr, ok := parseLinuxICMPError(line); ok {
+			result.addICMPError(icmpErr)
+			continue
+		}
+
+		// Parse payload mismatches, printed once per corrupted reply
+		// "wrong data byte #12 should be 0xab but was 0x0"
+		if strings.HasPrefix(line, "wrong data byte") {
+			result.Corrupted++
+			continue
+		}
+
+		// Parse echo replies
+		// "64 bytes from 8.8.8.8: icmp_seq=1 ttl=117 time=10.5 ms"
+		// "64 bytes from 127.0.0.1: seq=0 ttl=64 time=0.234 ms" (busybox)
+		if reply, ok := parseLinuxReply(line); ok {
+			result.Replies = append(result.Replies, reply)
+			// BSD ping numbers from 0 too, a reply to 0 tells
+			if !strings.Contains(line, "icmp_seq=") || reply.Seq == 0 {
+				zeroBased = true
+			}
+			continue
+		}
+
 		// Parse packet statistics
 		// "4 packets transmitted, 4 received, 0% packet loss, time 3003ms"
+		// "4 packets transmitted, 4 packets received, 0% packet loss" (busybox)
 		if strings.Contains(line, "packets transmitted") {
-			re := regexp.MustCompile(`(\d+) packets transmitted, (\d+) received`)
+			re := regexp.MustCompile(`(\d+) packets transmitted, (\d+) (?:packets )?received`)
 			matches := re.FindStringSubmatch(line)
 			if len(matches) >= 3 {
 				result.Sent, _ = strconv.Atoi(matches[1])
@@ -213,21 +747,17 @@ func parseLinuxPingOutput(output string, result *PingResult) {
 
 		// Parse RTT statistics
 		// "rtt min/avg/max/mdev = 0.035/0.048/0.062/0.011 ms"
-		if strings.Contains(line, "rtt min/avg/max") {
-			re := regexp.MustCompile(`(\d+(?:\.\d+)?)/(\d+(?:\.\d+)?)/(\d+(?:\.\d+)?)/(\d+(?:\.\d+)?)`)
+		// "round-trip min/avg/max = 0.101/0.167/0.234 ms" (busybox)
+		if isRTTSummary(line) {
+			re := regexp.MustCompile(`= *(\d+(?:\.\d+)?)/(\d+(?:\.\d+)?)/(\d+(?:\.\d+)?)(?:/(\d+(?:\.\d+)?))? *([µu]?s|ms)?`)
 			matches := re.FindStringSubmatch(line)
-			if len(matches) >= 5 {
-				if min, err := strconv.ParseFloat(matches[1], 64); err == nil {
-					result.MinRTT = time.Duration(min * float64(time.Millisecond))
-				}
-				if avg, err := strconv.ParseFloat(matches[2], 64); err == nil {
-					result.AvgRTT = time.Duration(avg * float64(time.Millisecond))
-				}
-				if max, err := strconv.ParseFloat(matches[3], 64); err == nil {
-					result.MaxRTT = time.Duration(max * float64(time.Millisecond))
-				}
-				if stddev, err := strconv.ParseFloat(matches[4], 64); err == nil {
-					result.StdDevRTT = time.Duration(stddev * float64(time.Millisecond))
+			if len(matches) >= 6 {
+				unit := matches[5]
+				result.MinRTT = parseRTT(matches[1], unit)
+				result.AvgRTT = parseRTT(matches[2], unit)
+				result.MaxRTT = parseRTT(matches[3], unit)
+				if matches[4] != "" {
+					result.StdDevRTT = parseRTT(matches[4], unit)
 				}
 			}
 		}
@@ -237,6 +767,188 @@ func parseLinuxPingOutput(output string, result *PingResult) {
 	if result.Sent > 0 && result.Lost == 0 {
 		result.Lost = result.Sent - result.Received
 	}
+
+	// iputils ping numbers the requests starting at 1, busybox and BSD at 0
+	if !quiet && result.Sent > 0 && (len(result.Replies) > 0 || result.Received == 0) {
+		sent := make([]int, result.Sent)
+		for i := range sent {
+			sent[i] = i + 1
+			if zeroBased {
+				sent[i] = i
+			}
+		}
+		result.OutOfOrder, result.MissingSeqs = sequenceGaps(sent, result.Replies)
+	}
+}
+
+// parseLinuxPingStderr parses the errors Linux ping prints to standard error
+func parseLinuxPingStderr(stderr string, result *PingResult) {
+	for _, line := range strings.Split(stderr, "\n") {
+		line = strings.TrimSpace(line)
+		// The packet exceeds the MTU of the outgoing interface or a path MTU known to the kernel
+		// "ping: local error: message too long, mtu=1400"
+		if strings.HasPrefix(line, "ping: local error:") {
+			if matches := fragNeededMTURegexp.FindStringSubmatch(strings.ToLower(line)); matches != nil {
+				result.FragmentationNeeded = true
+				result.NextHopMTU, _ = strconv.Atoi(matches[1])
+			}
+		}
+	}
+}
+
+var linuxReplyRegexp = regexp.MustCompile(`^\d+ bytes from (?:\S+ \()?([^):\s]+)\)?:.*?\b(?:icmp_)?seq=(\d+)(?:.*?ttl=(\d+))?(?:.*?time=(\d+(?:\.\d+)?) ?([µu]?s|ms)\b)?`)
+
+// parseLinuxReply parses an echo reply line of Linux ping
+// "64 bytes from 8.8.8.8: icmp_seq=1 ttl=117 time=10.5 ms"
+// "64 bytes from dns.google (8.8.8.8): icmp_seq=1 ttl=117 time=10.5 ms"
+func parseLinuxReply(line string) (PingReply, bool) {
+	matches := linuxReplyRegexp.FindStringSubmatch(line)
+	if len(matches) < 5 {
+		return PingReply{}, false
+	}
+
+	reply := PingReply{
+		From: net.ParseIP(matches[1]),
+	}
+	reply.Seq, _ = strconv.Atoi(matches[2])
+	reply.TTL, _ = strconv.Atoi(matches[3])
+	reply.RTT = parseRTT(matches[4], matches[5])
+	return reply, true
+}
+
+// isRTTSummary reports whether the line is the RTT statistics of Linux or busybox ping
+func isRTTSummary(line string) bool {
+	return strings.HasPrefix(line, "rtt min/avg/max") || strings.HasPrefix(line, "round-trip min/avg/max")
+}
+
+// parseRTT converts a ping time value to a duration, the unit is "ms" (default), "us", "µs" or "s"
+func parseRTT(value, unit string) time.Duration {
+	rtt, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0
+	}
+	switch unit {
+	case "us", "µs":
+		return time.Duration(rtt * float64(time.Microsecond))
+	case "s":
+		return time.Duration(rtt * float64(time.Second))
+	}
+	return time.Duration(rtt * float64(time.Millisecond))
+}
+
+// sequenceGaps compares the sent sequence numbers with the replies in arrival order. It returns the number
+// of replies which arrived after a higher sequence number and the sent sequence numbers never answered.
+func sequenceGaps(sent []int, replies []PingReply) (int, []int) {
+	received := make(map[int]bool)
+	outOfOrder := 0
+	highest := 0
+
+	for _, reply := range replies {
+		if reply.Error != "" || received[reply.Seq] {
+			// Failed probes and duplicates do not count as received
+			continue
+		}
+		received[reply.Seq] = true
+		if reply.Seq < highest {
+			outOfOrder++
+		} else {
+			highest = reply.Seq
+		}
+	}
+
+	var missing []int
+	for _, seq := range sent {
+		if !received[seq] {
+			missing = append(missing, seq)
+		}
+	}
+	return outOfOrder, missing
+}
+
+// addICMPError records an ICMP error, the router reporting an exceeded TTL and the next hop MTU
+// of "fragmentation needed" errors
+func (r *PingResult) addICMPError(icmpErr ICMPError) {
+	r.ICMPErrors = append(r.ICMPErrors, icmpErr)
+
+	errorType := strings.ToLower(icmpErr.Type)
+	if strings.Contains(errorType, "time to live exceeded") || strings.Contains(errorType, "ttl expired") {
+		r.TTLExceededFrom = icmpErr.From
+	}
+	if mtu, ok := parseFragNeeded(icmpErr.Type); ok {
+		r.FragmentationNeeded = true
+		if mtu > 0 {
+			r.NextHopMTU = mtu
+		}
+	}
+}
+
+var fragNeededMTURegexp = regexp.MustCompile(`mtu ?= ?(\d+)`)
+
+// parseFragNeeded reports whether the ICMP error of Linux ping is "fragmentation needed" and returns
+// the next hop MTU, 0 if the router didn't report one
+// "Frag needed and DF set (mtu = 1400)"
+// "Packet too big: mtu=1280" (IPv6)
+func parseFragNeeded(errorType string) (int, bool) {
+	lower := strings.ToLower(errorType)
+	if !strings.HasPrefix(lower, "frag needed") && !strings.HasPrefix(lower, "packet too big") {
+		return 0, false
+	}
+	mtu := 0
+	if matches := fragNeededMTURegexp.FindStringSubmatch(lower); matches != nil {
+		mtu, _ = strconv.Atoi(matches[1])
+	}
+	return mtu, true
+}
+
+var (
+	linuxICMPErrorRegexp   = regexp.MustCompile(`^From (\S+)(?: \(([^)]+)\))?(?: icmp_seq=(\d+))? (.+)$`)
+	windowsICMPErrorRegexp = regexp.MustCompile(`^Reply from ([^:]+): (.+)$`)
+)
+
+// parseLinuxICMPError parses an ICMP error line of Linux ping
+// "From 192.168.1.1 icmp_seq=1 Destination Host Unreachable"
+// "From gateway (192.168.1.1) icmp_seq=1 Destination Host Unreachable"
+func parseLinuxICMPError(line string) (ICMPError, bool) {
+	matches := linuxICMPErrorRegexp.FindStringSubmatch(line)
+	if len(matches) < 5 {
+		return ICMPError{}, false
+	}
+
+	from := matches[1]
+	if matches[2] != "" {
+		from = matches[2]
+	}
+	ip := net.ParseIP(strings.TrimSuffix(from, ":"))
+	if ip == nil {
+		return ICMPError{}, false
+	}
+
+	seq, _ := strconv.Atoi(matches[3])
+	return ICMPError{From: ip, Seq: seq, Type: strings.TrimSpace(matches[4])}, true
+}
+
+// parseWindowsICMPError parses an ICMP error line of Windows ping
+// "Reply from 192.168.1.1: Destination host unreachable."
+func parseWindowsICMPError(line string) (ICMPError, bool) {
+	matches := windowsICMPErrorRegexp.FindStringSubmatch(line)
+	if len(matches) < 3 || strings.Contains(matches[2], "bytes=") {
+		return ICMPError{}, false
+	}
+
+	ip := net.ParseIP(strings.TrimSpace(matches[1]))
+	if ip == nil {
+		return ICMPError{}, false
+	}
+	return ICMPError{From: ip, Type: strings.TrimSuffix(strings.TrimSpace(matches[2]), ".")}, true
+}
+
+// parseRouteHop parses a hop of the record route block which is either "ip" or "name (ip)"
+func parseRouteHop(line string) net.IP {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil
+	}
+	return net.ParseIP(strings.Trim(fields[len(fields)-1], "()"))
 }
 
 // String returns a formatted string representation of ping results
@@ -263,6 +975,10 @@ func (r *PingResult) String() string {
 		}
 	}
 
+	for _, icmpErr := range r.ICMPErrors {
+		result.WriteString(fmt.Sprintf("ICMP error from %s: %s\n", icmpErr.From, icmpErr.Type))
+	}
+
 	if r.Success {
 		result.WriteString("Status: SUCCESS\n")
 	} else {
@@ -270,4 +986,143 @@ func (r *PingResult) String() string {
 	}
 
 	return result.String()
-}
\ No newline at end of file
+}
+
+// ClassicString returns the ping statistics in the layout printed by the Linux ping command,
+// so tools parsing real ping output can consume the result
+func (r *PingResult) ClassicString() string {
+	var result strings.Builder
+
+	result.WriteString(fmt.Sprintf("--- %s ping statistics ---\n", r.Host))
+	result.WriteString(fmt.Sprintf("%d packets transmitted, %d received, %s%% packet loss\n",
+		r.Sent, r.Received, strconv.FormatFloat(r.PacketLoss, 'f', -1, 64)))
+
+	if r.Received > 0 {
+		result.WriteString(fmt.Sprintf("rtt min/avg/max/mdev = %.3f/%.3f/%.3f/%.3f ms\n",
+			durationToMs(r.MinRTT), durationToMs(r.AvgRTT), durationToMs(r.MaxRTT), durationToMs(r.StdDevRTT)))
+	}
+
+	return result.String()
+}
+
+// Summary returns the statistics in one line for logging, such as "8.8.8.8: 4/4 recv, 0% loss, avg 14.6ms".
+// The average is omitted without replies, the error message is appended if set.
+func (r *PingResult) Summary() string {
+	summary := fmt.Sprintf("%s: %d/%d recv, %.3g%% loss", r.Host, r.Received, r.Sent, r.PacketLoss)
+	if r.Received > 0 {
+		summary += fmt.Sprintf(", avg %.1fms", durationToMs(r.AvgRTT))
+	}
+	if r.ErrorMessage != "" {
+		summary += ", error: " + r.ErrorMessage
+	}
+	return summary
+}
+
+// durationToMs converts a duration to fractional milliseconds
+func durationToMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// PingFromFile pings the hosts listed in a file, one host per line. Blank lines and lines starting with # are ignored.
+func PingFromFile(ctx context.Context, path string, options *PingOptions, concurrency int) (map[string]*PingResult, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read host list: %w", err)
+	}
+
+	var hosts []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		hosts = append(hosts, line)
+	}
+
+	return PingHosts(ctx, hosts, options, concurrency)
+}
+
+// SummarizePings returns a table of host, packet loss, average RTT and status sorted by host
+func SummarizePings(results map[string]*PingResult) string {
+	hosts := make([]string, 0, len(results))
+	for host := range results {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	var buf strings.Builder
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "HOST\tLOSS\tAVG RTT\tSTATUS")
+	for _, host := range hosts {
+		result := results[host]
+		if result == nil {
+			fmt.Fprintf(w, "%s\t-\t-\tERROR\n", host)
+			continue
+		}
+
+		loss, avg, status := "-", "-", "OK"
+		if result.Sent > 0 {
+			loss = fmt.Sprintf("%.0f%%", result.PacketLoss)
+		}
+		if result.Received > 0 {
+			avg = fmt.Sprintf("%.2fms", durationToMs(result.AvgRTT))
+		}
+		switch {
+		case result.Sent == 0 && result.ErrorMessage != "":
+			status = "ERROR"
+		case !result.Success:
+			status = "FAIL"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", host, loss, avg, status)
+	}
+	w.Flush()
+	return buf.String()
+}
+
+// SortByLatency returns the hosts ordered by ascending average RTT, unreachable hosts last
+func SortByLatency(results map[string]*PingResult) []string {
+	hosts := make([]string, 0, len(results))
+	for host := range results {
+		hosts = append(hosts, host)
+	}
+
+	reachable := func(host string) bool {
+		return pingReachable(results[host])
+	}
+	sort.Slice(hosts, func(i, j int) bool {
+		a, b := hosts[i], hosts[j]
+		if reachable(a) != reachable(b) {
+			return reachable(a)
+		}
+		if reachable(a) && results[a].AvgRTT != results[b].AvgRTT {
+			return results[a].AvgRTT < results[b].AvgRTT
+		}
+		return a < b
+	})
+	return hosts
+}
+
+// FastestHost returns the reachable host with the lowest average RTT, empty if no host is reachable
+func FastestHost(results map[string]*PingResult) string {
+	hosts := SortByLatency(results)
+	if len(hosts) == 0 || !pingReachable(results[hosts[0]]) {
+		return ""
+	}
+	return hosts[0]
+}
+
+// SlowestHost returns the reachable host with the highest average RTT, empty if no host is reachable
+func SlowestHost(results map[string]*PingResult) string {
+	hosts := SortByLatency(results)
+	for i := len(hosts) - 1; i >= 0; i-- {
+		if pingReachable(results[hosts[i]]) {
+			return hosts[i]
+		}
+	}
+	return ""
+}
+
+// pingReachable reports whether the result has replies
+func pingReachable(result *PingResult) bool {
+	return result != nil && result.Success && result.Received > 0
+}
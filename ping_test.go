@@ -1,8 +1,17 @@
 package network
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -181,7 +190,7 @@ Approximate round trip times in milli-seconds:
 `
 
 	result := &PingResult{Host: "8.8.8.8"}
-	parseWindowsPingOutput(output, result)
+	parseWindowsPingOutput(output, result, false)
 
 	if result.Sent != 4 {
 		t.Errorf("parseWindowsPingOutput() Sent = %v, want 4", result.Sent)
@@ -219,7 +228,7 @@ func TestPingLinuxOutputParsing(t *testing.T) {
 rtt min/avg/max/mdev = 10.5/14.6/20.1/3.5 ms`
 
 	result := &PingResult{Host: "8.8.8.8"}
-	parseLinuxPingOutput(output, result)
+	parseLinuxPingOutput(output, result, false)
 
 	if result.Sent != 4 {
 		t.Errorf("parseLinuxPingOutput() Sent = %v, want 4", result.Sent)
@@ -242,4 +251,780 @@ func BenchmarkPing(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		Ping("127.0.0.1", opts)
 	}
-}
\ No newline at end of file
+}
+
+func TestPingResultClassicString(t *testing.T) {
+	original := &PingResult{
+		Host:       "8.8.8.8",
+		Sent:       4,
+		Received:   3,
+		Lost:       1,
+		PacketLoss: 25,
+		MinRTT:     10500 * time.Microsecond,
+		AvgRTT:     14600 * time.Microsecond,
+		MaxRTT:     20100 * time.Microsecond,
+		StdDevRTT:  3500 * time.Microsecond,
+		Success:    true,
+	}
+
+	str := original.ClassicString()
+	if !strings.Contains(str, "--- 8.8.8.8 ping statistics ---") {
+		t.Errorf("ClassicString() missing statistics header:\n%s", str)
+	}
+
+	// The classic output must be understood by the Linux ping parser
+	parsed := &PingResult{Host: original.Host}
+	parseLinuxPingOutput(str, parsed, false)
+
+	if parsed.Sent != original.Sent || parsed.Received != original.Received || parsed.Lost != original.Lost {
+		t.Errorf("parsed packets = %d/%d/%d, want %d/%d/%d", parsed.Sent, parsed.Received, parsed.Lost,
+			original.Sent, original.Received, original.Lost)
+	}
+	if parsed.PacketLoss != original.PacketLoss {
+		t.Errorf("parsed PacketLoss = %v, want %v", parsed.PacketLoss, original.PacketLoss)
+	}
+	if parsed.MinRTT != original.MinRTT || parsed.AvgRTT != original.AvgRTT ||
+		parsed.MaxRTT != original.MaxRTT || parsed.StdDevRTT != original.StdDevRTT {
+		t.Errorf("parsed RTT = %v/%v/%v/%v, want %v/%v/%v/%v",
+			parsed.MinRTT, parsed.AvgRTT, parsed.MaxRTT, parsed.StdDevRTT,
+			original.MinRTT, original.AvgRTT, original.MaxRTT, original.StdDevRTT)
+	}
+
+	// Without replies the rtt line is omitted, like the real ping command
+	lost := &PingResult{Host: "10.0.0.1", Sent: 2, Lost: 2, PacketLoss: 100}
+	if strings.Contains(lost.ClassicString(), "rtt") {
+		t.Error("ClassicString() should omit rtt line when nothing was received")
+	}
+}
+
+func TestPingResultSummary(t *testing.T) {
+	tests := []struct {
+		result *PingResult
+		want   string
+	}{
+		{
+			result: &PingResult{Host: "8.8.8.8", Sent: 4, Received: 4, AvgRTT: 14600 * time.Microsecond, Success: true},
+			want:   "8.8.8.8: 4/4 recv, 0% loss, avg 14.6ms",
+		},
+		{
+			result: &PingResult{Host: "10.0.0.1", Sent: 3, Received: 2, Lost: 1, PacketLoss: 100.0 / 3, AvgRTT: 2 * time.Millisecond},
+			want:   "10.0.0.1: 2/3 recv, 33.3% loss, avg 2.0ms",
+		},
+		{
+			result: &PingResult{Host: "10.0.0.2", Sent: 2, Lost: 2, PacketLoss: 100, ErrorMessage: "host unreachable"},
+			want:   "10.0.0.2: 0/2 recv, 100% loss, error: host unreachable",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := tt.result.Summary(); got != tt.want {
+			t.Errorf("Summary() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestPingLinuxRecordRouteParsing(t *testing.T) {
+	output := "PING 8.8.8.8 (8.8.8.8) 56(124) bytes of data.\n" +
+		"64 bytes from 8.8.8.8: icmp_seq=1 ttl=117 time=10.5 ms\n" +
+		"RR: \t192.168.1.10\n" +
+		"\tgw.example.net (10.0.0.1)\n" +
+		"\t72.14.0.1\n" +
+		"\t8.8.8.8\n" +
+		"\t192.168.1.10\n" +
+		"\n" +
+		"64 bytes from 8.8.8.8: icmp_seq=2 ttl=117 time=10.8 ms\t(same route)\n" +
+		"\n" +
+		"--- 8.8.8.8 ping statistics ---\n" +
+		"2 packets transmitted, 2 received, 0% packet loss, time 1001ms\n" +
+		"rtt min/avg/max/mdev = 10.5/10.6/10.8/0.1 ms\n"
+
+	result := &PingResult{Host: "8.8.8.8"}
+	parseLinuxPingOutput(output, result, false)
+
+	want := []string{"192.168.1.10", "10.0.0.1", "72.14.0.1", "8.8.8.8", "192.168.1.10"}
+	if len(result.RecordedRoute) != len(want) {
+		t.Fatalf("RecordedRoute = %v, want %v", result.RecordedRoute, want)
+	}
+	for i, ip := range want {
+		if result.RecordedRoute[i].String() != ip {
+			t.Errorf("RecordedRoute[%d] = %v, want %s", i, result.RecordedRoute[i], ip)
+		}
+	}
+	if result.Sent != 2 || result.Received != 2 {
+		t.Errorf("Sent/Received = %d/%d, want 2/2", result.Sent, result.Received)
+	}
+}
+
+func TestPingICMPErrorParsing(t *testing.T) {
+	linux := `PING 192.168.1.50 (192.168.1.50) 56(84) bytes of data.
+From 192.168.1.10 icmp_seq=1 Destination Host Unreachable
+From gateway (192.168.1.1) icmp_seq=2 Destination Net Unreachable
+
+--- 192.168.1.50 ping statistics ---
+2 packets transmitted, 0 received, +2 errors, 100% packet loss, time 1001ms`
+
+	result := &PingResult{Host: "192.168.1.50"}
+	parseLinuxPingOutput(linux, result, false)
+
+	if len(result.ICMPErrors) != 2 {
+		t.Fatalf("parseLinuxPingOutput() ICMPErrors = %v, want 2 entries", result.ICMPErrors)
+	}
+	first, second := result.ICMPErrors[0], result.ICMPErrors[1]
+	if first.From.String() != "192.168.1.10" || first.Seq != 1 || first.Type != "Destination Host Unreachable" {
+		t.Errorf("unexpected first ICMP error: %+v", first)
+	}
+	if second.From.String() != "192.168.1.1" || second.Seq != 2 || second.Type != "Destination Net Unreachable" {
+		t.Errorf("unexpected second ICMP error: %+v", second)
+	}
+	if result.Sent != 2 || result.Received != 0 {
+		t.Errorf("Sent/Received = %d/%d, want 2/0", result.Sent, result.Received)
+	}
+
+	windows := "Pinging 192.168.1.50 with 32 bytes of data:\r\n" +
+		"Reply from 192.168.1.10: Destination host unreachable.\r\n" +
+		"Reply from 192.168.1.10: Destination host unreachable.\r\n" +
+		"\r\n" +
+		"Ping statistics for 192.168.1.50:\r\n" +
+		"    Packets: Sent = 2, Received = 2, Lost = 0 (0% loss),\r\n"
+
+	result = &PingResult{Host: "192.168.1.50"}
+	parseWindowsPingOutput(windows, result, false)
+
+	if len(result.ICMPErrors) != 2 || result.ICMPErrors[0].Type != "Destination host unreachable" {
+		t.Fatalf("parseWindowsPingOutput() ICMPErrors = %+v", result.ICMPErrors)
+	}
+	// Windows reports error replies as received packets
+	if result.Received != 0 || result.Lost != 2 {
+		t.Errorf("Received/Lost = %d/%d, want 0/2", result.Received, result.Lost)
+	}
+}
+
+func TestPingTotalLossParsing(t *testing.T) {
+	exitErr := errors.New("exit status 1")
+	tests := []struct {
+		name   string
+		output string
+	}{
+		{"iputils", `PING 192.0.2.1 (192.0.2.1) 56(84) bytes of data.
+
+--- 192.0.2.1 ping statistics ---
+4 packets transmitted, 0 received, 100% packet loss, time 3062ms
+`},
+		{"busybox", `PING 192.0.2.1 (192.0.2.1): 56 data bytes
+
+--- 192.0.2.1 ping statistics ---
+4 packets transmitted, 0 packets received, 100% packet loss
+`},
+	}
+	for _, tt := range tests {
+		result := &PingResult{Host: "192.0.2.1"}
+		parseLinuxPingOutput(tt.output, result, false)
+		finishCommandResult(result, exitErr, nil)
+		if result.Success || result.ErrorMessage != "" {
+			t.Errorf("%s: Success/ErrorMessage = %v/%q, want false/\"\"", tt.name, result.Success, result.ErrorMessage)
+		}
+		if result.Sent != 4 || result.Received != 0 || result.Lost != 4 || result.PacketLoss != 100 {
+			t.Errorf("%s: Sent/Received/Lost/PacketLoss = %d/%d/%d/%v, want 4/0/4/100", tt.name,
+				result.Sent, result.Received, result.Lost, result.PacketLoss)
+		}
+		if result.AvgRTT != 0 || len(result.Replies) != 0 {
+			t.Errorf("%s: AvgRTT/Replies = %v/%d, want 0/0", tt.name, result.AvgRTT, len(result.Replies))
+		}
+	}
+
+	windows := "Pinging 192.0.2.1 with 32 bytes of data:\r\n" +
+		"Request timed out.\r\n" +
+		"Request timed out.\r\n" +
+		"\r\n" +
+		"Ping statistics for 192.0.2.1:\r\n" +
+		"    Packets: Sent = 2, Received = 0, Lost = 2 (100% loss),\r\n"
+	result := &PingResult{Host: "192.0.2.1"}
+	parseWindowsPingOutput(windows, result, false)
+	finishCommandResult(result, exitErr, nil)
+	if result.Success || result.ErrorMessage != "" || result.PacketLoss != 100 || result.Received != 0 {
+		t.Errorf("windows: unexpected result %+v", result)
+	}
+
+	// Without statistics or with a complaint on standard error ping failed
+	result = &PingResult{Host: "192.0.2.1"}
+	finishCommandResult(result, exitErr, nil)
+	if result.ErrorMessage == "" {
+		t.Error("finishCommandResult() without statistics should set ErrorMessage")
+	}
+	result = &PingResult{Host: "192.0.2.1"}
+	parseLinuxPingOutput(tests[0].output, result, false)
+	finishCommandResult(result, exitErr, []byte("ping: sendmsg: Network is unreachable\n"))
+	if result.ErrorMessage == "" || result.PacketLoss != 100 {
+		t.Errorf("finishCommandResult() with stderr: ErrorMessage/PacketLoss = %q/%v", result.ErrorMessage, result.PacketLoss)
+	}
+}
+
+func TestPingFragNeededParsing(t *testing.T) {
+	linux := `PING 198.51.100.1 (198.51.100.1) 1472(1500) bytes of data.
+From 192.0.2.1 icmp_seq=1 Frag needed and DF set (mtu = 1400)
+
+--- 198.51.100.1 ping statistics ---
+2 packets transmitted, 0 received, +1 errors, 100% packet loss, time 1001ms`
+
+	result := &PingResult{Host: "198.51.100.1"}
+	parseLinuxPingOutput(linux, result, false)
+	if !result.FragmentationNeeded || result.NextHopMTU != 1400 {
+		t.Errorf("FragmentationNeeded/NextHopMTU = %v/%d, want true/1400", result.FragmentationNeeded, result.NextHopMTU)
+	}
+	if len(result.ICMPErrors) != 1 || result.ICMPErrors[0].From.String() != "192.0.2.1" {
+		t.Errorf("ICMPErrors = %+v", result.ICMPErrors)
+	}
+
+	// Local errors are printed to standard error
+	result = &PingResult{Host: "198.51.100.1"}
+	parseLinuxPingStderr("ping: local error: message too long, mtu=1280\n", result)
+	if !result.FragmentationNeeded || result.NextHopMTU != 1280 {
+		t.Errorf("FragmentationNeeded/NextHopMTU = %v/%d, want true/1280", result.FragmentationNeeded, result.NextHopMTU)
+	}
+
+	tests := []struct {
+		errorType string
+		mtu       int
+		ok        bool
+	}{
+		{"Frag needed and DF set (mtu = 1400)", 1400, true},
+		{"frag needed and DF set", 0, true},
+		{"Packet too big: mtu=1280", 1280, true},
+		{"Destination Host Unreachable", 0, false},
+	}
+	for _, tt := range tests {
+		if mtu, ok := parseFragNeeded(tt.errorType); mtu != tt.mtu || ok != tt.ok {
+			t.Errorf("parseFragNeeded(%q) = %d, %v, want %d, %v", tt.errorType, mtu, ok, tt.mtu, tt.ok)
+		}
+	}
+
+	windows := "Pinging 198.51.100.1 with 1472 bytes of data:\r\n" +
+		"Packet needs to be fragmented but DF set.\r\n" +
+		"Packet needs to be fragmented but DF set.\r\n" +
+		"\r\n" +
+		"Ping statistics for 198.51.100.1:\r\n" +
+		"    Packets: Sent = 2, Received = 0, Lost = 2 (100% loss),\r\n"
+
+	result = &PingResult{Host: "198.51.100.1"}
+	parseWindowsPingOutput(windows, result, false)
+	if !result.FragmentationNeeded || result.NextHopMTU != 0 {
+		t.Errorf("FragmentationNeeded/NextHopMTU = %v/%d, want true/0", result.FragmentationNeeded, result.NextHopMTU)
+	}
+	if result.Lost != 2 {
+		t.Errorf("Lost = %d, want 2", result.Lost)
+	}
+}
+
+func TestRunPingCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+	cmd := command(context.Background(), "sh", "-c", "echo '1 packets transmitted, 0 received'; echo 'ping: socket: Operation not permitted' >&2; exit 2")
+	output, stderr, err := runPingCommand(cmd)
+	if strings.Contains(string(output), "socket") || !strings.Contains(string(output), "packets transmitted") {
+		t.Errorf("output = %q", output)
+	}
+
+	err = pingCommandError(err, stderr)
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || !strings.HasSuffix(err.Error(), ": ping: socket: Operation not permitted") {
+		t.Errorf("pingCommandError() = %v", err)
+	}
+	if err := pingCommandError(nil, stderr); err != nil {
+		t.Errorf("pingCommandError(nil) = %v, want nil", err)
+	}
+}
+
+func TestSelectIPVersion(t *testing.T) {
+	original := lookupIPAddr
+	defer func() { lookupIPAddr = original }()
+
+	lookupIPAddr = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		switch host {
+		case "v4only.example.com":
+			return []net.IPAddr{{IP: net.ParseIP("192.0.2.1")}}, nil
+		case "v6only.example.com":
+			return []net.IPAddr{{IP: net.ParseIP("2001:db8::1")}}, nil
+		case "dual.example.com":
+			return []net.IPAddr{{IP: net.ParseIP("2001:db8::1")}, {IP: net.ParseIP("192.0.2.1")}}, nil
+		}
+		return nil, fmt.Errorf("no such host")
+	}
+
+	tests := []struct {
+		host    string
+		version int
+		want    int
+		wantErr string
+	}{
+		{host: "v6only.example.com", version: IPVersionAuto, want: IPVersion6},
+		{host: "v4only.example.com", version: IPVersionAuto, want: IPVersionAuto},
+		{host: "dual.example.com", version: IPVersionAuto, want: IPVersionAuto},
+		{host: "dual.example.com", version: IPVersion6, want: IPVersion6},
+		{host: "v4only.example.com", version: IPVersion4, want: IPVersion4},
+		{host: "v4only.example.com", version: IPVersion6, wantErr: "no AAAA records"},
+		{host: "v6only.example.com", version: IPVersion4, wantErr: "no A records"},
+		{host: "unknown.example.com", version: IPVersionAuto, want: IPVersionAuto},
+		{host: "127.0.0.1", version: IPVersionAuto, want: IPVersionAuto},
+		{host: "::1", version: IPVersion6, want: IPVersion6},
+		{host: "::1", version: IPVersion4, wantErr: "cannot ping IPv6 address"},
+		{host: "127.0.0.1", version: 5, wantErr: "invalid IP version"},
+	}
+
+	for _, tt := range tests {
+		got, err := selectIPVersion(context.Background(), tt.host, tt.version, "")
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("selectIPVersion(%s, %d) error = %v, want %q", tt.host, tt.version, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("selectIPVersion(%s, %d) = %d, %v, want %d", tt.host, tt.version, got, err, tt.want)
+		}
+	}
+
+	if _, err := Ping("v4only.example.com", &PingOptions{IPVersion: IPVersion6}); err == nil {
+		t.Error("Ping() expected error for IPv6 ping of IPv4-only host")
+	}
+}
+
+func TestPingSequenceGaps(t *testing.T) {
+	// Reply 2 arrives late after reply 3, reply 4 is lost and reply 1 is duplicated
+	output := `PING 10.0.0.1 (10.0.0.1) 56(84) bytes of data.
+64 bytes from 10.0.0.1: icmp_seq=1 ttl=64 time=0.512 ms
+64 bytes from 10.0.0.1: icmp_seq=1 ttl=64 time=0.601 ms (DUP!)
+64 bytes from 10.0.0.1: icmp_seq=3 ttl=64 time=0.488 ms
+64 bytes from 10.0.0.1: icmp_seq=2 ttl=64 time=1520 ms
+64 bytes from 10.0.0.1: icmp_seq=5 ttl=64 time=0.470 ms
+
+--- 10.0.0.1 ping statistics ---
+5 packets transmitted, 4 received, +1 duplicates, 20% packet loss, time 4005ms
+rtt min/avg/max/mdev = 0.470/380.492/1520.000/658.004 ms`
+
+	result := &PingResult{Host: "10.0.0.1"}
+	parseLinuxPingOutput(output, result, false)
+
+	if len(result.Replies) != 5 {
+		t.Fatalf("parseLinuxPingOutput() parsed %d replies, want 5", len(result.Replies))
+	}
+	if reply := result.Replies[3]; reply.Seq != 2 || reply.TTL != 64 || reply.RTT != 1520*time.Millisecond || !reply.From.Equal(net.ParseIP("10.0.0.1")) {
+		t.Errorf("unexpected reply: %+v", reply)
+	}
+	if result.OutOfOrder != 1 {
+		t.Errorf("OutOfOrder = %d, want 1", result.OutOfOrder)
+	}
+	if len(result.MissingSeqs) != 1 || result.MissingSeqs[0] != 4 {
+		t.Errorf("MissingSeqs = %v, want [4]", result.MissingSeqs)
+	}
+
+	outOfOrder, missing := sequenceGaps([]int{1, 2, 3}, []PingReply{{Seq: 3}, {Seq: 1}, {Seq: 2, Error: "timeout"}})
+	if outOfOrder != 1 || len(missing) != 1 || missing[0] != 2 {
+		t.Errorf("sequenceGaps() = %d, %v, want 1, [2]", outOfOrder, missing)
+	}
+}
+
+func TestPingTTLExceededParsing(t *testing.T) {
+	linux := `PING 8.8.8.8 (8.8.8.8) 56(84) bytes of data.
+From 10.0.0.1 icmp_seq=1 Time to live exceeded
+
+--- 8.8.8.8 ping statistics ---
+1 packets transmitted, 0 received, +1 errors, 100% packet loss, time 0ms`
+
+	result := &PingResult{Host: "8.8.8.8"}
+	parseLinuxPingOutput(linux, result, false)
+	if !result.TTLExceededFrom.Equal(net.ParseIP("10.0.0.1")) {
+		t.Errorf("parseLinuxPingOutput() TTLExceededFrom = %v, want 10.0.0.1", result.TTLExceededFrom)
+	}
+
+	windows := "Pinging 8.8.8.8 with 32 bytes of data:\r\n" +
+		"Reply from 10.0.0.254: TTL expired in transit.\r\n" +
+		"\r\n" +
+		"Ping statistics for 8.8.8.8:\r\n" +
+		"    Packets: Sent = 1, Received = 1, Lost = 0 (0% loss),\r\n"
+
+	result = &PingResult{Host: "8.8.8.8"}
+	parseWindowsPingOutput(windows, result, false)
+	if !result.TTLExceededFrom.Equal(net.ParseIP("10.0.0.254")) {
+		t.Errorf("parseWindowsPingOutput() TTLExceededFrom = %v, want 10.0.0.254", result.TTLExceededFrom)
+	}
+
+	if _, err := Ping("127.0.0.1", &PingOptions{TTL: 256}); err == nil {
+		t.Error("Ping() expected error for invalid TTL")
+	}
+}
+
+func TestPingFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts.txt")
+	content := "# routers\n192.0.2.1\n\n  192.0.2.2  \n# 192.0.2.3\n192.0.2.1\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// An invalid IP version fails before ping is executed
+	options := &PingOptions{IPVersion: 5}
+	results, err := PingFromFile(context.Background(), path, options, 2)
+	if err != nil {
+		t.Fatalf("PingFromFile() error = %v", err)
+	}
+	if len(results) != 2 || results["192.0.2.1"] == nil || results["192.0.2.2"] == nil {
+		t.Fatalf("PingFromFile() results = %v", results)
+	}
+	if results["192.0.2.2"].ErrorMessage == "" {
+		t.Error("expected ErrorMessage for failed host")
+	}
+
+	if _, err := PingFromFile(context.Background(), filepath.Join(t.TempDir(), "missing"), nil, 1); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
+
+func TestPingHostsCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	results, err := PingHosts(ctx, []string{"192.0.2.1", "192.0.2.2"}, nil, 1)
+	if err != context.Canceled {
+		t.Errorf("PingHosts() error = %v, want context.Canceled", err)
+	}
+	if len(results) != 0 {
+		t.Errorf("PingHosts() results = %v, want none", results)
+	}
+}
+
+func TestForEachHost(t *testing.T) {
+	var mu sync.Mutex
+	running, peak := 0, 0
+	var done []string
+	forEachHost(context.Background(), []string{"a", "b", "a", "c", "d", "b"}, 2, func(host string) {
+		mu.Lock()
+		running++
+		if running > peak {
+			peak = running
+		}
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		running--
+		done = append(done, host)
+		mu.Unlock()
+	})
+	sort.Strings(done)
+	if strings.Join(done, ",") != "a,b,c,d" {
+		t.Errorf("forEachHost() ran %v, want every host once", done)
+	}
+	if peak != 2 {
+		t.Errorf("forEachHost() ran %d hosts at once, want 2", peak)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	forEachHost(ctx, []string{"a"}, 1, func(host string) {
+		t.Errorf("forEachHost() ran %s after the context was done", host)
+	})
+}
+
+func TestSummarizePings(t *testing.T) {
+	results := map[string]*PingResult{
+		"b.example.com": {Host: "b.example.com", Sent: 4, Received: 0, PacketLoss: 100},
+		"a.example.com": {Host: "a.example.com", Sent: 4, Received: 3, PacketLoss: 25, AvgRTT: 1500 * time.Microsecond, Success: true},
+		"c.example.com": {Host: "c.example.com", ErrorMessage: "invalid IP version 5"},
+	}
+
+	lines := strings.Split(strings.TrimSpace(SummarizePings(results)), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("SummarizePings() lines = %q", lines)
+	}
+	expected := [][]string{
+		{"HOST", "LOSS", "AVG", "RTT", "STATUS"},
+		{"a.example.com", "25%", "1.50ms", "OK"},
+		{"b.example.com", "100%", "-", "FAIL"},
+		{"c.example.com", "-", "-", "ERROR"},
+	}
+	for i, want := range expected {
+		if got := strings.Fields(lines[i]); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("line %d = %q, want %q", i, got, want)
+		}
+	}
+}
+
+func TestPingPatternParsing(t *testing.T) {
+	output := `PATTERN: 0xabcd
+PING 192.0.2.1 (192.0.2.1) 56(84) bytes of data.
+64 bytes from 192.0.2.1: icmp_seq=1 ttl=64 time=1.10 ms
+64 bytes from 192.0.2.1: icmp_seq=2 ttl=64 time=1.20 ms
+wrong data byte #12 should be 0xab but was 0x0
+#8	ab cd ab cd 0 0 0 0
+64 bytes from 192.0.2.1: icmp_seq=3 ttl=64 time=1.30 ms
+
+--- 192.0.2.1 ping statistics ---
+3 packets transmitted, 3 received, 0% packet loss, time 2003ms
+rtt min/avg/max/mdev = 1.100/1.200/1.300/0.081 ms`
+
+	result := &PingResult{}
+	parseLinuxPingOutput(output, result, false)
+	if result.Corrupted != 1 {
+		t.Errorf("Corrupted = %d, want 1", result.Corrupted)
+	}
+	if result.Received != 3 {
+		t.Errorf("Received = %d, want 3", result.Received)
+	}
+}
+
+func TestPingPatternTooLong(t *testing.T) {
+	_, err := Ping("127.0.0.1", &PingOptions{Pattern: make([]byte, 17)})
+	if err == nil {
+		t.Error("expected error for pattern longer than 16 bytes")
+	}
+}
+
+func TestSortByLatency(t *testing.T) {
+	results := map[string]*PingResult{
+		"slow":     {Success: true, Received: 4, AvgRTT: 80 * time.Millisecond},
+		"fast":     {Success: true, Received: 4, AvgRTT: 5 * time.Millisecond},
+		"medium":   {Success: true, Received: 2, AvgRTT: 20 * time.Millisecond},
+		"down":     {Success: false, Sent: 4},
+		"errored":  nil,
+		"medium-2": {Success: true, Received: 4, AvgRTT: 20 * time.Millisecond},
+	}
+
+	got := strings.Join(SortByLatency(results), ",")
+	want := "fast,medium,medium-2,slow,down,errored"
+	if got != want {
+		t.Errorf("SortByLatency() = %s, want %s", got, want)
+	}
+
+	if host := FastestHost(results); host != "fast" {
+		t.Errorf("FastestHost() = %q, want fast", host)
+	}
+	if host := SlowestHost(results); host != "slow" {
+		t.Errorf("SlowestHost() = %q, want slow", host)
+	}
+
+	unreachable := map[string]*PingResult{"down": {Sent: 4}, "errored": nil}
+	if host := FastestHost(unreachable); host != "" {
+		t.Errorf("FastestHost() = %q, want empty", host)
+	}
+	if host := SlowestHost(unreachable); host != "" {
+		t.Errorf("SlowestHost() = %q, want empty", host)
+	}
+}
+
+func TestPingQuietParsing(t *testing.T) {
+	linux := `PING 192.0.2.1 (192.0.2.1) 56(84) bytes of data.
+64 bytes from 192.0.2.1: icmp_seq=1 ttl=64 time=1.10 ms
+64 bytes from 192.0.2.1: icmp_seq=2 ttl=64 time=1.30 ms
+
+--- 192.0.2.1 ping statistics ---
+2 packets transmitted, 2 received, 0% packet loss, time 1001ms
+rtt min/avg/max/mdev = 1.100/1.200/1.300/0.100 ms`
+
+	result := &PingResult{}
+	parseLinuxPingOutput(linux, result, true)
+	if result.Sent != 2 || result.Received != 2 || result.AvgRTT != 1200*time.Microsecond {
+		t.Errorf("parseLinuxPingOutput(quiet) = %+v", result)
+	}
+	if len(result.Replies) != 0 || result.MissingSeqs != nil {
+		t.Errorf("parseLinuxPingOutput(quiet) collected replies %v", result.Replies)
+	}
+
+	windows := `Pinging 192.0.2.1 with 32 bytes of data:
+Reply from 192.0.2.1: bytes=32 time=10ms TTL=64
+Reply from 192.0.2.1: bytes=32 time=12ms TTL=64
+
+Ping statistics for 192.0.2.1:
+    Packets: Sent = 2, Received = 2, Lost = 0 (0% loss),
+Approximate round trip times in milli-seconds:
+    Minimum = 10ms, Maximum = 12ms, Average = 11ms`
+
+	result = &PingResult{}
+	parseWindowsPingOutput(windows, result, true)
+	if result.Sent != 2 || result.Received != 2 || result.AvgRTT != 11*time.Millisecond {
+		t.Errorf("parseWindowsPingOutput(quiet) = %+v", result)
+	}
+
+	// Windows counts unreachable replies as received, they must be subtracted in quiet mode too
+	unreachable := `Pinging 192.0.2.1 with 32 bytes of data:
+Reply from 192.168.1.1: Destination host unreachable.
+Reply from 192.168.1.1: Destination host unreachable.
+
+Ping statistics for 192.0.2.1:
+    Packets: Sent = 2, Received = 2, Lost = 0 (0% loss),`
+
+	result = &PingResult{}
+	parseWindowsPingOutput(unreachable, result, true)
+	finishCommandResult(result, nil, nil)
+	if result.Received != 0 || result.Lost != 2 || result.Success || len(result.ICMPErrors) != 2 {
+		t.Errorf("parseWindowsPingOutput(quiet, unreachable) = %+v", result)
+	}
+}
+
+func TestPingBusyboxParsing(t *testing.T) {
+	output := `PING 127.0.0.1 (127.0.0.1): 56 data bytes
+64 bytes from 127.0.0.1: seq=0 ttl=64 time=0.234 ms
+64 bytes from 127.0.0.1: seq=2 ttl=64 time=0.101 ms
+
+--- 127.0.0.1 ping statistics ---
+3 packets transmitted, 2 packets received, 33% packet loss
+round-trip min/avg/max = 0.101/0.167/0.234 ms`
+
+	result := &PingResult{}
+	parseLinuxPingOutput(output, result, false)
+	if result.Sent != 3 || result.Received != 2 || result.Lost != 1 || result.PacketLoss != 33 {
+		t.Errorf("parseLinuxPingOutput(busybox) counts = %+v", result)
+	}
+	if result.MinRTT != 101*time.Microsecond || result.AvgRTT != 167*time.Microsecond || result.MaxRTT != 234*time.Microsecond {
+		t.Errorf("parseLinuxPingOutput(busybox) RTT = %v/%v/%v", result.MinRTT, result.AvgRTT, result.MaxRTT)
+	}
+	if len(result.Replies) != 2 || result.Replies[0].Seq != 0 || result.Replies[0].RTT != 234*time.Microsecond || result.Replies[1].TTL != 64 {
+		t.Errorf("parseLinuxPingOutput(busybox) replies = %+v", result.Replies)
+	}
+	if len(result.MissingSeqs) != 1 || result.MissingSeqs[0] != 1 {
+		t.Errorf("parseLinuxPingOutput(busybox) MissingSeqs = %v, want [1]", result.MissingSeqs)
+	}
+
+	result = &PingResult{}
+	parseLinuxPingOutput(output, result, true)
+	if result.Sent != 3 || result.AvgRTT != 167*time.Microsecond {
+		t.Errorf("parseLinuxPingOutput(busybox quiet) = %+v", result)
+	}
+}
+
+func TestPingRTTUnits(t *testing.T) {
+	tests := []struct {
+		line string
+		want time.Duration
+	}{
+		{"64 bytes from 10.0.0.1: icmp_seq=1 ttl=64 time=0.045 ms", 45 * time.Microsecond},
+		{"64 bytes from 10.0.0.1: icmp_seq=1 ttl=64 time=45 us", 45 * time.Microsecond},
+		{"64 bytes from 10.0.0.1: icmp_seq=1 ttl=64 time=45µs", 45 * time.Microsecond},
+		{"64 bytes from 10.0.0.1: icmp_seq=1 ttl=64 time=12.5ms", 12500 * time.Microsecond},
+		{"64 bytes from 10.0.0.1: icmp_seq=1 ttl=64 time=1.5 s", 1500 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		reply, ok := parseLinuxReply(tt.line)
+		if !ok || reply.RTT != tt.want || reply.Seq != 1 {
+			t.Errorf("parseLinuxReply(%q) = %+v, %v, want RTT %v", tt.line, reply, ok, tt.want)
+		}
+	}
+
+	result := &PingResult{}
+	parseLinuxPingOutput("rtt min/avg/max/mdev = 45/50/55/5 us", result, false)
+	if result.MinRTT != 45*time.Microsecond || result.StdDevRTT != 5*time.Microsecond {
+		t.Errorf("parseLinuxPingOutput(us summary) = %+v", result)
+	}
+}
+
+func TestClassifyPingVariant(t *testing.T) {
+	tests := []struct {
+		output, goos, want string
+	}{
+		{"ping from iputils 20211215", "linux", PingVariantIputils},
+		{"ping utility, iputils-s20161105", "linux", PingVariantIputils},
+		{"ping: invalid option -- 'V'\nBusyBox v1.36.1 (2023-07-27) multi-call binary.", "linux", PingVariantBusybox},
+		{"ping: illegal option -- V\nusage: ping [-AaDdfnoQqRrv] ...", "darwin", PingVariantBSD},
+		{"", "freebsd", PingVariantBSD},
+		{"exec: \"ping\": executable file not found in $PATH", "linux", PingVariantUnknown},
+	}
+	for _, tt := range tests {
+		if got := classifyPingVariant(tt.output, tt.goos); got != tt.want {
+			t.Errorf("classifyPingVariant(%q, %s) = %s, want %s", tt.output, tt.goos, got, tt.want)
+		}
+	}
+
+	if first, second := PingVariant(), PingVariant(); first == "" || first != second {
+		t.Errorf("PingVariant() = %q then %q", first, second)
+	}
+}
+
+func TestPingArgs(t *testing.T) {
+	options := &PingOptions{Count: 3, Timeout: 2 * time.Second, Size: 56, TTL: 10, Pattern: []byte{0xab}, Quiet: true}
+
+	tests := []struct {
+		variant string
+		version int
+		want    string
+	}{
+		{PingVariantIputils, IPVersion6, "-c 3 -W 2 -s 56 -6 -t 10 -p ab -q"},
+		{PingVariantBusybox, IPVersion4, "-c 3 -W 2 -s 56 -4 -t 10 -p ab -q"},
+		{PingVariantBSD, IPVersion6, "-c 3 -W 2000 -s 56 -m 10 -p ab -q"},
+		{PingVariantUnknown, IPVersion4, "-c 3"},
+	}
+	for _, tt := range tests {
+		args, err := pingArgs(tt.variant, options, tt.version)
+		if err != nil {
+			t.Errorf("pingArgs(%s) error = %v", tt.variant, err)
+			continue
+		}
+		if got := strings.Join(args, " "); got != tt.want {
+			t.Errorf("pingArgs(%s) = %q, want %q", tt.variant, got, tt.want)
+		}
+	}
+
+	if _, err := pingArgs(PingVariantBusybox, &PingOptions{Count: 1, RecordRoute: true}, IPVersionAuto); err == nil {
+		t.Error("pingArgs(busybox) expected error for record route")
+	}
+	if _, err := pingArgs(PingVariantBusybox, &PingOptions{Count: 1, Pattern: []byte{1, 2}}, IPVersionAuto); err == nil {
+		t.Error("pingArgs(busybox) expected error for multi-byte pattern")
+	}
+	if args, err := pingArgs(PingVariantBSD, &PingOptions{Count: 1, RecordRoute: true}, IPVersionAuto); err != nil || !strings.Contains(strings.Join(args, " "), "-R") {
+		t.Errorf("pingArgs(bsd, RecordRoute) = %v, %v", args, err)
+	}
+}
+
+func TestPingArgsAdaptive(t *testing.T) {
+	options := &PingOptions{Count: 10, Timeout: time.Second, Size: 56, Adaptive: true}
+	args, err := pingArgs(PingVariantIputils, options, IPVersionAuto)
+	if err != nil || strings.Join(args, " ") != "-c 10 -W 1 -s 56 -A" {
+		t.Errorf("pingArgs(iputils, Adaptive) = %v, %v", args, err)
+	}
+	for _, variant := range []string{PingVariantBusybox, PingVariantBSD} {
+		if _, err := pingArgs(variant, options, IPVersionAuto); err == nil {
+			t.Errorf("pingArgs(%s) expected error for adaptive interval", variant)
+		}
+	}
+
+	options.Adaptive = false
+	if args, _ := pingArgs(PingVariantIputils, options, IPVersionAuto); strings.Contains(strings.Join(args, " "), "-A") {
+		t.Errorf("pingArgs() passed -A without Adaptive: %v", args)
+	}
+}
+
+func TestPingNativeAdaptive(t *testing.T) {
+	if !CanRawSocket() {
+		t.Skip("raw ICMP sockets are not permitted")
+	}
+	start := time.Now()
+	result, err := PingContext(context.Background(), "127.0.0.1", &PingOptions{Count: 5, Native: true, Adaptive: true})
+	if err != nil {
+		t.Fatalf("PingContext() error = %v", err)
+	}
+	if result.Received != 5 {
+		t.Errorf("Received = %d, want 5", result.Received)
+	}
+	// Without the adaptive mode the requests are a second apart
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("adaptive ping took %v", elapsed)
+	}
+}
+
+func TestPingArgsDSCP(t *testing.T) {
+	options := &PingOptions{Count: 1, Timeout: time.Second, Size: 56, DSCP: 46}
+	tests := map[string]string{
+		PingVariantIputils: "-Q 184",
+		PingVariantBSD:     "-z 184",
+	}
+	for variant, want := range tests {
+		args, err := pingArgs(variant, options, IPVersionAuto)
+		if err != nil || !strings.Contains(strings.Join(args, " "), want) {
+			t.Errorf("pingArgs(%s, DSCP) = %v, %v, want %q", variant, args, err, want)
+		}
+	}
+	if _, err := pingArgs(PingVariantBusybox, options, IPVersionAuto); err == nil {
+		t.Error("pingArgs(busybox) expected error for DSCP")
+	}
+
+	if _, err := PingContext(context.Background(), "127.0.0.1", &PingOptions{DSCP: 64}); err == nil {
+		t.Error("PingContext() accepted DSCP 64")
+	}
+}
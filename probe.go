@@ -0,0 +1,264 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// LatencyProbe sends echo requests at a fixed rate on one persistent ICMP socket and streams the replies,
+// suited for high-frequency probing (100+ requests per second) where ping processes are too expensive.
+// The zero value is ready to use, a probe can be started again after it stopped.
+type LatencyProbe struct {
+	Timeout time.Duration // Time a reply is waited for before the request counts as lost (default: 1s)
+	Size    int           // Payload size in bytes (default: 56)
+
+	mu      sync.Mutex
+	running bool
+	cancel  context.CancelFunc
+	done    chan struct{}
+	stats   ProbeStats
+	rttSum  time.Duration
+}
+
+// ProbeStats holds the running statistics of a LatencyProbe
+type ProbeStats struct {
+	Sent     int
+	Received int
+	Lost     int // Requests without a reply within the timeout
+	Dropped  int // Replies not delivered because the channel was full
+	MinRTT   time.Duration
+	MaxRTT   time.Duration
+	AvgRTT   time.Duration
+	LastRTT  time.Duration
+}
+
+// probeBuffer is the capacity of the reply channel of a LatencyProbe
+const probeBuffer = 1024
+
+// Start resolves the host, opens the ICMP socket and sends an echo request every interval until the
+// context is done or Stop is called. Replies and timeouts (Error "timeout") are sent to the returned
+// channel, which is closed when the probe stops. Replies are dropped rather than delaying the probe if
+// the channel is not drained in time, they are still counted in Stats.
+func (p *LatencyProbe) Start(ctx context.Context, host string, interval time.Duration) (<-chan PingReply, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("invalid interval %v", interval)
+	}
+	timeout := p.Timeout
+	if timeout <= 0 {
+		timeout = time.Second
+	}
+	size := p.Size
+	if size <= 0 {
+		size = 56
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.running {
+		return nil, fmt.Errorf("latency probe is already running")
+	}
+
+	target, err := resolvePingTarget(ctx, withZone(host), IPVersionAuto)
+	if err != nil {
+		return nil, err
+	}
+	sock, err := listenICMP(target.IP)
+	if err != nil {
+		return nil, err
+	}
+	sock.zone = target.Zone
+
+	ctx, cancel := context.WithCancel(ctx)
+	run := &probeRun{
+		probe:    p,
+		sock:     sock,
+		ip:       target.IP,
+		payload:  make([]byte, size),
+		timeout:  timeout,
+		interval: interval,
+		pending:  make(map[int]time.Time),
+		replies:  make(chan PingReply, probeBuffer),
+	}
+	run.id, run.matchID = sock.echoID(0)
+
+	p.running = true
+	p.cancel = cancel
+	p.done = make(chan struct{})
+	p.stats = ProbeStats{}
+	p.rttSum = 0
+
+	go run.loop(ctx, p.done)
+	return run.replies, nil
+}
+
+// Stop stops the probe and waits until its reply channel is closed. Requests without a reply yet are
+// reported and counted as lost.
+func (p *LatencyProbe) Stop() {
+	p.mu.Lock()
+	cancel, done := p.cancel, p.done
+	p.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+}
+
+// Stats returns the statistics of the current or last run
+func (p *LatencyProbe) Stats() ProbeStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.stats
+}
+
+// record updates the statistics with a reply, a delivered reply is not counted as dropped
+func (p *LatencyProbe) record(reply PingReply, delivered bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !delivered {
+		p.stats.Dropped++
+	}
+	if reply.Error != "" {
+		p.stats.Lost++
+		return
+	}
+	p.stats.Received++
+	p.stats.LastRTT = reply.RTT
+	if p.stats.Received == 1 || reply.RTT < p.stats.MinRTT {
+		p.stats.MinRTT = reply.RTT
+	}
+	if reply.RTT > p.stats.MaxRTT {
+		p.stats.MaxRTT = reply.RTT
+	}
+	p.rttSum += reply.RTT
+	p.stats.AvgRTT = p.rttSum / time.Duration(p.stats.Received)
+}
+
+// probeRun is a single run of a LatencyProbe
+type probeRun struct {
+	probe    *LatencyProbe
+	sock     *icmpSocket
+	ip       net.IP
+	id       int
+	matchID  int
+	payload  []byte
+	timeout  time.Duration
+	interval time.Duration
+
+	mu      sync.Mutex
+	pending map[int]time.Time // Send time of the requests waiting for a reply by sequence number
+	replies chan PingReply
+}
+
+// loop sends the requests and receives the replies until the context is done
+func (r *probeRun) loop(ctx context.Context, done chan struct{}) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		r.receive()
+	}()
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	seq := 0
+	for ctx.Err() == nil {
+		r.expire(time.Now())
+		seq = (seq + 1) & 0xffff
+		r.mu.Lock()
+		r.pending[seq] = time.Now()
+		r.mu.Unlock()
+		if err := r.sock.sendEcho(r.ip, r.id, seq, r.payload); err != nil {
+			r.mu.Lock()
+			delete(r.pending, seq)
+			r.mu.Unlock()
+			r.emit(PingReply{Seq: seq, Error: err.Error()})
+		}
+		r.probe.mu.Lock()
+		r.probe.stats.Sent++
+		r.probe.mu.Unlock()
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+		}
+	}
+
+	r.sock.conn.Close()
+	wg.Wait()
+	// Requests still waiting for a reply are lost, so Sent is Received plus Lost after the probe stopped
+	r.expire(time.Now().Add(r.timeout))
+
+	r.probe.mu.Lock()
+	r.probe.running = false
+	r.probe.mu.Unlock()
+	close(r.replies)
+	close(done)
+}
+
+// receive reads replies until the socket is closed
+func (r *probeRun) receive() {
+	buf := make([]byte, len(r.payload)+1500)
+	for {
+		msg, from, ttl, err := r.sock.read(buf)
+		received := time.Now()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+
+		reply, ok := matchEchoReply(msg, r.matchID, r.sock.ipv6)
+		if !ok {
+			continue
+		}
+		r.mu.Lock()
+		sentAt, pending := r.pending[reply.Seq]
+		delete(r.pending, reply.Seq)
+		r.mu.Unlock()
+		// Late replies and duplicates were already handled
+		if !pending {
+			continue
+		}
+
+		reply.From = from
+		if reply.Error == "" {
+			reply.TTL = ttl
+			reply.RTT = received.Sub(sentAt)
+		}
+		r.emit(reply)
+	}
+}
+
+// expire reports the requests sent before the timeout as lost
+func (r *probeRun) expire(now time.Time) {
+	var lost []int
+	r.mu.Lock()
+	for seq, sentAt := range r.pending {
+		if now.Sub(sentAt) >= r.timeout {
+			lost = append(lost, seq)
+			delete(r.pending, seq)
+		}
+	}
+	r.mu.Unlock()
+
+	for _, seq := range lost {
+		r.emit(PingReply{Seq: seq, Error: "timeout"})
+	}
+}
+
+// emit records the reply and sends it to the channel without blocking
+func (r *probeRun) emit(reply PingReply) {
+	select {
+	case r.replies <- reply:
+		r.probe.record(reply, true)
+	default:
+		r.probe.record(reply, false)
+	}
+}
@@ -0,0 +1,102 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLatencyProbe(t *testing.T) {
+	probe := &LatencyProbe{Timeout: 500 * time.Millisecond}
+	if _, err := probe.Start(context.Background(), "127.0.0.1", 0); err == nil {
+		t.Error("Start() accepted a zero interval")
+	}
+
+	replies, err := probe.Start(context.Background(), "127.0.0.1", 10*time.Millisecond)
+	if errors.Is(err, ErrInsufficientPrivilege) {
+		t.Skip("ICMP sockets are not permitted")
+	}
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if _, err := probe.Start(context.Background(), "127.0.0.1", time.Second); err == nil {
+		t.Error("Start() of a running probe succeeded")
+	}
+
+	seen := make(map[int]bool)
+	for len(seen) < 10 {
+		reply := <-replies
+		if reply.Error != "" || reply.RTT <= 0 || seen[reply.Seq] {
+			t.Fatalf("reply = %+v", reply)
+		}
+		seen[reply.Seq] = true
+	}
+	probe.Stop()
+	for range replies {
+		// Drained until the channel is closed
+	}
+
+	stats := probe.Stats()
+	if stats.Sent < 10 || stats.Received < 10 || stats.MinRTT <= 0 || stats.MinRTT > stats.AvgRTT || stats.AvgRTT > stats.MaxRTT {
+		t.Errorf("Stats() = %+v", stats)
+	}
+	if stats.Sent != stats.Received+stats.Lost {
+		t.Errorf("Stats() = %+v, Sent != Received + Lost after Stop()", stats)
+	}
+
+	// A stopped probe can be started again and is stopped by its context
+	ctx, cancel := context.WithCancel(context.Background())
+	replies, err = probe.Start(ctx, "127.0.0.1", 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Start() after Stop() error = %v", err)
+	}
+	<-replies
+	cancel()
+	for range replies {
+	}
+	probe.Stop()
+}
+
+func TestLatencyProbeTimeout(t *testing.T) {
+	run := &probeRun{
+		probe:   &LatencyProbe{},
+		timeout: time.Second,
+		pending: map[int]time.Time{},
+		replies: make(chan PingReply, 1),
+	}
+	now := time.Now()
+	run.pending[1] = now.Add(-2 * time.Second)
+	run.pending[2] = now.Add(-3 * time.Second)
+	run.pending[3] = now
+
+	run.expire(now)
+	if len(run.pending) != 1 {
+		t.Errorf("pending = %v, want only the recent request", run.pending)
+	}
+	if reply := <-run.replies; reply.Error != "timeout" {
+		t.Errorf("reply = %+v, want timeout", reply)
+	}
+	// The second timeout didn't fit the channel
+	stats := run.probe.Stats()
+	if stats.Lost != 2 || stats.Dropped != 1 {
+		t.Errorf("Stats() = %+v, want 2 lost and 1 dropped", stats)
+	}
+}
+
+func TestLatencyProbeStopExpiresPending(t *testing.T) {
+	run := &probeRun{
+		probe:   &LatencyProbe{},
+		timeout: time.Hour,
+		pending: map[int]time.Time{},
+		replies: make(chan PingReply, 2),
+	}
+	run.pending[1] = time.Now()
+	run.pending[2] = time.Now()
+
+	// The final expiry of a stopping run reports every pending request
+	run.expire(time.Now().Add(run.timeout))
+	if len(run.pending) != 0 || run.probe.Stats().Lost != 2 {
+		t.Errorf("pending = %v, Stats() = %+v", run.pending, run.probe.Stats())
+	}
+}
@@ -0,0 +1,322 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// ReachMethod selects how FirstReachable probes addresses
+type ReachMethod int
+
+const (
+	ReachICMP ReachMethod = iota // ICMP echo request
+	ReachTCP                     // TCP connect to the port
+)
+
+// reachTimeout is the timeout of a single FirstReachable probe
+const reachTimeout = 3 * time.Second
+
+// ResolveStrategy selects the order in which the IPv4 and IPv6 addresses of a dual-stack host are tried
+type ResolveStrategy int
+
+const (
+	StrategyDefault ResolveStrategy = iota // All addresses at once (FirstReachable), the system's order (TCPPing)
+	PreferIPv4                             // IPv4 addresses first, IPv6 only if none of them answers
+	PreferIPv6                             // IPv6 addresses first, IPv4 only if none of them answers
+	HappyEyeballs                          // IPv6 first, IPv4 raced after a short head start (RFC 8305)
+)
+
+// happyEyeballsDelay is the head start of IPv6 attempts with HappyEyeballs (RFC 8305 Connection Attempt Delay)
+var happyEyeballsDelay = 250 * time.Millisecond
+
+// WithStrategy sets the order in which FirstReachable probes the IPv4 and IPv6 addresses of the host
+func WithStrategy(strategy ResolveStrategy) Option {
+	return func(o *callOptions) {
+		o.strategy = strategy
+	}
+}
+
+// valid reports whether the strategy is known
+func (s ResolveStrategy) valid() bool {
+	return s >= StrategyDefault && s <= HappyEyeballs
+}
+
+// split divides the addresses into the ones tried first and the ones tried after the delay. A negative
+// delay starts the secondary addresses only after every primary address failed.
+func (s ResolveStrategy) split(ips []net.IP) (primary, secondary []net.IP, delay time.Duration) {
+	var v4, v6 []net.IP
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			v4 = append(v4, ip)
+		} else {
+			v6 = append(v6, ip)
+		}
+	}
+
+	switch s {
+	case PreferIPv4:
+		primary, secondary, delay = v4, v6, -1
+	case PreferIPv6:
+		primary, secondary, delay = v6, v4, -1
+	case HappyEyeballs:
+		primary, secondary, delay = v6, v4, happyEyeballsDelay
+	default:
+		return ips, nil, -1
+	}
+	if len(primary) == 0 {
+		return secondary, nil, -1
+	}
+	return primary, secondary, delay
+}
+
+// raceAddresses runs attempt for the primary addresses concurrently and for the secondary addresses
+// after the delay, or as soon as every primary attempt failed. The first address whose attempt succeeded
+// is returned, the context of the other attempts is canceled.
+func raceAddresses(ctx context.Context, primary, secondary []net.IP, delay time.Duration, attempt func(ctx context.Context, ip net.IP) error) (net.IP, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type attemptResult struct {
+		ip  net.IP
+		err error
+	}
+	results := make(chan attemptResult, len(primary)+len(secondary))
+	pending := 0
+	start := func(ips []net.IP) {
+		for _, ip := range ips {
+			pending++
+			go func(ip net.IP) {
+				results <- attemptResult{ip: ip, err: attempt(ctx, ip)}
+			}(ip)
+		}
+	}
+
+	start(primary)
+	var headStart <-chan time.Time
+	if len(secondary) > 0 && delay >= 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		headStart = timer.C
+	}
+
+	var errs []error
+	for pending > 0 || secondary != nil {
+		if pending == 0 {
+			start(secondary)
+			secondary, headStart = nil, nil
+			continue
+		}
+		select {
+		case <-headStart:
+			start(secondary)
+			secondary, headStart = nil, nil
+		case result := <-results:
+			pending--
+			if result.err == nil {
+				return result.ip, nil
+			}
+			errs = append(errs, result.err)
+		}
+	}
+	return nil, errors.Join(errs...)
+}
+
+// FirstReachable resolves all addresses of the host, probes them concurrently and returns the first
+// address which responds. The remaining probes are cancelled. The port is used by ReachTCP only.
+// WithStrategy changes the order in which IPv4 and IPv6 addresses are probed.
+func FirstReachable(ctx context.Context, host string, method ReachMethod, port int, opts ...Option) (net.IP, error) {
+	if host == "" {
+		return nil, fmt.Errorf("host cannot be empty")
+	}
+	if method != ReachICMP && method != ReachTCP {
+		return nil, fmt.Errorf("unsupported reach method %d", method)
+	}
+	if method == ReachTCP && (port <= 0 || port > 65535) {
+		return nil, fmt.Errorf("invalid port %d", port)
+	}
+	strategy := applyOptions(opts).strategy
+	if !strategy.valid() {
+		return nil, fmt.Errorf("unsupported resolve strategy %d", strategy)
+	}
+
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IP{ip}
+	} else {
+		addrs, err := lookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s: %w", host, err)
+		}
+		for _, addr := range addrs {
+			ips = append(ips, addr.IP)
+		}
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no addresses found for %s", host)
+	}
+
+	primary, secondary, delay := strategy.split(ips)
+	ip, err := raceAddresses(ctx, primary, secondary, delay, func(ctx context.Context, ip net.IP) error {
+		if err := probeAddress(ctx, ip, method, port); err != nil {
+			return fmt.Errorf("%s: %w", ip, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("no address of %s is reachable: %w", host, err)
+	}
+	return ip, nil
+}
+
+// strategyDialer dials host names by racing their addresses in the order of the strategy
+type strategyDialer struct {
+	dialer   proxy.ContextDialer
+	strategy ResolveStrategy
+}
+
+// DialContext resolves the host of the address and connects to the first address accepting the
+// connection, addresses with an IP are dialed directly
+func (d *strategyDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if ip, _ := splitZone(host); ip != nil || d.strategy == StrategyDefault {
+		return d.dialer.DialContext(ctx, network, address)
+	}
+
+	addrs, err := lookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", host, err)
+	}
+	var ips []net.IP
+	for _, addr := range addrs {
+		ips = append(ips, addr.IP)
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no addresses found for %s", host)
+	}
+
+	// Connections completing after the first one are closed
+	var (
+		mu     sync.Mutex
+		winner net.Conn
+	)
+	primary, secondary, delay := d.strategy.split(ips)
+	_, err = raceAddresses(ctx, primary, secondary, delay, func(ctx context.Context, ip net.IP) error {
+		conn, err := d.dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if winner != nil {
+			conn.Close()
+			return fmt.Errorf("another address connected first")
+		}
+		winner = conn
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	return winner, nil
+}
+
+// probeAddress returns nil if the address responds to the probe
+func probeAddress(ctx context.Context, ip net.IP, method ReachMethod, port int) error {
+	if method == ReachTCP {
+		reply := tcpConnect(ctx, newDirectDialer(reachTimeout, nil), net.JoinHostPort(ip.String(), strconv.Itoa(port)), 1, reachTimeout, false)
+		if reply.Error != "" {
+			return errors.New(reply.Error)
+		}
+		return nil
+	}
+
+	// Prefer the native pinger, the ping command is used if ICMP sockets are not permitted
+	options := &PingOptions{Count: 1, Timeout: reachTimeout, Size: 32, Native: true}
+	result, err := PingContext(ctx, ip.String(), options)
+	if errors.Is(err, ErrInsufficientPrivilege) {
+		options.Native = false
+		result, err = PingContext(ctx, ip.String(), options)
+	}
+	if err != nil {
+		return err
+	}
+	if !result.Success {
+		return errors.New(result.ErrorMessage)
+	}
+	return nil
+}
+
+// OnlineCheck configures the probes of IsOnline, empty probes are skipped
+type OnlineCheck struct {
+	DNSName    string   // Name resolved with the system resolver
+	TCPTargets []string // host:port addresses connected to
+	PingHosts  []string // Hosts pinged, native ICMP is preferred over the ping command
+}
+
+// DefaultOnlineCheck returns the probes of IsOnline, a DNS resolution and TCP connects to public
+// resolvers. Ping is disabled by default since ICMP is often filtered.
+func DefaultOnlineCheck() OnlineCheck {
+	return OnlineCheck{
+		DNSName:    "www.google.com",
+		TCPTargets: []string{"1.1.1.1:443", "8.8.8.8:53"},
+	}
+}
+
+// IsOnline reports whether the host has internet connectivity using the probes of DefaultOnlineCheck,
+// see IsOnlineWith
+func IsOnline(ctx context.Context) bool {
+	return IsOnlineWith(ctx, DefaultOnlineCheck())
+}
+
+// IsOnlineWith reports whether the host has internet connectivity. The probes of the check are tried
+// in order, a DNS resolution, TCP connects and pings, until one succeeds. False is returned if all fail
+// or the context is done first.
+func IsOnlineWith(ctx context.Context, check OnlineCheck) bool {
+	if check.DNSName != "" && ctx.Err() == nil {
+		lookupCtx, cancel := context.WithTimeout(ctx, reachTimeout)
+		addrs, err := lookupIPAddr(lookupCtx, check.DNSName)
+		cancel()
+		if err == nil && len(addrs) > 0 {
+			return true
+		}
+	}
+
+	for _, target := range check.TCPTargets {
+		if ctx.Err() != nil {
+			return false
+		}
+		host, portStr, err := net.SplitHostPort(target)
+		if err != nil {
+			continue
+		}
+		port, err := strconv.Atoi(portStr)
+		if err != nil {
+			continue
+		}
+		if _, err := FirstReachable(ctx, host, ReachTCP, port); err == nil {
+			return true
+		}
+	}
+
+	for _, host := range check.PingHosts {
+		if ctx.Err() != nil {
+			return false
+		}
+		if _, err := FirstReachable(ctx, host, ReachICMP, 0); err == nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,234 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFirstReachableTCP(t *testing.T) {
+	host, port := startTestTCPServer(t)
+
+	original := lookupIPAddr
+	defer func() { lookupIPAddr = original }()
+	lookupIPAddr = func(ctx context.Context, name string) ([]net.IPAddr, error) {
+		// Only 127.0.0.1 accepts connections
+		return []net.IPAddr{{IP: net.ParseIP("127.0.0.2")}, {IP: net.ParseIP(host)}, {IP: net.ParseIP("127.0.0.3")}}, nil
+	}
+
+	ip, err := FirstReachable(context.Background(), "anycast.example.com", ReachTCP, port)
+	if err != nil {
+		t.Fatalf("FirstReachable() error = %v", err)
+	}
+	if ip.String() != host {
+		t.Errorf("FirstReachable() = %v, want %s", ip, host)
+	}
+
+	if _, err := FirstReachable(context.Background(), "127.0.0.2", ReachTCP, port); err == nil {
+		t.Error("expected error when no address is reachable")
+	}
+}
+
+func TestFirstReachableICMP(t *testing.T) {
+	ip, err := FirstReachable(context.Background(), "127.0.0.1", ReachICMP, 0)
+	if err != nil {
+		t.Skipf("ICMP not available: %v", err)
+	}
+	if !ip.Equal(net.ParseIP("127.0.0.1")) {
+		t.Errorf("FirstReachable() = %v, want 127.0.0.1", ip)
+	}
+}
+
+func TestFirstReachableInvalid(t *testing.T) {
+	tests := []struct {
+		host   string
+		method ReachMethod
+		port   int
+	}{
+		{"", ReachICMP, 0},
+		{"127.0.0.1", ReachTCP, 0},
+		{"127.0.0.1", ReachTCP, 70000},
+		{"127.0.0.1", ReachMethod(9), 80},
+	}
+	for _, tt := range tests {
+		if _, err := FirstReachable(context.Background(), tt.host, tt.method, tt.port); err == nil {
+			t.Errorf("FirstReachable(%q, %d, %d) expected error", tt.host, tt.method, tt.port)
+		}
+	}
+}
+
+func TestIsOnline(t *testing.T) {
+	originalLookup := lookupIPAddr
+	defer func() { lookupIPAddr = originalLookup }()
+
+	dnsWorks := true
+	lookupIPAddr = func(ctx context.Context, name string) ([]net.IPAddr, error) {
+		if dnsWorks {
+			return []net.IPAddr{{IP: net.ParseIP("192.0.2.1")}}, nil
+		}
+		return nil, &net.DNSError{Err: "server misbehaving", Name: name, IsTemporary: true}
+	}
+
+	host, port := startTestTCPServer(t)
+	closed := net.JoinHostPort("127.0.0.1", strconv.Itoa(closedPort(t)))
+	check := OnlineCheck{DNSName: "online.example.com", TCPTargets: []string{closed}}
+
+	if !IsOnlineWith(context.Background(), check) {
+		t.Error("IsOnlineWith() = false with working DNS")
+	}
+
+	dnsWorks = false
+	if IsOnlineWith(context.Background(), check) {
+		t.Error("IsOnlineWith() = true with all probes failing")
+	}
+	if IsOnlineWith(context.Background(), OnlineCheck{}) {
+		t.Error("IsOnlineWith() = true without probes")
+	}
+
+	check.TCPTargets = append(check.TCPTargets, net.JoinHostPort(host, strconv.Itoa(port)))
+	if !IsOnlineWith(context.Background(), check) {
+		t.Error("IsOnlineWith() = false with a reachable TCP target")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if IsOnlineWith(ctx, check) {
+		t.Error("IsOnlineWith() = true with a canceled context")
+	}
+	if got := DefaultOnlineCheck(); got.DNSName == "" || len(got.TCPTargets) == 0 {
+		t.Errorf("DefaultOnlineCheck() = %+v, want DNS and TCP probes", got)
+	}
+}
+
+func TestResolveStrategySplit(t *testing.T) {
+	v4, v6 := net.ParseIP("192.0.2.1"), net.ParseIP("2001:db8::1")
+	tests := []struct {
+		strategy           ResolveStrategy
+		ips                []net.IP
+		primary, secondary string
+		delay              time.Duration
+	}{
+		{StrategyDefault, []net.IP{v4, v6}, "192.0.2.1 2001:db8::1", "", -1},
+		{PreferIPv4, []net.IP{v6, v4}, "192.0.2.1", "2001:db8::1", -1},
+		{PreferIPv6, []net.IP{v4, v6}, "2001:db8::1", "192.0.2.1", -1},
+		{HappyEyeballs, []net.IP{v4, v6}, "2001:db8::1", "192.0.2.1", happyEyeballsDelay},
+		{HappyEyeballs, []net.IP{v4}, "192.0.2.1", "", -1},
+		{PreferIPv4, []net.IP{v6}, "2001:db8::1", "", -1},
+	}
+	join := func(ips []net.IP) string {
+		var s []string
+		for _, ip := range ips {
+			s = append(s, ip.String())
+		}
+		return strings.Join(s, " ")
+	}
+	for _, tt := range tests {
+		primary, secondary, delay := tt.strategy.split(tt.ips)
+		if join(primary) != tt.primary || join(secondary) != tt.secondary || delay != tt.delay {
+			t.Errorf("%d.split(%v) = %v, %v, %v", tt.strategy, tt.ips, primary, secondary, delay)
+		}
+	}
+}
+
+func TestRaceAddresses(t *testing.T) {
+	v4, v6 := net.ParseIP("192.0.2.1"), net.ParseIP("2001:db8::1")
+	// attempt succeeds for the addresses after their delay and fails for the others
+	attempt := func(delays map[string]time.Duration) func(context.Context, net.IP) error {
+		return func(ctx context.Context, ip net.IP) error {
+			delay, ok := delays[ip.String()]
+			if !ok {
+				return errors.New("refused")
+			}
+			select {
+			case <-time.After(delay):
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+
+	// A slow IPv6 address loses against IPv4 once the head start is over
+	ip, err := raceAddresses(context.Background(), []net.IP{v6}, []net.IP{v4}, 20*time.Millisecond,
+		attempt(map[string]time.Duration{"2001:db8::1": time.Second, "192.0.2.1": 0}))
+	if err != nil || !ip.Equal(v4) {
+		t.Errorf("raceAddresses(slow IPv6) = %v, %v", ip, err)
+	}
+
+	// Within the head start IPv6 wins
+	ip, err = raceAddresses(context.Background(), []net.IP{v6}, []net.IP{v4}, time.Second,
+		attempt(map[string]time.Duration{"2001:db8::1": 10 * time.Millisecond, "192.0.2.1": 0}))
+	if err != nil || !ip.Equal(v6) {
+		t.Errorf("raceAddresses(fast IPv6) = %v, %v", ip, err)
+	}
+
+	// A failed primary starts the secondary addresses without waiting
+	start := time.Now()
+	ip, err = raceAddresses(context.Background(), []net.IP{v6}, []net.IP{v4}, -1,
+		attempt(map[string]time.Duration{"192.0.2.1": 0}))
+	if err != nil || !ip.Equal(v4) || time.Since(start) > 500*time.Millisecond {
+		t.Errorf("raceAddresses(failed IPv6) = %v, %v after %v", ip, err, time.Since(start))
+	}
+
+	if _, err := raceAddresses(context.Background(), []net.IP{v6}, []net.IP{v4}, -1, attempt(nil)); err == nil {
+		t.Error("raceAddresses() expected error when every attempt fails")
+	}
+}
+
+func TestFirstReachableStrategy(t *testing.T) {
+	host, port := startTestTCPServer(t)
+
+	original := lookupIPAddr
+	defer func() { lookupIPAddr = original }()
+	lookupIPAddr = func(ctx context.Context, name string) ([]net.IPAddr, error) {
+		// Only the IPv4 address accepts connections
+		return []net.IPAddr{{IP: net.ParseIP("::1")}, {IP: net.ParseIP(host)}}, nil
+	}
+
+	for _, strategy := range []ResolveStrategy{StrategyDefault, PreferIPv4, PreferIPv6, HappyEyeballs} {
+		ip, err := FirstReachable(context.Background(), "dualstack.example.com", ReachTCP, port, WithStrategy(strategy))
+		if err != nil || ip.String() != host {
+			t.Errorf("FirstReachable(strategy %d) = %v, %v, want %s", strategy, ip, err, host)
+		}
+	}
+	if _, err := FirstReachable(context.Background(), "dualstack.example.com", ReachTCP, port, WithStrategy(ResolveStrategy(9))); err == nil {
+		t.Error("FirstReachable() expected error for unsupported strategy")
+	}
+}
+
+func TestTCPPingStrategy(t *testing.T) {
+	host, port := startTestTCPServer(t)
+
+	var mu sync.Mutex
+	lookups := 0
+	original := lookupIPAddr
+	defer func() { lookupIPAddr = original }()
+	lookupIPAddr = func(ctx context.Context, name string) ([]net.IPAddr, error) {
+		mu.Lock()
+		lookups++
+		mu.Unlock()
+		return []net.IPAddr{{IP: net.ParseIP("::1")}, {IP: net.ParseIP(host)}}, nil
+	}
+
+	for _, strategy := range []ResolveStrategy{PreferIPv6, HappyEyeballs} {
+		result, err := TCPPing(context.Background(), "dualstack.example.com", port, &TCPPingOptions{Count: 1, Strategy: strategy})
+		if err != nil || !result.Success {
+			t.Fatalf("TCPPing(strategy %d) = %+v, %v", strategy, result, err)
+		}
+		if from := result.Replies[0].From; from.String() != host {
+			t.Errorf("TCPPing(strategy %d) connected to %v, want %s", strategy, from, host)
+		}
+	}
+	if lookups != 2 {
+		t.Errorf("lookups = %d, want 2", lookups)
+	}
+
+	if _, err := TCPPing(context.Background(), "dualstack.example.com", port, &TCPPingOptions{Strategy: PreferIPv4, ProxyAddr: "127.0.0.1:1080"}); err == nil {
+		t.Error("TCPPing() expected error for strategy with proxy")
+	}
+}
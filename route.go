@@ -0,0 +1,466 @@
+package network
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Route is an entry of the routing table
+type Route struct {
+	Destination *net.IPNet // Destination network, 0.0.0.0/0 or ::/0 for default routes
+	Gateway     net.IP     // Next hop, nil for directly connected networks
+	Interface   string     // Outgoing interface name
+	Metric      int        // Route metric, lower is preferred
+	Scope       string     // Route scope such as "global", "link" or "host" (Linux only)
+	Source      net.IP     // Preferred source address, nil if not set
+}
+
+// Default reports whether the route is a default route
+func (r Route) Default() bool {
+	if r.Destination == nil {
+		return false
+	}
+	ones, _ := r.Destination.Mask.Size()
+	return ones == 0
+}
+
+// GatewayAddr returns the gateway with the route's interface as zone if it is an IPv6 link-local
+// address, nil for directly connected networks
+func (r Route) GatewayAddr() *net.IPAddr {
+	if r.Gateway == nil {
+		return nil
+	}
+	addr := &net.IPAddr{IP: r.Gateway}
+	if isLinkLocalIPv6(r.Gateway) {
+		addr.Zone = r.Interface
+	}
+	return addr
+}
+
+// String returns the route in the notation of "ip route"
+// "default via 192.168.1.1 dev eth0 metric 100"
+func (r Route) String() string {
+	var sb strings.Builder
+	if r.Default() {
+		sb.WriteString("default")
+	} else if r.Destination != nil {
+		sb.WriteString(r.Destination.String())
+	}
+	if r.Gateway != nil {
+		fmt.Fprintf(&sb, " via %s", r.Gateway)
+	}
+	if r.Interface != "" {
+		fmt.Fprintf(&sb, " dev %s", r.Interface)
+	}
+	if r.Metric != 0 {
+		fmt.Fprintf(&sb, " metric %d", r.Metric)
+	}
+	return sb.String()
+}
+
+// RouteDiff is the difference between two snapshots of the routing table
+type RouteDiff struct {
+	Added   []Route
+	Removed []Route
+	Changed []RouteUpdate // Routes to the same destination over the same interface with another gateway or metric
+}
+
+// RouteUpdate is a route whose gateway, metric, scope or source changed
+type RouteUpdate struct {
+	Before Route
+	After  Route
+}
+
+// DiffRoutes compares two snapshots of RoutingTable. Routes are matched by destination and interface,
+// a matched route with another gateway, metric, scope or source is reported as changed.
+func DiffRoutes(before, after []Route) RouteDiff {
+	// Identical routes are matched first so duplicates of a destination and interface pair up correctly
+	unmatched := make(map[string][]Route)
+	for _, route := range before {
+		key := routeIdentity(route)
+		unmatched[key] = append(unmatched[key], route)
+	}
+	var added []Route
+	for _, route := range after {
+		key := routeIdentity(route)
+		if len(unmatched[key]) > 0 {
+			unmatched[key] = unmatched[key][1:]
+			continue
+		}
+		added = append(added, route)
+	}
+
+	// The remaining routes of before keep their order
+	removedByKey := make(map[string][]Route)
+	var keys []string
+	for _, route := range before {
+		key := routeIdentity(route)
+		if len(unmatched[key]) == 0 {
+			continue
+		}
+		route = unmatched[key][0]
+		unmatched[key] = unmatched[key][1:]
+		destination := routeKey(route)
+		if _, ok := removedByKey[destination]; !ok {
+			keys = append(keys, destination)
+		}
+		removedByKey[destination] = append(removedByKey[destination], route)
+	}
+
+	var diff RouteDiff
+	for _, route := range added {
+		key := routeKey(route)
+		if old := removedByKey[key]; len(old) > 0 {
+			diff.Changed = append(diff.Changed, RouteUpdate{Before: old[0], After: route})
+			removedByKey[key] = old[1:]
+			continue
+		}
+		diff.Added = append(diff.Added, route)
+	}
+	for _, key := range keys {
+		diff.Removed = append(diff.Removed, removedByKey[key]...)
+	}
+	return diff
+}
+
+// Empty reports whether the routing tables were equal
+func (d RouteDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// String returns one line per difference, "+" for added, "-" for removed and "~" for changed routes
+func (d RouteDiff) String() string {
+	if d.Empty() {
+		return "No route changes"
+	}
+	var sb strings.Builder
+	for _, route := range d.Added {
+		fmt.Fprintf(&sb, "+ %s\n", route)
+	}
+	for _, route := range d.Removed {
+		fmt.Fprintf(&sb, "- %s\n", route)
+	}
+	for _, update := range d.Changed {
+		fmt.Fprintf(&sb, "~ %s -> %s\n", update.Before, update.After)
+	}
+	return sb.String()
+}
+
+// routeKey identifies a route by its destination and interface
+func routeKey(r Route) string {
+	destination := ""
+	if r.Destination != nil {
+		destination = r.Destination.String()
+	}
+	return destination + " dev " + r.Interface
+}
+
+// routeIdentity identifies a route by all of its attributes
+func routeIdentity(r Route) string {
+	return fmt.Sprintf("%s via %s metric %d scope %s src %s", routeKey(r), r.Gateway, r.Metric, r.Scope, r.Source)
+}
+
+// RoutingTable returns the IPv4 and IPv6 routes of the main routing table. On Linux it runs
+// "ip route show" and falls back to /proc/net/route (IPv4 only), on Windows it parses "route print".
+func RoutingTable() ([]Route, error) {
+	switch runtime.GOOS {
+	case "linux":
+		return routingTableLinux()
+	case "windows":
+		return routingTableWindows()
+	}
+	return nil, fmt.Errorf("routing table is not supported on %s", runtime.GOOS)
+}
+
+// routingTableLinux reads the routing table using the ip command or /proc/net/route
+func routingTableLinux() ([]Route, error) {
+	if ipCmd := findCommand("ip", []string{"/bin/ip", "/sbin/ip", "/usr/bin/ip", "/usr/sbin/ip"}); ipCmd != "" {
+		out, err := command(context.Background(), ipCmd, "-4", "route", "show").Output()
+		if err == nil {
+			routes := parseIPRoute(string(out), false)
+			// IPv6 may be disabled, its routes are optional
+			if out, err := command(context.Background(), ipCmd, "-6", "route", "show").Output(); err == nil {
+				routes = append(routes, parseIPRoute(string(out), true)...)
+			}
+			return routes, nil
+		}
+	}
+
+	data, err := os.ReadFile("/proc/net/route")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read routing table: %w", err)
+	}
+	return parseProcNetRoute(string(data)), nil
+}
+
+// routingTableWindows reads the routing table using route print
+func routingTableWindows() ([]Route, error) {
+	out, err := command(context.Background(), "route", "print").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read routing table: %w", err)
+	}
+
+	routes := parseRoutePrint(string(out))
+	// route print identifies IPv4 interfaces by address and IPv6 interfaces by index
+	for i := range routes {
+		if ip := net.ParseIP(routes[i].Interface); ip != nil {
+			if interf, err := interfaceByIP(ip); err == nil {
+				routes[i].Interface = interf.Name
+			}
+		} else if index, err := strconv.Atoi(routes[i].Interface); err == nil {
+			if interf, err := net.InterfaceByIndex(index); err == nil {
+				routes[i].Interface = interf.Name
+			}
+		}
+	}
+	return routes, nil
+}
+
+// parseIPRoute parses the output of "ip route show". Routes which don't forward packets
+// (blackhole, unreachable, prohibit, throw) are left out, multipath routes yield one route per next hop.
+// "default via 192.168.1.1 dev eth0 proto dhcp src 192.168.1.10 metric 100"
+// "192.168.1.0/24 dev eth0 proto kernel scope link src 192.168.1.10"
+func parseIPRoute(output string, ipv6 bool) []Route {
+	var routes []Route
+	var multipath *Route
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		// Next hops of a multipath route follow it on indented lines
+		if fields[0] == "nexthop" {
+			if multipath != nil {
+				route := *multipath
+				applyRouteFields(&route, fields[1:])
+				routes = append(routes, route)
+			}
+			continue
+		}
+		multipath = nil
+
+		switch fields[0] {
+		case "blackhole", "unreachable", "prohibit", "throw":
+			continue
+		case "unicast":
+			fields = fields[1:]
+		}
+		if len(fields) == 0 {
+			continue
+		}
+
+		destination := parseRouteDestination(fields[0], ipv6)
+		if destination == nil {
+			continue
+		}
+		route := Route{Destination: destination, Scope: "global"}
+		applyRouteFields(&route, fields[1:])
+		if route.Interface == "" && route.Gateway == nil {
+			multipath = &route
+			continue
+		}
+		routes = append(routes, route)
+	}
+	return routes
+}
+
+// applyRouteFields sets the route attributes of "ip route" key value pairs
+func applyRouteFields(route *Route, fields []string) {
+	for i := 0; i+1 < len(fields); i++ {
+		value := fields[i+1]
+		switch fields[i] {
+		case "via":
+			// "via inet6 fe80::1" is used for IPv6 next hops of IPv4 routes
+			if value == "inet" || value == "inet6" {
+				if i+2 >= len(fields) {
+					continue
+				}
+				i++
+				value = fields[i+1]
+			}
+			route.Gateway = net.ParseIP(value)
+		case "dev":
+			route.Interface = value
+		case "metric":
+			route.Metric, _ = strconv.Atoi(value)
+		case "scope":
+			route.Scope = value
+		case "src":
+			route.Source = net.ParseIP(value)
+		default:
+			continue
+		}
+		i++
+	}
+}
+
+// parseRouteDestination parses a route destination, "default" or an address with an optional prefix length
+func parseRouteDestination(destination string, ipv6 bool) *net.IPNet {
+	if destination == "default" {
+		if ipv6 {
+			return &net.IPNet{IP: net.IPv6zero, Mask: net.CIDRMask(0, 128)}
+		}
+		return &net.IPNet{IP: net.IPv4zero.To4(), Mask: net.CIDRMask(0, 32)}
+	}
+	if !strings.Contains(destination, "/") {
+		ip := net.ParseIP(destination)
+		if ip == nil {
+			return nil
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+	}
+	_, ipnet, err := net.ParseCIDR(destination)
+	if err != nil {
+		return nil
+	}
+	return ipnet
+}
+
+// parseProcNetRoute parses /proc/net/route, addresses are hex encoded in little-endian byte order
+// "eth0	00000000	0101A8C0	0003	0	0	100	00000000	0	0	0"
+func parseProcNetRoute(data string) []Route {
+	var routes []Route
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 8 || fields[0] == "Iface" {
+			continue
+		}
+		destination, okDestination := procRouteIP(fields[1])
+		gateway, okGateway := procRouteIP(fields[2])
+		mask, okMask := procRouteIP(fields[7])
+		flags, err := strconv.ParseUint(fields[3], 16, 16)
+		// RTF_UP is set for usable routes
+		if !okDestination || !okGateway || !okMask || err != nil || flags&0x1 == 0 {
+			continue
+		}
+
+		route := Route{
+			Destination: &net.IPNet{IP: destination, Mask: net.IPMask(mask)},
+			Interface:   fields[0],
+			Scope:       "link",
+		}
+		route.Metric, _ = strconv.Atoi(fields[6])
+		// RTF_GATEWAY is set for routes using a next hop
+		if flags&0x2 != 0 {
+			route.Gateway = gateway
+			route.Scope = "global"
+		}
+		routes = append(routes, route)
+	}
+	return routes
+}
+
+// procRouteIP decodes a little-endian hex encoded IPv4 address of /proc/net/route
+func procRouteIP(s string) (net.IP, bool) {
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != 4 {
+		return nil, false
+	}
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, binary.LittleEndian.Uint32(b))
+	return ip, true
+}
+
+// parseRoutePrint parses the active routes of Windows "route print". Interface holds the interface
+// address of IPv4 routes and the interface index of IPv6 routes.
+// "          0.0.0.0          0.0.0.0      192.168.1.1    192.168.1.10     25"
+// " 12    281 fe80::/64                On-link"
+func parseRoutePrint(output string) []Route {
+	var (
+		routes  []Route
+		ipv6    bool
+		active  bool
+		pending *Route
+	)
+	for _, line := range strings.Split(output, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "IPv4 Route Table"):
+			ipv6, active = false, false
+			continue
+		case strings.HasPrefix(trimmed, "IPv6 Route Table"):
+			ipv6, active = true, false
+			continue
+		case strings.HasPrefix(trimmed, "Active Routes:"):
+			active = true
+			continue
+		case strings.HasPrefix(trimmed, "Persistent Routes:"):
+			active = false
+			continue
+		}
+		if !active {
+			continue
+		}
+
+		fields := strings.Fields(trimmed)
+
+		// Long IPv6 destinations push the gateway to the following line
+		if pending != nil {
+			if len(fields) == 1 {
+				pending.Gateway = routePrintGateway(fields[0])
+				routes = append(routes, *pending)
+				pending = nil
+				continue
+			}
+			routes = append(routes, *pending)
+			pending = nil
+		}
+
+		if !ipv6 {
+			if len(fields) != 5 {
+				continue
+			}
+			destination, mask := net.ParseIP(fields[0]).To4(), net.ParseIP(fields[1]).To4()
+			metric, err := strconv.Atoi(fields[4])
+			if destination == nil || mask == nil || err != nil {
+				continue
+			}
+			routes = append(routes, Route{
+				Destination: &net.IPNet{IP: destination, Mask: net.IPMask(mask)},
+				Gateway:     routePrintGateway(fields[2]),
+				Interface:   fields[3],
+				Metric:      metric,
+			})
+			continue
+		}
+
+		if len(fields) < 3 {
+			continue
+		}
+		metric, err := strconv.Atoi(fields[1])
+		_, destination, cidrErr := net.ParseCIDR(fields[2])
+		if _, indexErr := strconv.Atoi(fields[0]); indexErr != nil || err != nil || cidrErr != nil {
+			continue
+		}
+		route := Route{Destination: destination, Interface: fields[0], Metric: metric}
+		if len(fields) == 3 {
+			pending = &route
+			continue
+		}
+		route.Gateway = routePrintGateway(fields[3])
+		routes = append(routes, route)
+	}
+	if pending != nil {
+		routes = append(routes, *pending)
+	}
+	return routes
+}
+
+// routePrintGateway parses a gateway column of route print, "On-link" means no gateway
+func routePrintGateway(s string) net.IP {
+	if strings.EqualFold(s, "On-link") {
+		return nil
+	}
+	return net.ParseIP(s)
+}
@@ -0,0 +1,190 @@
+package network
+
+import (
+	"net"
+	"runtime"
+	"testing"
+)
+
+func TestParseIPRoute(t *testing.T) {
+	output := `default via 192.168.1.1 dev eth0 proto dhcp src 192.168.1.10 metric 100
+10.8.0.0/16 via inet6 fe80::1 dev wg0
+192.168.1.0/24 dev eth0 proto kernel scope link src 192.168.1.10 metric 100
+blackhole 10.99.0.0/16
+203.0.113.5 dev tun0 scope link
+default proto static metric 50
+	nexthop via 10.0.0.1 dev eth1 weight 1
+	nexthop via 10.0.1.1 dev eth2 weight 1
+`
+	routes := parseIPRoute(output, false)
+	if len(routes) != 6 {
+		t.Fatalf("parseIPRoute() returned %d routes: %+v", len(routes), routes)
+	}
+
+	def := routes[0]
+	if !def.Default() || def.Destination.String() != "0.0.0.0/0" || def.Gateway.String() != "192.168.1.1" ||
+		def.Interface != "eth0" || def.Metric != 100 || def.Scope != "global" || def.Source.String() != "192.168.1.10" {
+		t.Errorf("default route = %+v", def)
+	}
+	if routes[1].Gateway.String() != "fe80::1" || routes[1].Interface != "wg0" {
+		t.Errorf("IPv6 next hop route = %+v", routes[1])
+	}
+	if link := routes[2]; link.Default() || link.Destination.String() != "192.168.1.0/24" || link.Gateway != nil || link.Scope != "link" {
+		t.Errorf("link route = %+v", link)
+	}
+	if host := routes[3]; host.Destination.String() != "203.0.113.5/32" || host.Interface != "tun0" {
+		t.Errorf("host route = %+v", host)
+	}
+	for i, gateway := range []string{"10.0.0.1", "10.0.1.1"} {
+		route := routes[4+i]
+		if !route.Default() || route.Gateway.String() != gateway || route.Metric != 50 {
+			t.Errorf("multipath route %d = %+v", i, route)
+		}
+	}
+
+	routes = parseIPRoute("default via fd00::1 dev eth0 metric 1024 pref medium\nfe80::/64 dev eth0 proto kernel metric 256 pref medium\n", true)
+	if len(routes) != 2 || routes[0].Destination.String() != "::/0" || routes[0].Gateway.String() != "fd00::1" || routes[1].Metric != 256 {
+		t.Errorf("IPv6 routes = %+v", routes)
+	}
+}
+
+func TestParseProcNetRoute(t *testing.T) {
+	data := `Iface	Destination	Gateway 	Flags	RefCnt	Use	Metric	Mask		MTU	Window	IRTT
+eth0	00000000	010200C0	0003	0	0	100	00000000	0	0	0
+eth0	000200C0	00000000	0001	0	0	0	00FFFFFF	0	0	0
+eth1	0000000A	00000000	0000	0	0	0	000000FF	0	0	0
+`
+	routes := parseProcNetRoute(data)
+	if len(routes) != 2 {
+		t.Fatalf("parseProcNetRoute() returned %d routes: %+v", len(routes), routes)
+	}
+	if !routes[0].Default() || routes[0].Gateway.String() != "192.0.2.1" || routes[0].Metric != 100 || routes[0].Scope != "global" {
+		t.Errorf("default route = %+v", routes[0])
+	}
+	if routes[1].Destination.String() != "192.0.2.0/24" || routes[1].Gateway != nil || routes[1].Scope != "link" {
+		t.Errorf("link route = %+v", routes[1])
+	}
+}
+
+func TestParseRoutePrint(t *testing.T) {
+	output := `===========================================================================
+Interface List
+ 12...00 11 22 33 44 55 ......Intel(R) Ethernet Connection
+  1...........................Software Loopback Interface 1
+===========================================================================
+
+IPv4 Route Table
+===========================================================================
+Active Routes:
+Network Destination        Netmask          Gateway       Interface  Metric
+          0.0.0.0          0.0.0.0      192.168.1.1    192.168.1.10     25
+        127.0.0.0        255.0.0.0         On-link         127.0.0.1    331
+      192.168.1.0    255.255.255.0         On-link      192.168.1.10    281
+===========================================================================
+Persistent Routes:
+  Network Address          Netmask  Gateway Address  Metric
+          0.0.0.0          0.0.0.0      192.168.1.1  Default
+===========================================================================
+
+IPv6 Route Table
+===========================================================================
+Active Routes:
+ If Metric Network Destination      Gateway
+  1    331 ::1/128                  On-link
+ 12    281 2001:db8:1234:5678:9abc:def0:1234:5678/128
+                                    On-link
+ 12    281 ::/0                     fe80::1
+===========================================================================
+Persistent Routes:
+  None
+`
+	routes := parseRoutePrint(output)
+	if len(routes) != 6 {
+		t.Fatalf("parseRoutePrint() returned %d routes: %+v", len(routes), routes)
+	}
+	if !routes[0].Default() || routes[0].Gateway.String() != "192.168.1.1" || routes[0].Interface != "192.168.1.10" || routes[0].Metric != 25 {
+		t.Errorf("default route = %+v", routes[0])
+	}
+	if routes[1].Destination.String() != "127.0.0.0/8" || routes[1].Gateway != nil {
+		t.Errorf("loopback route = %+v", routes[1])
+	}
+	if routes[4].Destination.String() != "2001:db8:1234:5678:9abc:def0:1234:5678/128" || routes[4].Gateway != nil || routes[4].Interface != "12" {
+		t.Errorf("wrapped IPv6 route = %+v", routes[4])
+	}
+	if !routes[5].Default() || routes[5].Gateway.String() != "fe80::1" || routes[5].Metric != 281 {
+		t.Errorf("IPv6 default route = %+v", routes[5])
+	}
+}
+
+func TestRoutingTable(t *testing.T) {
+	routes, err := RoutingTable()
+	if runtime.GOOS != "linux" && runtime.GOOS != "windows" {
+		if err == nil {
+			t.Error("RoutingTable() expected error on unsupported platform")
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("RoutingTable() error = %v", err)
+	}
+	for _, route := range routes {
+		if route.Destination == nil || route.Interface == "" {
+			t.Errorf("RoutingTable() incomplete route %+v", route)
+		}
+	}
+}
+
+func TestRouteGatewayAddr(t *testing.T) {
+	route := Route{Gateway: net.ParseIP("fe80::1"), Interface: "eth0"}
+	if addr := route.GatewayAddr(); addr.String() != "fe80::1%eth0" {
+		t.Errorf("GatewayAddr() = %v", addr)
+	}
+	route = Route{Gateway: net.ParseIP("192.168.1.1"), Interface: "eth0"}
+	if addr := route.GatewayAddr(); addr.String() != "192.168.1.1" {
+		t.Errorf("GatewayAddr() = %v", addr)
+	}
+	if addr := (Route{Interface: "eth0"}).GatewayAddr(); addr != nil {
+		t.Errorf("GatewayAddr() without gateway = %v", addr)
+	}
+
+	entry := NeighborEntry{IP: net.ParseIP("fe80::2"), Interface: "wlan0"}
+	if addr := entry.Addr(); addr.String() != "fe80::2%wlan0" {
+		t.Errorf("Addr() = %v", addr)
+	}
+}
+
+func TestDiffRoutes(t *testing.T) {
+	before := parseIPRoute(`default via 192.168.1.1 dev eth0 metric 100
+192.168.1.0/24 dev eth0 scope link
+10.0.0.0/8 via 192.168.1.254 dev eth0
+`, false)
+	after := parseIPRoute(`default via 192.168.1.1 dev eth0 metric 600
+192.168.1.0/24 dev eth0 scope link
+10.8.0.0/24 dev tun0 scope link
+default dev tun0 metric 50
+`, false)
+
+	diff := DiffRoutes(before, after)
+	if len(diff.Added) != 2 || diff.Added[0].Destination.String() != "10.8.0.0/24" || diff.Added[1].Interface != "tun0" {
+		t.Errorf("Added = %v", diff.Added)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0].Destination.String() != "10.0.0.0/8" {
+		t.Errorf("Removed = %v", diff.Removed)
+	}
+	if len(diff.Changed) != 1 || diff.Changed[0].Before.Metric != 100 || diff.Changed[0].After.Metric != 600 {
+		t.Errorf("Changed = %+v", diff.Changed)
+	}
+
+	want := `+ 10.8.0.0/24 dev tun0
++ default dev tun0 metric 50
+- 10.0.0.0/8 via 192.168.1.254 dev eth0
+~ default via 192.168.1.1 dev eth0 metric 100 -> default via 192.168.1.1 dev eth0 metric 600
+`
+	if got := diff.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	if diff := DiffRoutes(before, before); !diff.Empty() || diff.String() != "No route changes" {
+		t.Errorf("DiffRoutes() of equal tables = %v", diff)
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !unix && !windows
+
+package network
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// setSocketTTL fails, socket options are not available on this platform
+func setSocketTTL(fd uintptr, ipv6 bool, ttl int) error {
+	return fmt.Errorf("setting the TTL is not supported on %s", runtime.GOOS)
+}
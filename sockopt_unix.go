@@ -0,0 +1,13 @@
+//go:build unix
+
+package network
+
+import "syscall"
+
+// setSocketTTL sets the TTL/hop limit of a socket before it is connected
+func setSocketTTL(fd uintptr, ipv6 bool, ttl int) error {
+	if ipv6 {
+		return syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_UNICAST_HOPS, ttl)
+	}
+	return syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_TTL, ttl)
+}
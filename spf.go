@@ -0,0 +1,288 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// SPFLookupLimit is the number of DNS lookups an SPF evaluation may cause (RFC 7208 section 4.6.4)
+const SPFLookupLimit = 10
+
+// SPFEvaluation is the outcome of EvaluateSPF
+type SPFEvaluation struct {
+	Domain       string
+	Record       string       // SPF record of the domain
+	Lookups      int          // DNS lookups of include, a, mx, ptr, exists and redirect of all records
+	ExceedsLimit bool         // Lookups is above SPFLookupLimit, receivers fail the check (permerror)
+	Includes     []string     // Domains of include and redirect in evaluation order
+	Networks     []*net.IPNet // Sending IP ranges authorized by ip4, ip6, a and mx mechanisms with pass qualifier
+	Errors       []string     // Problems found in the records, such as includes without SPF record
+}
+
+// lookupTXT returns the TXT records of a domain, replaced in tests
+var lookupTXT = func(ctx context.Context, domain string) ([]string, error) {
+	resolver := &net.Resolver{
+		PreferGo: true,
+	}
+	return resolver.LookupTXT(ctx, domain)
+}
+
+// lookupMX returns the MX records of a domain, replaced in tests
+var lookupMX = func(ctx context.Context, domain string) ([]*net.MX, error) {
+	resolver := &net.Resolver{
+		PreferGo: true,
+	}
+	return resolver.LookupMX(ctx, domain)
+}
+
+// EvaluateSPF fetches the SPF record of the domain, follows its include and redirect mechanisms
+// recursively and counts the DNS lookups the record causes against the limit of 10. The sending IP ranges
+// are resolved from the ip4, ip6, a and mx mechanisms which authorize senders. Macros are not expanded,
+// ptr and exists mechanisms are counted but not resolved. An error is returned if the domain has no
+// single SPF record, problems of included records are reported in Errors.
+func EvaluateSPF(ctx context.Context, domain string) (*SPFEvaluation, error) {
+	if domain == "" {
+		return nil, fmt.Errorf("domain cannot be empty")
+	}
+	domain = cleanDomain(domain)
+
+	record, err := spfRecord(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	evaluation := &SPFEvaluation{Domain: domain, Record: record}
+	e := &spfEvaluator{
+		result:   evaluation,
+		chain:    map[string]bool{strings.ToLower(domain): true},
+		networks: make(map[string]bool),
+	}
+	e.evaluate(ctx, domain, record, true)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	evaluation.ExceedsLimit = evaluation.Lookups > SPFLookupLimit
+	return evaluation, nil
+}
+
+// spfRecord returns the SPF record among the TXT records of the domain
+func spfRecord(ctx context.Context, domain string) (string, error) {
+	txts, err := lookupTXT(ctx, domain)
+	if err != nil {
+		return "", fmt.Errorf("failed to lookup TXT records of %s: %w", domain, err)
+	}
+
+	var records []string
+	for _, txt := range txts {
+		fields := strings.Fields(txt)
+		if len(fields) > 0 && strings.EqualFold(fields[0], "v=spf1") {
+			records = append(records, txt)
+		}
+	}
+	switch len(records) {
+	case 0:
+		return "", fmt.Errorf("%s has no SPF record", domain)
+	case 1:
+		return records[0], nil
+	}
+	return "", fmt.Errorf("%s has %d SPF records", domain, len(records))
+}
+
+// spfEvaluator walks the records of an SPF evaluation
+type spfEvaluator struct {
+	result   *SPFEvaluation
+	chain    map[string]bool // Domains of the records being evaluated, to detect loops
+	networks map[string]bool
+}
+
+// evaluate counts the lookups of the record and collects its networks, authorize is false
+// within includes whose matches don't authorize senders
+func (e *spfEvaluator) evaluate(ctx context.Context, domain, record string, authorize bool) {
+	var redirect string
+	hasAll := false
+	for _, term := range strings.Fields(record)[1:] {
+		// Modifiers are name=value, mechanisms may contain "=" only after ":" or "/"
+		if i := strings.IndexByte(term, '='); i > 0 && !strings.ContainsAny(term[:i], ":/") {
+			if strings.EqualFold(term[:i], "redirect") {
+				redirect = term[i+1:]
+			}
+			continue
+		}
+
+		pass := authorize
+		if strings.ContainsRune("+-~?", rune(term[0])) {
+			pass = authorize && term[0] == '+'
+			term = term[1:]
+		}
+		name, rest := term, ""
+		if i := strings.IndexAny(term, ":/"); i >= 0 {
+			name, rest = term[:i], term[i:]
+		}
+
+		switch strings.ToLower(name) {
+		case "all":
+			hasAll = true
+		case "ip4", "ip6":
+			if pass {
+				e.addCIDR(domain, strings.TrimPrefix(rest, ":"))
+			}
+		case "a", "mx":
+			e.result.Lookups++
+			if pass {
+				e.addHosts(ctx, domain, strings.ToLower(name), rest)
+			}
+		case "ptr", "exists":
+			e.result.Lookups++
+		case "include":
+			e.result.Lookups++
+			e.follow(ctx, strings.TrimPrefix(rest, ":"), pass)
+		default:
+			e.errorf("%s: unknown mechanism %q", domain, term)
+		}
+	}
+
+	// redirect is ignored if the record has an all mechanism
+	if redirect != "" && !hasAll {
+		e.result.Lookups++
+		e.follow(ctx, redirect, authorize)
+	}
+}
+
+// follow evaluates the record of an included or redirected domain
+func (e *spfEvaluator) follow(ctx context.Context, domain string, authorize bool) {
+	if domain == "" || strings.Contains(domain, "%") {
+		e.errorf("%q can't be followed, macros are not expanded", domain)
+		return
+	}
+	key := strings.ToLower(domain)
+	if e.chain[key] {
+		e.errorf("%s includes itself", domain)
+		return
+	}
+
+	record, err := spfRecord(ctx, domain)
+	if err != nil {
+		e.errorf("%v", err)
+		return
+	}
+	e.result.Includes = append(e.result.Includes, domain)
+	e.chain[key] = true
+	e.evaluate(ctx, domain, record, authorize)
+	delete(e.chain, key)
+}
+
+// addCIDR adds the network of an ip4 or ip6 mechanism, a single address without prefix length
+func (e *spfEvaluator) addCIDR(domain, value string) {
+	if !strings.Contains(value, "/") {
+		ip := net.ParseIP(value)
+		if ip == nil {
+			e.errorf("%s: invalid address %q", domain, value)
+			return
+		}
+		e.addIP(ip, 32, 128)
+		return
+	}
+	_, ipnet, err := net.ParseCIDR(value)
+	if err != nil {
+		e.errorf("%s: invalid network %q", domain, value)
+		return
+	}
+	e.addNetwork(ipnet)
+}
+
+// addHosts resolves the addresses of an a or mx mechanism, rest is the optional ":domain" and
+// "/prefix4//prefix6" part of the mechanism
+func (e *spfEvaluator) addHosts(ctx context.Context, domain, mechanism, rest string) {
+	target := domain
+	if strings.HasPrefix(rest, ":") {
+		target, rest = rest[1:], ""
+		if i := strings.IndexByte(target, '/'); i >= 0 {
+			target, rest = target[:i], target[i:]
+		}
+	}
+	prefix4, prefix6, ok := parseSPFPrefixes(rest)
+	if !ok {
+		e.errorf("%s: invalid prefix length in %s%s", domain, mechanism, rest)
+		return
+	}
+	if strings.Contains(target, "%") {
+		e.errorf("%s: %q can't be resolved, macros are not expanded", domain, target)
+		return
+	}
+
+	hosts := []string{target}
+	if mechanism == "mx" {
+		records, err := lookupMX(ctx, target)
+		if err != nil {
+			e.errorf("%s: failed to lookup MX records of %s: %v", domain, target, err)
+			return
+		}
+		hosts = hosts[:0]
+		for _, mx := range records {
+			if host := strings.TrimSuffix(mx.Host, "."); host != "" {
+				hosts = append(hosts, host)
+			}
+		}
+	}
+
+	for _, host := range hosts {
+		addrs, err := lookupIPAddr(ctx, host)
+		if err != nil {
+			e.errorf("%s: failed to resolve %s: %v", domain, host, err)
+			continue
+		}
+		for _, addr := range addrs {
+			e.addIP(addr.IP, prefix4, prefix6)
+		}
+	}
+}
+
+// parseSPFPrefixes parses the dual CIDR length of a and mx mechanisms, "/24", "//64" or "/24//64"
+func parseSPFPrefixes(s string) (int, int, bool) {
+	prefix4, prefix6 := 32, 128
+	if s == "" {
+		return prefix4, prefix6, true
+	}
+	v4, v6, dual := strings.Cut(s, "//")
+	if v4 != "" {
+		n, err := strconv.Atoi(strings.TrimPrefix(v4, "/"))
+		if err != nil || !strings.HasPrefix(v4, "/") || n < 0 || n > 32 {
+			return 0, 0, false
+		}
+		prefix4 = n
+	}
+	if dual {
+		n, err := strconv.Atoi(v6)
+		if err != nil || n < 0 || n > 128 {
+			return 0, 0, false
+		}
+		prefix6 = n
+	}
+	return prefix4, prefix6, true
+}
+
+// addIP adds the network of the address with the prefix length of its IP version
+func (e *spfEvaluator) addIP(ip net.IP, prefix4, prefix6 int) {
+	mask := net.CIDRMask(prefix6, 128)
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, mask = ip4, net.CIDRMask(prefix4, 32)
+	}
+	e.addNetwork(&net.IPNet{IP: ip.Mask(mask), Mask: mask})
+}
+
+// addNetwork adds the network unless it was added before
+func (e *spfEvaluator) addNetwork(ipnet *net.IPNet) {
+	if e.networks[ipnet.String()] {
+		return
+	}
+	e.networks[ipnet.String()] = true
+	e.result.Networks = append(e.result.Networks, ipnet)
+}
+
+// errorf records a problem of the evaluation
+func (e *spfEvaluator) errorf(format string, args ...interface{}) {
+	e.result.Errors = append(e.result.Errors, fmt.Sprintf(format, args...))
+}
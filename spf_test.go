@@ -0,0 +1,130 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+)
+
+// fakeSPFDNS replaces the TXT, MX and address lookups with the records until the test ends
+func fakeSPFDNS(t *testing.T, txt map[string][]string) {
+	t.Helper()
+	originalTXT, originalMX, originalIP := lookupTXT, lookupMX, lookupIPAddr
+	t.Cleanup(func() { lookupTXT, lookupMX, lookupIPAddr = originalTXT, originalMX, originalIP })
+
+	lookupTXT = func(ctx context.Context, domain string) ([]string, error) {
+		if records, ok := txt[domain]; ok {
+			return records, nil
+		}
+		return nil, fmt.Errorf("no such host")
+	}
+	lookupMX = func(ctx context.Context, domain string) ([]*net.MX, error) {
+		return []*net.MX{{Host: "mx1." + domain + ".", Pref: 10}, {Host: "mx2." + domain + ".", Pref: 20}}, nil
+	}
+	lookupIPAddr = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		switch host {
+		case "example.com":
+			return []net.IPAddr{{IP: net.ParseIP("192.0.2.10")}, {IP: net.ParseIP("2001:db8::10")}}, nil
+		case "mx1.example.com":
+			return []net.IPAddr{{IP: net.ParseIP("192.0.2.25")}}, nil
+		case "mx2.example.com":
+			return []net.IPAddr{{IP: net.ParseIP("192.0.2.26")}}, nil
+		}
+		return nil, fmt.Errorf("no such host")
+	}
+}
+
+func TestEvaluateSPF(t *testing.T) {
+	fakeSPFDNS(t, map[string][]string{
+		"example.com": {
+			"google-site-verification=abc",
+			"v=spf1 ip4:198.51.100.0/24 a/28//64 mx include:_spf.example.net -include:bad.example.net ~all",
+		},
+		"_spf.example.net":  {"v=spf1 ip6:2001:db8:1::/48 ip4:203.0.113.5 redirect=_spf2.example.net"},
+		"_spf2.example.net": {"v=spf1 exists:%{i}.example.net ptr -all"},
+		"bad.example.net":   {"v=spf1 ip4:192.0.2.200 a:missing.example.net -all"},
+	})
+
+	evaluation, err := EvaluateSPF(context.Background(), "example.com")
+	if err != nil {
+		t.Fatalf("EvaluateSPF() error = %v", err)
+	}
+	if !strings.HasPrefix(evaluation.Record, "v=spf1 ip4:198.51.100.0/24") {
+		t.Errorf("Record = %q", evaluation.Record)
+	}
+	// a, mx, 2 includes, redirect, exists, ptr, a of bad.example.net
+	if evaluation.Lookups != 8 || evaluation.ExceedsLimit {
+		t.Errorf("Lookups = %d, ExceedsLimit = %v", evaluation.Lookups, evaluation.ExceedsLimit)
+	}
+	if got := strings.Join(evaluation.Includes, ","); got != "_spf.example.net,_spf2.example.net,bad.example.net" {
+		t.Errorf("Includes = %s", got)
+	}
+
+	var networks []string
+	for _, ipnet := range evaluation.Networks {
+		networks = append(networks, ipnet.String())
+	}
+	want := "198.51.100.0/24,192.0.2.0/28,2001:db8::/64,192.0.2.25/32,192.0.2.26/32,2001:db8:1::/48,203.0.113.5/32"
+	if got := strings.Join(networks, ","); got != want {
+		t.Errorf("Networks = %s, want %s", got, want)
+	}
+	if len(evaluation.Errors) != 0 {
+		t.Errorf("Errors = %v", evaluation.Errors)
+	}
+}
+
+func TestEvaluateSPFLimit(t *testing.T) {
+	txt := map[string][]string{"example.com": {"v=spf1 include:a.example.net include:loop.example.net -all"}}
+	txt["a.example.net"] = []string{"v=spf1 -a -mx -a -mx -a -mx include:b.example.net"}
+	txt["b.example.net"] = []string{"v=spf1 -a -mx include:missing.example.net ?all"}
+	txt["loop.example.net"] = []string{"v=spf1 include:loop.example.net"}
+	fakeSPFDNS(t, txt)
+
+	evaluation, err := EvaluateSPF(context.Background(), "example.com")
+	if err != nil {
+		t.Fatalf("EvaluateSPF() error = %v", err)
+	}
+	if evaluation.Lookups != 13 || !evaluation.ExceedsLimit {
+		t.Errorf("Lookups = %d, ExceedsLimit = %v", evaluation.Lookups, evaluation.ExceedsLimit)
+	}
+	if len(evaluation.Errors) != 2 || !strings.Contains(evaluation.Errors[0], "missing.example.net") ||
+		!strings.Contains(evaluation.Errors[1], "loop.example.net includes itself") {
+		t.Errorf("Errors = %q", evaluation.Errors)
+	}
+}
+
+func TestEvaluateSPFErrors(t *testing.T) {
+	fakeSPFDNS(t, map[string][]string{
+		"none.example.com":     {"hello"},
+		"multiple.example.com": {"v=spf1 -all", "v=spf1 ~all"},
+	})
+	for _, domain := range []string{"", "none.example.com", "multiple.example.com", "missing.example.com"} {
+		if _, err := EvaluateSPF(context.Background(), domain); err == nil {
+			t.Errorf("EvaluateSPF(%q) expected error", domain)
+		}
+	}
+}
+
+func TestParseSPFPrefixes(t *testing.T) {
+	tests := []struct {
+		s        string
+		v4, v6   int
+		wantFail bool
+	}{
+		{"", 32, 128, false},
+		{"/24", 24, 128, false},
+		{"//64", 32, 64, false},
+		{"/24//64", 24, 64, false},
+		{"/33", 0, 0, true},
+		{"24", 0, 0, true},
+		{"//129", 0, 0, true},
+	}
+	for _, tt := range tests {
+		v4, v6, ok := parseSPFPrefixes(tt.s)
+		if ok == tt.wantFail || (ok && (v4 != tt.v4 || v6 != tt.v6)) {
+			t.Errorf("parseSPFPrefixes(%q) = %d, %d, %v", tt.s, v4, v6, ok)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// srvDialTimeout limits each connection attempt of DialSRV, so an unreachable target doesn't use up the context
+var srvDialTimeout = 5 * time.Second
+
+// lookupSRV returns the SRV records of a service, replaced in tests
+var lookupSRV = func(ctx context.Context, service, proto, domain string) (string, []*net.SRV, error) {
+	resolver := &net.Resolver{
+		PreferGo: true,
+	}
+	return resolver.LookupSRV(ctx, service, proto, domain)
+}
+
+// DialSRV looks up the SRV records of the service ("xmpp-client", "sip", "minecraft", ...) of the domain
+// and connects to the targets in RFC 2782 order: lowest priority first, targets of the same priority
+// picked at random in proportion to their weight. The first connection established is returned with
+// the "host:port" of its target. proto is "tcp" or "udp".
+func DialSRV(ctx context.Context, service, proto, domain string) (net.Conn, string, error) {
+	if domain == "" {
+		return nil, "", fmt.Errorf("domain cannot be empty")
+	}
+	if proto != "tcp" && proto != "udp" {
+		return nil, "", fmt.Errorf("invalid protocol %q", proto)
+	}
+	domain = cleanDomain(domain)
+	name := "_" + service + "._" + proto + "." + domain
+
+	_, records, err := lookupSRV(ctx, service, proto, domain)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to lookup SRV records of %s: %w", name, err)
+	}
+	// A single record with target "." means the service is decidedly not available
+	if len(records) == 0 || (len(records) == 1 && strings.TrimSuffix(records[0].Target, ".") == "") {
+		return nil, "", fmt.Errorf("%s is not available", name)
+	}
+
+	var errs []error
+	for _, srv := range orderSRV(records) {
+		if err := ctx.Err(); err != nil {
+			return nil, "", err
+		}
+		target := net.JoinHostPort(strings.TrimSuffix(srv.Target, "."), strconv.Itoa(int(srv.Port)))
+		dialer := net.Dialer{Timeout: srvDialTimeout}
+		conn, err := dialer.DialContext(ctx, proto, target)
+		if err == nil {
+			return conn, target, nil
+		}
+		errs = append(errs, err)
+	}
+	return nil, "", fmt.Errorf("failed to connect to %s: %w", name, errors.Join(errs...))
+}
+
+// srvRandom returns a random number in [0, n), replaced in tests
+var srvRandom = rand.Intn
+
+// orderSRV sorts the records by priority and orders the records of each priority by the weighted random
+// selection of RFC 2782: the records with weight 0 are placed first, a number in [0, sum of the weights]
+// is picked and the first record whose running sum of weights reaches it is selected next. Records with
+// weight 0 have a small chance to be selected first.
+func orderSRV(records []*net.SRV) []*net.SRV {
+	ordered := append([]*net.SRV(nil), records...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		if ordered[i].Priority != ordered[j].Priority {
+			return ordered[i].Priority < ordered[j].Priority
+		}
+		return ordered[i].Weight == 0 && ordered[j].Weight != 0
+	})
+
+	for start := 0; start < len(ordered); {
+		end := start
+		for end < len(ordered) && ordered[end].Priority == ordered[start].Priority {
+			end++
+		}
+		group := ordered[start:end]
+		for i := range group {
+			sum := 0
+			for _, srv := range group[i:] {
+				sum += int(srv.Weight)
+			}
+			pick := srvRandom(sum + 1)
+			running := 0
+			for j := i; j < len(group); j++ {
+				running += int(group[j].Weight)
+				if running >= pick {
+					// The unselected records keep their order, zero weights stay in front
+					selected := group[j]
+					copy(group[i+1:j+1], group[i:j])
+					group[i] = selected
+					break
+				}
+			}
+		}
+		start = end
+	}
+	return ordered
+}
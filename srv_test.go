@@ -0,0 +1,120 @@
+package network
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+)
+
+func TestDialSRV(t *testing.T) {
+	original := lookupSRV
+	defer func() { lookupSRV = original }()
+
+	host, port := startTestTCPServer(t)
+	closed := closedPort(t)
+	var queried string
+	lookupSRV = func(ctx context.Context, service, proto, domain string) (string, []*net.SRV, error) {
+		queried = "_" + service + "._" + proto + "." + domain
+		return queried + ".", []*net.SRV{
+			{Target: host + ".", Port: uint16(port), Priority: 20, Weight: 10},
+			{Target: "127.0.0.1.", Port: uint16(closed), Priority: 10, Weight: 10},
+		}, nil
+	}
+
+	conn, target, err := DialSRV(context.Background(), "xmpp-client", "tcp", "example.com")
+	if err != nil {
+		t.Fatalf("DialSRV() error = %v", err)
+	}
+	conn.Close()
+	if queried != "_xmpp-client._tcp.example.com" {
+		t.Errorf("queried %q", queried)
+	}
+	// The preferred target refuses connections, the backup is used
+	if want := net.JoinHostPort(host, strconv.Itoa(port)); target != want {
+		t.Errorf("DialSRV() target = %q, want %q", target, want)
+	}
+
+	// No target accepts
+	lookupSRV = func(ctx context.Context, service, proto, domain string) (string, []*net.SRV, error) {
+		return "", []*net.SRV{{Target: "127.0.0.1.", Port: uint16(closed)}}, nil
+	}
+	if _, _, err := DialSRV(context.Background(), "sip", "tcp", "example.com"); err == nil {
+		t.Error("expected error when no target accepts")
+	}
+
+	// "." announces that the service is not available
+	lookupSRV = func(ctx context.Context, service, proto, domain string) (string, []*net.SRV, error) {
+		return "", []*net.SRV{{Target: ".", Port: 0}}, nil
+	}
+	if _, _, err := DialSRV(context.Background(), "sip", "tcp", "example.com"); err == nil {
+		t.Error("expected error for unavailable service")
+	}
+	if _, _, err := DialSRV(context.Background(), "sip", "sctp", "example.com"); err == nil {
+		t.Error("expected error for invalid protocol")
+	}
+}
+
+func TestOrderSRV(t *testing.T) {
+	records := []*net.SRV{
+		{Target: "c", Priority: 20, Weight: 0},
+		{Target: "light", Priority: 10, Weight: 1},
+		{Target: "heavy", Priority: 10, Weight: 99},
+	}
+
+	// Every number of [0, sum] is picked once, the first records count the exact RFC 2782 proportions
+	first := func(records []*net.SRV, sum int) map[string]int {
+		original := srvRandom
+		defer func() { srvRandom = original }()
+		counts := map[string]int{}
+		for pick := 0; pick <= sum; pick++ {
+			calls := 0
+			srvRandom = func(n int) int {
+				if n != sum+1 && calls == 0 {
+					t.Fatalf("srvRandom(%d), want %d", n, sum+1)
+				}
+				calls++
+				if calls == 1 {
+					return pick
+				}
+				return 0
+			}
+			ordered := orderSRV(records)
+			if len(ordered) != len(records) || ordered[len(ordered)-1].Priority != 20 {
+				t.Fatalf("orderSRV() = %v, priority 20 must come last", ordered)
+			}
+			counts[ordered[0].Target]++
+		}
+		return counts
+	}
+
+	// light wins with 0 and 1, heavy with 2..100
+	if counts := first(records, 100); counts["light"] != 2 || counts["heavy"] != 99 {
+		t.Errorf("first targets = %v, want light 2 and heavy 99 of 101", counts)
+	}
+
+	// The zero weight record is placed first and only selected by 0
+	zero := []*net.SRV{
+		{Target: "b", Priority: 10, Weight: 20},
+		{Target: "zero", Priority: 10, Weight: 0},
+		{Target: "a", Priority: 10, Weight: 10},
+		{Target: "c", Priority: 20, Weight: 5},
+	}
+	if counts := first(zero, 30); counts["zero"] != 1 || counts["b"] != 20 || counts["a"] != 10 {
+		t.Errorf("first targets = %v, want zero 1, b 20 and a 10 of 31", counts)
+	}
+
+	// Random selection still puts the heavy target first most of the time
+	heavyFirst := 0
+	for i := 0; i < 1000; i++ {
+		if orderSRV(records)[0].Target == "heavy" {
+			heavyFirst++
+		}
+	}
+	if heavyFirst < 900 {
+		t.Errorf("heavy target was first %d of 1000 times", heavyFirst)
+	}
+	if records[0].Target != "c" {
+		t.Error("orderSRV() modified its input")
+	}
+}
@@ -0,0 +1,90 @@
+package network
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// DefaultPorts maps URL schemes to their default port
+var DefaultPorts = map[string]int{
+	"http":  80,
+	"https": 443,
+	"ws":    80,
+	"wss":   443,
+	"ftp":   21,
+	"ssh":   22,
+	"smtp":  25,
+	"dns":   53,
+	"ldap":  389,
+	"ldaps": 636,
+}
+
+// ParseTarget splits a target such as "example.com:443", "https://example.com", "[::1]:80" or a bare host
+// into host, port and scheme. When the port is missing it defaults by scheme, or 0 if the scheme is unknown.
+func ParseTarget(s string) (host string, port int, scheme string, err error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", 0, "", fmt.Errorf("target cannot be empty")
+	}
+
+	if strings.Contains(s, "://") {
+		u, err := url.Parse(s)
+		if err != nil {
+			return "", 0, "", fmt.Errorf("invalid target %s: %w", s, err)
+		}
+		scheme = strings.ToLower(u.Scheme)
+		host = u.Hostname()
+		if host == "" {
+			return "", 0, "", fmt.Errorf("invalid target %s: missing host", s)
+		}
+		if u.Port() != "" {
+			port, err = parsePort(u.Port())
+			if err != nil {
+				return "", 0, "", err
+			}
+		} else {
+			port = DefaultPorts[scheme]
+		}
+		return host, port, scheme, nil
+	}
+
+	// Bare IPv6 address without brackets, e.g. "::1" or "fe80::1%eth0"
+	if strings.Count(s, ":") > 1 && !strings.HasPrefix(s, "[") {
+		if ip := net.ParseIP(strings.SplitN(s, "%", 2)[0]); ip == nil {
+			return "", 0, "", fmt.Errorf("invalid target %s", s)
+		}
+		return s, 0, "", nil
+	}
+
+	if h, p, splitErr := net.SplitHostPort(s); splitErr == nil {
+		if h == "" {
+			return "", 0, "", fmt.Errorf("invalid target %s: missing host", s)
+		}
+		port, err = parsePort(p)
+		if err != nil {
+			return "", 0, "", err
+		}
+		return h, port, "", nil
+	}
+
+	if strings.HasPrefix(s, "[") != strings.HasSuffix(s, "]") {
+		return "", 0, "", fmt.Errorf("invalid target %s: unbalanced brackets", s)
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	if strings.ContainsAny(host, "[]/ ") {
+		return "", 0, "", fmt.Errorf("invalid target %s", s)
+	}
+	return host, 0, "", nil
+}
+
+// parsePort parses and validates a port number
+func parsePort(s string) (int, error) {
+	port, err := strconv.Atoi(s)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("invalid port %s", s)
+	}
+	return port, nil
+}
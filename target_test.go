@@ -0,0 +1,53 @@
+package network
+
+import "testing"
+
+func TestParseTarget(t *testing.T) {
+	tests := []struct {
+		input   string
+		host    string
+		port    int
+		scheme  string
+		wantErr bool
+	}{
+		{input: "example.com:443", host: "example.com", port: 443},
+		{input: "example.com", host: "example.com"},
+		{input: "192.168.1.1:22", host: "192.168.1.1", port: 22},
+		{input: "https://example.com", host: "example.com", port: 443, scheme: "https"},
+		{input: "http://example.com/path?q=1", host: "example.com", port: 80, scheme: "http"},
+		{input: "HTTPS://example.com:8443/", host: "example.com", port: 8443, scheme: "https"},
+		{input: "ssh://10.0.0.1", host: "10.0.0.1", port: 22, scheme: "ssh"},
+		{input: "gopher://example.com", host: "example.com", port: 0, scheme: "gopher"},
+		{input: "[::1]:80", host: "::1", port: 80},
+		{input: "[2001:db8::1]", host: "2001:db8::1"},
+		{input: "2001:db8::1", host: "2001:db8::1"},
+		{input: "fe80::1%eth0", host: "fe80::1%eth0"},
+		{input: "[fe80::1%eth0]:8080", host: "fe80::1%eth0", port: 8080},
+		{input: "https://[2001:db8::1]", host: "2001:db8::1", port: 443, scheme: "https"},
+		{input: "https://[2001:db8::1]:8443", host: "2001:db8::1", port: 8443, scheme: "https"},
+		{input: "  example.com:80  ", host: "example.com", port: 80},
+		{input: "", wantErr: true},
+		{input: "example.com:0", wantErr: true},
+		{input: "example.com:70000", wantErr: true},
+		{input: "example.com:http", wantErr: true},
+		{input: ":80", wantErr: true},
+		{input: "https://", wantErr: true},
+		{input: "2001:db8::zz", wantErr: true},
+		{input: "[::1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		host, port, scheme, err := ParseTarget(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseTarget(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if host != tt.host || port != tt.port || scheme != tt.scheme {
+			t.Errorf("ParseTarget(%q) = %q, %d, %q, want %q, %d, %q",
+				tt.input, host, port, scheme, tt.host, tt.port, tt.scheme)
+		}
+	}
+}
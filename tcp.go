@@ -0,0 +1,474 @@
+package network
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http/httptrace"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// ProbeOptions holds the settings shared by the connection probes. It's embedded into their option structs
+// (TCPPingOptions, PortScanOptions, HTTPCheckOptions), so every probe is tuned with the same fields:
+//
+//	network.TCPPing(ctx, host, 443, &network.TCPPingOptions{
+//		ProbeOptions: network.ProbeOptions{Timeout: time.Second, Retries: 2, Interface: "eth1"},
+//		Count:        4,
+//	})
+//
+// The default timeout is documented by each probe.
+type ProbeOptions struct {
+	Timeout time.Duration // Timeout of each attempt
+	Retries int           // Number of times a failed attempt is repeated before it counts as failed
+
+	// Interface sends the probes from an address of the interface in the family of each destination:
+	// its first IPv4 address for IPv4 targets, its first IPv6 address (global before link-local) for
+	// IPv6 targets. SourceAddr sets the source address directly, it must be assigned to this host, and
+	// to Interface if both are set.
+	Interface  string
+	SourceAddr net.IP
+
+	// Addresses of Interface, set by normalize unless SourceAddr is set
+	ipv4Source *net.TCPAddr
+	ipv6Source *net.TCPAddr
+}
+
+// normalize validates the options, fills in the default timeout and looks up the addresses of Interface
+func (o ProbeOptions) normalize(defaultTimeout time.Duration) (ProbeOptions, error) {
+	if o.Timeout <= 0 {
+		o.Timeout = defaultTimeout
+	}
+	if o.Retries < 0 {
+		o.Retries = 0
+	}
+
+	if o.SourceAddr != nil {
+		interf, err := interfaceByIP(o.SourceAddr)
+		if err != nil {
+			return o, fmt.Errorf("source address %s is not assigned to this host", o.SourceAddr)
+		}
+		if o.Interface != "" && interf.Name != o.Interface {
+			return o, fmt.Errorf("source address %s is not assigned to %s", o.SourceAddr, o.Interface)
+		}
+		return o, nil
+	}
+	if o.Interface == "" {
+		return o, nil
+	}
+
+	interf, err := net.InterfaceByName(o.Interface)
+	if err != nil {
+		return o, fmt.Errorf("invalid interface %s: %w", o.Interface, err)
+	}
+	addrs, err := interf.Addrs()
+	if err != nil {
+		return o, fmt.Errorf("failed to get addresses of %s: %w", o.Interface, err)
+	}
+	var linkLocal *net.TCPAddr
+	for _, addr := range addrs {
+		ipnet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		switch {
+		case ipnet.IP.To4() != nil:
+			if o.ipv4Source == nil {
+				o.ipv4Source = &net.TCPAddr{IP: ipnet.IP}
+			}
+		case isLinkLocalIPv6(ipnet.IP):
+			if linkLocal == nil {
+				linkLocal = &net.TCPAddr{IP: ipnet.IP, Zone: interf.Name}
+			}
+		case o.ipv6Source == nil:
+			o.ipv6Source = &net.TCPAddr{IP: ipnet.IP}
+		}
+	}
+	if o.ipv6Source == nil {
+		o.ipv6Source = linkLocal
+	}
+	if o.ipv4Source == nil && o.ipv6Source == nil {
+		return o, fmt.Errorf("interface %s has no address", o.Interface)
+	}
+	return o, nil
+}
+
+// dialer returns the direct dialer of the probes, connecting from the source address or interface
+func (o ProbeOptions) dialer() directDialer {
+	if o.SourceAddr == nil && (o.ipv4Source != nil || o.ipv6Source != nil) {
+		return &interfaceDialer{timeout: o.Timeout, name: o.Interface, ipv4: o.ipv4Source, ipv6: o.ipv6Source}
+	}
+	return newDirectDialer(o.Timeout, o.SourceAddr)
+}
+
+// TCPPingOptions configures TCP ping behavior
+type TCPPingOptions struct {
+	ProbeOptions               // Timeout of each attempt (default: 4 seconds), retries and source address
+	Count        int           // Number of connection attempts (default: 4)
+	Interval     time.Duration // Delay between attempts (default: 1 second)
+
+	// ProxyAddr is the address (host:port) of a SOCKS5 proxy to connect through. The latency is then
+	// measured from here through the proxy to the target.
+	ProxyAddr string
+
+	// TLS performs a TLS handshake after connecting and reports its duration in the timing of the
+	// replies. The certificate is not verified since only the latency is measured.
+	TLS bool
+
+	// Strategy selects the order in which the IPv4 and IPv6 addresses of a host name are connected to,
+	// the system's order is used by default. It is not supported together with ProxyAddr.
+	Strategy ResolveStrategy
+}
+
+// ConnectTiming is the connection setup breakdown of a TCPPing attempt
+type ConnectTiming struct {
+	DNS     time.Duration // Host name resolution, 0 for IP addresses and proxies resolving the name
+	Connect time.Duration // TCP handshake, with the proxy if one is used
+	TLS     time.Duration // TLS handshake, 0 unless TCPPingOptions.TLS is set
+}
+
+// PortScanOptions configures port scan behavior
+type PortScanOptions struct {
+	ProbeOptions        // Timeout of each port (default: 2 seconds), retries and source address
+	Concurrency  int    // Number of ports probed in parallel (default: 100)
+	ProxyAddr    string // SOCKS5 proxy (host:port) to connect through
+}
+
+// PortResult is the state of a scanned port
+type PortResult struct {
+	Port    int
+	Open    bool
+	Latency time.Duration // Time to establish the connection if open
+}
+
+// TCPPing measures reachability and latency of a TCP port by repeatedly opening connections.
+// Unlike ICMP ping it works through SOCKS5 proxies and firewalls which block ICMP.
+func TCPPing(ctx context.Context, host string, port int, options *TCPPingOptions) (*PingResult, error) {
+	if host == "" {
+		return nil, fmt.Errorf("host cannot be empty")
+	}
+	host = withZone(host)
+	if port < 1 || port > 65535 {
+		return nil, fmt.Errorf("invalid port %d", port)
+	}
+
+	if options == nil {
+		options = &TCPPingOptions{}
+	}
+	count := options.Count
+	if count <= 0 {
+		count = 4
+	}
+	probe, err := options.ProbeOptions.normalize(4 * time.Second)
+	if err != nil {
+		return nil, err
+	}
+	interval := options.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	if !options.Strategy.valid() {
+		return nil, fmt.Errorf("unsupported resolve strategy %d", options.Strategy)
+	}
+	if options.Strategy != StrategyDefault && options.ProxyAddr != "" {
+		return nil, fmt.Errorf("resolve strategy is not supported with a proxy")
+	}
+
+	dialer, err := newContextDialer(options.ProxyAddr, probe.dialer())
+	if err != nil {
+		return nil, err
+	}
+	if options.Strategy != StrategyDefault {
+		dialer = &strategyDialer{dialer: probe.dialer(), strategy: options.Strategy}
+	}
+
+	address := net.JoinHostPort(host, strconv.Itoa(port))
+	result := &PingResult{
+		Host: address,
+	}
+
+	for seq := 1; seq <= count; seq++ {
+		if seq > 1 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(interval):
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		reply := tcpConnectRetry(ctx, dialer, address, seq, probe, options.TLS)
+		// Through a proxy the connection's peer is the proxy, the address of the target is unknown
+		if options.ProxyAddr != "" {
+			reply.From = nil
+		}
+		result.Replies = append(result.Replies, reply)
+	}
+
+	result.summarizeReplies()
+	if !result.Success && len(result.Replies) > 0 {
+		result.ErrorMessage = fmt.Sprintf("failed to connect to %s: %s", address, result.Replies[len(result.Replies)-1].Error)
+	}
+	return result, nil
+}
+
+// ScanPorts checks which of the given TCP ports accept connections. Results are sorted by port.
+func ScanPorts(ctx context.Context, host string, ports []int, options *PortScanOptions) ([]PortResult, error) {
+	if host == "" {
+		return nil, fmt.Errorf("host cannot be empty")
+	}
+	host = withZone(host)
+	for _, port := range ports {
+		if port < 1 || port > 65535 {
+			return nil, fmt.Errorf("invalid port %d", port)
+		}
+	}
+
+	if options == nil {
+		options = &PortScanOptions{}
+	}
+	probe, err := options.ProbeOptions.normalize(2 * time.Second)
+	if err != nil {
+		return nil, err
+	}
+	concurrency := options.Concurrency
+	if concurrency <= 0 {
+		concurrency = 100
+	}
+
+	dialer, err := newContextDialer(options.ProxyAddr, probe.dialer())
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results []PortResult
+		jobs    = make(chan int)
+	)
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for port := range jobs {
+				reply := tcpConnectRetry(ctx, dialer, net.JoinHostPort(host, strconv.Itoa(port)), 0, probe, false)
+				mu.Lock()
+				results = append(results, PortResult{Port: port, Open: reply.Error == "", Latency: reply.RTT})
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, port := range ports {
+		if ctx.Err() != nil {
+			break
+		}
+		jobs <- port
+	}
+	close(jobs)
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Port < results[j].Port
+	})
+	return results, ctx.Err()
+}
+
+// tcpConnectRetry connects like tcpConnect and repeats failed attempts up to the retries of the options
+func tcpConnectRetry(ctx context.Context, dialer proxy.ContextDialer, address string, seq int, probe ProbeOptions, useTLS bool) PingReply {
+	reply := tcpConnect(ctx, dialer, address, seq, probe.Timeout, useTLS)
+	for attempt := 1; attempt <= probe.Retries && reply.Error != "" && ctx.Err() == nil; attempt++ {
+		logger().Info("retrying TCP connect", "address", address, "attempt", attempt, "error", reply.Error)
+		reply = tcpConnect(ctx, dialer, address, seq, probe.Timeout, useTLS)
+	}
+	return reply
+}
+
+// tcpConnect opens and closes a single connection and returns its outcome with the timing of the
+// connection setup. With useTLS a TLS handshake is performed after connecting.
+func tcpConnect(ctx context.Context, dialer proxy.ContextDialer, address string, seq int, timeout time.Duration, useTLS bool) PingReply {
+	conn, reply := tcpDial(ctx, dialer, address, seq, timeout, useTLS)
+	if conn != nil {
+		conn.Close()
+	}
+	return reply
+}
+
+// tcpDial opens a connection like tcpConnect and returns it open, the connection is nil if the reply
+// holds an error
+func tcpDial(ctx context.Context, dialer proxy.ContextDialer, address string, seq int, timeout time.Duration, useTLS bool) (net.Conn, PingReply) {
+	reply := PingReply{Seq: seq}
+
+	dialCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// The hooks may run concurrently, and even after the dial returned, when several addresses
+	// are dialed in parallel
+	var (
+		mu           sync.Mutex
+		timing       ConnectTiming
+		dnsStart     time.Time
+		connectStart time.Time
+	)
+	snapshot := func() *ConnectTiming {
+		mu.Lock()
+		defer mu.Unlock()
+		current := timing
+		return &current
+	}
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			mu.Lock()
+			dnsStart = time.Now()
+			mu.Unlock()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			mu.Lock()
+			timing.DNS = time.Since(dnsStart)
+			mu.Unlock()
+		},
+		ConnectStart: func(string, string) {
+			mu.Lock()
+			if connectStart.IsZero() {
+				connectStart = time.Now()
+			}
+			mu.Unlock()
+		},
+		ConnectDone: func(_, _ string, err error) {
+			mu.Lock()
+			if err == nil && timing.Connect == 0 {
+				timing.Connect = time.Since(connectStart)
+			}
+			mu.Unlock()
+		},
+	}
+
+	start := time.Now()
+	conn, err := dialer.DialContext(httptrace.WithClientTrace(dialCtx, trace), "tcp", address)
+	reply.Timing = snapshot()
+	if err != nil {
+		reply.Error = err.Error()
+		return nil, reply
+	}
+	reply.RTT = time.Since(start)
+	if addr, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		reply.From = addr.IP
+	}
+
+	if useTLS {
+		host, _, _ := net.SplitHostPort(address)
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: host, InsecureSkipVerify: true})
+		handshakeStart := time.Now()
+		if err := tlsConn.HandshakeContext(dialCtx); err != nil {
+			conn.Close()
+			reply.Error = fmt.Sprintf("TLS handshake failed: %v", err)
+			return nil, reply
+		}
+		reply.Timing.TLS = time.Since(handshakeStart)
+		return tlsConn, reply
+	}
+	return conn, reply
+}
+
+// newDirectDialer returns a dialer connecting from the local address, any address if nil
+func newDirectDialer(timeout time.Duration, local net.IP) *net.Dialer {
+	dialer := &net.Dialer{Timeout: timeout}
+	if local != nil {
+		dialer.LocalAddr = &net.TCPAddr{IP: local}
+	}
+	return dialer
+}
+
+// directDialer connects without a proxy
+type directDialer interface {
+	proxy.Dialer
+	proxy.ContextDialer
+}
+
+// interfaceDialer connects from the address of an interface in the family of the destination, the
+// addresses of host names are tried in order until one accepts the connection
+type interfaceDialer struct {
+	timeout    time.Duration
+	name       string
+	ipv4, ipv6 *net.TCPAddr
+}
+
+// Dial connects to the address without a context
+func (d *interfaceDialer) Dial(network, address string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, address)
+}
+
+// DialContext connects to the address from the interface address of its family
+func (d *interfaceDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	var targets []net.IPAddr
+	if ip, zone := splitZone(host); ip != nil {
+		targets = []net.IPAddr{{IP: ip, Zone: zone}}
+	} else {
+		targets, err = lookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s: %w", host, err)
+		}
+	}
+
+	if d.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.timeout)
+		defer cancel()
+	}
+	var errs []error
+	for _, target := range targets {
+		local, family := d.ipv4, 4
+		if target.IP.To4() == nil {
+			local, family = d.ipv6, 6
+		}
+		if local == nil {
+			errs = append(errs, fmt.Errorf("interface %s has no IPv%d address to connect to %s", d.name, family, target.IP))
+			continue
+		}
+		dialer := &net.Dialer{LocalAddr: local}
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(target.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if len(errs) == 0 {
+		return nil, fmt.Errorf("no addresses found for %s", host)
+	}
+	return nil, errors.Join(errs...)
+}
+
+// newContextDialer returns the direct dialer, or a SOCKS5 dialer connecting through it if a proxy
+// address is given
+func newContextDialer(proxyAddr string, direct directDialer) (proxy.ContextDialer, error) {
+	if proxyAddr == "" {
+		return direct, nil
+	}
+
+	dialer, err := proxy.SOCKS5("tcp", proxyAddr, nil, direct)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SOCKS5 proxy %s: %w", proxyAddr, err)
+	}
+	contextDialer, ok := dialer.(proxy.ContextDialer)
+	if !ok {
+		return nil, fmt.Errorf("SOCKS5 dialer does not support contexts")
+	}
+	return contextDialer, nil
+}
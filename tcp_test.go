@@ -0,0 +1,367 @@
+package network
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// startTestTCPServer accepts and immediately closes connections on localhost
+func startTestTCPServer(t testing.TB) (string, int) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	addr := listener.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port
+}
+
+// closedPort returns a localhost port nobody listens on
+func closedPort(t testing.TB) int {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+	return port
+}
+
+// startTestSOCKS5Server runs a minimal no-auth SOCKS5 server supporting CONNECT
+func startTestSOCKS5Server(t testing.TB, connects *int32) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	handle := func(conn net.Conn) {
+		defer conn.Close()
+
+		// Greeting: version, number of methods, methods
+		header := make([]byte, 2)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		if _, err := io.ReadFull(conn, make([]byte, header[1])); err != nil {
+			return
+		}
+		conn.Write([]byte{5, 0})
+
+		// Request: version, command, reserved, address type
+		request := make([]byte, 4)
+		if _, err := io.ReadFull(conn, request); err != nil {
+			return
+		}
+		var host string
+		switch request[3] {
+		case 1:
+			ip := make([]byte, 4)
+			io.ReadFull(conn, ip)
+			host = net.IP(ip).String()
+		case 3:
+			length := make([]byte, 1)
+			io.ReadFull(conn, length)
+			name := make([]byte, length[0])
+			io.ReadFull(conn, name)
+			host = string(name)
+		case 4:
+			ip := make([]byte, 16)
+			io.ReadFull(conn, ip)
+			host = net.IP(ip).String()
+		}
+		portBytes := make([]byte, 2)
+		io.ReadFull(conn, portBytes)
+		port := binary.BigEndian.Uint16(portBytes)
+
+		atomic.AddInt32(connects, 1)
+		target, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(port))))
+		if err != nil {
+			conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+			return
+		}
+		defer target.Close()
+		conn.Write([]byte{5, 0, 0, 1, 127, 0, 0, 1, 0, 0})
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go handle(conn)
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+func TestTCPPing(t *testing.T) {
+	host, port := startTestTCPServer(t)
+
+	result, err := TCPPing(context.Background(), host, port, &TCPPingOptions{Count: 3, Interval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("TCPPing() error = %v", err)
+	}
+	if !result.Success || result.Sent != 3 || result.Received != 3 || result.PacketLoss != 0 {
+		t.Errorf("TCPPing() unexpected result: %+v", result)
+	}
+	if len(result.Replies) != 3 || result.Replies[2].Seq != 3 {
+		t.Errorf("TCPPing() replies = %+v", result.Replies)
+	}
+	if result.AvgRTT <= 0 || result.MinRTT > result.MaxRTT {
+		t.Errorf("TCPPing() invalid RTT statistics: min %v avg %v max %v", result.MinRTT, result.AvgRTT, result.MaxRTT)
+	}
+
+	result, err = TCPPing(context.Background(), "127.0.0.1", closedPort(t), &TCPPingOptions{Count: 2, Interval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("TCPPing() error = %v", err)
+	}
+	if result.Success || result.Received != 0 || result.PacketLoss != 100 || result.ErrorMessage == "" {
+		t.Errorf("TCPPing() to closed port unexpected result: %+v", result)
+	}
+
+	if _, err := TCPPing(context.Background(), "127.0.0.1", 0, nil); err == nil {
+		t.Error("TCPPing() expected error for invalid port")
+	}
+}
+
+func TestTCPPingTiming(t *testing.T) {
+	_, port := startTestTCPServer(t)
+
+	result, err := TCPPing(context.Background(), "localhost", port, &TCPPingOptions{Count: 1})
+	if err != nil {
+		t.Fatalf("TCPPing() error = %v", err)
+	}
+	if !result.Success || len(result.Replies) != 1 {
+		t.Fatalf("TCPPing() unexpected result: %+v", result)
+	}
+	timing := result.Replies[0].Timing
+	if timing == nil || timing.DNS <= 0 || timing.Connect <= 0 || timing.TLS != 0 {
+		t.Errorf("Timing = %+v", timing)
+	}
+
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+	addr := server.Listener.Addr().(*net.TCPAddr)
+
+	result, err = TCPPing(context.Background(), addr.IP.String(), addr.Port, &TCPPingOptions{Count: 1, TLS: true})
+	if err != nil {
+		t.Fatalf("TCPPing(TLS) error = %v", err)
+	}
+	if !result.Success {
+		t.Fatalf("TCPPing(TLS) unexpected result: %+v", result)
+	}
+	timing = result.Replies[0].Timing
+	if timing.DNS != 0 || timing.Connect <= 0 || timing.TLS <= 0 {
+		t.Errorf("TLS Timing = %+v", timing)
+	}
+
+	// Plain TCP servers fail the TLS handshake
+	result, err = TCPPing(context.Background(), "127.0.0.1", port, &TCPPingOptions{Count: 1, TLS: true})
+	if err != nil {
+		t.Fatalf("TCPPing(TLS) error = %v", err)
+	}
+	if result.Success || !strings.Contains(result.Replies[0].Error, "TLS handshake failed") {
+		t.Errorf("TCPPing(TLS) to plain server = %+v", result.Replies)
+	}
+}
+
+func TestTCPPingThroughProxy(t *testing.T) {
+	var connects int32
+	proxyAddr := startTestSOCKS5Server(t, &connects)
+	host, port := startTestTCPServer(t)
+
+	result, err := TCPPing(context.Background(), host, port, &TCPPingOptions{
+		Count:     2,
+		Interval:  10 * time.Millisecond,
+		ProxyAddr: proxyAddr,
+	})
+	if err != nil {
+		t.Fatalf("TCPPing() error = %v", err)
+	}
+	if !result.Success || result.Received != 2 {
+		t.Errorf("TCPPing() through proxy unexpected result: %+v", result)
+	}
+	if atomic.LoadInt32(&connects) != 2 {
+		t.Errorf("proxy handled %d connects, want 2", connects)
+	}
+	for _, reply := range result.Replies {
+		if reply.From != nil {
+			t.Errorf("reply From = %v through a proxy, want nil", reply.From)
+		}
+	}
+}
+
+func TestScanPorts(t *testing.T) {
+	var connects int32
+	proxyAddr := startTestSOCKS5Server(t, &connects)
+	host, open := startTestTCPServer(t)
+	closed := closedPort(t)
+
+	for _, proxyAddr := range []string{"", proxyAddr} {
+		results, err := ScanPorts(context.Background(), host, []int{closed, open}, &PortScanOptions{
+			ProbeOptions: ProbeOptions{Timeout: time.Second},
+			ProxyAddr:    proxyAddr,
+		})
+		if err != nil {
+			t.Fatalf("ScanPorts() error = %v", err)
+		}
+		if len(results) != 2 {
+			t.Fatalf("ScanPorts() returned %d results, want 2", len(results))
+		}
+		for _, result := range results {
+			if result.Open != (result.Port == open) {
+				t.Errorf("ScanPorts(proxy=%q) port %d open = %v", proxyAddr, result.Port, result.Open)
+			}
+		}
+	}
+	if atomic.LoadInt32(&connects) != 2 {
+		t.Errorf("proxy handled %d connects, want 2", connects)
+	}
+}
+
+func TestProbeOptions(t *testing.T) {
+	loopback, err := interfaceByIP(net.ParseIP("127.0.0.1"))
+	if err != nil {
+		t.Skipf("no loopback interface: %v", err)
+	}
+
+	probe, err := ProbeOptions{Retries: -1}.normalize(2 * time.Second)
+	if err != nil || probe.Timeout != 2*time.Second || probe.Retries != 0 || probe.SourceAddr != nil {
+		t.Errorf("normalize() = %+v, %v", probe, err)
+	}
+
+	probe, err = ProbeOptions{Interface: loopback.Name}.normalize(time.Second)
+	if err != nil || probe.SourceAddr != nil || probe.ipv4Source == nil || !probe.ipv4Source.IP.Equal(net.ParseIP("127.0.0.1")) {
+		t.Errorf("normalize(Interface %s) = %+v, %v", loopback.Name, probe, err)
+	}
+	if _, err := (ProbeOptions{Interface: loopback.Name, SourceAddr: net.ParseIP("127.0.0.1")}).normalize(time.Second); err != nil {
+		t.Errorf("normalize() rejected the address of the interface: %v", err)
+	}
+
+	invalid := []ProbeOptions{
+		{SourceAddr: net.ParseIP("192.0.2.1")},
+		{Interface: "nonexistent0"},
+		{Interface: "nonexistent0", SourceAddr: net.ParseIP("127.0.0.1")},
+	}
+	for _, options := range invalid {
+		if _, err := options.normalize(time.Second); err == nil {
+			t.Errorf("normalize(%+v) accepted invalid options", options)
+		}
+	}
+}
+
+func TestTCPPingInterfaceIPv6(t *testing.T) {
+	loopback, err := interfaceByIP(net.ParseIP("127.0.0.1"))
+	if err != nil {
+		t.Skipf("no loopback interface: %v", err)
+	}
+	listener, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 loopback unavailable: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	// The interface address is chosen per destination family, an IPv4 source can't reach ::1
+	port := listener.Addr().(*net.TCPAddr).Port
+	result, err := TCPPing(context.Background(), "::1", port, &TCPPingOptions{
+		ProbeOptions: ProbeOptions{Timeout: time.Second, Interface: loopback.Name},
+		Count:        1,
+	})
+	if err != nil || !result.Success {
+		t.Fatalf("TCPPing(::1) from %s = %+v, %v", loopback.Name, result, err)
+	}
+}
+
+func TestTCPPingProbeOptions(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer listener.Close()
+	remote := make(chan net.Addr, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		remote <- conn.RemoteAddr()
+		conn.Close()
+	}()
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	result, err := TCPPing(context.Background(), "127.0.0.1", port, &TCPPingOptions{
+		ProbeOptions: ProbeOptions{SourceAddr: net.ParseIP("127.0.0.1")},
+		Count:        1,
+	})
+	if err != nil || !result.Success {
+		t.Fatalf("TCPPing() = %+v, %v", result, err)
+	}
+	if addr := (<-remote).(*net.TCPAddr); !addr.IP.Equal(net.ParseIP("127.0.0.1")) {
+		t.Errorf("connection came from %v, want 127.0.0.1", addr)
+	}
+
+	if _, err := TCPPing(context.Background(), "127.0.0.1", port, &TCPPingOptions{
+		ProbeOptions: ProbeOptions{SourceAddr: net.ParseIP("192.0.2.1")},
+	}); err == nil {
+		t.Error("TCPPing() accepted a source address not assigned to this host")
+	}
+
+	// Failed attempts are repeated before they count as lost
+	recorder := &recordingLogger{}
+	SetLogger(recorder)
+	defer SetLogger(nil)
+	result, err = TCPPing(context.Background(), "127.0.0.1", closedPort(t), &TCPPingOptions{
+		ProbeOptions: ProbeOptions{Retries: 2},
+		Count:        1,
+	})
+	if err != nil || result.Success || result.Sent != 1 || result.Lost != 1 {
+		t.Errorf("TCPPing() with retries = %+v, %v", result, err)
+	}
+	retries := 0
+	for _, event := range recorder.events {
+		if strings.HasPrefix(event, "INFO retrying TCP connect") {
+			retries++
+		}
+	}
+	if retries != 2 {
+		t.Errorf("logged %d retries, want 2", retries)
+	}
+}
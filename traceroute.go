@@ -0,0 +1,652 @@
+package network
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// Traceroute probe methods used by TracerouteOptions.Method
+const (
+	TracerouteICMP = "icmp" // ICMP echo requests
+	TracerouteUDP  = "udp"  // UDP datagrams, the destination answers with port unreachable
+	TracerouteTCP  = "tcp"  // TCP SYN to the port, reaches hosts which drop ICMP and UDP
+)
+
+// defaultTracerouteUDPPort is the first destination port of UDP probes, incremented for every probe
+const defaultTracerouteUDPPort = 33434
+
+// TracerouteOptions configures Traceroute
+type TracerouteOptions struct {
+	Method    string        // TracerouteICMP (default), TracerouteUDP or TracerouteTCP
+	Port      int           // Destination port, default 80 for TCP. UDP probes use 33434 and up unless set.
+	MaxHops   int           // Maximum TTL (default: 30)
+	Queries   int           // Probes per hop, the loss and RTT statistics of a hop are computed from them (default: 3)
+	Timeout   time.Duration // Time to wait for the answer of a probe (default: 2 seconds)
+	IPVersion int           // IPVersionAuto, IPVersion4 or IPVersion6
+}
+
+// DefaultTracerouteOptions returns default traceroute options
+func DefaultTracerouteOptions() *TracerouteOptions {
+	return &TracerouteOptions{
+		Method:  TracerouteICMP,
+		MaxHops: 30,
+		Queries: 3,
+		Timeout: 2 * time.Second,
+	}
+}
+
+// TracerouteHop is a TTL of the trace and the router which answered its probes
+type TracerouteHop struct {
+	TTL    int
+	From   net.IP          // Answering router, nil if no probe was answered
+	RTTs   []time.Duration // Round trip times of the answered probes
+	Lost   int             // Unanswered probes
+	Loss   float64         // Percentage of unanswered probes
+	MinRTT time.Duration
+	AvgRTT time.Duration
+	MaxRTT time.Duration
+	Error  string // Destination unreachable message such as "Destination Host Unreachable"
+}
+
+// summarize computes the loss and RTT statistics of the hop from its probes
+func (h *TracerouteHop) summarize() {
+	h.Loss, h.MinRTT, h.AvgRTT, h.MaxRTT = 0, 0, 0, 0
+	if sent := len(h.RTTs) + h.Lost; sent > 0 {
+		h.Loss = float64(h.Lost) / float64(sent) * 100
+	}
+	var sum time.Duration
+	for i, rtt := range h.RTTs {
+		if i == 0 || rtt < h.MinRTT {
+			h.MinRTT = rtt
+		}
+		if rtt > h.MaxRTT {
+			h.MaxRTT = rtt
+		}
+		sum += rtt
+	}
+	if len(h.RTTs) > 0 {
+		h.AvgRTT = sum / time.Duration(len(h.RTTs))
+	}
+}
+
+// TracerouteResult is the path to a host
+type TracerouteResult struct {
+	Host    string
+	IP      net.IP
+	Method  string
+	Hops    []TracerouteHop
+	Reached bool // The destination answered
+
+	ErrorMessage string // Why the trace failed, set by TracerouteMulti
+}
+
+// String returns the hops in the traceroute format
+func (r *TracerouteResult) String() string {
+	if r.ErrorMessage != "" {
+		return fmt.Sprintf("traceroute to %s failed: %s\n", r.Host, r.ErrorMessage)
+	}
+
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("traceroute to %s (%s) using %s\n", r.Host, r.IP, r.Method))
+	for _, hop := range r.Hops {
+		result.WriteString(fmt.Sprintf("%2d  ", hop.TTL))
+		if hop.From == nil {
+			result.WriteString("*\n")
+			continue
+		}
+		result.WriteString(hop.From.String())
+		for _, rtt := range hop.RTTs {
+			result.WriteString(fmt.Sprintf("  %.3f ms", float64(rtt)/float64(time.Millisecond)))
+		}
+		for i := 0; i < hop.Lost; i++ {
+			result.WriteString("  *")
+		}
+		if hop.Error != "" {
+			result.WriteString("  " + hop.Error)
+		}
+		result.WriteString("\n")
+	}
+	return result.String()
+}
+
+// Traceroute sends probes with increasing TTL to the host and reports the routers answering with
+// "Time to live exceeded" until the destination answers. TCP probes are SYNs to the port, a connection
+// accepted or refused by the destination ends the trace. A raw ICMP socket is required for every method.
+func Traceroute(ctx context.Context, host string, options *TracerouteOptions) (*TracerouteResult, error) {
+	if host == "" {
+		return nil, fmt.Errorf("host cannot be empty")
+	}
+
+	if options == nil {
+		options = DefaultTracerouteOptions()
+	} else {
+		copied := *options
+		options = &copied
+	}
+	if options.Method == "" {
+		options.Method = TracerouteICMP
+	}
+	if options.Method != TracerouteICMP && options.Method != TracerouteUDP && options.Method != TracerouteTCP {
+		return nil, fmt.Errorf("invalid traceroute method %q", options.Method)
+	}
+	if options.Port < 0 || options.Port > 65535 {
+		return nil, fmt.Errorf("invalid port %d", options.Port)
+	}
+	if options.Port == 0 && options.Method == TracerouteTCP {
+		options.Port = 80
+	}
+	if options.MaxHops <= 0 {
+		options.MaxHops = 30
+	}
+	if options.MaxHops > 255 {
+		return nil, fmt.Errorf("invalid max hops %d", options.MaxHops)
+	}
+	if options.Queries <= 0 {
+		options.Queries = 3
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = 2 * time.Second
+	}
+
+	target, err := resolvePingTarget(ctx, host, options.IPVersion)
+	if err != nil {
+		return nil, err
+	}
+	ip := target.IP
+
+	// A random identifier keeps the echo replies of concurrent traces apart
+	t := &tracer{ip: ip, ipv6: ip.To4() == nil, options: options, id: rand.Intn(0xffff) + 1}
+	network, address := "ip4:icmp", "0.0.0.0"
+	if t.ipv6 {
+		network, address = "ip6:ipv6-icmp", "::"
+	}
+	conn, err := icmp.ListenPacket(network, address)
+	if err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			return nil, fmt.Errorf("%w (%v)", ErrInsufficientPrivilege, err)
+		}
+		return nil, fmt.Errorf("failed to open ICMP socket: %w", err)
+	}
+	defer conn.Close()
+	t.sock = &icmpSocket{conn: conn, ipv6: t.ipv6, mode: PingModeRaw}
+
+	result := &TracerouteResult{Host: host, IP: ip, Method: options.Method}
+	seq := 0
+	for ttl := 1; ttl <= options.MaxHops && !result.Reached; ttl++ {
+		hop := TracerouteHop{TTL: ttl}
+		for q := 0; q < options.Queries; q++ {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			seq++
+			reply, err := t.probe(ctx, ttl, seq)
+			if err != nil {
+				return nil, err
+			}
+			if reply.from == nil {
+				hop.Lost++
+				continue
+			}
+			if hop.From == nil {
+				hop.From = reply.from
+			}
+			hop.RTTs = append(hop.RTTs, reply.rtt)
+			if reply.err != "" {
+				hop.Error = reply.err
+			}
+			result.Reached = result.Reached || reply.reached
+		}
+		hop.summarize()
+		result.Hops = append(result.Hops, hop)
+		// Routers reporting the destination unreachable end the trace as well
+		if hop.Error != "" {
+			break
+		}
+	}
+	return result, nil
+}
+
+// TracerouteMulti traces the hosts using at most concurrency parallel traces (default: 4) and returns the
+// results keyed by host. A failed trace doesn't abort the others, its result has ErrorMessage set. Hosts
+// not started before the context was done are missing from the results.
+func TracerouteMulti(ctx context.Context, hosts []string, options *TracerouteOptions, concurrency int) map[string]*TracerouteResult {
+	if concurrency <= 0 {
+		concurrency = 4
+	}
+
+	var mu sync.Mutex
+	results := make(map[string]*TracerouteResult)
+	forEachHost(ctx, hosts, concurrency, func(host string) {
+		result, err := Traceroute(ctx, host, options)
+		if err != nil {
+			result = &TracerouteResult{Host: host, ErrorMessage: err.Error()}
+		}
+		mu.Lock()
+		results[host] = result
+		mu.Unlock()
+	})
+	return results
+}
+
+// RouteChange is a hop which answered from another router than in the previous trace
+type RouteChange struct {
+	Position int // TTL of the hop
+	Old      net.IP
+	New      net.IP
+	At       time.Time
+}
+
+// MonitorRoute traces the route to the host every interval until the context is done and calls
+// onChange for every hop answering from another router than in the previous trace. Hops which didn't
+// answer in either trace are not compared, a lost probe is no route change. The error of a failed
+// trace is returned, the end of the context returns nil.
+func MonitorRoute(ctx context.Context, host string, options *TracerouteOptions, interval time.Duration, onChange func(RouteChange)) error {
+	if interval <= 0 {
+		return fmt.Errorf("invalid interval %v", interval)
+	}
+
+	var previous *TracerouteResult
+	for {
+		result, err := Traceroute(ctx, host, options)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if previous != nil && onChange != nil {
+			for _, change := range routeChanges(previous, result, time.Now()) {
+				onChange(change)
+			}
+		}
+		previous = result
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+// MTRHop holds the statistics of a TTL over all rounds of MTR
+type MTRHop struct {
+	TTL      int
+	Hosts    []net.IP // Routers which answered, in order of their first answer
+	Sent     int
+	Received int
+	Loss     float64 // Percentage of unanswered probes
+	Last     time.Duration
+	Best     time.Duration
+	Avg      time.Duration
+	Worst    time.Duration
+
+	rttSum time.Duration
+}
+
+// MTRReport is the accumulated result of the rounds of MTR
+type MTRReport struct {
+	Host   string
+	IP     net.IP
+	Rounds int
+	Hops   []MTRHop
+}
+
+// String returns the report in the layout of "mtr --report"
+func (r *MTRReport) String() string {
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("HOST: %-36s Loss%%   Snt   Last    Avg   Best  Wrst\n", fmt.Sprintf("%s (%s)", r.Host, r.IP)))
+	ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+	for _, hop := range r.Hops {
+		host := "???"
+		if len(hop.Hosts) > 0 {
+			host = hop.Hosts[0].String()
+		}
+		result.WriteString(fmt.Sprintf("%3d.|-- %-35s %5.1f%% %5d %6.1f %6.1f %6.1f %6.1f\n",
+			hop.TTL, host, hop.Loss, hop.Sent, ms(hop.Last), ms(hop.Avg), ms(hop.Best), ms(hop.Worst)))
+	}
+	return result.String()
+}
+
+// add accumulates the probes of a trace
+func (r *MTRReport) add(trace *TracerouteResult) {
+	r.Rounds++
+	r.IP = trace.IP
+	for _, hop := range trace.Hops {
+		for len(r.Hops) < hop.TTL {
+			r.Hops = append(r.Hops, MTRHop{TTL: len(r.Hops) + 1})
+		}
+		stats := &r.Hops[hop.TTL-1]
+		if hop.From != nil && !containsIP(stats.Hosts, hop.From) {
+			stats.Hosts = append(stats.Hosts, hop.From)
+		}
+		stats.Sent += len(hop.RTTs) + hop.Lost
+		for _, rtt := range hop.RTTs {
+			if stats.Received == 0 || rtt < stats.Best {
+				stats.Best = rtt
+			}
+			if rtt > stats.Worst {
+				stats.Worst = rtt
+			}
+			stats.Received++
+			stats.rttSum += rtt
+			stats.Last = rtt
+		}
+		if stats.Received > 0 {
+			stats.Avg = stats.rttSum / time.Duration(stats.Received)
+		}
+		if stats.Sent > 0 {
+			stats.Loss = float64(stats.Sent-stats.Received) / float64(stats.Sent) * 100
+		}
+	}
+}
+
+// containsIP reports whether the address is in the list
+func containsIP(ips []net.IP, ip net.IP) bool {
+	for _, candidate := range ips {
+		if candidate.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// MTR traces the route to the host every interval like mtr and calls onReport with the loss and RTT
+// statistics per hop accumulated over all rounds so far. Every round sends options.Queries probes per
+// hop. The error of a failed trace is returned, the end of the context returns nil.
+func MTR(ctx context.Context, host string, options *TracerouteOptions, interval time.Duration, onReport func(*MTRReport)) error {
+	if interval <= 0 {
+		return fmt.Errorf("invalid interval %v", interval)
+	}
+
+	report := &MTRReport{Host: host}
+	for {
+		trace, err := Traceroute(ctx, host, options)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		report.add(trace)
+		if onReport != nil {
+			// The callback gets a copy, the hosts of a hop are only ever appended
+			snapshot := *report
+			snapshot.Hops = append([]MTRHop(nil), report.Hops...)
+			onReport(&snapshot)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+// routeChanges compares the hops of two traces, hops without an answer are skipped
+func routeChanges(old, new *TracerouteResult, at time.Time) []RouteChange {
+	routers := make(map[int]net.IP)
+	for _, hop := range old.Hops {
+		if hop.From != nil {
+			routers[hop.TTL] = hop.From
+		}
+	}
+
+	var changes []RouteChange
+	for _, hop := range new.Hops {
+		previous, ok := routers[hop.TTL]
+		if ok && hop.From != nil && !hop.From.Equal(previous) {
+			changes = append(changes, RouteChange{Position: hop.TTL, Old: previous, New: hop.From, At: at})
+		}
+	}
+	return changes
+}
+
+// tracer sends the probes of a traceroute
+type tracer struct {
+	ip      net.IP
+	ipv6    bool
+	options *TracerouteOptions
+	sock    *icmpSocket // raw socket receiving the ICMP answers of all methods
+	id      int
+}
+
+// traceReply is the answer to a probe, from is nil if the probe timed out
+type traceReply struct {
+	from    net.IP
+	rtt     time.Duration
+	reached bool
+	err     string
+}
+
+// probe sends a single probe with the TTL and waits for its answer
+func (t *tracer) probe(ctx context.Context, ttl, seq int) (traceReply, error) {
+	switch t.options.Method {
+	case TracerouteUDP:
+		return t.probeUDP(ctx, ttl, seq)
+	case TracerouteTCP:
+		return t.probeTCP(ctx, ttl)
+	}
+	return t.probeICMP(ctx, ttl, seq)
+}
+
+// probeICMP sends an echo request, the destination answers with an echo reply
+func (t *tracer) probeICMP(ctx context.Context, ttl, seq int) (traceReply, error) {
+	if err := t.sock.setTTL(ttl); err != nil {
+		return traceReply{}, fmt.Errorf("failed to set TTL: %w", err)
+	}
+	start := time.Now()
+	if err := t.sock.sendEcho(t.ip, t.id, seq&0xffff, make([]byte, 32)); err != nil {
+		return traceReply{}, fmt.Errorf("failed to send echo request to %s: %w", t.ip, err)
+	}
+
+	reply, _ := t.wait(ctx, start, nil, func(msg *icmp.Message, from net.IP) (traceReply, bool) {
+		reply, ok := matchEchoReply(msg, t.id, t.ipv6)
+		if !ok || reply.Seq != seq&0xffff {
+			return traceReply{}, false
+		}
+		if reply.Error == "" {
+			return traceReply{from: from, reached: true}, true
+		}
+		if reply.Error == "Time to live exceeded" {
+			return traceReply{from: from}, true
+		}
+		return traceReply{from: from, err: reply.Error}, true
+	})
+	return reply, nil
+}
+
+// probeUDP sends a datagram to an unused port, the destination answers with port unreachable
+func (t *tracer) probeUDP(ctx context.Context, ttl, seq int) (traceReply, error) {
+	port := t.options.Port
+	if port == 0 {
+		port = defaultTracerouteUDPPort + seq - 1
+	}
+	conn, err := net.DialUDP(t.network("udp"), nil, &net.UDPAddr{IP: t.ip, Port: port})
+	if err != nil {
+		return traceReply{}, fmt.Errorf("failed to open UDP socket: %w", err)
+	}
+	defer conn.Close()
+	if t.ipv6 {
+		err = ipv6.NewConn(conn).SetHopLimit(ttl)
+	} else {
+		err = ipv4.NewConn(conn).SetTTL(ttl)
+	}
+	if err != nil {
+		return traceReply{}, fmt.Errorf("failed to set TTL: %w", err)
+	}
+	localPort := conn.LocalAddr().(*net.UDPAddr).Port
+
+	start := time.Now()
+	if _, err := conn.Write(make([]byte, 32)); err != nil {
+		return traceReply{}, fmt.Errorf("failed to send UDP probe to %s: %w", t.ip, err)
+	}
+
+	reply, _ := t.wait(ctx, start, nil, t.matchTransport(syscall.IPPROTO_UDP, localPort, port))
+	return reply, nil
+}
+
+// probeTCP connects to the port with the TTL set on the SYN, the destination accepts or refuses the connection
+func (t *tracer) probeTCP(ctx context.Context, ttl int) (traceReply, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.options.Timeout)
+	defer cancel()
+
+	dialer := net.Dialer{
+		Control: func(network, address string, c syscall.RawConn) error {
+			var err error
+			if controlErr := c.Control(func(fd uintptr) {
+				err = setSocketTTL(fd, t.ipv6, ttl)
+			}); controlErr != nil {
+				return controlErr
+			}
+			return err
+		},
+	}
+
+	start := time.Now()
+	connected := make(chan traceReply, 1)
+	go func() {
+		conn, err := dialer.DialContext(ctx, t.network("tcp"), net.JoinHostPort(t.ip.String(), strconv.Itoa(t.options.Port)))
+		if err == nil {
+			conn.Close()
+		}
+		if err == nil || errors.Is(err, syscall.ECONNREFUSED) {
+			connected <- traceReply{from: t.ip, rtt: time.Since(start), reached: true}
+			return
+		}
+		connected <- traceReply{}
+	}()
+
+	// The local port is unknown before the connect, probes are sequential so the destination identifies them
+	reply, _ := t.wait(ctx, start, connected, t.matchTransport(syscall.IPPROTO_TCP, 0, t.options.Port))
+	return reply, nil
+}
+
+// network returns the network name of the address family, "udp4" or "udp6" for "udp"
+func (t *tracer) network(protocol string) string {
+	if t.ipv6 {
+		return protocol + "6"
+	}
+	return protocol + "4"
+}
+
+// matchTransport matches the ICMP errors quoting a UDP or TCP probe to the port, a zero local port matches any
+func (t *tracer) matchTransport(protocol, localPort, port int) func(*icmp.Message, net.IP) (traceReply, bool) {
+	return func(msg *icmp.Message, from net.IP) (traceReply, bool) {
+		var data []byte
+		switch body := msg.Body.(type) {
+		case *icmp.TimeExceeded:
+			data = body.Data
+		case *icmp.DstUnreach:
+			data = body.Data
+		default:
+			return traceReply{}, false
+		}
+
+		quoted, ok := parseQuotedTransport(data, t.ipv6)
+		if !ok || quoted.protocol != protocol || !quoted.dst.Equal(t.ip) || quoted.dstPort != port {
+			return traceReply{}, false
+		}
+		if localPort != 0 && quoted.srcPort != localPort {
+			return traceReply{}, false
+		}
+
+		if _, ok := msg.Body.(*icmp.TimeExceeded); ok {
+			return traceReply{from: from}, true
+		}
+		message := unreachableMessage(msg.Code, t.ipv6)
+		if message == "Destination Port Unreachable" && from.Equal(t.ip) {
+			return traceReply{from: from, reached: true}, true
+		}
+		return traceReply{from: from, err: message}, true
+	}
+}
+
+// wait reads ICMP messages until match accepts one, the probe times out or a reply arrives on done.
+// RTTs of matched messages are measured from start.
+func (t *tracer) wait(ctx context.Context, start time.Time, done <-chan traceReply, match func(*icmp.Message, net.IP) (traceReply, bool)) (traceReply, bool) {
+	deadline := start.Add(t.options.Timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+
+	buf := make([]byte, 1500)
+	for ctx.Err() == nil && time.Now().Before(deadline) {
+		select {
+		case reply := <-done:
+			if reply.from != nil {
+				return reply, true
+			}
+			// The probe failed locally, an ICMP error may still tell why
+			done = nil
+		default:
+		}
+
+		// Reads are short while another probe result may arrive on done
+		readDeadline := deadline
+		if done != nil && time.Until(readDeadline) > 20*time.Millisecond {
+			readDeadline = time.Now().Add(20 * time.Millisecond)
+		}
+		t.sock.conn.SetReadDeadline(readDeadline)
+		msg, from, _, err := t.sock.read(buf)
+		if err != nil {
+			continue
+		}
+		if reply, ok := match(msg, from); ok {
+			reply.rtt = time.Since(start)
+			return reply, true
+		}
+	}
+	return traceReply{}, false
+}
+
+// quotedTransport is the IP and transport header of a probe quoted in an ICMP error
+type quotedTransport struct {
+	protocol int
+	dst      net.IP
+	srcPort  int
+	dstPort  int
+}
+
+// parseQuotedTransport parses the IP header and ports of the packet quoted in an ICMP error.
+// IPv6 extension headers are not supported.
+func parseQuotedTransport(data []byte, ipv6Message bool) (quotedTransport, bool) {
+	var q quotedTransport
+	offset := ipv6.HeaderLen
+	if ipv6Message {
+		if len(data) < ipv6.HeaderLen {
+			return q, false
+		}
+		q.protocol = int(data[6])
+		q.dst = net.IP(append([]byte(nil), data[24:40]...))
+	} else {
+		if len(data) < ipv4.HeaderLen {
+			return q, false
+		}
+		offset = int(data[0]&0x0f) * 4
+		q.protocol = int(data[9])
+		q.dst = net.IPv4(data[16], data[17], data[18], data[19])
+	}
+	// Routers quote at least the first 8 bytes of the transport header
+	if offset < ipv4.HeaderLen || len(data) < offset+4 {
+		return q, false
+	}
+	q.srcPort = int(binary.BigEndian.Uint16(data[offset:]))
+	q.dstPort = int(binary.BigEndian.Uint16(data[offset+2:]))
+	return q, true
+}
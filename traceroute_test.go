@@ -0,0 +1,263 @@
+package network
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTracerouteInvalid(t *testing.T) {
+	if _, err := Traceroute(context.Background(), "", nil); err == nil {
+		t.Error("Traceroute() expected error for empty host")
+	}
+	if _, err := Traceroute(context.Background(), "127.0.0.1", &TracerouteOptions{Method: "sctp"}); err == nil {
+		t.Error("Traceroute() expected error for invalid method")
+	}
+	if _, err := Traceroute(context.Background(), "127.0.0.1", &TracerouteOptions{Port: 70000}); err == nil {
+		t.Error("Traceroute() expected error for invalid port")
+	}
+}
+
+func TestTraceroute(t *testing.T) {
+	if !CanRawSocket() {
+		t.Skip("raw ICMP sockets are not permitted")
+	}
+	_, port := startTestTCPServer(t)
+
+	for _, options := range []*TracerouteOptions{
+		{Method: TracerouteICMP},
+		{Method: TracerouteUDP},
+		{Method: TracerouteTCP, Port: port},
+		{Method: TracerouteTCP, Port: closedPort(t)},
+	} {
+		options.MaxHops, options.Queries, options.Timeout = 3, 2, time.Second
+		result, err := Traceroute(context.Background(), "127.0.0.1", options)
+		if err != nil {
+			t.Fatalf("Traceroute(%s) error = %v", options.Method, err)
+		}
+		if !result.Reached || len(result.Hops) != 1 {
+			t.Fatalf("Traceroute(%s) = %+v", options.Method, result)
+		}
+		hop := result.Hops[0]
+		if hop.TTL != 1 || !hop.From.Equal(net.ParseIP("127.0.0.1")) || len(hop.RTTs) != 2 || hop.Lost != 0 || hop.Error != "" ||
+			hop.Loss != 0 || hop.MinRTT <= 0 || hop.MinRTT > hop.AvgRTT || hop.AvgRTT > hop.MaxRTT {
+			t.Errorf("Traceroute(%s) hop = %+v", options.Method, hop)
+		}
+		if !strings.HasPrefix(result.String(), "traceroute to 127.0.0.1 (127.0.0.1) using "+options.Method+"\n 1  127.0.0.1  ") {
+			t.Errorf("String() = %q", result.String())
+		}
+	}
+}
+
+func TestTracerouteMulti(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if results := TracerouteMulti(ctx, []string{"192.0.2.1", "192.0.2.2"}, nil, 1); len(results) != 0 {
+		t.Errorf("TracerouteMulti() canceled results = %v, want none", results)
+	}
+
+	if !CanRawSocket() {
+		t.Skip("raw ICMP sockets are not permitted")
+	}
+	options := &TracerouteOptions{MaxHops: 3, Queries: 2, Timeout: time.Second}
+	hosts := []string{"127.0.0.1", "::1", "127.0.0.1", "invalid..host"}
+	results := TracerouteMulti(context.Background(), hosts, options, 0)
+	if len(results) != 3 {
+		t.Fatalf("TracerouteMulti() results = %v", results)
+	}
+	for _, host := range []string{"127.0.0.1", "::1"} {
+		result := results[host]
+		if result == nil || result.ErrorMessage != "" || !result.Reached || len(result.Hops) != 1 {
+			t.Errorf("TracerouteMulti() result of %s = %+v", host, result)
+		}
+	}
+	if result := results["invalid..host"]; result == nil || result.ErrorMessage == "" {
+		t.Errorf("TracerouteMulti() result of invalid host = %+v", result)
+	} else if !strings.Contains(result.String(), "failed") {
+		t.Errorf("String() = %q", result.String())
+	}
+}
+
+func TestTracerouteHopSummarize(t *testing.T) {
+	hop := TracerouteHop{RTTs: []time.Duration{3 * time.Millisecond, time.Millisecond, 2 * time.Millisecond}, Lost: 1}
+	hop.summarize()
+	if hop.Loss != 25 || hop.MinRTT != time.Millisecond || hop.AvgRTT != 2*time.Millisecond || hop.MaxRTT != 3*time.Millisecond {
+		t.Errorf("summarize() = %+v", hop)
+	}
+
+	hop = TracerouteHop{Lost: 3}
+	hop.summarize()
+	if hop.Loss != 100 || hop.MinRTT != 0 || hop.AvgRTT != 0 || hop.MaxRTT != 0 {
+		t.Errorf("summarize() without replies = %+v", hop)
+	}
+}
+
+func TestMTRReport(t *testing.T) {
+	router, other, target := net.ParseIP("192.168.1.1"), net.ParseIP("192.168.1.2"), net.ParseIP("192.0.2.10")
+	report := &MTRReport{Host: "example.com"}
+	report.add(&TracerouteResult{IP: target, Hops: []TracerouteHop{
+		{TTL: 1, From: router, RTTs: []time.Duration{time.Millisecond, 3 * time.Millisecond}},
+		{TTL: 2, Lost: 2},
+	}})
+	report.add(&TracerouteResult{IP: target, Hops: []TracerouteHop{
+		{TTL: 1, From: other, RTTs: []time.Duration{2 * time.Millisecond}, Lost: 1},
+		{TTL: 2, Lost: 2},
+		{TTL: 3, From: target, RTTs: []time.Duration{10 * time.Millisecond, 20 * time.Millisecond}},
+	}})
+
+	if report.Rounds != 2 || !report.IP.Equal(target) || len(report.Hops) != 3 {
+		t.Fatalf("report = %+v", report)
+	}
+	first := report.Hops[0]
+	if len(first.Hosts) != 2 || first.Sent != 4 || first.Received != 3 || first.Loss != 25 ||
+		first.Last != 2*time.Millisecond || first.Best != time.Millisecond || first.Avg != 2*time.Millisecond || first.Worst != 3*time.Millisecond {
+		t.Errorf("hop 1 = %+v", first)
+	}
+	if second := report.Hops[1]; second.Sent != 4 || second.Received != 0 || second.Loss != 100 || len(second.Hosts) != 0 {
+		t.Errorf("hop 2 = %+v", second)
+	}
+	if third := report.Hops[2]; third.Sent != 2 || third.Loss != 0 || third.Avg != 15*time.Millisecond {
+		t.Errorf("hop 3 = %+v", third)
+	}
+
+	lines := strings.Split(strings.TrimSpace(report.String()), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[0], "HOST: example.com (192.0.2.10)") ||
+		!strings.Contains(lines[1], "  1.|-- 192.168.1.1") || !strings.Contains(lines[1], " 25.0%     4    2.0    2.0    1.0    3.0") ||
+		!strings.Contains(lines[2], "  2.|-- ???") || !strings.Contains(lines[2], "100.0%") {
+		t.Errorf("String() = %q", report.String())
+	}
+}
+
+func TestMTR(t *testing.T) {
+	if err := MTR(context.Background(), "127.0.0.1", nil, 0, nil); err == nil {
+		t.Error("MTR() expected error for invalid interval")
+	}
+	if err := MTR(context.Background(), "", nil, time.Second, nil); err == nil {
+		t.Error("MTR() expected error for failing trace")
+	}
+	if !CanRawSocket() {
+		t.Skip("raw ICMP sockets are not permitted")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var reports []*MTRReport
+	options := &TracerouteOptions{MaxHops: 2, Queries: 2, Timeout: time.Second}
+	err := MTR(ctx, "127.0.0.1", options, 10*time.Millisecond, func(report *MTRReport) {
+		reports = append(reports, report)
+		if len(reports) == 3 {
+			cancel()
+		}
+	})
+	if err != nil {
+		t.Fatalf("MTR() error = %v", err)
+	}
+	if len(reports) != 3 {
+		t.Fatalf("MTR() reported %d times", len(reports))
+	}
+	last := reports[2]
+	if last.Rounds != 3 || len(last.Hops) != 1 || last.Hops[0].Sent != 6 || last.Hops[0].Received != 6 || last.Hops[0].Loss != 0 {
+		t.Errorf("MTR() report = %+v", last)
+	}
+	if reports[0].Rounds != 1 || reports[0].Hops[0].Sent != 2 {
+		t.Errorf("MTR() first report changed: %+v", reports[0])
+	}
+}
+
+func TestTracerouteResultString(t *testing.T) {
+	result := &TracerouteResult{
+		Host:   "example.com",
+		IP:     net.ParseIP("192.0.2.10"),
+		Method: TracerouteTCP,
+		Hops: []TracerouteHop{
+			{TTL: 1, From: net.ParseIP("192.168.1.1"), RTTs: []time.Duration{1500 * time.Microsecond}, Lost: 1},
+			{TTL: 2, Lost: 2},
+			{TTL: 3, From: net.ParseIP("198.51.100.1"), RTTs: []time.Duration{20 * time.Millisecond}, Error: "Destination Host Unreachable"},
+		},
+	}
+	want := "traceroute to example.com (192.0.2.10) using tcp\n" +
+		" 1  192.168.1.1  1.500 ms  *\n" +
+		" 2  *\n" +
+		" 3  198.51.100.1  20.000 ms  Destination Host Unreachable\n"
+	if got := result.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestParseQuotedTransport(t *testing.T) {
+	packet := make([]byte, 28)
+	packet[0] = 0x45
+	packet[9] = 6
+	copy(packet[16:20], net.ParseIP("192.0.2.10").To4())
+	binary.BigEndian.PutUint16(packet[20:], 40000)
+	binary.BigEndian.PutUint16(packet[22:], 443)
+
+	q, ok := parseQuotedTransport(packet, false)
+	if !ok || q.protocol != 6 || !q.dst.Equal(net.ParseIP("192.0.2.10")) || q.srcPort != 40000 || q.dstPort != 443 {
+		t.Errorf("parseQuotedTransport() = %+v, %v", q, ok)
+	}
+	if _, ok := parseQuotedTransport(packet[:22], false); ok {
+		t.Error("parseQuotedTransport() expected failure for truncated packet")
+	}
+
+	packet6 := make([]byte, 48)
+	packet6[0] = 0x60
+	packet6[6] = 17
+	copy(packet6[24:40], net.ParseIP("2001:db8::10"))
+	binary.BigEndian.PutUint16(packet6[40:], 50000)
+	binary.BigEndian.PutUint16(packet6[42:], 33434)
+	q, ok = parseQuotedTransport(packet6, true)
+	if !ok || q.protocol != 17 || !q.dst.Equal(net.ParseIP("2001:db8::10")) || q.srcPort != 50000 || q.dstPort != 33434 {
+		t.Errorf("parseQuotedTransport() IPv6 = %+v, %v", q, ok)
+	}
+}
+
+func TestRouteChanges(t *testing.T) {
+	hops := func(routers ...string) *TracerouteResult {
+		result := &TracerouteResult{}
+		for i, router := range routers {
+			result.Hops = append(result.Hops, TracerouteHop{TTL: i + 1, From: net.ParseIP(router)})
+		}
+		return result
+	}
+
+	at := time.Now()
+	old := hops("192.168.1.1", "10.0.0.1", "", "198.51.100.1")
+	changes := routeChanges(old, hops("192.168.1.1", "10.0.0.2", "203.0.113.1", "", "192.0.2.10"), at)
+	if len(changes) != 1 {
+		t.Fatalf("routeChanges() = %+v", changes)
+	}
+	if c := changes[0]; c.Position != 2 || c.Old.String() != "10.0.0.1" || c.New.String() != "10.0.0.2" || !c.At.Equal(at) {
+		t.Errorf("routeChanges() = %+v", c)
+	}
+
+	if changes := routeChanges(old, old, at); len(changes) != 0 {
+		t.Errorf("routeChanges() of the same route = %+v", changes)
+	}
+}
+
+func TestMonitorRoute(t *testing.T) {
+	if err := MonitorRoute(context.Background(), "127.0.0.1", nil, 0, nil); err == nil {
+		t.Error("MonitorRoute() expected error for invalid interval")
+	}
+	if err := MonitorRoute(context.Background(), "", nil, time.Second, nil); err == nil {
+		t.Error("MonitorRoute() expected error for failing trace")
+	}
+	if !CanRawSocket() {
+		t.Skip("raw ICMP sockets are not permitted")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	changes := 0
+	options := &TracerouteOptions{MaxHops: 2, Queries: 1, Timeout: time.Second}
+	if err := MonitorRoute(ctx, "127.0.0.1", options, 20*time.Millisecond, func(RouteChange) { changes++ }); err != nil {
+		t.Fatalf("MonitorRoute() error = %v", err)
+	}
+	if changes != 0 {
+		t.Errorf("MonitorRoute() reported %d changes of a constant route", changes)
+	}
+}